@@ -1,12 +1,20 @@
 package main
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/knd/kndchain/pkg/storage/leveldb"
 
 	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
 	"github.com/knd/kndchain/pkg/validating"
@@ -35,14 +43,77 @@ func toMiningTransactions(data []listing.Transaction) []mining.Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toMiningInputs(transaction.ExtraInputs),
 		})
 	}
 	return mTxs
 }
 
+// hexStringToBinary is how leading zeros of a block hash used to be checked, kept to compare against
+func hexStringToBinary(s string) string {
+	res := ""
+	b, _ := hex.DecodeString(s)
+	for _, c := range b {
+		binary, _ := strconv.Atoi(fmt.Sprintf("%.b", c))
+		res = fmt.Sprintf("%s%s", res, fmt.Sprintf("%08d", binary))
+	}
+	return res
+}
+
+// hashRate returns the hashes per second a single goroutine tries with given hash function over duration d
+func hashRate(d time.Duration, hash func(nonce uint32) bool) float64 {
+	start := time.Now()
+	var nonce uint32
+	for ; time.Since(start) < d; nonce++ {
+		hash(nonce)
+	}
+	return float64(nonce) / time.Since(start).Seconds()
+}
+
+// compareHashRates prints the single goroutine hash rate of encoding every header and checking its hex string
+// against hashing a pre-serialized header and checking its raw bytes
+func compareHashRates(d time.Duration) {
+	const difficulty = 32
+	block := hashing.Block{LastHash: "0x000", MerkleRoot: hashing.MerkleRoot([]hashing.Tx{hashing.Tx{ID: "dummy-tx"}}), Difficulty: difficulty}
+
+	before := hashRate(d, func(nonce uint32) bool {
+		block.Timestamp = time.Now().UnixNano()
+		block.Nonce = nonce
+		return hexStringToBinary(hashing.BlockHash(block))[:difficulty] == strings.Repeat("0", difficulty)
+	})
+
+	header := hashing.NewHeaderTemplate(block)
+	header.SetTimestamp(time.Now().UnixNano())
+	after := hashRate(d, func(nonce uint32) bool {
+		header.SetNonce(nonce)
+		hash := header.Hash()
+		return hashing.LeadingZeroBits(hash[:]) >= difficulty
+	})
+
+	fmt.Printf("Hash rate per worker before: %.0f hashes/s, after: %.0f hashes/s (%.1fx)", before, after, after/before)
+	fmt.Println()
+}
+
 func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines to mine with")
+	retargeting := flag.String("retargeting", consensus.DefaultParams().Retargeting, "difficulty retargeting algorithm, either step, window or moving-average")
+	compareFor := flag.Duration("compareFor", 2*time.Second, "time spent comparing hash rates of the string and raw byte proof of work checks, 0 to skip")
+	flag.Parse()
+
+	params := consensus.DefaultParams()
+	params.Retargeting = *retargeting
+	params.TargetBlockTime = 200 * time.Second
+	if _, err := params.Retargeter(); err != nil {
+		log.Fatalf("Invalid retargeting %s, %v", *retargeting, err)
+	}
+
+	if *compareFor > 0 {
+		compareHashRates(*compareFor)
+	}
+
 	// set up storage
 	// storageType := Memory
 
@@ -53,8 +124,8 @@ func main() {
 	storage := leveldb.NewRepository("/Users/knd/kndchainDatadir")
 
 	lister = listing.NewService(storage)
-	validator = validating.NewService(lister, calculating.NewService(1000), "MINER_REWARD", 5)
-	miner = mining.NewService(storage, lister, validator, 200000)
+	validator = validating.NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", params.CoinbaseMaturity), "MINER_REWARD", 5, params)
+	miner = mining.NewService(storage, lister, validator, params, *workers)
 
 	fmt.Println("Staring now")
 
@@ -68,6 +139,7 @@ func main() {
 		mb := &mining.Block{
 			Timestamp:  lastBlock.Timestamp,
 			LastHash:   lastBlock.LastHash,
+			MerkleRoot: lastBlock.MerkleRoot,
 			Hash:       lastBlock.Hash,
 			Data:       toMiningTransactions(lastBlock.Data),
 			Nonce:      lastBlock.Nonce,
@@ -90,10 +162,25 @@ func main() {
 		averageDuration := float64(sumDuration) / float64(len(durations))
 
 		fmt.Printf(
-			"Time to mine block: %.2f ms. Difficulty: %d. Average time: %.2f ms", durationDiffInMillis,
+			"Time to mine block: %.2f ms. Difficulty: %d. Average time: %.2f ms. Hash rate: %.0f hashes/s", durationDiffInMillis,
 			newB.Difficulty,
 			averageDuration,
+			miner.HashRate(),
 		)
 		fmt.Println()
 	}
 }
+
+func toMiningInputs(inputs []listing.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
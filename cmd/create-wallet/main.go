@@ -1,17 +1,132 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/wallet"
 )
 
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]s [flags] <keysDatadir>                                  create a new key
+  %[1]s [flags] create-hd <keysDatadir>                        create a HD wallet and print its mnemonic
+  %[1]s [flags] restore-hd <keysDatadir>                       restore a HD wallet from its mnemonic
+  %[1]s [flags] change-passphrase <keysDatadir> <pubKeyHex>    encrypt a key with a new passphrase
+  %[1]s [flags] export <keysDatadir> <pubKeyHex>               print a private key in hex
+  %[1]s [flags] import <keysDatadir> <pubKeyHex>               encrypt an unencrypted key file
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
 func main() {
-	secp265k1 := crypto.NewSecp256k1Generator()
-	pathToKeyDir := os.Args[1]
-	wal := wallet.NewWallet(secp265k1, nil, 0, &pathToKeyDir)
+	passphraseFile := flag.String("passphraseFile", "", "file whose first line is the passphrase, prompted for when empty")
+	newPassphraseFile := flag.String("newPassphraseFile", "", "file whose first line is the new passphrase for change-passphrase, prompted for when empty")
+	mnemonicFile := flag.String("mnemonicFile", "", "file whose first line is the mnemonic for restore-hd, prompted for when empty")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 1 {
+		args = []string{"create", args[0]}
+	}
+	if len(args) != 3 && !(len(args) == 2 && (args[0] == "create" || args[0] == "create-hd" || args[0] == "restore-hd")) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	keystore := wallet.NewKeystore(args[1], wallet.StandardScryptN)
+
+	switch args[0] {
+	case "create":
+		passphrase, err := wallet.ReadNewPassphrase(*passphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		wal := wallet.NewWallet(crypto.NewSecp256k1Generator(), nil, 0, keystore, passphrase)
+		fmt.Printf("Your pubKey: %s\n", wal.PubKeyHex())
+		fmt.Printf("Your address: %s\n", wal.Address())
+	case "create-hd":
+		mnemonic, err := wallet.NewMnemonic()
+		if err != nil {
+			log.Fatalf("Error creating mnemonic, %v", err)
+		}
+		seed, err := wallet.MnemonicToSeed(mnemonic, "")
+		if err != nil {
+			log.Fatalf("Error creating seed, %v", err)
+		}
+		passphrase, err := wallet.ReadNewPassphrase(*passphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		printHDWallet(seed, keystore, passphrase)
+		fmt.Printf("Write down your mnemonic, it restores all addresses of the wallet:\n%s\n", mnemonic)
+	case "restore-hd":
+		mnemonic, err := wallet.ReadPassphrase(*mnemonicFile, "Mnemonic: ")
+		if err != nil {
+			log.Fatalf("Error reading mnemonic, %v", err)
+		}
+		seed, err := wallet.MnemonicToSeed(mnemonic, "")
+		if err != nil {
+			log.Fatalf("Error restoring seed, %v", err)
+		}
+		passphrase, err := wallet.ReadNewPassphrase(*passphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		printHDWallet(seed, keystore, passphrase)
+	case "change-passphrase":
+		oldPassphrase, err := wallet.ReadPassphrase(*passphraseFile, "Current passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		newPassphrase, err := wallet.ReadNewPassphrase(*newPassphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		if err := keystore.ChangePassphrase(args[2], oldPassphrase, newPassphrase); err != nil {
+			log.Fatalf("Error changing passphrase of %s, %v", args[2], err)
+		}
+		fmt.Println("Passphrase changed")
+	case "export":
+		passphrase, err := wallet.ReadPassphrase(*passphraseFile, "Passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		privKeyHex, err := keystore.Export(args[2], passphrase)
+		if err != nil {
+			log.Fatalf("Error exporting key of %s, %v", args[2], err)
+		}
+		fmt.Println(privKeyHex)
+	case "import":
+		passphrase, err := wallet.ReadNewPassphrase(*passphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		if err := keystore.Import(args[2], passphrase); err != nil {
+			log.Fatalf("Error importing key of %s, %v", args[2], err)
+		}
+		fmt.Println("Key encrypted")
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// printHDWallet stores seed in keystore and prints the wallet id and its first address
+func printHDWallet(seed []byte, keystore wallet.Keystore, passphrase string) {
+	hd, err := wallet.NewHDWallet(crypto.NewSecp256k1Generator(), nil, seed, wallet.DefaultGapLimit, keystore, passphrase)
+	if err != nil {
+		log.Fatalf("Error creating HD wallet, %v", err)
+	}
+	address, err := hd.NextAddress()
+	if err != nil {
+		log.Fatalf("Error deriving address, %v", err)
+	}
 
-	fmt.Printf("Your pubKey: %s\n", wal.PubKeyHex())
+	fmt.Printf("Your HD wallet id: %s\n", hd.ID())
+	fmt.Printf("Your first address: %s\n", address)
 }
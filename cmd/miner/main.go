@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
 	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/http/rest"
 	"github.com/knd/kndchain/pkg/listing"
+	pkgminer "github.com/knd/kndchain/pkg/miner"
 	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/networking/p2p"
 	"github.com/knd/kndchain/pkg/networking/pubsub"
 	"github.com/knd/kndchain/pkg/storage/leveldb"
 	"github.com/knd/kndchain/pkg/validating"
@@ -22,7 +28,6 @@ const (
 
 	blockRewardAddress string = "MINER_REWARD"
 	blockRewardAmount  uint64 = 5
-	blockMiningRate    int64  = 10 * 1000 // 10 seconds
 
 	p2pBlockChannel string = "kndchain"
 	p2pTxChannel    string = "kndchaintransactions"
@@ -34,42 +39,123 @@ func main() {
 	address := flag.String("address", "", "provide pubkeyhex/ address used for transactions or mining reward")
 	chainDatadir := flag.String("chainDatadir", "/tmp/kndchainDatadir", "directory to store blockchain data")
 	keysDatadir := flag.String("keysDatadir", "/tmp/kndchainKeys", "directory to store keys")
+	hdWallet := flag.String("hdWallet", "", "id of a HD wallet created with create-wallet, -address then picks one of its addresses")
+	passphraseFile := flag.String("passphraseFile", "", "file whose first line is the passphrase of the wallet key, prompted for when empty")
+	p2pTransport := flag.String("p2p", "redis", "peer-to-peer transport, either redis or tcp")
+	p2pListen := flag.String("p2pListen", ":4001", "address to accept peer connections on when using tcp transport")
+	seeds := flag.String("seeds", "", "comma separated addresses of peers to connect to when using tcp transport")
+	maxBlockSize := flag.Int("maxBlockSize", consensus.DefaultParams().MaxBlockSize, "maximum encoded size of a block in bytes, must match the network")
+	maxBlockTxs := flag.Int("maxBlockTxs", consensus.DefaultParams().MaxBlockTransactions, "maximum number of transactions in a block, must match the network")
+	retargeting := flag.String("retargeting", consensus.DefaultParams().Retargeting, "difficulty retargeting algorithm, either step, window or moving-average, must match the network")
+	miningWorkers := flag.Int("miningWorkers", runtime.NumCPU(), "number of goroutines to mine with")
+	coinbaseMaturity := flag.Int("coinbaseMaturity", consensus.DefaultParams().CoinbaseMaturity, "number of blocks before a mining reward may be spent, must match the network")
+	maxFutureDrift := flag.Duration("maxFutureDrift", consensus.DefaultParams().MaxFutureDrift, "how far ahead of local time a block timestamp may be, must match the network")
 	flag.Parse()
 
-	calculator := calculating.NewService(initialBalance)
+	consensusParams := consensus.DefaultParams()
+	consensusParams.MaxBlockSize = *maxBlockSize
+	consensusParams.MaxBlockTransactions = *maxBlockTxs
+	consensusParams.MaxFutureDrift = *maxFutureDrift
+	consensusParams.Retargeting = *retargeting
+	consensusParams.CoinbaseMaturity = *coinbaseMaturity
+	if _, err := consensusParams.Retargeter(); err != nil {
+		log.Fatalf("Invalid retargeting %s, %v", *retargeting, err)
+	}
+
 	repository := leveldb.NewRepository(*chainDatadir)
+	calculator := calculating.NewService(initialBalance, repository, blockRewardAddress, consensusParams.CoinbaseMaturity)
 	lister := listing.NewService(repository)
-	validator := validating.NewService(lister, calculator, blockRewardAddress, blockRewardAmount)
-	miningService := mining.NewService(repository, lister, validator, blockMiningRate)
+	validator := validating.NewService(lister, calculator, blockRewardAddress, blockRewardAmount, consensusParams)
+	miningService := mining.NewService(repository, lister, validator, consensusParams, *miningWorkers)
 
 	var wal wallet.Wallet
-	if len(*address) != 0 {
+	var hd wallet.HDWallet
+	keystore := wallet.NewKeystore(*keysDatadir, wallet.StandardScryptN)
+	if len(*hdWallet) != 0 {
+		// Load HD wallet, using its latest address unless given one
+		passphrase, err := wallet.ReadPassphrase(*passphraseFile, "Passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
+		hd, err = wallet.LoadHDWallet(
+			crypto.NewSecp256k1Generator(),
+			calculator,
+			keystore,
+			*hdWallet,
+			passphrase,
+			wallet.DefaultGapLimit)
+		if err != nil {
+			log.Fatalf("Error loading HD wallet %s, %v", *hdWallet, err)
+		}
+
+		hdAddress := *address
+		if len(hdAddress) == 0 {
+			if addresses := hd.Addresses(); len(addresses) != 0 {
+				hdAddress = addresses[len(addresses)-1]
+			} else if hdAddress, err = hd.NextAddress(); err != nil {
+				log.Fatalf("Error deriving address of HD wallet %s, %v", *hdWallet, err)
+			}
+		}
+		wal, err = hd.Wallet(hdAddress)
+		if err != nil {
+			log.Fatalf("Error using address %s of HD wallet %s, %v", hdAddress, *hdWallet, err)
+		}
+		log.Printf("Loaded HD wallet with %d addresses, total balance=%d", len(hd.Addresses()), hd.Balance())
+	} else if len(*address) != 0 {
 		// Load wallet
+		passphrase, err := wallet.ReadPassphrase(*passphraseFile, "Passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
 		wal = wallet.LoadWallet(
 			crypto.NewSecp256k1Generator(),
 			calculator,
-			lister,
-			*keysDatadir,
-			*address)
+			keystore,
+			*address,
+			passphrase)
 	} else {
+		passphrase, err := wallet.ReadNewPassphrase(*passphraseFile, "New passphrase: ")
+		if err != nil {
+			log.Fatalf("Error reading passphrase, %v", err)
+		}
 		wal = wallet.NewWallet(
 			crypto.NewSecp256k1Generator(),
 			calculator,
 			initialBalance,
-			keysDatadir)
+			keystore,
+			passphrase)
 		log.Printf("Created new pubkey=%s, in %s", wal.PubKeyHex(), *keysDatadir)
 	}
-
-	// Open Redis connection
-	transactionPool := wallet.NewTransactionPool(lister)
-	p2pComm := pubsub.NewService(
-		lister,
-		miningService,
-		transactionPool,
-		p2pBlockChannel,
-		p2pTxChannel,
-		p2pURI)
-	p2pComm.Connect()
+	log.Printf("Sending and mining with address=%s", wal.Address())
+
+	// Open peer-to-peer connection
+	// multisig transactions still collecting signatures are forgotten once a block has them
+	multisigPool := wallet.NewTransactionPool(lister)
+	transactionPool := wallet.NewTransactionPool(lister, multisigPool)
+	var p2pComm pubsub.Service
+	if *p2pTransport == "tcp" {
+		var seedAddrs []string
+		if len(*seeds) != 0 {
+			seedAddrs = strings.Split(*seeds, ",")
+		}
+		p2pComm = p2p.NewService(
+			lister,
+			miningService,
+			transactionPool,
+			*p2pListen,
+			seedAddrs)
+	} else {
+		p2pComm = pubsub.NewService(
+			lister,
+			miningService,
+			transactionPool,
+			p2pBlockChannel,
+			p2pTxChannel,
+			p2pURI)
+	}
+	if err := p2pComm.Connect(); err != nil {
+		log.Fatal(err)
+	}
 	defer p2pComm.Disconnect()
 	err := p2pComm.SubscribePeers()
 	if err != nil {
@@ -78,14 +164,15 @@ func main() {
 
 	if *enableMining {
 		// Create miner
-		miner := NewMiner(
+		miner := pkgminer.NewMiner(
 			miningService,
 			lister,
 			transactionPool,
 			wal,
 			p2pComm,
 			blockRewardAddress,
-			blockRewardAmount)
+			blockRewardAmount,
+			consensusParams)
 
 		// Create genesis block
 		if lister.GetBlockCount() == 0 {
@@ -101,7 +188,16 @@ func main() {
 			for {
 				lastBlock := lister.GetLastBlock()
 
-				minedBlock, _ := miner.Mine()
+				minedBlock, err := miner.Mine(context.Background())
+				if err == pkgminer.ErrStaleTip {
+					log.Println("Chain tip moved, restarting mining on new tip")
+					continue
+				}
+				if err != nil {
+					log.Printf("Failed to mine block, %v", err)
+					time.Sleep(time.Second)
+					continue
+				}
 
 				durationDiff := minedBlock.Timestamp - lastBlock.Timestamp
 				durationDiffInMillis := float64(durationDiff) / float64(time.Millisecond)
@@ -122,7 +218,18 @@ func main() {
 		}()
 	}
 
-	router := rest.Handler(lister, miningService, p2pComm, transactionPool, wal, calculator)
+	// external workers mine templates claiming the reward for this node's wallet
+	workServer := pkgminer.NewWorkServer(
+		miningService,
+		lister,
+		transactionPool,
+		wal,
+		p2pComm,
+		blockRewardAddress,
+		blockRewardAmount,
+		consensusParams)
+
+	router := rest.Handler(lister, miningService, p2pComm, transactionPool, multisigPool, wal, hd, calculator, workServer)
 	log.Println("Serving now on http://localhost:3001")
 	log.Fatal(http.ListenAndServe(":3001", router))
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/knd/kndchain/pkg/miner"
+)
+
+// workRefreshInterval is how long extra nonces of the same work are tried, newer pool transactions only make it into new work
+const workRefreshInterval = 30 * time.Second
+
+func main() {
+	nodeURL := flag.String("nodeURL", "http://localhost:3001", "URL of the full node to get work from and submit solved blocks to")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines to mine with")
+	pollInterval := flag.Duration("pollInterval", time.Second, "how often the node is asked whether the current work is stale")
+	flag.Parse()
+
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	log.Printf("Working for %s with %d goroutines", *nodeURL, *workers)
+	for {
+		work, err := fetchWork(client, *nodeURL)
+		if err != nil {
+			log.Printf("Failed to get work, %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		ctx, stale := context.WithCancel(context.Background())
+		go watchWork(ctx, client, *nodeURL, work.ID, *pollInterval, stale)
+
+		start := time.Now()
+		var nonce uint32
+		var found bool
+		var hashes uint64
+		extraNonce := uint64(0)
+		for {
+			merkleRoot, err := work.MerkleRootAt(extraNonce)
+			if err != nil {
+				log.Printf("Failed to roll extra nonce of work, %v", err)
+				break
+			}
+			var extraNonceHashes uint64
+			nonce, found, extraNonceHashes = solve(ctx, work, merkleRoot, *workers)
+			hashes += extraNonceHashes
+			if found || ctx.Err() != nil || time.Since(start) > workRefreshInterval {
+				break
+			}
+			// every nonce of the range gave no block, the next extra nonce gives new headers to hash
+			extraNonce++
+		}
+		isStale := ctx.Err() != nil
+		stale()
+		log.Printf("Worked on template %s nonces %d-%d with %d extra nonces at %.0f hashes/s", work.ID, work.NonceStart, work.NonceEnd, extraNonce+1, float64(hashes)/time.Since(start).Seconds())
+		if !found {
+			if isStale {
+				log.Println("Chain tip moved, getting new work")
+			}
+			continue
+		}
+
+		block, err := submitWork(client, *nodeURL, miner.Solution{ID: work.ID, Nonce: nonce, ExtraNonce: extraNonce})
+		if err != nil {
+			log.Printf("Failed to submit work, %v", err)
+			continue
+		}
+		log.Printf("Solved block %v at difficulty %d", block["hash"], work.Difficulty)
+	}
+}
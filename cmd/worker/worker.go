@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/knd/kndchain/pkg/hashing"
+	"github.com/knd/kndchain/pkg/miner"
+)
+
+// hashBatch is the number of nonces a goroutine tries between checks for cancellation
+const hashBatch = 1 << 12
+
+// fetchWork gets the next template and nonce range to work on from the node
+func fetchWork(client *http.Client, nodeURL string) (*miner.Work, error) {
+	resp, err := client.Get(fmt.Sprintf("%s/api/work", nodeURL))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var work miner.Work
+	if err := json.NewDecoder(resp.Body).Decode(&work); err != nil {
+		return nil, err
+	}
+	return &work, nil
+}
+
+// submitWork sends a solution to the node, which responds with the block it added
+func submitWork(client *http.Client, nodeURL string, solution miner.Solution) (map[string]interface{}, error) {
+	body, err := json.Marshal(solution)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post(fmt.Sprintf("%s/api/work", nodeURL), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var block map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// watchWork calls stale once the node no longer takes solutions for the template with given id
+func watchWork(ctx context.Context, client *http.Client, nodeURL string, id string, interval time.Duration, stale func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := client.Get(fmt.Sprintf("%s/api/work/%s", nodeURL, id))
+			if err != nil {
+				// keep working, the node may only be briefly unreachable
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusGone {
+				stale()
+				return
+			}
+		}
+	}
+}
+
+// solve searches the nonce range of work with given merkle root and number of goroutines, each trying every workers-th nonce.
+// It returns false when the range is exhausted or ctx is done before a nonce is found, along with the hashes tried.
+func solve(ctx context.Context, work *miner.Work, merkleRoot string, workers int) (uint32, bool, uint64) {
+	workCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// buffered so a goroutine never blocks on finding a nonce after another one did
+	found := make(chan uint32, workers)
+	var hashes uint64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		if uint64(work.NonceStart)+uint64(w) > uint64(work.NonceEnd) {
+			break
+		}
+
+		wg.Add(1)
+		go func(nonce uint32) {
+			defer wg.Done()
+			header := hashing.NewHeaderTemplate(hashing.Block{
+				Timestamp:  work.Timestamp,
+				LastHash:   work.LastHash,
+				MerkleRoot: merkleRoot,
+				Difficulty: work.Difficulty,
+			})
+			step := uint32(workers)
+			for {
+				select {
+				case <-workCtx.Done():
+					return
+				default:
+				}
+
+				for i := 0; i < hashBatch; i++ {
+					header.SetNonce(nonce)
+					hash := header.Hash()
+					if uint32(hashing.LeadingZeroBits(hash[:])) >= work.Difficulty {
+						atomic.AddUint64(&hashes, uint64(i+1))
+						found <- nonce
+						return
+					}
+					// compared in 64 bits since the range may end at the largest nonce
+					if uint64(nonce)+uint64(step) > uint64(work.NonceEnd) {
+						atomic.AddUint64(&hashes, uint64(i+1))
+						return
+					}
+					nonce += step
+				}
+				atomic.AddUint64(&hashes, hashBatch)
+			}
+		}(work.NonceStart + uint32(w))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case nonce := <-found:
+		stop()
+		<-done
+		return nonce, true, atomic.LoadUint64(&hashes)
+	case <-done:
+		// every goroutine has returned, a nonce found just before is still good
+		select {
+		case nonce := <-found:
+			return nonce, true, atomic.LoadUint64(&hashes)
+		default:
+			return 0, false, atomic.LoadUint64(&hashes)
+		}
+	}
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("Node responded %s, %s", resp.Status, bytes.TrimSpace(body))
+}
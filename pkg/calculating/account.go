@@ -0,0 +1,50 @@
+package calculating
+
+// Account is the balance state of an address as of a chain tip
+type Account struct {
+	// Balance excludes the initial balance until the address has sent a transaction,
+	// after that it is the change returned to the address plus what it received since
+	Balance uint64 `json:"balance"`
+	HasSent bool   `json:"hasSent"`
+	// Nonce is the number of transactions sent by the address, which is also the nonce of its next transaction
+	Nonce uint64 `json:"nonce"`
+}
+
+// ApplyBlock returns the account of every address touched by block after applying its transactions in order on top of accountOf
+func ApplyBlock(block Block, accountOf func(address string) Account) map[string]Account {
+	accounts := make(map[string]Account)
+	current := func(address string) Account {
+		if account, ok := accounts[address]; ok {
+			return account
+		}
+		return accountOf(address)
+	}
+
+	for _, tx := range block.Data {
+		for address, account := range ApplyTransaction(tx, current) {
+			accounts[address] = account
+		}
+	}
+	return accounts
+}
+
+// ApplyTransaction returns the account of every address touched by tx after applying tx on top of accountOf,
+// each input address is left with its change output and its nonce moves on by one
+func ApplyTransaction(tx Transaction, accountOf func(address string) Account) map[string]Account {
+	accounts := make(map[string]Account)
+	for _, input := range tx.Inputs() {
+		account := accountOf(input.Address)
+		// the change output replaces what the input address received before
+		accounts[input.Address] = Account{Balance: tx.Output[input.Address], HasSent: true, Nonce: account.Nonce + 1}
+	}
+
+	for address, amount := range tx.Output {
+		if _, spent := accounts[address]; spent {
+			continue
+		}
+		account := accountOf(address)
+		account.Balance += amount
+		accounts[address] = account
+	}
+	return accounts
+}
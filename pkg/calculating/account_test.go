@@ -0,0 +1,107 @@
+package calculating
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	createTransaction := func(sender string, amount uint64, output map[string]uint64) Transaction {
+		return Transaction{Input: Input{Address: sender, Amount: amount}, Output: output}
+	}
+	blockchain := &Blockchain{Chain: []Block{
+		Block{Data: []Transaction{
+			createTransaction("alice", 1000, map[string]uint64{"alice": 900, "bob": 100}),
+			createTransaction("MINER_REWARD", 0, map[string]uint64{"alice": 5}),
+		}},
+		Block{Data: []Transaction{
+			createTransaction("bob", 1100, map[string]uint64{"bob": 1050, "carol": 50}),
+			createTransaction("dave", 1000, map[string]uint64{"dave": 980, "alice": 20}),
+		}},
+	}}
+
+	t.Run("returns same balances as walking the chain", func(t *testing.T) {
+		service := NewService(1000, nil, "MINER_REWARD", 1)
+		accounts := make(map[string]Account)
+		accountOf := func(address string) Account {
+			return accounts[address]
+		}
+
+		// perform test
+		for _, block := range blockchain.Chain {
+			for address, account := range ApplyBlock(block, accountOf) {
+				accounts[address] = account
+			}
+		}
+
+		// test verification
+		for _, address := range []string{"alice", "bob", "carol", "dave", "erin"} {
+			assert.Equal(service.Balance(address, blockchain), service.AccountBalance(accounts[address]), address)
+		}
+		for _, address := range []string{"alice", "bob", "carol", "dave", "erin"} {
+			assert.Equal(service.Nonce(address, blockchain), accounts[address].Nonce, address)
+		}
+		assert.Equal(Account{Balance: 925, HasSent: true, Nonce: 1}, accounts["alice"])
+		assert.Equal(Account{Balance: 50}, accounts["carol"])
+	})
+
+	t.Run("counts sent transactions on top of previous nonce", func(t *testing.T) {
+		// perform test
+		accounts := ApplyBlock(blockchain.Chain[1], func(address string) Account { return Account{Balance: 100, HasSent: true, Nonce: 4} })
+
+		// test verification
+		assert.Equal(uint64(5), accounts["bob"].Nonce)
+		assert.Equal(uint64(4), accounts["carol"].Nonce)
+	})
+
+	t.Run("applies transactions of same sender in order and spends every input", func(t *testing.T) {
+		service := NewService(1000, nil, "MINER_REWARD", 1)
+		multiInput := createTransaction("carol", 1040, map[string]uint64{"carol": 0, "erin": 2050})
+		multiInput.ExtraInputs = []Input{{Address: "dave", Amount: 1010}}
+		block := Block{Data: []Transaction{
+			createTransaction("carol", 1000, map[string]uint64{"carol": 990, "dave": 10}),
+			createTransaction("carol", 990, map[string]uint64{"carol": 960, "erin": 30}),
+			createTransaction("erin", 1030, map[string]uint64{"erin": 950, "carol": 80}),
+			multiInput,
+		}}
+		chain := &Blockchain{Chain: []Block{block}}
+
+		// perform test
+		accounts := ApplyBlock(block, func(address string) Account { return Account{} })
+
+		// test verification
+		assert.Equal(Account{Balance: 0, HasSent: true, Nonce: 3}, accounts["carol"])
+		assert.Equal(Account{Balance: 0, HasSent: true, Nonce: 1}, accounts["dave"])
+		assert.Equal(Account{Balance: 3000, HasSent: true, Nonce: 1}, accounts["erin"])
+		for _, address := range []string{"carol", "dave", "erin"} {
+			assert.Equal(service.Balance(address, chain), service.AccountBalance(accounts[address]), address)
+			assert.Equal(service.Nonce(address, chain), accounts[address].Nonce, address)
+		}
+	})
+
+	t.Run("only returns touched addresses", func(t *testing.T) {
+		// perform test
+		accounts := ApplyBlock(blockchain.Chain[0], func(address string) Account { return Account{} })
+
+		// test verification
+		assert.Len(accounts, 3)
+		assert.Contains(accounts, "MINER_REWARD")
+	})
+}
+
+func TestService_CurrentBalance(t *testing.T) {
+	assert := assert.New(t)
+	mockedRepository := new(MockedRepository)
+	mockedRepository.On("GetAccount", "alice").Return(&Account{Balance: 925, HasSent: true})
+	mockedRepository.On("GetAccount", "carol").Return(&Account{Balance: 50})
+	mockedRepository.On("GetAccount", "erin").Return(nil)
+	service := NewService(1000, mockedRepository, "MINER_REWARD", 1)
+
+	// perform test & verification
+	assert.Equal(uint64(925), service.CurrentBalance("alice"))
+	assert.Equal(uint64(1050), service.CurrentBalance("carol"))
+	assert.Equal(uint64(1000), service.CurrentBalance("erin"))
+}
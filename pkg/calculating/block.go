@@ -1,26 +1,78 @@
 package calculating
 
+import "github.com/knd/kndchain/pkg/listing"
+
 // Input of transaction
 type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
 // Transaction in block data
 type Transaction struct {
-	ID     string            `json:"id"`
-	Input  Input             `json:"input"`
-	Output map[string]uint64 `json:"output"`
+	ID          string            `json:"id"`
+	Input       Input             `json:"input"`
+	ExtraInputs []Input           `json:"extraInputs,omitempty"`
+	Output      map[string]uint64 `json:"output"`
+}
+
+// Inputs returns Input followed by the extra inputs of a transaction spending from several addresses
+func (tx Transaction) Inputs() []Input {
+	return append([]Input{tx.Input}, tx.ExtraInputs...)
 }
 
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   *string       `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       *string       `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
 	Difficulty uint32        `json:"difficulty"`
 }
+
+func fromListingBlock(lBlock listing.Block) Block {
+	var txs []Transaction
+	for _, transaction := range lBlock.Data {
+		txs = append(txs, Transaction{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: Input{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: fromListingInputs(transaction.ExtraInputs),
+		})
+	}
+
+	return Block{
+		Timestamp:  lBlock.Timestamp,
+		LastHash:   lBlock.LastHash,
+		MerkleRoot: lBlock.MerkleRoot,
+		Hash:       lBlock.Hash,
+		Data:       txs,
+		Nonce:      lBlock.Nonce,
+		Difficulty: lBlock.Difficulty,
+	}
+}
+
+func fromListingInputs(lInputs []listing.Input) []Input {
+	var inputs []Input
+	for _, input := range lInputs {
+		inputs = append(inputs, Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return inputs
+}
@@ -0,0 +1,32 @@
+package calculating
+
+import (
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockedRepository is a mocked object that implements Repository
+type MockedRepository struct {
+	mock.Mock
+}
+
+// GetAccount returns the account of address
+func (m *MockedRepository) GetAccount(address string) *Account {
+	args := m.Called(address)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*Account)
+}
+
+// GetBlockCount returns the number of main chain blocks
+func (m *MockedRepository) GetBlockCount() uint32 {
+	args := m.Called()
+	return args.Get(0).(uint32)
+}
+
+// GetBlockRange returns up to limit main chain blocks starting at height start
+func (m *MockedRepository) GetBlockRange(start uint32, limit uint32) []listing.Block {
+	args := m.Called(start, limit)
+	return args.Get(0).([]listing.Block)
+}
@@ -2,21 +2,101 @@ package calculating
 
 import (
 	"log"
+
+	"github.com/knd/kndchain/pkg/listing"
 )
 
+// Repository provides access to account states and blocks as of the main chain tip
+type Repository interface {
+	// GetAccount returns the account of address, nil if address has no transactions yet
+	GetAccount(address string) *Account
+	// GetBlockCount returns the number of main chain blocks
+	GetBlockCount() uint32
+	// GetBlockRange returns up to limit main chain blocks starting at height start
+	GetBlockRange(start uint32, limit uint32) []listing.Block
+}
+
 // Service provides access to calculating operations
 type Service interface {
 	Balance(address string, bc *Blockchain) uint64
 	BalanceByBlockIndex(address string, bc *Blockchain, index int) uint64
+	CurrentBalance(address string) uint64
+	AccountBalance(account Account) uint64
+	Nonce(address string, bc *Blockchain) uint64
+	CurrentNonce(address string) uint64
+	ImmatureBalance(address string, bc *Blockchain) uint64
+	ImmatureBalanceByBlockIndex(address string, bc *Blockchain, index int) uint64
+	CurrentImmatureBalance(address string) uint64
+	TotalBalance(addresses []string, bc *Blockchain) uint64
+	CurrentTotalBalance(addresses []string) uint64
+	HasTransactions(address string, bc *Blockchain) bool
+	CurrentHasTransactions(address string) bool
 }
 
 type service struct {
-	InitialBalance uint64
+	InitialBalance       uint64
+	r                    Repository
+	RewardTxInputAddress string
+	CoinbaseMaturity     int
+}
+
+// NewService creates a calculating service, r may be nil when only given blockchains are calculated.
+// Rewards, i.e. transactions from rewardTxInputAddress, are immature until coinbaseMaturity blocks after their block.
+func NewService(initialBalance uint64, r Repository, rewardTxInputAddress string, coinbaseMaturity int) Service {
+	return &service{initialBalance, r, rewardTxInputAddress, coinbaseMaturity}
 }
 
-// NewService creates a calculating service
-func NewService(initialBalance uint64) Service {
-	return &service{initialBalance}
+// CurrentBalance returns the balance of the address as of the main chain tip from the account index
+func (s *service) CurrentBalance(address string) uint64 {
+	if s.r == nil {
+		log.Println("CurrentBalance: no account repository, returning initial balance")
+		return s.InitialBalance
+	}
+
+	account := s.r.GetAccount(address)
+	if account == nil {
+		return s.InitialBalance
+	}
+	return s.AccountBalance(*account)
+}
+
+// AccountBalance returns the balance of given account state
+func (s *service) AccountBalance(account Account) uint64 {
+	if account.HasSent {
+		return account.Balance
+	}
+	return s.InitialBalance + account.Balance
+}
+
+// Nonce returns the nonce of the next transaction sent by the address given blockchain history
+func (s *service) Nonce(address string, bc *Blockchain) uint64 {
+	var nonce uint64
+	if bc == nil {
+		return nonce
+	}
+
+	for _, block := range bc.Chain {
+		for _, tx := range block.Data {
+			if spendsFrom(tx, address) {
+				nonce++
+			}
+		}
+	}
+	return nonce
+}
+
+// CurrentNonce returns the nonce of the next transaction sent by the address as of the main chain tip from the account index
+func (s *service) CurrentNonce(address string) uint64 {
+	if s.r == nil {
+		log.Println("CurrentNonce: no account repository, returning 0")
+		return 0
+	}
+
+	account := s.r.GetAccount(address)
+	if account == nil {
+		return 0
+	}
+	return account.Nonce
 }
 
 // Balance returns the current balance of the address given blockchain history
@@ -45,7 +125,7 @@ func (s *service) BalanceByBlockIndex(address string, bc *Blockchain, index int)
 
 		var blockAmount uint64
 		for _, tx := range block.Data {
-			if tx.Input.Address == address {
+			if spendsFrom(tx, address) {
 				blockAmount = tx.Output[address]
 				foundWalletTxInBlock = true
 			} else if amount, ok := tx.Output[address]; ok {
@@ -66,3 +146,119 @@ func (s *service) BalanceByBlockIndex(address string, bc *Blockchain, index int)
 
 	return s.InitialBalance + balance
 }
+
+// ImmatureBalance returns the part of the balance of the address given blockchain history that the next block may not spend yet
+func (s *service) ImmatureBalance(address string, bc *Blockchain) uint64 {
+	if bc == nil {
+		return 0
+	}
+	return s.ImmatureBalanceByBlockIndex(address, bc, len(bc.Chain)-1)
+}
+
+// ImmatureBalanceByBlockIndex returns the rewards of the address in blocks up to index that the block after index may not spend yet
+func (s *service) ImmatureBalanceByBlockIndex(address string, bc *Blockchain, index int) uint64 {
+	if bc == nil {
+		return 0
+	}
+	if index >= len(bc.Chain) {
+		index = len(bc.Chain) - 1
+	}
+
+	var immature uint64
+	for i := index; i >= 0 && !s.isMature(i, index+1); i-- {
+		immature += BlockRewards(bc.Chain[i], s.RewardTxInputAddress)[address]
+	}
+	return immature
+}
+
+// CurrentImmatureBalance returns the rewards of the address that a block on the main chain tip may not spend yet
+func (s *service) CurrentImmatureBalance(address string) uint64 {
+	if s.r == nil || s.CoinbaseMaturity <= 1 {
+		return 0
+	}
+
+	count := s.r.GetBlockCount()
+	var start uint32
+	if count > uint32(s.CoinbaseMaturity-1) {
+		start = count - uint32(s.CoinbaseMaturity-1)
+	}
+
+	bc := &Blockchain{}
+	for _, block := range s.r.GetBlockRange(start, count-start) {
+		bc.Chain = append(bc.Chain, fromListingBlock(block))
+	}
+	return s.ImmatureBalance(address, bc)
+}
+
+// TotalBalance returns the sum of the balances of addresses given blockchain history, e.g. of the keys of one wallet
+func (s *service) TotalBalance(addresses []string, bc *Blockchain) uint64 {
+	var total uint64
+	for _, address := range addresses {
+		total += s.Balance(address, bc)
+	}
+	return total
+}
+
+// CurrentTotalBalance returns the sum of the balances of addresses as of the main chain tip from the account index
+func (s *service) CurrentTotalBalance(addresses []string) uint64 {
+	var total uint64
+	for _, address := range addresses {
+		total += s.CurrentBalance(address)
+	}
+	return total
+}
+
+// HasTransactions returns true if the address sent or received a transaction given blockchain history
+func (s *service) HasTransactions(address string, bc *Blockchain) bool {
+	if bc == nil {
+		return false
+	}
+
+	for _, block := range bc.Chain {
+		for _, tx := range block.Data {
+			if _, ok := tx.Output[address]; ok || spendsFrom(tx, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CurrentHasTransactions returns true if the address sent or received a transaction as of the main chain tip
+func (s *service) CurrentHasTransactions(address string) bool {
+	if s.r == nil {
+		log.Println("CurrentHasTransactions: no account repository, returning false")
+		return false
+	}
+
+	return s.r.GetAccount(address) != nil
+}
+
+// spendsFrom returns true if one of the inputs of tx is from address
+func spendsFrom(tx Transaction, address string) bool {
+	for _, input := range tx.Inputs() {
+		if input.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// isMature returns true if a reward in the block at rewardIndex may be spent in the block at spendIndex
+func (s *service) isMature(rewardIndex int, spendIndex int) bool {
+	return spendIndex-rewardIndex >= s.CoinbaseMaturity
+}
+
+// BlockRewards returns the amount every address is rewarded in block, rewards are transactions from rewardTxInputAddress
+func BlockRewards(block Block, rewardTxInputAddress string) map[string]uint64 {
+	rewards := make(map[string]uint64)
+	for _, tx := range block.Data {
+		if tx.Input.Address != rewardTxInputAddress {
+			continue
+		}
+		for address, amount := range tx.Output {
+			rewards[address] += amount
+		}
+	}
+	return rewards
+}
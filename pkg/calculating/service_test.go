@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/knd/kndchain/pkg/listing"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,7 +15,7 @@ func TestService_Balance(t *testing.T) {
 	var initialBalance uint64 = 1000
 
 	beforeEach := func() {
-		service = NewService(initialBalance)
+		service = NewService(initialBalance, nil, "MINER_REWARD", 1)
 	}
 
 	createTransaction := func(id string, output map[string]uint64, timestamp int64, amount uint64, address string, signature string) Transaction {
@@ -84,3 +85,86 @@ func TestService_Balance(t *testing.T) {
 	})
 
 }
+
+func TestService_ImmatureBalance(t *testing.T) {
+	assert := assert.New(t)
+	service := NewService(1000, nil, "MINER_REWARD", 3)
+	reward := func(address string, amount uint64) Block {
+		return Block{Data: []Transaction{Transaction{Input: Input{Address: "MINER_REWARD"}, Output: map[string]uint64{address: amount}}}}
+	}
+	bc := &Blockchain{Chain: []Block{Block{}, reward("alice", 5), reward("alice", 7), reward("bob", 5)}}
+
+	t.Run("counts rewards of the last maturity-1 blocks", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(uint64(7), service.ImmatureBalance("alice", bc))
+		assert.Equal(uint64(5), service.ImmatureBalance("bob", bc))
+		assert.Equal(uint64(0), service.ImmatureBalance("carol", bc))
+	})
+
+	t.Run("counts rewards as of block index", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(uint64(12), service.ImmatureBalanceByBlockIndex("alice", bc, 2))
+		assert.Equal(uint64(5), service.ImmatureBalanceByBlockIndex("alice", bc, 1))
+	})
+
+	t.Run("has nothing immature with maturity of 1", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(uint64(0), NewService(1000, nil, "MINER_REWARD", 1).ImmatureBalance("bob", bc))
+	})
+}
+
+func TestService_CurrentImmatureBalance(t *testing.T) {
+	assert := assert.New(t)
+	mockedRepository := new(MockedRepository)
+	mockedRepository.On("GetBlockCount").Return(uint32(10))
+	mockedRepository.On("GetBlockRange", uint32(8), uint32(2)).Return([]listing.Block{
+		listing.Block{Data: []listing.Transaction{listing.Transaction{Input: listing.Input{Address: "MINER_REWARD"}, Output: map[string]uint64{"alice": 5}}}},
+		listing.Block{Data: []listing.Transaction{listing.Transaction{Input: listing.Input{Address: "MINER_REWARD"}, Output: map[string]uint64{"alice": 7}}}},
+	})
+	service := NewService(1000, mockedRepository, "MINER_REWARD", 3)
+
+	// perform test & verification
+	assert.Equal(uint64(12), service.CurrentImmatureBalance("alice"))
+	assert.Equal(uint64(0), service.CurrentImmatureBalance("bob"))
+}
+
+func TestService_TotalBalance(t *testing.T) {
+	assert := assert.New(t)
+	service := NewService(1000, nil, "MINER_REWARD", 1)
+	bc := &Blockchain{Chain: []Block{Block{Data: []Transaction{
+		Transaction{Input: Input{Address: "alice"}, Output: map[string]uint64{"alice": 900, "bob": 100}},
+		Transaction{Input: Input{Address: "MINER_REWARD"}, Output: map[string]uint64{"carol": 5}},
+	}}}}
+
+	t.Run("sums balances of addresses", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(uint64(900+1100), service.TotalBalance([]string{"alice", "bob"}, bc))
+		assert.Equal(uint64(0), service.TotalBalance([]string{}, bc))
+	})
+
+	t.Run("finds addresses with transactions", func(t *testing.T) {
+		// perform test & verification
+		assert.True(service.HasTransactions("alice", bc))
+		assert.True(service.HasTransactions("bob", bc))
+		assert.True(service.HasTransactions("carol", bc))
+		assert.False(service.HasTransactions("dave", bc))
+		assert.False(service.HasTransactions("alice", nil))
+	})
+}
+
+func TestService_CurrentTotalBalance(t *testing.T) {
+	assert := assert.New(t)
+	mockedRepository := new(MockedRepository)
+	mockedRepository.On("GetAccount", "alice").Return(&Account{Balance: 900, HasSent: true, Nonce: 1})
+	mockedRepository.On("GetAccount", "bob").Return(&Account{Balance: 100})
+	mockedRepository.On("GetAccount", "carol").Return(nil)
+	service := NewService(1000, mockedRepository, "MINER_REWARD", 1)
+
+	// perform test & verification
+	assert.Equal(uint64(900+1100+1000), service.CurrentTotalBalance([]string{"alice", "bob", "carol"}))
+	assert.True(service.CurrentHasTransactions("bob"))
+	assert.False(service.CurrentHasTransactions("carol"))
+	assert.Equal(uint64(1), service.CurrentNonce("alice"))
+	assert.Equal(uint64(0), service.CurrentNonce("bob"))
+	assert.Equal(uint64(0), service.CurrentNonce("carol"))
+}
@@ -0,0 +1,38 @@
+package consensus
+
+import "time"
+
+// Params are the block rules every node must apply the same way to agree on one chain
+type Params struct {
+	// MaxBlockSize is the maximum length in bytes of the canonical encoding of a block
+	MaxBlockSize int
+	// MaxBlockTransactions is the maximum number of transactions in a block, the reward transaction included
+	MaxBlockTransactions int
+	// MaxFutureDrift is how far ahead of local time a block timestamp may be
+	MaxFutureDrift time.Duration
+	// MedianTimeSpan is the number of previous blocks whose median timestamp a block must be later than
+	MedianTimeSpan int
+	// Retargeting selects the algorithm that moves difficulty towards TargetBlockTime
+	Retargeting string
+	// RetargetWindow is the number of blocks retargeting measures block time over
+	RetargetWindow int
+	// TargetBlockTime is how long mining a block should take on average
+	TargetBlockTime time.Duration
+	// CoinbaseMaturity is the number of blocks from a reward's block to the first block that may spend it,
+	// so rewards of blocks that may still be orphaned in a reorg are not spent
+	CoinbaseMaturity int
+}
+
+// DefaultParams returns the parameters used by the kndchain network
+func DefaultParams() Params {
+	return Params{
+		MaxBlockSize:         1 << 20,
+		MaxBlockTransactions: 4096,
+		MaxFutureDrift:       2 * time.Minute,
+		MedianTimeSpan:       11,
+		Retargeting:          WindowRetargeting,
+		RetargetWindow:       60,
+		TargetBlockTime:      10 * time.Second,
+		CoinbaseMaturity:     100,
+	}
+}
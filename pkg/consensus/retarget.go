@@ -0,0 +1,145 @@
+package consensus
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnknownRetargeting is used when params select a retargeting algorithm that does not exist
+var ErrUnknownRetargeting = errors.New("Unknown retargeting algorithm")
+
+const (
+	// StepRetargeting moves difficulty by 1 on every block depending on the time since its parent
+	StepRetargeting = "step"
+	// WindowRetargeting adjusts difficulty every RetargetWindow blocks against the time the window took
+	WindowRetargeting = "window"
+	// MovingAverageRetargeting adjusts difficulty on every block against the average time of the last RetargetWindow blocks
+	MovingAverageRetargeting = "moving-average"
+
+	// maxWindowStep is the most difficulty may change at once in window retargeting, a factor of 4 in work
+	maxWindowStep = 2
+)
+
+// Header is the part of a block retargeting looks at
+type Header struct {
+	Height     uint32
+	Timestamp  int64
+	Difficulty uint32
+}
+
+// Retargeter decides the difficulty a block must be mined at
+type Retargeter interface {
+	// Window returns how many headers before a block NextDifficulty looks at
+	Window() int
+	// NextDifficulty returns the difficulty of a block with given timestamp,
+	// parents are the last Window headers before the block, oldest first, and hold at least its parent
+	NextDifficulty(parents []Header, timestamp int64) uint32
+}
+
+// Retargeter returns the retargeting algorithm selected by params
+func (p Params) Retargeter() (Retargeter, error) {
+	switch p.Retargeting {
+	case StepRetargeting:
+		return &stepRetargeter{p.TargetBlockTime}, nil
+	case WindowRetargeting:
+		if p.RetargetWindow < 1 {
+			return nil, ErrUnknownRetargeting
+		}
+		return &windowRetargeter{p.TargetBlockTime, p.RetargetWindow}, nil
+	case MovingAverageRetargeting:
+		if p.RetargetWindow < 1 {
+			return nil, ErrUnknownRetargeting
+		}
+		return &movingAverageRetargeter{p.TargetBlockTime, p.RetargetWindow}, nil
+	}
+	return nil, ErrUnknownRetargeting
+}
+
+type stepRetargeter struct {
+	target time.Duration
+}
+
+func (r *stepRetargeter) Window() int {
+	return 1
+}
+
+func (r *stepRetargeter) NextDifficulty(parents []Header, timestamp int64) uint32 {
+	parent := parents[len(parents)-1]
+	if timestamp-parent.Timestamp < r.target.Nanoseconds() {
+		return parent.Difficulty + 1
+	} else if timestamp-parent.Timestamp > r.target.Nanoseconds() {
+		return lowerDifficulty(parent.Difficulty, 1)
+	}
+
+	return parent.Difficulty
+}
+
+type windowRetargeter struct {
+	target time.Duration
+	window int
+}
+
+func (r *windowRetargeter) Window() int {
+	// the block before the window marks when the window started
+	return r.window + 1
+}
+
+func (r *windowRetargeter) NextDifficulty(parents []Header, timestamp int64) uint32 {
+	parent := parents[len(parents)-1]
+	if (parent.Height+1)%uint32(r.window) != 0 || len(parents) < 2 {
+		return parent.Difficulty
+	}
+
+	first := parents[0]
+	blocks := int64(parent.Height - first.Height)
+	return retarget(parent.Difficulty, parent.Timestamp-first.Timestamp, blocks*r.target.Nanoseconds(), maxWindowStep)
+}
+
+type movingAverageRetargeter struct {
+	target time.Duration
+	window int
+}
+
+func (r *movingAverageRetargeter) Window() int {
+	return r.window + 1
+}
+
+func (r *movingAverageRetargeter) NextDifficulty(parents []Header, timestamp int64) uint32 {
+	parent := parents[len(parents)-1]
+	if len(parents) < 2 {
+		return parent.Difficulty
+	}
+
+	first := parents[0]
+	blocks := int64(parent.Height - first.Height)
+	return retarget(parent.Difficulty, parent.Timestamp-first.Timestamp, blocks*r.target.Nanoseconds(), 1)
+}
+
+// retarget moves difficulty one bit, i.e. doubling or halving the work, for each factor of 2 between actual and expected time,
+// by no more than maxStep. A ratio between 3/4 and 3/2 leaves difficulty as is so it does not flip on every retarget.
+func retarget(difficulty uint32, actual int64, expected int64, maxStep int) uint32 {
+	if actual < 1 {
+		actual = 1
+	}
+
+	for step := 0; step < maxStep; step++ {
+		if actual*4 < expected*3 {
+			difficulty++
+			actual *= 2
+		} else if actual*2 > expected*3 {
+			difficulty = lowerDifficulty(difficulty, 1)
+			expected *= 2
+		} else {
+			break
+		}
+	}
+	return difficulty
+}
+
+// lowerDifficulty lowers difficulty by n keeping the minimum difficulty of 1
+func lowerDifficulty(difficulty uint32, n uint32) uint32 {
+	if difficulty <= n+1 {
+		return 1
+	}
+	return difficulty - n
+}
@@ -0,0 +1,173 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepRetargeter(t *testing.T) {
+	assert := assert.New(t)
+	retargeter, _ := Params{Retargeting: StepRetargeting, TargetBlockTime: 600 * time.Second}.Retargeter()
+	parent := Header{Height: 1, Timestamp: time.Now().UnixNano(), Difficulty: 2}
+
+	t.Run("raises block difficulty if mining rate is faster than target block time", func(t *testing.T) {
+		blockTimestamp := parent.Timestamp + (time.Millisecond * 999).Nanoseconds()
+
+		// perform test
+		difficulty := retargeter.NextDifficulty([]Header{parent}, blockTimestamp)
+
+		// test verification
+		assert.Equal(uint32(3), difficulty)
+	})
+
+	t.Run("lowers block difficulty if mining rate is slower than target block time", func(t *testing.T) {
+		blockTimestamp := parent.Timestamp + (time.Millisecond * 700000).Nanoseconds()
+
+		// perform test
+		difficulty := retargeter.NextDifficulty([]Header{parent}, blockTimestamp)
+
+		// test verficiation
+		assert.Equal(uint32(1), difficulty)
+	})
+
+	t.Run("keeps block difficulty if mining rate is equal to target block time", func(t *testing.T) {
+		blockTimestamp := parent.Timestamp + (time.Millisecond * 600000).Nanoseconds()
+
+		// perform test
+		difficulty := retargeter.NextDifficulty([]Header{parent}, blockTimestamp)
+
+		// test verficiation
+		assert.Equal(uint32(2), difficulty)
+	})
+
+	t.Run("has minimum difficulty of 1 no matter what", func(t *testing.T) {
+		blockTimestamp := parent.Timestamp + (time.Millisecond * 1001).Nanoseconds()
+
+		// perform test
+		difficulty := retargeter.NextDifficulty([]Header{Header{Timestamp: parent.Timestamp, Difficulty: 0}}, blockTimestamp)
+
+		// test verficiation
+		assert.Equal(uint32(1), difficulty)
+	})
+}
+
+func TestWindowRetargeter(t *testing.T) {
+	assert := assert.New(t)
+	retargeter, _ := Params{Retargeting: WindowRetargeting, RetargetWindow: 4, TargetBlockTime: 10 * time.Second}.Retargeter()
+
+	createHeaders := func(blockTime time.Duration, count int) []Header {
+		var headers []Header
+		for i := 0; i < count; i++ {
+			headers = append(headers, Header{Height: uint32(i), Timestamp: int64(i) * blockTime.Nanoseconds(), Difficulty: 8})
+		}
+		return headers
+	}
+
+	t.Run("looks at the window and the block before it", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(5, retargeter.Window())
+	})
+
+	t.Run("keeps difficulty between retargets", func(t *testing.T) {
+		headers := createHeaders(time.Second, 7)
+
+		// perform test & verification
+		assert.Equal(uint32(8), retargeter.NextDifficulty(headers[2:], 0))
+	})
+
+	t.Run("raises difficulty when window is mined faster than target", func(t *testing.T) {
+		headers := createHeaders(4*time.Second, 8)
+
+		// perform test & verification
+		assert.Equal(uint32(9), retargeter.NextDifficulty(headers[3:], 0))
+	})
+
+	t.Run("lowers difficulty when window is mined slower than target", func(t *testing.T) {
+		headers := createHeaders(20*time.Second, 8)
+
+		// perform test & verification
+		assert.Equal(uint32(7), retargeter.NextDifficulty(headers[3:], 0))
+	})
+
+	t.Run("keeps difficulty when window is mined close to target", func(t *testing.T) {
+		headers := createHeaders(12*time.Second, 8)
+
+		// perform test & verification
+		assert.Equal(uint32(8), retargeter.NextDifficulty(headers[3:], 0))
+	})
+
+	t.Run("changes difficulty by at most 2 at once", func(t *testing.T) {
+		headers := createHeaders(time.Millisecond, 8)
+
+		// perform test & verification
+		assert.Equal(uint32(10), retargeter.NextDifficulty(headers[3:], 0))
+	})
+
+	t.Run("measures short chain from genesis", func(t *testing.T) {
+		headers := createHeaders(time.Second, 4)
+
+		// perform test & verification
+		assert.Equal(uint32(10), retargeter.NextDifficulty(headers, 0))
+	})
+}
+
+func TestMovingAverageRetargeter(t *testing.T) {
+	assert := assert.New(t)
+	retargeter, _ := Params{Retargeting: MovingAverageRetargeting, RetargetWindow: 4, TargetBlockTime: 10 * time.Second}.Retargeter()
+
+	createHeaders := func(blockTimes ...time.Duration) []Header {
+		headers := []Header{Header{Difficulty: 8}}
+		for i, blockTime := range blockTimes {
+			headers = append(headers, Header{Height: uint32(i + 1), Timestamp: headers[i].Timestamp + blockTime.Nanoseconds(), Difficulty: 8})
+		}
+		return headers
+	}
+
+	t.Run("keeps difficulty of genesis child", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(uint32(8), retargeter.NextDifficulty(createHeaders(), 0))
+	})
+
+	t.Run("raises difficulty by 1 when average is faster than target", func(t *testing.T) {
+		headers := createHeaders(time.Second, time.Second, time.Second, time.Second)
+
+		// perform test & verification
+		assert.Equal(uint32(9), retargeter.NextDifficulty(headers, 0))
+	})
+
+	t.Run("lowers difficulty by 1 when average is slower than target", func(t *testing.T) {
+		headers := createHeaders(time.Minute, time.Minute, time.Minute, time.Minute)
+
+		// perform test & verification
+		assert.Equal(uint32(7), retargeter.NextDifficulty(headers, 0))
+	})
+
+	t.Run("keeps difficulty when one slow block is averaged out", func(t *testing.T) {
+		headers := createHeaders(5*time.Second, 5*time.Second, 25*time.Second, 5*time.Second)
+
+		// perform test & verification
+		assert.Equal(uint32(8), retargeter.NextDifficulty(headers, 0))
+	})
+}
+
+func TestParams_Retargeter(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("returns error for unknown algorithm", func(t *testing.T) {
+		// perform test
+		_, err := Params{Retargeting: "unknown"}.Retargeter()
+
+		// test verification
+		assert.Equal(ErrUnknownRetargeting, err)
+	})
+
+	t.Run("returns error for empty window", func(t *testing.T) {
+		// perform test
+		_, err := Params{Retargeting: WindowRetargeting}.Retargeter()
+
+		// test verification
+		assert.Equal(ErrUnknownRetargeting, err)
+	})
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// AddressVersion is the version byte of addresses, it makes every address start with k
+const AddressVersion byte = 0x6b
+
+// ErrInvalidAddress indicates an address with another version or length
+var ErrInvalidAddress = errors.New("Invalid address")
+
+// PubKeyToAddress returns the address of a public key, the Base58Check encoding of
+// AddressVersion followed by the RIPEMD-160 of the SHA-256 of the compressed public key
+func PubKeyToAddress(pubKey []byte) (string, error) {
+	compressed, err := CompressPubKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	return base58CheckEncode(AddressVersion, hash160(compressed)), nil
+}
+
+// ValidateAddress returns nil if address is a well formed single key or multisig address, ErrInvalidChecksum hints at a typo
+func ValidateAddress(address string) error {
+	version, payload, err := base58CheckDecode(address)
+	if err != nil {
+		return err
+	}
+	if (version != AddressVersion && version != MultisigAddressVersion) || len(payload) != ripemd160.Size {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// CompressPubKey returns the 33 bytes form of a 65 bytes uncompressed public key, compressed keys are returned as they are
+func CompressPubKey(pubKey []byte) ([]byte, error) {
+	if len(pubKey) == 33 && (pubKey[0] == 0x02 || pubKey[0] == 0x03) {
+		return pubKey, nil
+	}
+
+	x, y := secp256k1.S256().Unmarshal(pubKey)
+	if x == nil || !secp256k1.S256().IsOnCurve(x, y) {
+		return nil, ErrInvalidPubKey
+	}
+	return compress(x, y), nil
+}
+
+// compress returns the x coordinate prefixed by the parity of y
+func compress(x, y *big.Int) []byte {
+	pubKey := make([]byte, 33)
+	pubKey[0] = 0x02 + byte(y.Bit(0))
+	blob := x.Bytes()
+	copy(pubKey[33-len(blob):], blob)
+	return pubKey
+}
+
+func hash160(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
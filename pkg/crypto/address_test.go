@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase58Check(t *testing.T) {
+	assert := assert.New(t)
+	payload, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+
+	// perform test
+	encoded := base58CheckEncode(0x00, payload)
+	version, decoded, err := base58CheckDecode(encoded)
+
+	// test verification
+	assert.Equal("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", encoded)
+	assert.NoError(err)
+	assert.Equal(byte(0x00), version)
+	assert.Equal(payload, decoded)
+}
+
+func TestPubKeyToAddress(t *testing.T) {
+	assert := assert.New(t)
+	// public key of private key 1, i.e. the generator point
+	pubKey, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	t.Run("derives address from compressed public key", func(t *testing.T) {
+		// perform test
+		address, err := PubKeyToAddress(pubKey)
+		compressed, _ := CompressPubKey(pubKey)
+		fromCompressed, _ := PubKeyToAddress(compressed)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal("kEqoumnSLNSWeh7FqfkRiGYAU61V4cZKCy", address)
+		assert.Equal(address, fromCompressed)
+		assert.NoError(ValidateAddress(address))
+	})
+
+	t.Run("rejects invalid public key", func(t *testing.T) {
+		// perform test
+		_, err := PubKeyToAddress(pubKey[:64])
+
+		// test verification
+		assert.Equal(ErrInvalidPubKey, err)
+	})
+
+	t.Run("detects typos", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal(ErrInvalidChecksum, ValidateAddress("kEqoumnSLNSWeh7FqfkRiGYAU61V4cZKCz"))
+		assert.Equal(ErrInvalidChecksum, ValidateAddress("kEqoumnSLN"))
+		assert.Equal(ErrInvalidBase58, ValidateAddress("kEqoumnSLNSWeh7FqfkRiGYAU6lV4cZKCy"))
+		assert.Equal(ErrInvalidAddress, ValidateAddress("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"))
+	})
+}
+
+func TestSecp256k1Generator_VerifyAddress(t *testing.T) {
+	assert := assert.New(t)
+	gen := NewSecp256k1Generator()
+	pubKey, privKey := gen.Generate()
+	address, _ := PubKeyToAddress(pubKey)
+	otherPubKey, _ := gen.Generate()
+	otherAddress, _ := PubKeyToAddress(otherPubKey)
+	msg := []byte("foo")
+	signature, _ := gen.Sign(msg, privKey)
+
+	// perform test
+	recovered, err := gen.RecoverPubKey(msg, signature)
+
+	// test verification
+	assert.NoError(err)
+	assert.Equal(pubKey, recovered)
+	assert.True(gen.VerifyAddress(address, msg, signature))
+	assert.False(gen.VerifyAddress(otherAddress, msg, signature))
+	assert.False(gen.VerifyAddress(address, []byte("bar"), signature))
+	assert.False(gen.VerifyAddress(address, msg, signature[:64]))
+}
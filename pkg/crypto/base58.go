@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// base58Alphabet leaves out 0, O, I and l which are easily mistaken for each other
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ErrInvalidBase58 indicates a string with a character outside the base58 alphabet
+var ErrInvalidBase58 = errors.New("Invalid base58 character")
+
+// ErrInvalidChecksum indicates a Base58Check string whose checksum does not match, e.g. because of a typo
+var ErrInvalidChecksum = errors.New("Invalid checksum")
+
+var base58Radix = big.NewInt(58)
+
+// base58Encode encodes b in base58, each leading zero byte becomes a leading 1
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	mod := new(big.Int)
+
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base58Radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < len(b) && b[i] == 0; i++ {
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// base58Decode decodes base58 string s
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	for i := 0; i < len(s); i++ {
+		digit := -1
+		for j := 0; j < len(base58Alphabet); j++ {
+			if base58Alphabet[j] == s[i] {
+				digit = j
+				break
+			}
+		}
+		if digit < 0 {
+			return nil, ErrInvalidBase58
+		}
+		n.Mul(n, base58Radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// base58CheckEncode encodes version and payload followed by the first 4 bytes of their double SHA-256
+func base58CheckEncode(version byte, payload []byte) string {
+	b := append([]byte{version}, payload...)
+	return base58Encode(append(b, checksum(b)...))
+}
+
+// base58CheckDecode returns the version and payload of s after checking its checksum
+func base58CheckDecode(s string) (version byte, payload []byte, err error) {
+	b, err := base58Decode(s)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 5 {
+		return 0, nil, ErrInvalidChecksum
+	}
+
+	sum := checksum(b[:len(b)-4])
+	for i := range sum {
+		if sum[i] != b[len(b)-4+i] {
+			return 0, nil, ErrInvalidChecksum
+		}
+	}
+	return b[0], b[1 : len(b)-4], nil
+}
+
+func checksum(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
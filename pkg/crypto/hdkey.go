@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+)
+
+// HardenedKeyStart is the index of the first hardened child, whose public key can not be derived from the parent public key
+const HardenedKeyStart uint32 = 0x80000000
+
+// masterKeyHMACKey is the HMAC key of master key generation defined by BIP-32
+var masterKeyHMACKey = []byte("Bitcoin seed")
+
+// ErrInvalidSeed indicates a seed that is too short or too long, or derives an invalid master key
+var ErrInvalidSeed = errors.New("Invalid seed, Seed must be 16 to 64 bytes")
+
+// ErrInvalidChild indicates an index whose derived key is invalid, BIP-32 says to proceed with the next index
+var ErrInvalidChild = errors.New("Invalid child key, Use the next index")
+
+// ErrInvalidPath indicates a derivation path not in the form m/44'/1'/0'/0
+var ErrInvalidPath = errors.New("Invalid derivation path")
+
+// ExtendedKey is a BIP-32 extended private key, it derives a tree of secp256k1 keys from one seed
+type ExtendedKey struct {
+	privKey   []byte
+	chainCode []byte
+	depth     uint8
+	index     uint32
+}
+
+// NewMasterKey returns the root of the key tree of seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, ErrInvalidSeed
+	}
+
+	mac := hmac.New(sha512.New, masterKeyHMACKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if !isValidPrivKey(sum[:32]) {
+		return nil, ErrInvalidSeed
+	}
+	return &ExtendedKey{privKey: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// Child returns the child key at index, indexes from HardenedKeyStart on are hardened
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	data := make([]byte, 0, 37)
+	if index >= HardenedKeyStart {
+		data = append(data, 0x00)
+		data = append(data, k.privKey...)
+	} else {
+		data = append(data, k.compressedPubKey()...)
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	data = append(data, indexBytes[:]...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	if !isValidPrivKey(sum[:32]) {
+		return nil, ErrInvalidChild
+	}
+	n := secp256k1.S256().Params().N
+	childKey := new(big.Int).SetBytes(sum[:32])
+	childKey.Add(childKey, new(big.Int).SetBytes(k.privKey))
+	childKey.Mod(childKey, n)
+	if childKey.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+
+	privKey := make([]byte, 32)
+	blob := childKey.Bytes()
+	copy(privKey[32-len(blob):], blob)
+	return &ExtendedKey{privKey: privKey, chainCode: sum[32:], depth: k.depth + 1, index: index}, nil
+}
+
+// Derive returns the descendant key at path, e.g. m/44'/1'/0'/0/5
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// PrivKey returns the 32 bytes private key, as returned by Secp256k1Generator#Generate
+func (k *ExtendedKey) PrivKey() []byte {
+	return k.privKey
+}
+
+// PubKey returns the uncompressed public key, as returned by Secp256k1Generator#Generate
+func (k *ExtendedKey) PubKey() []byte {
+	x, y := secp256k1.S256().ScalarBaseMult(k.privKey)
+	return secp256k1.S256().Marshal(x, y)
+}
+
+// ChainCode returns the entropy the children of the key are derived with
+func (k *ExtendedKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+// Depth returns the number of derivations from the master key
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// Index returns the index of the key in its parent
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
+
+// compressedPubKey returns the 33 bytes public key BIP-32 hashes into non-hardened children
+func (k *ExtendedKey) compressedPubKey() []byte {
+	return compress(secp256k1.S256().ScalarBaseMult(k.privKey))
+}
+
+// ParsePath returns the child indexes of a path like m/44'/1'/0'/0, where ' or h marks a hardened index
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, ErrInvalidPath
+	}
+
+	indexes := []uint32{}
+	for _, part := range parts[1:] {
+		var offset uint32
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedKeyStart
+			part = part[:len(part)-1]
+		}
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, ErrInvalidPath
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, nil
+}
+
+// isValidPrivKey returns true if b is a scalar in [1, n-1]
+func isValidPrivKey(b []byte) bool {
+	key := new(big.Int).SetBytes(b)
+	return key.Sign() > 0 && key.Cmp(secp256k1.S256().Params().N) < 0
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtendedKey(t *testing.T) {
+	assert := assert.New(t)
+	// test vector 1 of BIP-32
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	t.Run("derives master key from seed", func(t *testing.T) {
+		// perform test
+		master, err := NewMasterKey(seed)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal("e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", hex.EncodeToString(master.PrivKey()))
+		assert.Equal("873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", hex.EncodeToString(master.ChainCode()))
+		assert.Equal(uint8(0), master.Depth())
+	})
+
+	t.Run("derives hardened and normal children", func(t *testing.T) {
+		master, _ := NewMasterKey(seed)
+
+		// perform test
+		hardened, err := master.Derive("m/0'")
+		assert.NoError(err)
+		normal, err := master.Derive("m/0h/1")
+		assert.NoError(err)
+
+		// test verification
+		assert.Equal("edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", hex.EncodeToString(hardened.PrivKey()))
+		assert.Equal("47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", hex.EncodeToString(hardened.ChainCode()))
+		assert.Equal("3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", hex.EncodeToString(normal.PrivKey()))
+		assert.Equal("2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", hex.EncodeToString(normal.ChainCode()))
+		assert.Equal("03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c", hex.EncodeToString(normal.compressedPubKey()))
+		assert.Equal(uint8(2), normal.Depth())
+		assert.Equal(uint32(1), normal.Index())
+	})
+
+	t.Run("derives keys that sign like generated ones", func(t *testing.T) {
+		master, _ := NewMasterKey(seed)
+		key, _ := master.Derive("m/44'/1'/0'/0/3")
+		gen := NewSecp256k1Generator()
+		msg := []byte("foo")
+
+		// perform test
+		signature, err := gen.Sign(msg, key.PrivKey())
+
+		// test verification
+		assert.NoError(err)
+		assert.Len(key.PubKey(), 65)
+		assert.True(gen.Verify(key.PubKey(), msg, signature))
+	})
+
+	t.Run("rejects invalid seed", func(t *testing.T) {
+		// perform test
+		_, err := NewMasterKey(seed[:8])
+
+		// test verification
+		assert.Equal(ErrInvalidSeed, err)
+	})
+}
+
+func TestParsePath(t *testing.T) {
+	assert := assert.New(t)
+
+	indexes, err := ParsePath("m/44'/1h/0'/0/5")
+	assert.NoError(err)
+	assert.Equal([]uint32{HardenedKeyStart + 44, HardenedKeyStart + 1, HardenedKeyStart, 0, 5}, indexes)
+
+	indexes, err = ParsePath("m")
+	assert.NoError(err)
+	assert.Empty(indexes)
+
+	for _, path := range []string{"", "44'/0", "m/", "m/x", "m/-1", "m/2147483648"} {
+		_, err := ParsePath(path)
+		assert.Equal(ErrInvalidPath, err, path)
+	}
+}
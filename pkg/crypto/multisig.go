@@ -0,0 +1,182 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// MultisigAddressVersion is the version byte of multisig addresses, it makes every multisig address start with m
+const MultisigAddressVersion byte = 0x6e
+
+// MaxMultisigKeys limits the number of keys of a multisig script
+const MaxMultisigKeys = 15
+
+// signatureLength is the length of a recoverable [R || S || V] signature
+const signatureLength = 65
+
+// ErrInvalidMultisig indicates a multisig script or signature that can't be parsed or that breaks m-of-n limits
+var ErrInvalidMultisig = errors.New("Invalid multisig")
+
+// MultisigScript holds the n public keys that control a multisig address and the m of them that must sign
+type MultisigScript struct {
+	Required int
+	// PubKeys are compressed and sorted, so the address does not depend on the order keys are given in
+	PubKeys [][]byte
+}
+
+// NewMultisigScript creates a script requiring required signatures of pubKeys
+func NewMultisigScript(required int, pubKeys [][]byte) (*MultisigScript, error) {
+	var keys [][]byte
+	for _, pubKey := range pubKeys {
+		compressed, err := CompressPubKey(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, compressed)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	script := &MultisigScript{Required: required, PubKeys: keys}
+	if err := script.validate(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// ParseMultisigScript parses the encoding returned by Bytes
+func ParseMultisigScript(b []byte) (*MultisigScript, error) {
+	if len(b) < 2 || len(b) != 2+int(b[1])*33 {
+		return nil, ErrInvalidMultisig
+	}
+
+	script := &MultisigScript{Required: int(b[0])}
+	for i := 2; i < len(b); i += 33 {
+		script.PubKeys = append(script.PubKeys, b[i:i+33])
+	}
+	if err := script.validate(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// validate returns nil if script requires 1 to n of up to MaxMultisigKeys distinct sorted keys
+func (s *MultisigScript) validate() error {
+	if len(s.PubKeys) == 0 || len(s.PubKeys) > MaxMultisigKeys || s.Required < 1 || s.Required > len(s.PubKeys) {
+		return ErrInvalidMultisig
+	}
+
+	for i, pubKey := range s.PubKeys {
+		// keys are parsed from the network as well, so they have to be points on the curve
+		if x, _ := secp256k1.DecompressPubkey(pubKey); x == nil || len(pubKey) != 33 {
+			return ErrInvalidPubKey
+		}
+		if i > 0 && bytes.Compare(s.PubKeys[i-1], pubKey) >= 0 {
+			return ErrInvalidMultisig
+		}
+	}
+	return nil
+}
+
+// Bytes returns the encoding of script, the required count and key count as single bytes followed by the keys
+func (s *MultisigScript) Bytes() []byte {
+	b := []byte{byte(s.Required), byte(len(s.PubKeys))}
+	for _, pubKey := range s.PubKeys {
+		b = append(b, pubKey...)
+	}
+	return b
+}
+
+// Address returns the multisig address of script, the Base58Check encoding of
+// MultisigAddressVersion followed by the RIPEMD-160 of the SHA-256 of the script bytes
+func (s *MultisigScript) Address() string {
+	return base58CheckEncode(MultisigAddressVersion, hash160(s.Bytes()))
+}
+
+// IsMultisigAddress returns true if address is a well formed multisig address
+func IsMultisigAddress(address string) bool {
+	version, payload, err := base58CheckDecode(address)
+	return err == nil && version == MultisigAddressVersion && len(payload) == ripemd160.Size
+}
+
+// EncodeMultisigSignature returns the script followed by the signatures collected so far,
+// which is what an input spending from a multisig address carries as its signature
+func EncodeMultisigSignature(script *MultisigScript, signatures [][]byte) []byte {
+	b := script.Bytes()
+	for _, signature := range signatures {
+		b = append(b, signature...)
+	}
+	return b
+}
+
+// DecodeMultisigSignature returns the script and signatures of the encoding returned by EncodeMultisigSignature
+func DecodeMultisigSignature(b []byte) (*MultisigScript, [][]byte, error) {
+	if len(b) < 2 || len(b) < 2+int(b[1])*33 {
+		return nil, nil, ErrInvalidMultisig
+	}
+
+	scriptLength := 2 + int(b[1])*33
+	script, err := ParseMultisigScript(b[:scriptLength])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rest := b[scriptLength:]
+	if len(rest)%signatureLength != 0 {
+		return nil, nil, ErrInvalidMultisig
+	}
+	var signatures [][]byte
+	for i := 0; i < len(rest); i += signatureLength {
+		signatures = append(signatures, rest[i:i+signatureLength])
+	}
+	return script, signatures, nil
+}
+
+// Signer returns the index in script of the key that created signature over msg
+func (s *Secp256k1Generator) Signer(script *MultisigScript, msg, signature []byte) (int, bool) {
+	if len(signature) != signatureLength {
+		return 0, false
+	}
+
+	pubKey, err := s.RecoverPubKey(msg, signature)
+	if err != nil || !s.Verify(pubKey, msg, signature) {
+		return 0, false
+	}
+	compressed, err := CompressPubKey(pubKey)
+	if err != nil {
+		return 0, false
+	}
+
+	for i, key := range script.PubKeys {
+		if bytes.Equal(key, compressed) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// VerifyMultisig checks that multisig, as encoded by EncodeMultisigSignature, holds the script of address
+// and at least the required signatures over msg, each by a different key of the script
+func (s *Secp256k1Generator) VerifyMultisig(address string, msg, multisig []byte) bool {
+	script, signatures, err := DecodeMultisigSignature(multisig)
+	if err != nil || script.Address() != address {
+		return false
+	}
+
+	// any extra signature has to be valid too, so signatures can't be padded with junk
+	signed := make(map[int]bool)
+	for _, signature := range signatures {
+		signer, ok := s.Signer(script, msg, signature)
+		if !ok || signed[signer] {
+			return false
+		}
+		signed[signer] = true
+	}
+
+	return len(signed) >= script.Required
+}
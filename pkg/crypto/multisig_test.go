@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultisigScript(t *testing.T) {
+	assert := assert.New(t)
+	gen := NewSecp256k1Generator()
+	alicePubKey, _ := gen.Generate()
+	bobPubKey, _ := gen.Generate()
+	carolPubKey, _ := gen.Generate()
+
+	t.Run("derives same address whatever the order of keys", func(t *testing.T) {
+		// perform test
+		script, err := NewMultisigScript(2, [][]byte{alicePubKey, bobPubKey, carolPubKey})
+		reordered, _ := NewMultisigScript(2, [][]byte{carolPubKey, alicePubKey, bobPubKey})
+		parsed, parseErr := ParseMultisigScript(script.Bytes())
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(script.Address(), reordered.Address())
+		assert.True(strings.HasPrefix(script.Address(), "m"))
+		assert.True(IsMultisigAddress(script.Address()))
+		assert.NoError(ValidateAddress(script.Address()))
+		assert.NoError(parseErr)
+		assert.Equal(script, parsed)
+	})
+
+	t.Run("rejects scripts breaking m-of-n limits", func(t *testing.T) {
+		// perform test
+		_, noneErr := NewMultisigScript(0, [][]byte{alicePubKey})
+		_, tooManyErr := NewMultisigScript(3, [][]byte{alicePubKey, bobPubKey})
+		_, duplicateErr := NewMultisigScript(1, [][]byte{alicePubKey, alicePubKey})
+		_, invalidKeyErr := NewMultisigScript(1, [][]byte{alicePubKey[:64]})
+
+		// test verification
+		assert.Equal(ErrInvalidMultisig, noneErr)
+		assert.Equal(ErrInvalidMultisig, tooManyErr)
+		assert.Equal(ErrInvalidMultisig, duplicateErr)
+		assert.Equal(ErrInvalidPubKey, invalidKeyErr)
+	})
+
+	t.Run("tells address of single key apart", func(t *testing.T) {
+		address, _ := PubKeyToAddress(alicePubKey)
+
+		// perform test & verification
+		assert.False(IsMultisigAddress(address))
+	})
+}
+
+func TestSecp256k1Generator_VerifyMultisig(t *testing.T) {
+	assert := assert.New(t)
+	gen := NewSecp256k1Generator()
+	alicePubKey, alicePrivKey := gen.Generate()
+	bobPubKey, bobPrivKey := gen.Generate()
+	_, malloryPrivKey := gen.Generate()
+	script, _ := NewMultisigScript(2, [][]byte{alicePubKey, bobPubKey})
+	otherScript, _ := NewMultisigScript(1, [][]byte{alicePubKey, bobPubKey})
+	msg := []byte("foo")
+	aliceSig, _ := gen.Sign(msg, alicePrivKey)
+	bobSig, _ := gen.Sign(msg, bobPrivKey)
+	mallorySig, _ := gen.Sign(msg, malloryPrivKey)
+
+	// perform test
+	multisig := EncodeMultisigSignature(script, [][]byte{bobSig, aliceSig})
+	decodedScript, signatures, err := DecodeMultisigSignature(multisig)
+
+	// test verification
+	assert.NoError(err)
+	assert.Equal(script, decodedScript)
+	assert.Equal([][]byte{bobSig, aliceSig}, signatures)
+	assert.True(gen.VerifyMultisig(script.Address(), msg, multisig))
+	assert.False(gen.VerifyMultisig(otherScript.Address(), msg, multisig))
+	assert.False(gen.VerifyMultisig(script.Address(), []byte("bar"), multisig))
+	assert.False(gen.VerifyMultisig(script.Address(), msg, EncodeMultisigSignature(script, [][]byte{aliceSig})))
+	assert.False(gen.VerifyMultisig(script.Address(), msg, EncodeMultisigSignature(script, [][]byte{aliceSig, aliceSig})))
+	assert.False(gen.VerifyMultisig(script.Address(), msg, EncodeMultisigSignature(script, [][]byte{aliceSig, bobSig, mallorySig})))
+	assert.False(gen.VerifyMultisig(script.Address(), msg, multisig[:len(multisig)-1]))
+}
@@ -4,13 +4,16 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"encoding/hex"
+	"crypto/sha256"
+	"errors"
 	"log"
 
 	"github.com/ethereum/go-ethereum/crypto/secp256k1"
-	"github.com/knd/kndchain/pkg/hashing"
 )
 
+// ErrInvalidPubKey indicates bytes that are not a point on the secp256k1 curve
+var ErrInvalidPubKey = errors.New("Invalid public key")
+
 // Secp256k1Generator provides secp256k1 operations
 type Secp256k1Generator struct{}
 
@@ -64,7 +67,37 @@ func (s *Secp256k1Generator) Sign(msg, privKey []byte) ([]byte, error) {
 	return secp256k1.Sign(msgHash, privKey)
 }
 
+// RecoverPubKey returns the uncompressed public key that created the 65 bytes [R || S || V] signature over msg
+func (s *Secp256k1Generator) RecoverPubKey(msg, signature []byte) ([]byte, error) {
+	msgHash, err := sha256Hash(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return secp256k1.RecoverPubkey(msgHash, signature)
+}
+
+// VerifyAddress checks that the public key of address created signature over msg, the key is recovered from signature
+func (s *Secp256k1Generator) VerifyAddress(address string, msg, signature []byte) bool {
+	if len(signature) != 65 {
+		log.Printf("Secp256k1Generator#VerifyAddress: Signature length=%d is not 65", len(signature))
+		return false
+	}
+
+	pubKey, err := s.RecoverPubKey(msg, signature)
+	if err != nil {
+		return false
+	}
+
+	recovered, err := PubKeyToAddress(pubKey)
+	if err != nil || recovered != address {
+		return false
+	}
+	// recovery does not reject a high S value, so the usual verification still runs
+	return s.Verify(pubKey, msg, signature)
+}
+
 func sha256Hash(data []byte) ([]byte, error) {
-	dataHash := hashing.SHA256Hash(data)
-	return hex.DecodeString(dataHash)
+	dataHash := sha256.Sum256(data)
+	return dataHash[:], nil
 }
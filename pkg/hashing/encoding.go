@@ -0,0 +1,309 @@
+package hashing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// EncodingVersion is the first byte of every canonical encoding, it changes whenever the layout changes
+const EncodingVersion byte = 4
+
+// maxEncodedLength limits decoded string lengths and item counts
+const maxEncodedLength = 1 << 24
+
+// ErrUnsupportedEncoding is used when decoding bytes of an unknown encoding version
+var ErrUnsupportedEncoding = errors.New("Unsupported encoding version")
+
+// ErrMalformedEncoding is used when decoding bytes that are truncated or have trailing data
+var ErrMalformedEncoding = errors.New("Malformed encoding")
+
+// TxInput is the input of a transaction in canonical encoding
+type TxInput struct {
+	Timestamp int64
+	Amount    uint64
+	Nonce     uint64
+	Address   string
+	Signature string
+}
+
+// Tx is a transaction in canonical encoding
+type Tx struct {
+	ID          string
+	Input       TxInput
+	ExtraInputs []TxInput
+	Output      map[string]uint64
+}
+
+// Block is a block in canonical encoding, the block hash itself is not part of it
+type Block struct {
+	Timestamp  int64
+	LastHash   string
+	MerkleRoot string
+	Data       []Tx
+	Nonce      uint32
+	Difficulty uint32
+}
+
+// Encoding layout, integers are big-endian with fixed width and strings are prefixed by their uvarint length:
+//
+//	output: uvarint count, then entries sorted by address: string address, uint64 amount
+//	input:  int64 timestamp, uint64 amount, uint64 nonce, string address, string signature
+//	tx:     string id, input, uvarint extra input count, extra inputs, output
+//	header: int64 timestamp, string lastHash, string merkleRoot, uint32 nonce, uint32 difficulty
+//	block:  header, uvarint tx count, txs
+//
+// Every top level encoding is prefixed by EncodingVersion.
+
+// EncodeHeader returns the canonical encoding of block header, transactions are committed to by the merkle root only
+func EncodeHeader(block Block) []byte {
+	e := newEncoder()
+	e.header(block)
+	return e.buf.Bytes()
+}
+
+// EncodeBlock returns the canonical encoding of block header followed by its transactions
+func EncodeBlock(block Block) []byte {
+	e := newEncoder()
+	e.header(block)
+	e.uvarint(uint64(len(block.Data)))
+	for _, tx := range block.Data {
+		e.tx(tx, true)
+	}
+	return e.buf.Bytes()
+}
+
+// EncodeTransaction returns the canonical encoding of tx
+func EncodeTransaction(tx Tx) []byte {
+	e := newEncoder()
+	e.tx(tx, true)
+	return e.buf.Bytes()
+}
+
+// TransactionSigningBytes returns the canonical encoding of tx without its signatures, which is what every input signs
+func TransactionSigningBytes(tx Tx) []byte {
+	e := newEncoder()
+	e.tx(tx, false)
+	return e.buf.Bytes()
+}
+
+// BlockHash returns the hex SHA256 hash of the canonical encoding of block header
+func BlockHash(block Block) string {
+	return SHA256HashBytes(EncodeHeader(block))
+}
+
+// DecodeBlock parses the canonical encoding of a block
+func DecodeBlock(b []byte) (Block, error) {
+	d, err := newDecoder(b)
+	if err != nil {
+		return Block{}, err
+	}
+
+	var block Block
+	block.Timestamp = d.int64()
+	block.LastHash = d.string()
+	block.MerkleRoot = d.string()
+	block.Nonce = d.uint32()
+	block.Difficulty = d.uint32()
+	count := d.count()
+	for i := 0; i < count && d.err == nil; i++ {
+		block.Data = append(block.Data, d.tx())
+	}
+
+	return block, d.finish()
+}
+
+// DecodeTransaction parses the canonical encoding of a transaction
+func DecodeTransaction(b []byte) (Tx, error) {
+	d, err := newDecoder(b)
+	if err != nil {
+		return Tx{}, err
+	}
+
+	tx := d.tx()
+	return tx, d.finish()
+}
+
+type encoder struct {
+	buf *bytes.Buffer
+}
+
+func newEncoder() *encoder {
+	e := &encoder{buf: &bytes.Buffer{}}
+	e.buf.WriteByte(EncodingVersion)
+	return e
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf.Write(b[:n])
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) int64(v int64) {
+	e.uint64(uint64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) header(block Block) {
+	e.int64(block.Timestamp)
+	e.string(block.LastHash)
+	e.string(block.MerkleRoot)
+	e.uint32(block.Nonce)
+	e.uint32(block.Difficulty)
+}
+
+func (e *encoder) input(input TxInput, withSignature bool) {
+	e.int64(input.Timestamp)
+	e.uint64(input.Amount)
+	e.uint64(input.Nonce)
+	e.string(input.Address)
+	if withSignature {
+		e.string(input.Signature)
+	}
+}
+
+func (e *encoder) tx(tx Tx, withSignature bool) {
+	e.string(tx.ID)
+	e.input(tx.Input, withSignature)
+	e.uvarint(uint64(len(tx.ExtraInputs)))
+	for _, input := range tx.ExtraInputs {
+		e.input(input, withSignature)
+	}
+
+	addresses := make([]string, 0, len(tx.Output))
+	for address := range tx.Output {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	e.uvarint(uint64(len(addresses)))
+	for _, address := range addresses {
+		e.string(address)
+		e.uint64(tx.Output[address])
+	}
+}
+
+// decoder reads canonical encodings, the first error sticks and zero values are returned after it
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newDecoder(b []byte) (*decoder, error) {
+	if len(b) == 0 {
+		return nil, ErrMalformedEncoding
+	}
+	if b[0] != EncodingVersion {
+		return nil, ErrUnsupportedEncoding
+	}
+	return &decoder{r: bytes.NewReader(b[1:])}, nil
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && d.r.Len() > 0 {
+		d.err = ErrMalformedEncoding
+	}
+	return d.err
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > d.r.Len() {
+		d.err = ErrMalformedEncoding
+		return nil
+	}
+	b := make([]byte, n)
+	d.r.Read(b)
+	return b
+}
+
+func (d *decoder) count() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil || v > maxEncodedLength {
+		d.err = ErrMalformedEncoding
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.read(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+func (d *decoder) string() string {
+	return string(d.read(d.count()))
+}
+
+func (d *decoder) input() TxInput {
+	var input TxInput
+	input.Timestamp = d.int64()
+	input.Amount = d.uint64()
+	input.Nonce = d.uint64()
+	input.Address = d.string()
+	input.Signature = d.string()
+	return input
+}
+
+func (d *decoder) tx() Tx {
+	var tx Tx
+	tx.ID = d.string()
+	tx.Input = d.input()
+
+	count := d.count()
+	for i := 0; i < count && d.err == nil; i++ {
+		tx.ExtraInputs = append(tx.ExtraInputs, d.input())
+	}
+
+	count = d.count()
+	tx.Output = make(map[string]uint64, count)
+	prev := ""
+	for i := 0; i < count && d.err == nil; i++ {
+		address := d.string()
+		// entries must be sorted and unique so every transaction has a single encoding
+		if i > 0 && address <= prev {
+			d.err = ErrMalformedEncoding
+		}
+		tx.Output[address] = d.uint64()
+		prev = address
+	}
+	return tx
+}
@@ -0,0 +1,110 @@
+package hashing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Leaves and inner nodes are hashed with different prefixes so an inner node can never pass as a leaf
+const (
+	merkleLeafPrefix byte = 0
+	merkleNodePrefix byte = 1
+)
+
+// MerkleStep is one sibling hash on the path from a leaf to the merkle root
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	// Left tells whether the sibling is hashed on the left of the running hash
+	Left bool `json:"left"`
+}
+
+// MerkleRoot returns the root of the merkle tree over txs, the hash of no data when txs is empty.
+// An odd node at any level is paired with itself.
+func MerkleRoot(txs []Tx) string {
+	if len(txs) == 0 {
+		return SHA256HashBytes(nil)
+	}
+
+	level := merkleLeaves(txs)
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// MerkleProof returns the sibling hashes from the leaf of txs[index] up to the merkle root, nil if index is out of range
+func MerkleProof(txs []Tx, index int) []MerkleStep {
+	if index < 0 || index >= len(txs) {
+		return nil
+	}
+
+	proof := []MerkleStep{}
+	level := merkleLeaves(txs)
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		proof = append(proof, MerkleStep{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return proof
+}
+
+// VerifyMerkleProof tells whether tx is committed to by root through proof
+func VerifyMerkleProof(tx Tx, proof []MerkleStep, root string) bool {
+	proofRoot, ok := MerkleRootFromProof(tx, proof)
+	return ok && proofRoot == root
+}
+
+// MerkleRootFromProof returns the merkle root proof leads to from the leaf of tx, false if a sibling hash is malformed.
+// The first leaf is never paired with itself, so the proof of the first of txs leads to their root whatever that
+// transaction is.
+func MerkleRootFromProof(tx Tx, proof []MerkleStep) (string, bool) {
+	hash := merkleLeaf(tx)
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return "", false
+		}
+		if step.Left {
+			hash = merkleNode(sibling, hash)
+		} else {
+			hash = merkleNode(hash, sibling)
+		}
+	}
+	return hex.EncodeToString(hash), true
+}
+
+func merkleLeaves(txs []Tx) [][]byte {
+	leaves := make([][]byte, len(txs))
+	for i, tx := range txs {
+		leaves[i] = merkleLeaf(tx)
+	}
+	return leaves
+}
+
+func merkleLevel(nodes [][]byte) [][]byte {
+	var parents [][]byte
+	for i := 0; i < len(nodes); i += 2 {
+		right := nodes[i]
+		if i+1 < len(nodes) {
+			right = nodes[i+1]
+		}
+		parents = append(parents, merkleNode(nodes[i], right))
+	}
+	return parents
+}
+
+func merkleLeaf(tx Tx) []byte {
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, EncodeTransaction(tx)...))
+	return sum[:]
+}
+
+func merkleNode(left []byte, right []byte) []byte {
+	b := append([]byte{merkleNodePrefix}, left...)
+	sum := sha256.Sum256(append(b, right...))
+	return sum[:]
+}
@@ -0,0 +1,101 @@
+package hashing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashing_MerkleRoot(t *testing.T) {
+	assert := assert.New(t)
+	tx := Tx{
+		ID:     "tx1",
+		Input:  TxInput{Timestamp: 1, Amount: 100, Nonce: 7, Address: "alice", Signature: "sig"},
+		Output: map[string]uint64{"bob": 40, "alice": 60},
+	}
+
+	t.Run("is hash of no data when there are no transactions", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", MerkleRoot(nil))
+	})
+
+	t.Run("is leaf hash of single transaction", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal("3bd87ea8eccd170ba9deb5f86511db7522faa1f0563b04db84d4a5ade446e58f", MerkleRoot([]Tx{tx}))
+	})
+
+	t.Run("pairs odd node with itself", func(t *testing.T) {
+		// perform test & verification
+		assert.Equal("162777ed53ec80db805ff908b3d209273695f16588de94fcf0ad63fd014251ed", MerkleRoot([]Tx{tx, {ID: "tx2"}, {ID: "tx3"}}))
+	})
+
+	t.Run("changes when transactions are reordered", func(t *testing.T) {
+		// perform test & verification
+		assert.NotEqual(MerkleRoot([]Tx{tx, {ID: "tx2"}}), MerkleRoot([]Tx{{ID: "tx2"}, tx}))
+	})
+}
+
+func TestHashing_MerkleProof(t *testing.T) {
+	assert := assert.New(t)
+	var txs []Tx
+	for _, id := range []string{"tx1", "tx2", "tx3", "tx4", "tx5"} {
+		txs = append(txs, Tx{ID: id})
+	}
+	root := MerkleRoot(txs)
+
+	t.Run("proves inclusion of every transaction", func(t *testing.T) {
+		for i, tx := range txs {
+			// perform test
+			proof := MerkleProof(txs, i)
+
+			// test verification
+			assert.Len(proof, 3)
+			assert.True(VerifyMerkleProof(tx, proof, root))
+		}
+	})
+
+	t.Run("proves single transaction with empty path", func(t *testing.T) {
+		// perform test
+		proof := MerkleProof(txs[:1], 0)
+
+		// test verification
+		assert.Empty(proof)
+		assert.True(VerifyMerkleProof(txs[0], proof, MerkleRoot(txs[:1])))
+	})
+
+	t.Run("returns nil when index is out of range", func(t *testing.T) {
+		// perform test & verification
+		assert.Nil(MerkleProof(txs, -1))
+		assert.Nil(MerkleProof(txs, len(txs)))
+	})
+
+	t.Run("rejects proof of other transaction", func(t *testing.T) {
+		// perform test & verification
+		assert.False(VerifyMerkleProof(Tx{ID: "tx6"}, MerkleProof(txs, 0), root))
+		assert.False(VerifyMerkleProof(txs[1], MerkleProof(txs, 0), root))
+	})
+
+	t.Run("rejects tampered proof", func(t *testing.T) {
+		proof := MerkleProof(txs, 2)
+		proof[0].Left = !proof[0].Left
+
+		// perform test & verification
+		assert.False(VerifyMerkleProof(txs[2], proof, root))
+
+		proof = MerkleProof(txs, 2)
+		proof[1].Hash = "zz"
+		assert.False(VerifyMerkleProof(txs[2], proof, root))
+	})
+
+	t.Run("leads from any first transaction to the root of transactions with it first", func(t *testing.T) {
+		proof := MerkleProof(txs, 0)
+		replaced := append([]Tx{{ID: "tx0"}}, txs[1:]...)
+
+		// perform test
+		proofRoot, ok := MerkleRootFromProof(replaced[0], proof)
+
+		// test verification
+		assert.True(ok)
+		assert.Equal(MerkleRoot(replaced), proofRoot)
+	})
+}
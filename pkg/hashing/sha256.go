@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math/bits"
 	"sort"
 
 	"github.com/knd/kndchain/pkg/sorting"
@@ -29,3 +30,19 @@ func SHA256Hash(inputs ...interface{}) string {
 	h.Write(unifiedBytes)
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// SHA256HashBytes returns the 256 bit hash of b in hex form
+func SHA256HashBytes(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// LeadingZeroBits returns the number of zero bits hash starts with
+func LeadingZeroBits(hash []byte) int {
+	for i, b := range hash {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return len(hash) * 8
+}
@@ -1,6 +1,7 @@
 package hashing
 
 import (
+	"encoding/hex"
 	"testing"
 	"time"
 
@@ -40,3 +41,153 @@ func TestHashing_HashYeildsDeterministicResultOfStruct(t *testing.T) {
 
 	assert.Equal(t, SHA256Hash(structA, structB), SHA256Hash(SB{Num: 1}, SA{Str: "test"}))
 }
+
+func TestHashing_LeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, LeadingZeroBits([]byte{0x80, 0x00}))
+	assert.Equal(t, 7, LeadingZeroBits([]byte{0x01, 0x00}))
+	assert.Equal(t, 12, LeadingZeroBits([]byte{0x00, 0x0f}))
+	assert.Equal(t, 16, LeadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func TestHashing_CanonicalEncoding(t *testing.T) {
+	assert := assert.New(t)
+	var tx Tx
+	var block Block
+
+	beforeEach := func() {
+		tx = Tx{
+			ID:     "tx1",
+			Input:  TxInput{Timestamp: 1, Amount: 100, Nonce: 7, Address: "alice", Signature: "sig"},
+			Output: map[string]uint64{"bob": 40, "alice": 60},
+		}
+		block = Block{Timestamp: 2, LastHash: "last", MerkleRoot: "root", Data: []Tx{tx}, Nonce: 3, Difficulty: 4}
+	}
+
+	t.Run("encodes transaction to fixed bytes", func(t *testing.T) {
+		beforeEach()
+
+		// perform test & verification
+		assert.Equal("040374783100000000000000010000000000000064000000000000000705616c69636503736967000205616c696365000000000000003c03626f620000000000000028", hex.EncodeToString(EncodeTransaction(tx)))
+		assert.Equal("040374783100000000000000010000000000000064000000000000000705616c696365000205616c696365000000000000003c03626f620000000000000028", hex.EncodeToString(TransactionSigningBytes(tx)))
+	})
+
+	t.Run("encodes block to fixed bytes and hashes its header only", func(t *testing.T) {
+		beforeEach()
+
+		// perform test & verification
+		assert.Equal("040000000000000002046c61737404726f6f740000000300000004", hex.EncodeToString(EncodeHeader(block)))
+		assert.Equal("040000000000000002046c61737404726f6f740000000300000004010374783100000000000000010000000000000064000000000000000705616c69636503736967000205616c696365000000000000003c03626f620000000000000028", hex.EncodeToString(EncodeBlock(block)))
+		assert.Equal("9d62cd320d5fef023585e80cda042808ea42ed9fc6193815e29625c10799ba8e", BlockHash(block))
+
+		block.Data = nil
+		assert.Equal("9d62cd320d5fef023585e80cda042808ea42ed9fc6193815e29625c10799ba8e", BlockHash(block))
+	})
+
+	t.Run("encodes outputs regardless of insertion order", func(t *testing.T) {
+		beforeEach()
+		other := tx
+		other.Output = map[string]uint64{}
+		other.Output["alice"] = 60
+		other.Output["bob"] = 40
+
+		// perform test & verification
+		assert.Equal(EncodeTransaction(tx), EncodeTransaction(other))
+	})
+
+	t.Run("decodes what it encodes", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		decodedTx, errTx := DecodeTransaction(EncodeTransaction(tx))
+		decodedBlock, errBlock := DecodeBlock(EncodeBlock(block))
+
+		// test verification
+		assert.Nil(errTx)
+		assert.Equal(tx, decodedTx)
+		assert.Nil(errBlock)
+		assert.Equal(block, decodedBlock)
+	})
+
+	t.Run("encodes extra inputs and leaves all signatures out of signing bytes", func(t *testing.T) {
+		beforeEach()
+		tx.ExtraInputs = []TxInput{{Timestamp: 1, Amount: 50, Nonce: 0, Address: "carol", Signature: "sig2"}}
+		other := tx
+		other.Input.Signature = "other"
+		other.ExtraInputs = []TxInput{{Timestamp: 1, Amount: 50, Nonce: 0, Address: "carol", Signature: "other2"}}
+
+		// perform test
+		decodedTx, err := DecodeTransaction(EncodeTransaction(tx))
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal(tx, decodedTx)
+		assert.Equal("040374783100000000000000010000000000000064000000000000000705616c69636501000000000000000100000000000000320000000000000000056361726f6c0205616c696365000000000000003c03626f620000000000000028", hex.EncodeToString(TransactionSigningBytes(tx)))
+		assert.Equal(TransactionSigningBytes(tx), TransactionSigningBytes(other))
+		assert.NotEqual(EncodeTransaction(tx), EncodeTransaction(other))
+	})
+
+	t.Run("rejects unknown version", func(t *testing.T) {
+		beforeEach()
+		b := EncodeTransaction(tx)
+		b[0] = EncodingVersion + 1
+
+		// perform test
+		_, err := DecodeTransaction(b)
+
+		// test verification
+		assert.Equal(ErrUnsupportedEncoding, err)
+	})
+
+	t.Run("rejects truncated and trailing bytes", func(t *testing.T) {
+		beforeEach()
+		b := EncodeBlock(block)
+
+		// perform test
+		_, errTruncated := DecodeBlock(b[:len(b)-1])
+		_, errTrailing := DecodeBlock(append(b, 0))
+
+		// test verification
+		assert.Equal(ErrMalformedEncoding, errTruncated)
+		assert.Equal(ErrMalformedEncoding, errTrailing)
+	})
+
+	t.Run("rejects unsorted outputs", func(t *testing.T) {
+		beforeEach()
+		b, _ := hex.DecodeString("040374783100000000000000010000000000000064000000000000000705616c69636503736967000203626f620000000000000028" + "05616c696365000000000000003c")
+
+		// perform test
+		_, err := DecodeTransaction(b)
+
+		// test verification
+		assert.Equal(ErrMalformedEncoding, err)
+	})
+}
+
+func TestHashing_HeaderTemplate(t *testing.T) {
+	assert := assert.New(t)
+	block := Block{Timestamp: 2, LastHash: "last", MerkleRoot: "root", Nonce: 3, Difficulty: 4}
+
+	t.Run("hashes as block hash", func(t *testing.T) {
+		// perform test
+		hash := NewHeaderTemplate(block).Hash()
+
+		// test verification
+		assert.Equal(BlockHash(block), hex.EncodeToString(hash[:]))
+	})
+
+	t.Run("hashes as block hash after setting timestamp, nonce and difficulty", func(t *testing.T) {
+		template := NewHeaderTemplate(block)
+		block.Timestamp = time.Now().UnixNano()
+		block.Nonce = 1 << 31
+		block.Difficulty = 20
+
+		// perform test
+		template.SetTimestamp(block.Timestamp)
+		template.SetNonce(block.Nonce)
+		template.SetDifficulty(block.Difficulty)
+		hash := template.Hash()
+
+		// test verification
+		assert.Equal(BlockHash(block), hex.EncodeToString(hash[:]))
+	})
+}
@@ -0,0 +1,41 @@
+package hashing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// timestampOffset is where the header timestamp starts, right after EncodingVersion
+const timestampOffset = 1
+
+// HeaderTemplate is the canonical encoding of a block header whose timestamp, nonce and difficulty are set in place,
+// so mining hashes the same bytes for every nonce without encoding the header again.
+// It is not safe for concurrent use, every mining worker needs its own.
+type HeaderTemplate struct {
+	buf []byte
+}
+
+// NewHeaderTemplate returns a template of block header, transactions are committed to by the merkle root only
+func NewHeaderTemplate(block Block) *HeaderTemplate {
+	return &HeaderTemplate{buf: EncodeHeader(block)}
+}
+
+// SetTimestamp sets the header timestamp
+func (t *HeaderTemplate) SetTimestamp(timestamp int64) {
+	binary.BigEndian.PutUint64(t.buf[timestampOffset:], uint64(timestamp))
+}
+
+// SetNonce sets the header nonce
+func (t *HeaderTemplate) SetNonce(nonce uint32) {
+	binary.BigEndian.PutUint32(t.buf[len(t.buf)-8:], nonce)
+}
+
+// SetDifficulty sets the header difficulty
+func (t *HeaderTemplate) SetDifficulty(difficulty uint32) {
+	binary.BigEndian.PutUint32(t.buf[len(t.buf)-4:], difficulty)
+}
+
+// Hash returns the SHA256 hash of the header as BlockHash does, in raw bytes
+func (t *HeaderTemplate) Hash() [sha256.Size]byte {
+	return sha256.Sum256(t.buf)
+}
@@ -1,29 +1,55 @@
 package rest
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/miner"
 	"github.com/knd/kndchain/pkg/mining"
 	"github.com/knd/kndchain/pkg/networking/pubsub"
+	"github.com/knd/kndchain/pkg/validating"
 	"github.com/knd/kndchain/pkg/wallet"
 )
 
-// Handler provides list of routes and action handlers
-func Handler(l listing.Service, m mining.Service, c pubsub.Service, p wallet.TransactionPool, wal wallet.Wallet, cal calculating.Service) http.Handler {
+const (
+	maxHeadersPerRequest uint32 = 2000
+	maxBlocksPerRequest  uint32 = 100
+	// maxLocatorHashes is more than the locator of any chain a uint32 height can address lists
+	maxLocatorHashes = 64
+)
+
+// Handler provides list of routes and action handlers, mp keeps multisig transactions until they have enough co-signatures to go to p.
+// hd is the HD wallet wal is an address of, routes sending from all of its addresses are left out if it is nil.
+func Handler(l listing.Service, m mining.Service, c pubsub.Service, p wallet.TransactionPool, mp wallet.TransactionPool, wal wallet.Wallet, hd wallet.HDWallet, cal calculating.Service, ws miner.WorkServer) http.Handler {
 	router := httprouter.New()
 
 	router.GET("/api/blocks", getBlocks(l))
 	router.POST("/api/blocks", mineBlock(m, l, c))
+	router.GET("/api/blocks/range", getBlockRange(l))
+	router.GET("/api/headers", getHeaders(l))
 	router.GET("/api/transactions", getTxPool(p))
 	router.POST("/api/transactions", addTx(p, wal, c, l))
-	router.GET("/api/address/:address", getAddressInfo(l, cal))
+	router.GET("/api/transactions/:id/proof", getTxProof(l))
+	if hd != nil {
+		router.POST("/api/hdwallet/transactions", addHDTx(p, hd, c, l))
+	}
+	router.GET("/api/address/:address", getAddressInfo(cal))
+	router.POST("/api/multisig", createMultisigAddress())
+	router.POST("/api/multisig/transactions", addMultisigTx(p, mp, wal, c, l, cal))
+	router.GET("/api/multisig/transactions/:id", getMultisigTx(mp))
+	router.POST("/api/multisig/transactions/:id/signatures", cosignMultisigTx(p, mp, wal, c))
+	router.GET("/api/work", getWork(ws))
+	router.GET("/api/work/:id", getWorkStatus(ws))
+	router.POST("/api/work", submitWork(ws))
 
 	return router
 }
@@ -35,6 +61,81 @@ func getBlocks(l listing.Service) func(w http.ResponseWriter, r *http.Request, _
 	}
 }
 
+func getHeaders(l listing.Service) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		start, limit, err := parseRange(r, maxHeadersPerRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// a locator finds the fork point with the caller's chain, start is ignored then
+		var headers []listing.Header
+		if locator := r.URL.Query().Get("locator"); len(locator) != 0 {
+			hashes := strings.Split(locator, ",")
+			if len(hashes) > maxLocatorHashes {
+				http.Error(w, fmt.Sprintf("Locator has more than %d hashes", maxLocatorHashes), http.StatusBadRequest)
+				return
+			}
+			headers = l.GetHeadersAfter(hashes, limit)
+		} else {
+			headers = l.GetHeaders(start, limit)
+		}
+		if headers == nil {
+			headers = []listing.Header{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(headers)
+	}
+}
+
+func getBlockRange(l listing.Service) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		start, limit, err := parseRange(r, maxBlocksPerRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		blocks := l.GetBlockRange(start, limit)
+		if blocks == nil {
+			blocks = []listing.Block{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocks)
+	}
+}
+
+// parseRange reads start height and limit query params, limit defaults to and is capped at maxLimit
+func parseRange(r *http.Request, maxLimit uint32) (uint32, uint32, error) {
+	query := r.URL.Query()
+
+	var start uint64
+	if len(query.Get("start")) != 0 {
+		var err error
+		start, err = strconv.ParseUint(query.Get("start"), 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid start=%s", query.Get("start"))
+		}
+	}
+
+	limit := uint64(maxLimit)
+	if len(query.Get("limit")) != 0 {
+		var err error
+		limit, err = strconv.ParseUint(query.Get("limit"), 10, 32)
+		if err != nil || limit == 0 {
+			return 0, 0, fmt.Errorf("Invalid limit=%s", query.Get("limit"))
+		}
+	}
+	if limit > uint64(maxLimit) {
+		limit = uint64(maxLimit)
+	}
+
+	return uint32(start), uint32(limit), nil
+}
+
 func mineBlock(m mining.Service, l listing.Service, c pubsub.Service) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		decoder := json.NewDecoder(r.Body)
@@ -50,6 +151,7 @@ func mineBlock(m mining.Service, l listing.Service, c pubsub.Service) func(w htt
 		mb := &mining.Block{
 			Timestamp:  lb.Timestamp,
 			LastHash:   lb.LastHash,
+			MerkleRoot: lb.MerkleRoot,
 			Hash:       lb.Hash,
 			Data:       toMiningTransactions(lb.Data),
 			Nonce:      lb.Nonce,
@@ -57,16 +159,17 @@ func mineBlock(m mining.Service, l listing.Service, c pubsub.Service) func(w htt
 		}
 		newBlock, err := m.MineNewBlock(mb, []mining.Transaction{transaction})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = m.AddBlock(newBlock)
+		// the block carries a transaction from the request, so it goes through the same validation as a peer's block
+		err = m.AcceptBlock(newBlock)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err, http.StatusInternalServerError)
 			return
 		}
 
-		c.BroadcastBlockchain(l.GetBlockchain())
+		c.BroadcastBlock(newBlock)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(l.GetLastBlock())
@@ -83,8 +186,10 @@ func toMiningTransactions(data []listing.Transaction) []mining.Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toMiningInputs(transaction.ExtraInputs),
 		})
 	}
 	return mTxs
@@ -93,6 +198,10 @@ func toMiningTransactions(data []listing.Transaction) []mining.Transaction {
 type addTxInput struct {
 	Receiver string `json:"receiver"`
 	Amount   uint64 `json:"amount"`
+	// Fee is only set on new transactions, appending to a pooled transaction keeps its fee
+	Fee uint64 `json:"fee"`
+	// Separate creates a transaction after the pooled ones of the node wallet with the next nonce instead of appending to them
+	Separate bool `json:"separate"`
 }
 
 func addTx(p wallet.TransactionPool, wal wallet.Wallet, c pubsub.Service, lister listing.Service) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -106,13 +215,58 @@ func addTx(p wallet.TransactionPool, wal wallet.Wallet, c pubsub.Service, lister
 			return
 		}
 
+		if err := crypto.ValidateAddress(ati.Receiver); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid receiver address %s, %v", ati.Receiver, err), http.StatusBadRequest)
+			return
+		}
+
 		var tx wallet.Transaction
-		if p.Exists(wal.PubKeyHex()) {
-			tx = p.GetTransaction(wal.PubKeyHex())
+		if pooled := p.LastTransaction(wal.Address()); pooled != nil && ati.Separate {
+			tx, err = wallet.NewNextTransaction(wal, pooled, ati.Receiver, ati.Amount, ati.Fee)
+		} else if p.Exists(wal.Address()) {
+			tx = p.GetTransaction(wal.Address())
 			err = tx.Append(wal, ati.Receiver, ati.Amount)
 		} else {
-			tx, err = wal.CreateTransaction(ati.Receiver, ati.Amount, lister)
+			tx, err = wal.CreateTransaction(ati.Receiver, ati.Amount, ati.Fee)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.Add(tx)
+		c.BroadcastTransaction(tx)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tx)
+	}
+}
+
+// addHDTx creates a transaction spending from as many addresses of the HD wallet as it takes, with their balances as of the main chain
+func addHDTx(p wallet.TransactionPool, hd wallet.HDWallet, c pubsub.Service, lister listing.Service) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		decoder := json.NewDecoder(r.Body)
+
+		var ati addTxInput
+		err := decoder.Decode(&ati)
+		if err != nil || len(ati.Receiver) == 0 || ati.Amount <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid input err=%s, receiver=%s, amount=%d", err, ati.Receiver, ati.Amount), http.StatusBadRequest)
+			return
+		}
+
+		if err := crypto.ValidateAddress(ati.Receiver); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid receiver address %s, %v", ati.Receiver, err), http.StatusBadRequest)
+			return
+		}
+
+		// pooled transactions of the addresses would spend the same balances
+		for _, address := range hd.Addresses() {
+			if p.LastTransaction(address) != nil {
+				http.Error(w, fmt.Sprintf("Address %s has a pooled transaction, Wait until it is in a block", address), http.StatusConflict)
+				return
+			}
 		}
+
+		tx, err := hd.CreateTransaction(ati.Receiver, ati.Amount, ati.Fee)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -125,6 +279,217 @@ func addTx(p wallet.TransactionPool, wal wallet.Wallet, c pubsub.Service, lister
 	}
 }
 
+type createMultisigInput struct {
+	Required int `json:"required"`
+	// PubKeys are public keys in hex
+	PubKeys []string `json:"pubKeys"`
+}
+
+// MultisigAddress is return result from createMultisigAddress
+type MultisigAddress struct {
+	Address string `json:"address"`
+	// Script is the hex of the script co-signers need to spend from address
+	Script string `json:"script"`
+}
+
+func createMultisigAddress() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		decoder := json.NewDecoder(r.Body)
+
+		var cmi createMultisigInput
+		if err := decoder.Decode(&cmi); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var pubKeys [][]byte
+		for _, pubKeyHex := range cmi.PubKeys {
+			pubKey, err := hex.DecodeString(pubKeyHex)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid public key %s", pubKeyHex), http.StatusBadRequest)
+				return
+			}
+			pubKeys = append(pubKeys, pubKey)
+		}
+
+		script, err := crypto.NewMultisigScript(cmi.Required, pubKeys)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MultisigAddress{Address: script.Address(), Script: hex.EncodeToString(script.Bytes())})
+	}
+}
+
+type addMultisigTxInput struct {
+	// Script is the hex of the script of the multisig address to spend from
+	Script   string `json:"script"`
+	Receiver string `json:"receiver"`
+	Amount   uint64 `json:"amount"`
+	Fee      uint64 `json:"fee"`
+	// Sign adds the signature of the node wallet, it has to be one of the keys of the script
+	Sign bool `json:"sign"`
+}
+
+// MultisigTransaction is return result of multisig transaction actions
+type MultisigTransaction struct {
+	Transaction wallet.Transaction `json:"transaction"`
+	// SigningBytes is the hex of what co-signers sign
+	SigningBytes string `json:"signingBytes"`
+	Signatures   int    `json:"signatures"`
+	Required     int    `json:"required"`
+}
+
+// addMultisigTx creates a transaction spending from a multisig address, the node wallet only signs it when asked to
+func addMultisigTx(p wallet.TransactionPool, mp wallet.TransactionPool, wal wallet.Wallet, c pubsub.Service, lister listing.Service, cal calculating.Service) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		decoder := json.NewDecoder(r.Body)
+
+		var amti addMultisigTxInput
+		err := decoder.Decode(&amti)
+		if err != nil || len(amti.Receiver) == 0 || amti.Amount <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid input err=%s, receiver=%s, amount=%d", err, amti.Receiver, amti.Amount), http.StatusBadRequest)
+			return
+		}
+
+		if err := crypto.ValidateAddress(amti.Receiver); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid receiver address %s, %v", amti.Receiver, err), http.StatusBadRequest)
+			return
+		}
+
+		scriptBytes, err := hex.DecodeString(amti.Script)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid script %s", amti.Script), http.StatusBadRequest)
+			return
+		}
+		script, err := crypto.ParseMultisigScript(scriptBytes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := wallet.NewMultisigTransaction(script, cal, amti.Receiver, amti.Amount, amti.Fee)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if amti.Sign {
+			tx, err = wallet.Cosign(tx, wal)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		collectMultisigTx(w, tx, p, mp, c)
+	}
+}
+
+func getMultisigTx(mp wallet.TransactionPool) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		tx := mp.Get(p.ByName("id"))
+		if tx == nil {
+			http.Error(w, "Multisig transaction not found", http.StatusNotFound)
+			return
+		}
+
+		writeMultisigTx(w, tx)
+	}
+}
+
+// cosignInput carries either a co-signer signature or a request for the node wallet to sign
+type cosignInput struct {
+	// Signature is the hex of a co-signer signature over the signing bytes
+	Signature string `json:"signature"`
+	Sign      bool   `json:"sign"`
+}
+
+func cosignMultisigTx(p wallet.TransactionPool, mp wallet.TransactionPool, wal wallet.Wallet, c pubsub.Service) func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		tx := mp.Get(params.ByName("id"))
+		if tx == nil {
+			http.Error(w, "Multisig transaction not found", http.StatusNotFound)
+			return
+		}
+
+		var ci cosignInput
+		if err := json.NewDecoder(r.Body).Decode(&ci); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ci.Sign == (len(ci.Signature) != 0) {
+			http.Error(w, "Either a signature or sign is required", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if ci.Sign {
+			tx, err = wallet.Cosign(tx, wal)
+		} else {
+			signature, decodeErr := hex.DecodeString(ci.Signature)
+			if decodeErr != nil {
+				http.Error(w, fmt.Sprintf("Invalid signature %s", ci.Signature), http.StatusBadRequest)
+				return
+			}
+			tx, err = wallet.AddSignature(tx, signature)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collectMultisigTx(w, tx, p, mp, c)
+	}
+}
+
+// collectMultisigTx keeps tx in mp until it has the signatures it requires, then it is moved to p and broadcast
+func collectMultisigTx(w http.ResponseWriter, tx wallet.Transaction, p wallet.TransactionPool, mp wallet.TransactionPool, c pubsub.Service) {
+	if signed, required, err := wallet.Signatures(tx); err == nil && signed >= required {
+		mp.Remove(tx.GetID())
+		p.Add(tx)
+		c.BroadcastTransaction(tx)
+	} else {
+		mp.Add(tx)
+	}
+
+	writeMultisigTx(w, tx)
+}
+
+func writeMultisigTx(w http.ResponseWriter, tx wallet.Transaction) {
+	signed, required, err := wallet.Signatures(tx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultisigTransaction{
+		Transaction:  tx,
+		SigningBytes: hex.EncodeToString(wallet.SigningBytes(tx)),
+		Signatures:   signed,
+		Required:     required,
+	})
+}
+
+func getTxProof(l listing.Service) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		proof, err := l.GetTransactionProof(p.ByName("id"))
+		if err == listing.ErrTransactionNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proof)
+	}
+}
+
 func getTxPool(p wallet.TransactionPool) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		output := make(map[string]wallet.Transaction)
@@ -140,9 +505,10 @@ func getTxPool(p wallet.TransactionPool) func(w http.ResponseWriter, r *http.Req
 
 func mineTransactions(miner miner.Miner, lister listing.Service) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		err := miner.Mine()
+		_, err := miner.Mine(r.Context())
 		if err != nil {
 			log.Printf("Failed to mine, %v", err)
+			writeError(w, err, http.StatusInternalServerError)
 			return
 		}
 
@@ -151,19 +517,88 @@ func mineTransactions(miner miner.Miner, lister listing.Service) func(w http.Res
 	}
 }
 
-// AddressInfo is return result from getAddressInfo
+func getWork(ws miner.WorkServer) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		work, err := ws.GetWork()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(work)
+	}
+}
+
+// WorkStatus is return result from getWorkStatus
+type WorkStatus struct {
+	ID      string `json:"id"`
+	Current bool   `json:"current"`
+}
+
+// getWorkStatus tells a worker whether it should keep working on a template, it responds 410 once the template is stale
+func getWorkStatus(ws miner.WorkServer) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		status := WorkStatus{ID: p.ByName("id"), Current: ws.IsCurrent(p.ByName("id"))}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Current {
+			w.WriteHeader(http.StatusGone)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+func submitWork(ws miner.WorkServer) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		decoder := json.NewDecoder(r.Body)
+
+		var solution miner.Solution
+		err := decoder.Decode(&solution)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		block, err := ws.SubmitWork(solution)
+		if err == miner.ErrStaleWork {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err == miner.ErrInvalidWork {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(block)
+	}
+}
+
+// AddressInfo is return result from getAddressInfo, Balance is SpendableBalance plus ImmatureBalance
 type AddressInfo struct {
-	Address string `json:"address"`
-	Balance uint64 `json:"balance"`
+	Address          string `json:"address"`
+	Balance          uint64 `json:"balance"`
+	SpendableBalance uint64 `json:"spendableBalance"`
+	// ImmatureBalance is made of mining rewards that are not CoinbaseMaturity blocks deep yet
+	ImmatureBalance uint64 `json:"immatureBalance"`
 }
 
-func getAddressInfo(lister listing.Service, cal calculating.Service) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func getAddressInfo(cal calculating.Service) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		pubKeyHex := p.ByName("address")
 
 		addressInfo := AddressInfo{
-			Address: pubKeyHex,
-			Balance: cal.Balance(pubKeyHex, toCalculatingBlockchain(lister.GetBlockchain())),
+			Address:         pubKeyHex,
+			Balance:         cal.CurrentBalance(pubKeyHex),
+			ImmatureBalance: cal.CurrentImmatureBalance(pubKeyHex),
+		}
+		if addressInfo.ImmatureBalance < addressInfo.Balance {
+			addressInfo.SpendableBalance = addressInfo.Balance - addressInfo.ImmatureBalance
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -171,37 +606,35 @@ func getAddressInfo(lister listing.Service, cal calculating.Service) func(w http
 	}
 }
 
-func toCalculatingBlockchain(bc *listing.Blockchain) *calculating.Blockchain {
-	if bc == nil {
-		return nil
-	}
+// Rejection is returned when blocks break a consensus rule
+type Rejection struct {
+	Message string `json:"message"`
+	*validating.ValidationError
+}
 
-	result := &calculating.Blockchain{}
-	for _, block := range bc.Chain {
-		cTransactions := []calculating.Transaction{}
-		for _, transaction := range block.Data {
-			cTx := calculating.Transaction{
-				ID:     transaction.ID,
-				Output: transaction.Output,
-				Input: calculating.Input{
-					Timestamp: transaction.Input.Timestamp,
-					Amount:    transaction.Input.Amount,
-					Address:   transaction.Input.Address,
-					Signature: transaction.Input.Signature,
-				},
-			}
-			cTransactions = append(cTransactions, cTx)
-		}
-		cBlock := calculating.Block{
-			Timestamp:  block.Timestamp,
-			LastHash:   block.LastHash,
-			Hash:       block.Hash,
-			Data:       cTransactions,
-			Nonce:      block.Nonce,
-			Difficulty: block.Difficulty,
-		}
-		result.Chain = append(result.Chain, cBlock)
+// writeError responds with err, a validation error is responded in JSON so the caller sees which block broke which rule
+func writeError(w http.ResponseWriter, err error, status int) {
+	vErr, ok := err.(*validating.ValidationError)
+	if !ok {
+		http.Error(w, err.Error(), status)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(Rejection{Message: vErr.Error(), ValidationError: vErr})
+}
+
+func toMiningInputs(inputs []listing.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
 	return result
 }
@@ -0,0 +1,226 @@
+package rest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandler_Multisig(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	node := wallet.NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	bob := wallet.NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	carol := wallet.NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	script, _ := crypto.NewMultisigScript(2, [][]byte{node.PubKey(), bob.PubKey(), carol.PubKey()})
+	var mockedPubSub *MockedPubSub
+	var pool wallet.TransactionPool
+	var multisigPool wallet.TransactionPool
+	var handler http.Handler
+
+	type multisigTx struct {
+		Transaction wallet.Tx `json:"transaction"`
+		Signatures  int       `json:"signatures"`
+	}
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	// create posts a new multisig transaction and returns it as responded
+	create := func(body string) (*httptest.ResponseRecorder, multisigTx) {
+		recorder := post("/api/multisig/transactions", body)
+		var mtx multisigTx
+		json.NewDecoder(recorder.Body).Decode(&mtx)
+		return recorder, mtx
+	}
+
+	beforeEach := func() {
+		mockedCalculating := new(MockedCalculating)
+		mockedCalculating.On("CurrentBalance", script.Address()).Return(uint64(1000))
+		mockedCalculating.On("CurrentImmatureBalance", script.Address()).Return(uint64(0))
+		mockedCalculating.On("CurrentNonce", script.Address()).Return(uint64(0))
+		mockedListing := new(MockedListing)
+		mockedListing.On("GetBlockchain").Return(&listing.Blockchain{})
+		mockedPubSub = new(MockedPubSub)
+		mockedPubSub.On("BroadcastTransaction", mock.Anything).Return(nil)
+		pool = wallet.NewTransactionPool(mockedListing)
+		multisigPool = wallet.NewTransactionPool(mockedListing)
+		handler = Handler(mockedListing, nil, mockedPubSub, pool, multisigPool, node, nil, mockedCalculating, nil)
+	}
+
+	newTxBody := `{"script":"` + hex.EncodeToString(script.Bytes()) + `","receiver":"` + bob.Address() + `","amount":10,"fee":1`
+
+	t.Run("creates multisig transaction without signing it with node wallet", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		recorder, mtx := create(newTxBody + `}`)
+
+		// test verification
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(0, mtx.Signatures)
+		signed, _, _ := wallet.Signatures(multisigPool.Get(mtx.Transaction.ID))
+		assert.Equal(0, signed)
+	})
+
+	t.Run("signs new multisig transaction with node wallet when asked to", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		recorder, mtx := create(newTxBody + `,"sign":true}`)
+
+		// test verification
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(1, mtx.Signatures)
+	})
+
+	t.Run("requires either a signature or sign to co-sign", func(t *testing.T) {
+		beforeEach()
+		_, mtx := create(newTxBody + `}`)
+		path := "/api/multisig/transactions/" + mtx.Transaction.ID + "/signatures"
+		signature := hex.EncodeToString(bob.Sign(wallet.SigningBytes(multisigPool.Get(mtx.Transaction.ID))))
+
+		// perform test
+		emptyBody := post(path, "")
+		emptyObject := post(path, `{}`)
+		both := post(path, `{"sign":true,"signature":"`+signature+`"}`)
+
+		// test verification
+		assert.Equal(http.StatusBadRequest, emptyBody.Code)
+		assert.Equal(http.StatusBadRequest, emptyObject.Code)
+		assert.Equal(http.StatusBadRequest, both.Code)
+		signed, _, _ := wallet.Signatures(multisigPool.Get(mtx.Transaction.ID))
+		assert.Equal(0, signed)
+	})
+
+	t.Run("co-signs with node wallet and given signature until transaction goes to pool", func(t *testing.T) {
+		beforeEach()
+		_, mtx := create(newTxBody + `}`)
+		path := "/api/multisig/transactions/" + mtx.Transaction.ID + "/signatures"
+		signature := hex.EncodeToString(bob.Sign(wallet.SigningBytes(multisigPool.Get(mtx.Transaction.ID))))
+
+		// perform test
+		nodeSigned := post(path, `{"sign":true}`)
+		inPoolAfterOne := pool.Get(mtx.Transaction.ID)
+		bobSigned := post(path, `{"signature":"`+signature+`"}`)
+
+		// test verification
+		assert.Equal(http.StatusOK, nodeSigned.Code)
+		assert.Equal(http.StatusOK, bobSigned.Code)
+		assert.Nil(inPoolAfterOne)
+		assert.NotNil(pool.Get(mtx.Transaction.ID))
+		assert.Nil(multisigPool.Get(mtx.Transaction.ID))
+		mockedPubSub.AssertNumberOfCalls(t, "BroadcastTransaction", 1)
+	})
+}
+
+func TestHandler_Transactions(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	seed, _ := wallet.MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	receiver := wallet.NewWallet(secp256k1, new(MockedCalculating), 0, nil, "").Address()
+	var mockedCalculating *MockedCalculating
+	var mockedListing *MockedListing
+	var pool wallet.TransactionPool
+	var node wallet.Wallet
+	var hd wallet.HDWallet
+
+	post := func(handler http.Handler, path string, body string) (*httptest.ResponseRecorder, wallet.Tx) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		var tx wallet.Tx
+		json.NewDecoder(recorder.Body).Decode(&tx)
+		return recorder, tx
+	}
+
+	beforeEach := func() {
+		mockedCalculating = new(MockedCalculating)
+		mockedCalculating.On("CurrentBalance", mock.Anything).Return(uint64(1000))
+		mockedCalculating.On("CurrentImmatureBalance", mock.Anything).Return(uint64(0))
+		mockedCalculating.On("CurrentNonce", mock.Anything).Return(uint64(3))
+		mockedCalculating.On("CurrentHasTransactions", mock.Anything).Return(true)
+		mockedListing = new(MockedListing)
+		mockedListing.On("GetBlockchain").Return(&listing.Blockchain{})
+		pool = wallet.NewTransactionPool(mockedListing)
+		node = wallet.NewWallet(secp256k1, mockedCalculating, 0, nil, "")
+		hd, _ = wallet.NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		hd.NextAddress()
+		hd.NextAddress()
+	}
+
+	newHandler := func(hd wallet.HDWallet) http.Handler {
+		mockedPubSub := new(MockedPubSub)
+		mockedPubSub.On("BroadcastTransaction", mock.Anything).Return(nil)
+		return Handler(mockedListing, nil, mockedPubSub, pool, nil, node, hd, mockedCalculating, nil)
+	}
+
+	t.Run("appends to pooled transaction of node wallet unless asked for a separate one", func(t *testing.T) {
+		beforeEach()
+		handler := newHandler(nil)
+		_, first := post(handler, "/api/transactions", `{"receiver":"`+receiver+`","amount":100,"fee":10}`)
+
+		// perform test
+		_, appended := post(handler, "/api/transactions", `{"receiver":"`+receiver+`","amount":50}`)
+		recorder, next := post(handler, "/api/transactions", `{"receiver":"`+receiver+`","amount":20,"fee":5,"separate":true}`)
+
+		// test verification
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(first.ID, appended.ID)
+		assert.Len(pool.All(), 2)
+		assert.Equal(uint64(3), pool.Get(first.ID).GetInput().Nonce)
+		assert.Equal(uint64(4), next.Input.Nonce)
+		assert.Equal(uint64(840), next.Input.Amount)
+		assert.Equal(wallet.Output{receiver: 20, node.Address(): 815}, next.Output)
+	})
+
+	t.Run("sends from several addresses of HD wallet", func(t *testing.T) {
+		beforeEach()
+		handler := newHandler(hd)
+
+		// perform test
+		recorder, tx := post(handler, "/api/hdwallet/transactions", `{"receiver":"`+receiver+`","amount":1500,"fee":10}`)
+
+		// test verification
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(hd.Addresses()[0], tx.Input.Address)
+		assert.Len(tx.ExtraInputs, 1)
+		assert.Equal(hd.Addresses()[1], tx.ExtraInputs[0].Address)
+		assert.NotNil(pool.Get(tx.ID))
+	})
+
+	t.Run("refuses HD wallet transaction while one of its addresses has a pooled transaction", func(t *testing.T) {
+		beforeEach()
+		handler := newHandler(hd)
+		post(handler, "/api/hdwallet/transactions", `{"receiver":"`+receiver+`","amount":1500,"fee":10}`)
+
+		// perform test
+		recorder, _ := post(handler, "/api/hdwallet/transactions", `{"receiver":"`+receiver+`","amount":100,"fee":10}`)
+
+		// test verification
+		assert.Equal(http.StatusConflict, recorder.Code)
+		assert.Len(pool.All(), 1)
+	})
+
+	t.Run("has no HD wallet route without HD wallet", func(t *testing.T) {
+		beforeEach()
+		handler := newHandler(nil)
+
+		// perform test
+		recorder, _ := post(handler, "/api/hdwallet/transactions", `{"receiver":"`+receiver+`","amount":100,"fee":10}`)
+
+		// test verification
+		assert.Equal(http.StatusNotFound, recorder.Code)
+	})
+}
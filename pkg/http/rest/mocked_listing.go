@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"math/big"
+
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockedListing is a mocked object that implememnts listing.Service
+type MockedListing struct {
+	mock.Mock
+}
+
+// GetLastBlock adds mined block to blockchain
+func (m *MockedListing) GetLastBlock() listing.Block {
+	args := m.Called()
+	return args.Get(0).(listing.Block)
+}
+
+// GetBlockCount returns the latest block count in blockchain
+func (m *MockedListing) GetBlockCount() uint32 {
+	args := m.Called()
+	return uint32(args.Int(0))
+}
+
+// GetBlockchain returns a list of blocks from genesis block
+func (m *MockedListing) GetBlockchain() *listing.Blockchain {
+	args := m.Called()
+	return args.Get(0).(*listing.Blockchain)
+}
+
+// GetBlockByHash returns the block with given hash
+func (m *MockedListing) GetBlockByHash(hash string) *listing.Block {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*listing.Block)
+}
+
+// GetBlockRange returns main chain blocks starting at given height
+func (m *MockedListing) GetBlockRange(start uint32, limit uint32) []listing.Block {
+	args := m.Called(start, limit)
+	return args.Get(0).([]listing.Block)
+}
+
+// GetChainWork returns the cumulative work of the main chain
+func (m *MockedListing) GetChainWork() *big.Int {
+	args := m.Called()
+	return args.Get(0).(*big.Int)
+}
+
+// GetChainWorkAt returns the cumulative work of the chain ending at block with given hash
+func (m *MockedListing) GetChainWorkAt(hash string) *big.Int {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*big.Int)
+}
+
+// GetMainChainHeight returns the height of block with given hash on the main chain
+func (m *MockedListing) GetMainChainHeight(hash string) (uint32, bool) {
+	args := m.Called(hash)
+	return args.Get(0).(uint32), args.Bool(1)
+}
+
+// GetLocator returns main chain hashes from tip to genesis
+func (m *MockedListing) GetLocator() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+// GetHeadersAfter returns main chain block headers following the latest locator hash on the main chain
+func (m *MockedListing) GetHeadersAfter(locator []string, limit uint32) []listing.Header {
+	args := m.Called(locator, limit)
+	return args.Get(0).([]listing.Header)
+}
+
+// GetHeaders returns main chain block headers starting at given height
+func (m *MockedListing) GetHeaders(start uint32, limit uint32) []listing.Header {
+	args := m.Called(start, limit)
+	return args.Get(0).([]listing.Header)
+}
+
+// GetTransactionProof returns the merkle inclusion proof of the transaction with given id
+func (m *MockedListing) GetTransactionProof(txID string) (*listing.TransactionProof, error) {
+	args := m.Called(txID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*listing.TransactionProof), args.Error(1)
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockedPubSub is a mocked object that implements pubsub.Service
+type MockedPubSub struct {
+	mock.Mock
+}
+
+// Connect connects to peers
+func (m *MockedPubSub) Connect() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// Disconnect disconnects from peers
+func (m *MockedPubSub) Disconnect() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// SubscribePeers starts receiving messages from peers
+func (m *MockedPubSub) SubscribePeers() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// BroadcastBlockchain broadcasts blockchain to peers
+func (m *MockedPubSub) BroadcastBlockchain(bc *listing.Blockchain) error {
+	args := m.Called(bc)
+	return args.Error(0)
+}
+
+// BroadcastBlock broadcasts a newly mined block to peers
+func (m *MockedPubSub) BroadcastBlock(b *mining.Block) error {
+	args := m.Called(b)
+	return args.Error(0)
+}
+
+// BroadcastTransaction broadcasts transaction to peers
+func (m *MockedPubSub) BroadcastTransaction(tx wallet.Transaction) error {
+	args := m.Called(tx)
+	return args.Error(0)
+}
@@ -5,22 +5,36 @@ type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
 // Transaction in block data
 type Transaction struct {
-	ID     string            `json:"id"`
-	Input  Input             `json:"input"`
-	Output map[string]uint64 `json:"output"`
+	ID          string            `json:"id"`
+	Input       Input             `json:"input"`
+	ExtraInputs []Input           `json:"extraInputs,omitempty"`
+	Output      map[string]uint64 `json:"output"`
 }
 
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   *string       `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       *string       `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
 	Difficulty uint32        `json:"difficulty"`
 }
+
+// Header is a block without its transaction data
+type Header struct {
+	Height     uint32  `json:"height"`
+	Timestamp  int64   `json:"timestamp"`
+	LastHash   *string `json:"lastHash"`
+	MerkleRoot string  `json:"merkleRoot"`
+	Hash       *string `json:"hash"`
+	Nonce      uint32  `json:"nonce"`
+	Difficulty uint32  `json:"difficulty"`
+}
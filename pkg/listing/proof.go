@@ -0,0 +1,84 @@
+package listing
+
+import (
+	"errors"
+
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
+// proofScanBatch is the number of blocks read at once while looking up a transaction
+const proofScanBatch uint32 = 100
+
+// ErrTransactionNotFound is used when no main chain block contains the transaction
+var ErrTransactionNotFound = errors.New("Transaction is not found in blockchain")
+
+// TransactionProof shows that a transaction is committed to by the merkle root of a main chain block header
+type TransactionProof struct {
+	Transaction Transaction          `json:"transaction"`
+	BlockHash   string               `json:"blockHash"`
+	Height      uint32               `json:"height"`
+	MerkleRoot  string               `json:"merkleRoot"`
+	Proof       []hashing.MerkleStep `json:"proof"`
+}
+
+// GetTransactionProof returns the merkle inclusion proof of the main chain transaction with given id, newest blocks are searched first
+func (s *service) GetTransactionProof(txID string) (*TransactionProof, error) {
+	for end := s.r.GetBlockCount(); end > 0; {
+		start := uint32(0)
+		if end > proofScanBatch {
+			start = end - proofScanBatch
+		}
+
+		blocks := s.r.GetBlockRange(start, end-start)
+		for i := len(blocks) - 1; i >= 0; i-- {
+			for j, tx := range blocks[i].Data {
+				if tx.ID == txID {
+					return newTransactionProof(blocks[i], start+uint32(i), j), nil
+				}
+			}
+		}
+		end = start
+	}
+
+	return nil, ErrTransactionNotFound
+}
+
+func newTransactionProof(block Block, height uint32, index int) *TransactionProof {
+	var hTxs []hashing.Tx
+	for _, tx := range block.Data {
+		hTxs = append(hTxs, hashing.Tx{
+			ID:     tx.ID,
+			Output: tx.Output,
+			Input: hashing.TxInput{
+				Timestamp: tx.Input.Timestamp,
+				Amount:    tx.Input.Amount,
+				Address:   tx.Input.Address,
+				Nonce:     tx.Input.Nonce,
+				Signature: tx.Input.Signature,
+			},
+			ExtraInputs: toHashingTxInputs(tx.ExtraInputs),
+		})
+	}
+
+	return &TransactionProof{
+		Transaction: block.Data[index],
+		BlockHash:   *block.Hash,
+		Height:      height,
+		MerkleRoot:  block.MerkleRoot,
+		Proof:       hashing.MerkleProof(hTxs, index),
+	}
+}
+
+func toHashingTxInputs(inputs []Input) []hashing.TxInput {
+	var result []hashing.TxInput
+	for _, input := range inputs {
+		result = append(result, hashing.TxInput{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
@@ -1,17 +1,36 @@
 package listing
 
+import "math/big"
+
 // Repository provides access to the blockchain
 type Repository interface {
 	GetLastBlock() Block
 	GetBlockCount() uint32
 	GetBlockchain() *Blockchain
+	GetBlockByHash(hash string) *Block
+	GetBlockRange(start uint32, limit uint32) []Block
+	GetChainWork() *big.Int
+	GetChainWorkAt(hash string) *big.Int
+	GetMainChainHeight(hash string) (uint32, bool)
 }
 
+// maxLocatorDense is the number of latest main chain hashes a locator lists before it starts skipping blocks
+const maxLocatorDense = 10
+
 // Service provides block listing operations
 type Service interface {
 	GetLastBlock() Block
 	GetBlockCount() uint32
 	GetBlockchain() *Blockchain
+	GetBlockByHash(hash string) *Block
+	GetBlockRange(start uint32, limit uint32) []Block
+	GetChainWork() *big.Int
+	GetChainWorkAt(hash string) *big.Int
+	GetMainChainHeight(hash string) (uint32, bool)
+	GetLocator() []string
+	GetHeaders(start uint32, limit uint32) []Header
+	GetHeadersAfter(locator []string, limit uint32) []Header
+	GetTransactionProof(txID string) (*TransactionProof, error)
 }
 
 type service struct {
@@ -37,3 +56,81 @@ func (s *service) GetBlockCount() uint32 {
 func (s *service) GetBlockchain() *Blockchain {
 	return s.r.GetBlockchain()
 }
+
+// GetBlockByHash returns the block with given hash from main chain or side branches, nil if not found
+func (s *service) GetBlockByHash(hash string) *Block {
+	return s.r.GetBlockByHash(hash)
+}
+
+// GetBlockRange returns up to limit main chain blocks starting at height start
+func (s *service) GetBlockRange(start uint32, limit uint32) []Block {
+	return s.r.GetBlockRange(start, limit)
+}
+
+// GetChainWork returns the cumulative work of the main chain up to its tip
+func (s *service) GetChainWork() *big.Int {
+	return s.r.GetChainWork()
+}
+
+// GetChainWorkAt returns the cumulative work of the chain ending at block with given hash, nil if not found
+func (s *service) GetChainWorkAt(hash string) *big.Int {
+	return s.r.GetChainWorkAt(hash)
+}
+
+// GetMainChainHeight returns the height of block with given hash, false if it is not on the main chain
+func (s *service) GetMainChainHeight(hash string) (uint32, bool) {
+	return s.r.GetMainChainHeight(hash)
+}
+
+// GetLocator returns main chain hashes from tip to genesis, the latest ones in full then with doubling gaps,
+// so a peer finds the fork point with its own chain in a single round trip
+func (s *service) GetLocator() []string {
+	count := s.r.GetBlockCount()
+	if count == 0 {
+		return nil
+	}
+
+	var hashes []string
+	step := uint32(1)
+	for height := count - 1; ; height -= step {
+		hashes = append(hashes, *s.r.GetBlockRange(height, 1)[0].Hash)
+		if len(hashes) >= maxLocatorDense {
+			step *= 2
+		}
+		if height < step {
+			break
+		}
+	}
+	if genesis := *s.r.GetBlockRange(0, 1)[0].Hash; hashes[len(hashes)-1] != genesis {
+		hashes = append(hashes, genesis)
+	}
+	return hashes
+}
+
+// GetHeadersAfter returns up to limit main chain block headers following the latest locator hash on the main chain,
+// from genesis when none of them is
+func (s *service) GetHeadersAfter(locator []string, limit uint32) []Header {
+	for _, hash := range locator {
+		if height, ok := s.r.GetMainChainHeight(hash); ok {
+			return s.GetHeaders(height+1, limit)
+		}
+	}
+	return s.GetHeaders(0, limit)
+}
+
+// GetHeaders returns up to limit main chain block headers starting at height start
+func (s *service) GetHeaders(start uint32, limit uint32) []Header {
+	var headers []Header
+	for i, block := range s.r.GetBlockRange(start, limit) {
+		headers = append(headers, Header{
+			Height:     start + uint32(i),
+			Timestamp:  block.Timestamp,
+			LastHash:   block.LastHash,
+			MerkleRoot: block.MerkleRoot,
+			Hash:       block.Hash,
+			Nonce:      block.Nonce,
+			Difficulty: block.Difficulty,
+		})
+	}
+	return headers
+}
@@ -1,17 +1,32 @@
 package miner
 
 import (
+	"context"
+	"errors"
 	"log"
+	"time"
 
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
 	"github.com/knd/kndchain/pkg/networking/pubsub"
 	"github.com/knd/kndchain/pkg/wallet"
 )
 
+// ErrStaleTip is used when the chain tip moves while mining, the block should be mined again on the new tip
+var ErrStaleTip = errors.New("Chain tip moved while mining")
+
+// tipPollInterval is how often the chain tip is checked while mining
+const tipPollInterval = 200 * time.Millisecond
+
+// blockOverhead is room kept in a block for its header and transaction count,
+// a header holds two hex hashes and fixed width numbers so it is well under this
+const blockOverhead = 256
+
 // Miner provides entry to mining actions
 type Miner interface {
-	Mine() error
+	Mine(ctx context.Context) (*mining.Block, error)
 }
 
 type miner struct {
@@ -22,53 +37,101 @@ type miner struct {
 	comm                 pubsub.Service
 	rewardTxInputAddress string
 	rewardAmount         uint64
+	params               consensus.Params
 }
 
 // NewMiner creates a miner with necessary dependencies
-func NewMiner(s mining.Service, l listing.Service, p wallet.TransactionPool, w wallet.Wallet, c pubsub.Service, rewardTxInputAddress string, rewardAmount uint64) Miner {
-	return &miner{s, l, p, w, c, rewardTxInputAddress, rewardAmount}
+func NewMiner(s mining.Service, l listing.Service, p wallet.TransactionPool, w wallet.Wallet, c pubsub.Service, rewardTxInputAddress string, rewardAmount uint64, params consensus.Params) Miner {
+	return &miner{s, l, p, w, c, rewardTxInputAddress, rewardAmount, params}
 }
 
-func (m *miner) Mine() error {
-	validTransactions := m.transactionPool.ValidTransactions()
-	rewardTransaction, _ := wallet.CreateRewardTransaction(m.wal, m.rewardTxInputAddress, m.rewardAmount)
-
-	validTransactions = append(validTransactions, rewardTransaction)
-
+// Mine mines a block of pool transactions on the chain tip, it stops with ErrStaleTip if the tip moves meanwhile.
+// The mined block is returned once it is added, along with any error broadcasting it or clearing the pool.
+func (m *miner) Mine(ctx context.Context) (*mining.Block, error) {
 	lastBlock := m.lister.GetLastBlock()
-	mb := &mining.Block{
-		Timestamp:  lastBlock.Timestamp,
-		LastHash:   lastBlock.LastHash,
-		Hash:       lastBlock.Hash,
-		Data:       fromListingtoMiningTransactions(lastBlock.Data),
-		Nonce:      lastBlock.Nonce,
-		Difficulty: lastBlock.Difficulty,
+	mineCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go m.watchTip(mineCtx, *lastBlock.Hash, stop)
+
+	minedBlock, err := m.service.MineBlock(mineCtx, fromListingToMiningBlock(lastBlock), m.blockTransactions())
+	if err != nil && ctx.Err() == nil && mineCtx.Err() != nil {
+		return nil, ErrStaleTip
 	}
-	minedBlock, err := m.service.MineNewBlock(mb, fromPooltoMiningTransactions(validTransactions))
 	if err != nil {
 		log.Printf("Failed to create mined block: %s", err.Error())
-		return err
+		return nil, err
 	}
+	log.Printf("Mined block at %.0f hashes/s", m.service.HashRate())
 
-	err = m.service.AddBlock(minedBlock)
+	// the block is validated like a peer's block, so the chain is not extended by a block peers reject
+	err = m.service.AcceptBlock(minedBlock)
 	if err != nil {
 		log.Printf("Failed to add block to chain: %s", err.Error())
-		return err
+		return nil, err
 	}
 
-	err = m.comm.BroadcastBlockchain(m.lister.GetBlockchain())
+	err = m.comm.BroadcastBlock(minedBlock)
 	if err != nil {
-		log.Printf("Failed to broadcast blockchain: %s", err.Error())
-		return err
+		log.Printf("Failed to broadcast block: %s", err.Error())
+		return minedBlock, err
 	}
 
-	err = m.transactionPool.Clear()
+	// transactions left out of the template stay in the pool for the next block
+	err = m.transactionPool.ClearBlockTransactions()
 	if err != nil {
 		log.Printf("Failed to clear transaction pool: %s", err.Error())
-		return err
+		return minedBlock, err
 	}
 
-	return nil
+	return minedBlock, nil
+}
+
+// blockTransactions returns the reward transaction claiming the fees of the pool transactions that fit in a block
+// followed by them. The reward comes first, so its merkle branch stays the same whatever extra nonce it carries.
+func (m *miner) blockTransactions() []mining.Transaction {
+	// the reward transaction encodes to the same size whatever it claims, so room is kept for it up front
+	rewardTransaction, _ := wallet.CreateRewardTransaction(m.wal, m.rewardTxInputAddress, m.rewardAmount)
+	validTransactions := m.transactionPool.BlockTemplate(
+		m.params.MaxBlockSize-blockOverhead-wallet.Size(rewardTransaction),
+		m.params.MaxBlockTransactions-1)
+
+	var fees uint64
+	for _, tx := range validTransactions {
+		fees += wallet.Fee(tx)
+	}
+	rewardTransaction, _ = wallet.CreateRewardTransaction(m.wal, m.rewardTxInputAddress, m.rewardAmount+fees)
+
+	return fromPooltoMiningTransactions(append([]wallet.Transaction{rewardTransaction}, validTransactions...))
+}
+
+// watchTip calls stale once the chain tip is no longer tipHash
+func (m *miner) watchTip(ctx context.Context, tipHash string, stale func()) {
+	ticker := time.NewTicker(tipPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if lastBlock := m.lister.GetLastBlock(); lastBlock.Hash != nil && *lastBlock.Hash != tipHash {
+				stale()
+				return
+			}
+		}
+	}
+}
+
+func fromListingToMiningBlock(lastBlock listing.Block) *mining.Block {
+	return &mining.Block{
+		Timestamp:  lastBlock.Timestamp,
+		LastHash:   lastBlock.LastHash,
+		MerkleRoot: lastBlock.MerkleRoot,
+		Hash:       lastBlock.Hash,
+		Data:       fromListingtoMiningTransactions(lastBlock.Data),
+		Nonce:      lastBlock.Nonce,
+		Difficulty: lastBlock.Difficulty,
+	}
 }
 
 func fromListingtoMiningTransactions(data []listing.Transaction) []mining.Transaction {
@@ -81,8 +144,10 @@ func fromListingtoMiningTransactions(data []listing.Transaction) []mining.Transa
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: fromListingtoMiningInputs(transaction.ExtraInputs),
 		})
 	}
 	return mTxs
@@ -98,9 +163,70 @@ func fromPooltoMiningTransactions(data []wallet.Transaction) []mining.Transactio
 				Timestamp: transaction.GetInput().Timestamp,
 				Amount:    transaction.GetInput().Amount,
 				Address:   transaction.GetInput().Address,
+				Nonce:     transaction.GetInput().Nonce,
 				Signature: transaction.GetInput().Signature,
 			},
+			ExtraInputs: fromPooltoMiningInputs(transaction.GetExtraInputs()),
 		})
 	}
 	return mTxs
 }
+
+func fromListingtoMiningInputs(inputs []listing.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func fromPooltoMiningInputs(inputs []wallet.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toHashingTxs(data []mining.Transaction) []hashing.Tx {
+	var hTxs []hashing.Tx
+	for _, transaction := range data {
+		hTxs = append(hTxs, hashing.Tx{
+			ID:          transaction.ID,
+			Output:      transaction.Output,
+			Input:       toHashingInput(transaction.Input),
+			ExtraInputs: toHashingInputs(transaction.ExtraInputs),
+		})
+	}
+	return hTxs
+}
+
+func toHashingInputs(inputs []mining.Input) []hashing.TxInput {
+	var result []hashing.TxInput
+	for _, input := range inputs {
+		result = append(result, toHashingInput(input))
+	}
+	return result
+}
+
+func toHashingInput(input mining.Input) hashing.TxInput {
+	return hashing.TxInput{
+		Timestamp: input.Timestamp,
+		Amount:    input.Amount,
+		Address:   input.Address,
+		Nonce:     input.Nonce,
+		Signature: input.Signature,
+	}
+}
@@ -0,0 +1,70 @@
+package miner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/validating"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMiner_Mine(t *testing.T) {
+	assert := assert.New(t)
+	minerWallet := wallet.NewWallet(crypto.NewSecp256k1Generator(), nil, 0, nil, "")
+	tipHash := "0x001"
+	minedHash := "0x002"
+	minedBlock := &mining.Block{Timestamp: 2, LastHash: &tipHash, Hash: &minedHash, Difficulty: 4}
+	var mockedMining *MockedMining
+	var mockedListing *MockedListing
+	var mockedPubSub *MockedPubSub
+	var m Miner
+
+	beforeEach := func() {
+		mockedListing = new(MockedListing)
+		mockedListing.On("GetLastBlock").Return(listing.Block{Hash: &tipHash, LastHash: &tipHash})
+		mockedListing.On("GetBlockchain").Return(&listing.Blockchain{})
+		mockedMining = new(MockedMining)
+		mockedMining.On("MineBlock", mock.Anything, mock.Anything, mock.Anything).Return(minedBlock, nil)
+		mockedMining.On("HashRate").Return(float64(1))
+		mockedPubSub = new(MockedPubSub)
+		mockedPubSub.On("BroadcastBlock", mock.Anything).Return(nil)
+		pool := wallet.NewTransactionPool(mockedListing)
+		m = NewMiner(mockedMining, mockedListing, pool, minerWallet, mockedPubSub, "MINER_REWARD", 5, consensus.DefaultParams())
+	}
+
+	t.Run("validates and broadcasts mined block", func(t *testing.T) {
+		beforeEach()
+		mockedMining.On("AcceptBlock", mock.Anything).Return(nil)
+
+		// perform test
+		block, err := m.Mine(context.Background())
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(minedBlock, block)
+		mockedMining.AssertCalled(t, "AcceptBlock", minedBlock)
+		mockedMining.AssertNotCalled(t, "AddBlock", mock.Anything)
+		mockedPubSub.AssertCalled(t, "BroadcastBlock", minedBlock)
+	})
+
+	t.Run("neither adds nor broadcasts mined block that fails validation", func(t *testing.T) {
+		beforeEach()
+		invalid := &validating.ValidationError{Reason: validating.ReasonInvalidNonce}
+		mockedMining.On("AcceptBlock", mock.Anything).Return(invalid)
+
+		// perform test
+		block, err := m.Mine(context.Background())
+
+		// test verification
+		assert.Equal(invalid, err)
+		assert.Nil(block)
+		mockedMining.AssertNotCalled(t, "AddBlock", mock.Anything)
+		mockedPubSub.AssertNotCalled(t, "BroadcastBlock", mock.Anything)
+	})
+}
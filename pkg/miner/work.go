@@ -0,0 +1,253 @@
+package miner
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/hashing"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/networking/pubsub"
+	"github.com/knd/kndchain/pkg/validating"
+	"github.com/knd/kndchain/pkg/wallet"
+)
+
+// ErrStaleWork is used when work is submitted for a template that is unknown or no longer on the chain tip
+var ErrStaleWork = errors.New("Work is stale, Chain tip moved or template is unknown")
+
+// ErrInvalidWork is used when submitted work does not meet the difficulty of its template
+var ErrInvalidWork = errors.New("Work does not meet template difficulty")
+
+const (
+	// nonceRange is the number of nonces handed out with every piece of work
+	nonceRange uint32 = 1 << 26
+	// templateRefreshInterval is how long a template is handed out before one with newer pool transactions is made
+	templateRefreshInterval = 30 * time.Second
+)
+
+// Work is a block header template for an external worker to find a nonce for.
+// The worker hashes the header with every nonce from NonceStart to NonceEnd and submits one that gives Difficulty leading zero bits.
+// Nonce ranges of the same template never overlap, so workers can share it.
+//
+// Once its nonce range is tried, a worker goes on with the next extra nonce instead of asking for new work.
+// The extra nonce is the input nonce of the reward transaction, which spends from no account, and it changes the
+// merkle root MerkleRootAt returns. Workers keep their own nonce ranges, so they never hash the same header.
+type Work struct {
+	ID         string `json:"id"`
+	Timestamp  int64  `json:"timestamp"`
+	LastHash   string `json:"lastHash"`
+	MerkleRoot string `json:"merkleRoot"`
+	Difficulty uint32 `json:"difficulty"`
+	NonceStart uint32 `json:"nonceStart"`
+	NonceEnd   uint32 `json:"nonceEnd"`
+	// RewardTx is the canonical encoding of the reward transaction with extra nonce 0, the first transaction of the block
+	RewardTx []byte `json:"rewardTx"`
+	// MerkleBranch holds the sibling hashes from the reward transaction up to the merkle root
+	MerkleBranch []hashing.MerkleStep `json:"merkleBranch"`
+}
+
+// MerkleRootAt returns the merkle root of the template with given extra nonce, MerkleRoot being the one of extra nonce 0
+func (w *Work) MerkleRootAt(extraNonce uint64) (string, error) {
+	reward, err := hashing.DecodeTransaction(w.RewardTx)
+	if err != nil {
+		return "", err
+	}
+	return merkleRootAt(reward, w.MerkleBranch, extraNonce)
+}
+
+// merkleRootAt returns the merkle root branch leads to from reward carrying extraNonce
+func merkleRootAt(reward hashing.Tx, branch []hashing.MerkleStep, extraNonce uint64) (string, error) {
+	reward.Input.Nonce = extraNonce
+	root, ok := hashing.MerkleRootFromProof(reward, branch)
+	if !ok {
+		return "", ErrInvalidWork
+	}
+	return root, nil
+}
+
+// Solution is a nonce found by an external worker for a template
+type Solution struct {
+	ID         string `json:"id"`
+	Nonce      uint32 `json:"nonce"`
+	ExtraNonce uint64 `json:"extraNonce"`
+}
+
+// WorkServer hands out block templates to external workers and adds the blocks they solve
+type WorkServer interface {
+	GetWork() (*Work, error)
+	IsCurrent(id string) bool
+	SubmitWork(solution Solution) (*mining.Block, error)
+}
+
+type template struct {
+	id    string
+	block *mining.Block
+	// reward is the first transaction of block, branch leads from it to the merkle root
+	reward    hashing.Tx
+	branch    []hashing.MerkleStep
+	createdAt time.Time
+	// nextNonce is the start of the next nonce range to hand out
+	nextNonce uint32
+	exhausted bool
+}
+
+type workServer struct {
+	*miner
+
+	mu        sync.Mutex
+	sequence  uint64
+	tipHash   string
+	current   *template
+	templates map[string]*template
+}
+
+// NewWorkServer creates a work server with necessary dependencies, solved blocks claim the reward like blocks of Miner
+func NewWorkServer(s mining.Service, l listing.Service, p wallet.TransactionPool, w wallet.Wallet, c pubsub.Service, rewardTxInputAddress string, rewardAmount uint64, params consensus.Params) WorkServer {
+	return &workServer{
+		miner:     &miner{s, l, p, w, c, rewardTxInputAddress, rewardAmount, params},
+		templates: make(map[string]*template),
+	}
+}
+
+// GetWork returns the next nonce range of the current template, a new template is made when the tip moves,
+// the current one runs out of nonces or is old enough to miss pool transactions
+func (ws *workServer) GetWork() (*Work, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	lastBlock := ws.lister.GetLastBlock()
+	if lastBlock.Hash == nil {
+		return nil, mining.ErrMissingLastBlock
+	}
+	if *lastBlock.Hash != ws.tipHash {
+		// templates on an old tip can never be added
+		ws.tipHash = *lastBlock.Hash
+		ws.current = nil
+		ws.templates = make(map[string]*template)
+	}
+	if ws.current == nil || ws.current.exhausted || time.Since(ws.current.createdAt) > templateRefreshInterval {
+		if err := ws.newTemplate(lastBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	t := ws.current
+	work := &Work{
+		ID:           t.id,
+		Timestamp:    t.block.Timestamp,
+		LastHash:     *t.block.LastHash,
+		MerkleRoot:   t.block.MerkleRoot,
+		Difficulty:   t.block.Difficulty,
+		NonceStart:   t.nextNonce,
+		NonceEnd:     t.nextNonce + nonceRange - 1,
+		RewardTx:     hashing.EncodeTransaction(t.reward),
+		MerkleBranch: t.branch,
+	}
+	if t.nextNonce > math.MaxUint32-nonceRange {
+		work.NonceEnd = math.MaxUint32
+		t.exhausted = true
+	} else {
+		t.nextNonce += nonceRange
+	}
+	return work, nil
+}
+
+// newTemplate makes the current template a block of pool transactions on lastBlock
+func (ws *workServer) newTemplate(lastBlock listing.Block) error {
+	// a newer template never shares its timestamp with an older one, so the same header is not handed out twice
+	timestamp := time.Now().UnixNano()
+	if ws.current != nil && timestamp <= ws.current.block.Timestamp {
+		timestamp = ws.current.block.Timestamp + 1
+	}
+
+	block, err := ws.service.BlockTemplate(fromListingToMiningBlock(lastBlock), ws.blockTransactions(), timestamp)
+	if err != nil {
+		log.Printf("WorkServer#GetWork: Failed to create block template, %v", err)
+		return err
+	}
+
+	txs := toHashingTxs(block.Data)
+	ws.sequence++
+	ws.current = &template{
+		id:        strconv.FormatUint(ws.sequence, 10),
+		block:     block,
+		reward:    txs[0],
+		branch:    hashing.MerkleProof(txs, 0),
+		createdAt: time.Now(),
+	}
+	ws.templates[ws.current.id] = ws.current
+	return nil
+}
+
+// IsCurrent returns true if work of the template with given id may still be submitted
+func (ws *workServer) IsCurrent(id string) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	_, ok := ws.templates[id]
+	return ok && ws.isOnTip()
+}
+
+func (ws *workServer) isOnTip() bool {
+	lastBlock := ws.lister.GetLastBlock()
+	return lastBlock.Hash != nil && *lastBlock.Hash == ws.tipHash
+}
+
+// SubmitWork adds and broadcasts the block of a template solved with given nonce and extra nonce
+func (ws *workServer) SubmitWork(solution Solution) (*mining.Block, error) {
+	ws.mu.Lock()
+	t, ok := ws.templates[solution.ID]
+	if !ok || !ws.isOnTip() {
+		ws.mu.Unlock()
+		return nil, ErrStaleWork
+	}
+	block := *t.block
+	block.Data = append([]mining.Transaction{}, t.block.Data...)
+	ws.mu.Unlock()
+
+	merkleRoot, err := merkleRootAt(t.reward, t.branch, solution.ExtraNonce)
+	if err != nil {
+		return nil, err
+	}
+	block.Data[0].Input.Nonce = solution.ExtraNonce
+	block.MerkleRoot = merkleRoot
+	block.Nonce = solution.Nonce
+	hash := hashing.BlockHash(hashing.Block{
+		Timestamp:  block.Timestamp,
+		LastHash:   *block.LastHash,
+		MerkleRoot: block.MerkleRoot,
+		Nonce:      block.Nonce,
+		Difficulty: block.Difficulty,
+	})
+	if !validating.HasProofOfWork(hash, block.Difficulty) {
+		return nil, ErrInvalidWork
+	}
+	block.Hash = &hash
+
+	// the block went through an external worker, so it is validated like a peer's block
+	err = ws.service.AcceptBlock(&block)
+	if err != nil {
+		log.Printf("WorkServer#SubmitWork: Failed to add block to chain, %v", err)
+		return nil, err
+	}
+	log.Printf("Worker solved block %s", hash)
+
+	err = ws.comm.BroadcastBlock(&block)
+	if err != nil {
+		log.Printf("WorkServer#SubmitWork: Failed to broadcast block, %v", err)
+		return nil, err
+	}
+
+	err = ws.transactionPool.ClearBlockTransactions()
+	if err != nil {
+		log.Printf("WorkServer#SubmitWork: Failed to clear transaction pool, %v", err)
+		return nil, err
+	}
+
+	return &block, nil
+}
@@ -0,0 +1,205 @@
+package miner
+
+import (
+	"math"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/knd/kndchain/pkg/hashing"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/validating"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWorkServer(t *testing.T) {
+	assert := assert.New(t)
+	minerWallet := wallet.NewWallet(crypto.NewSecp256k1Generator(), nil, 0, nil, "")
+	tipHash := "0x001"
+	var mockedMining *MockedMining
+	var mockedPubSub *MockedPubSub
+	var ws *workServer
+
+	// listingAt returns a listing whose chain tip is hash
+	listingAt := func(hash string) *MockedListing {
+		mockedListing := new(MockedListing)
+		mockedListing.On("GetLastBlock").Return(listing.Block{Hash: &hash, LastHash: &hash})
+		mockedListing.On("GetBlockchain").Return(&listing.Blockchain{})
+		return mockedListing
+	}
+
+	templateData := []mining.Transaction{
+		{ID: "reward", Input: mining.Input{Address: "MINER_REWARD"}, Output: map[string]uint64{minerWallet.Address(): 5}},
+		{ID: "tx", Input: mining.Input{Address: "alice", Nonce: 3}, Output: map[string]uint64{"bob": 1}},
+	}
+	templateBlock := mining.Block{Timestamp: 1, LastHash: &tipHash, MerkleRoot: hashing.MerkleRoot(toHashingTxs(templateData)), Data: templateData, Difficulty: 4}
+
+	// merkleRootWith returns the merkle root of templateBlock with extraNonce in its reward transaction
+	merkleRootWith := func(extraNonce uint64) string {
+		txs := toHashingTxs(templateData)
+		txs[0].Input.Nonce = extraNonce
+		return hashing.MerkleRoot(txs)
+	}
+
+	// findNonce returns the first nonce that gives templateBlock with merkleRoot a hash meeting its difficulty or not
+	findNonce := func(merkleRoot string, meetsDifficulty bool) uint32 {
+		for nonce := uint32(0); ; nonce++ {
+			hash := hashing.BlockHash(hashing.Block{
+				Timestamp:  templateBlock.Timestamp,
+				LastHash:   *templateBlock.LastHash,
+				MerkleRoot: merkleRoot,
+				Nonce:      nonce,
+				Difficulty: templateBlock.Difficulty,
+			})
+			if validating.HasProofOfWork(hash, templateBlock.Difficulty) == meetsDifficulty {
+				return nonce
+			}
+		}
+	}
+
+	beforeEach := func() {
+		mockedListing := listingAt(tipHash)
+		mockedMining = new(MockedMining)
+		mockedMining.On("BlockTemplate", mock.Anything, mock.Anything, mock.Anything).Return(&templateBlock, nil)
+		mockedMining.On("AcceptBlock", mock.Anything).Return(nil)
+		mockedPubSub = new(MockedPubSub)
+		mockedPubSub.On("BroadcastBlock", mock.Anything).Return(nil)
+		pool := wallet.NewTransactionPool(mockedListing)
+		ws = NewWorkServer(mockedMining, mockedListing, pool, minerWallet, mockedPubSub, "MINER_REWARD", 5, consensus.DefaultParams()).(*workServer)
+	}
+
+	t.Run("hands out consecutive nonce ranges of one template", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		first, _ := ws.GetWork()
+		second, _ := ws.GetWork()
+
+		// test verification
+		assert.Equal(first.ID, second.ID)
+		assert.Equal(uint32(0), first.NonceStart)
+		assert.Equal(nonceRange-1, first.NonceEnd)
+		assert.Equal(nonceRange, second.NonceStart)
+		assert.Equal(2*nonceRange-1, second.NonceEnd)
+		assert.Equal(tipHash, first.LastHash)
+		mockedMining.AssertNumberOfCalls(t, "BlockTemplate", 1)
+	})
+
+	t.Run("makes a new template once nonces of the current one run out", func(t *testing.T) {
+		beforeEach()
+		var last *Work
+		for i := uint64(0); i < (math.MaxUint32+1)/uint64(nonceRange); i++ {
+			last, _ = ws.GetWork()
+		}
+
+		// perform test
+		next, err := ws.GetWork()
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(uint32(math.MaxUint32), last.NonceEnd)
+		assert.NotEqual(last.ID, next.ID)
+		assert.Equal(uint32(0), next.NonceStart)
+		assert.True(ws.IsCurrent(last.ID))
+		mockedMining.AssertNumberOfCalls(t, "BlockTemplate", 2)
+	})
+
+	t.Run("drops templates of the old tip when tip moves", func(t *testing.T) {
+		beforeEach()
+		old, _ := ws.GetWork()
+		ws.lister = listingAt("0x002")
+
+		// perform test
+		staleBeforeNewWork := ws.IsCurrent(old.ID)
+		next, _ := ws.GetWork()
+
+		// test verification
+		assert.False(staleBeforeNewWork)
+		assert.NotEqual(old.ID, next.ID)
+		assert.False(ws.IsCurrent(old.ID))
+		assert.True(ws.IsCurrent(next.ID))
+		assert.Len(ws.templates, 1)
+	})
+
+	t.Run("hands out reward transaction and merkle branch to roll extra nonce with", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		work, _ := ws.GetWork()
+		rootAtZero, errAtZero := work.MerkleRootAt(0)
+		rootAtSeven, errAtSeven := work.MerkleRootAt(7)
+
+		// test verification
+		assert.NoError(errAtZero)
+		assert.NoError(errAtSeven)
+		assert.Equal(work.MerkleRoot, rootAtZero)
+		assert.Equal(merkleRootWith(7), rootAtSeven)
+		assert.NotEqual(work.MerkleRoot, rootAtSeven)
+	})
+
+	t.Run("returns error without last block", func(t *testing.T) {
+		beforeEach()
+		mockedListing := new(MockedListing)
+		mockedListing.On("GetLastBlock").Return(listing.Block{})
+		ws.lister = mockedListing
+
+		// perform test
+		_, err := ws.GetWork()
+
+		// test verification
+		assert.Equal(mining.ErrMissingLastBlock, err)
+	})
+
+	submitTests := []struct {
+		name string
+		// unknown submits for a template that was never handed out
+		unknown    bool
+		tipMoved   bool
+		validWork  bool
+		extraNonce uint64
+		err        error
+	}{
+		{name: "adds and broadcasts block solved with nonce meeting difficulty", validWork: true},
+		{name: "adds block solved with extra nonce in its reward transaction", validWork: true, extraNonce: 7},
+		{name: "returns ErrInvalidWork for nonce missing difficulty with extra nonce", extraNonce: 7, err: ErrInvalidWork},
+		{name: "returns ErrInvalidWork for nonce missing difficulty", err: ErrInvalidWork},
+		{name: "returns ErrStaleWork for unknown template", unknown: true, validWork: true, err: ErrStaleWork},
+		{name: "returns ErrStaleWork once tip moved", tipMoved: true, validWork: true, err: ErrStaleWork},
+	}
+	for _, test := range submitTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			beforeEach()
+			work, _ := ws.GetWork()
+			solution := Solution{ID: work.ID, Nonce: findNonce(merkleRootWith(test.extraNonce), test.validWork), ExtraNonce: test.extraNonce}
+			if test.unknown {
+				solution.ID = "0"
+			}
+			if test.tipMoved {
+				ws.lister = listingAt("0x002")
+			}
+
+			// perform test
+			block, err := ws.SubmitWork(solution)
+
+			// test verification
+			assert.Equal(test.err, err)
+			if test.err != nil {
+				assert.Nil(block)
+				mockedMining.AssertNotCalled(t, "AcceptBlock", mock.Anything)
+				mockedPubSub.AssertNotCalled(t, "BroadcastBlock", mock.Anything)
+				return
+			}
+			assert.Equal(solution.Nonce, block.Nonce)
+			assert.Equal(test.extraNonce, block.Data[0].Input.Nonce)
+			assert.Equal(merkleRootWith(test.extraNonce), block.MerkleRoot)
+			assert.True(validating.HasProofOfWork(*block.Hash, block.Difficulty))
+			assert.Equal(uint64(0), templateData[0].Input.Nonce)
+			mockedMining.AssertCalled(t, "AcceptBlock", block)
+			mockedPubSub.AssertCalled(t, "BroadcastBlock", block)
+		})
+	}
+}
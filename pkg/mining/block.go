@@ -1,11 +1,142 @@
 package mining
 
+import (
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   *string       `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       *string       `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
 	Difficulty uint32        `json:"difficulty"`
 }
+
+// MarshalBinary returns the canonical encoding of block, its hash is recomputed on decoding
+func (b *Block) MarshalBinary() ([]byte, error) {
+	return hashing.EncodeBlock(hashing.Block{
+		Timestamp:  b.Timestamp,
+		LastHash:   *b.LastHash,
+		MerkleRoot: b.MerkleRoot,
+		Data:       toHashingTxs(b.Data),
+		Nonce:      b.Nonce,
+		Difficulty: b.Difficulty,
+	}), nil
+}
+
+// UnmarshalBinary parses the canonical encoding of a block and sets its hash
+func (b *Block) UnmarshalBinary(data []byte) error {
+	hBlock, err := hashing.DecodeBlock(data)
+	if err != nil {
+		return err
+	}
+
+	var txs []Transaction
+	for _, hTx := range hBlock.Data {
+		txs = append(txs, Transaction{
+			ID:     hTx.ID,
+			Output: hTx.Output,
+			Input: Input{
+				Timestamp: hTx.Input.Timestamp,
+				Amount:    hTx.Input.Amount,
+				Address:   hTx.Input.Address,
+				Nonce:     hTx.Input.Nonce,
+				Signature: hTx.Input.Signature,
+			},
+			ExtraInputs: fromHashingTxInputs(hTx.ExtraInputs),
+		})
+	}
+
+	hash := hashing.BlockHash(hBlock)
+	*b = Block{
+		Timestamp:  hBlock.Timestamp,
+		LastHash:   &hBlock.LastHash,
+		MerkleRoot: hBlock.MerkleRoot,
+		Hash:       &hash,
+		Data:       txs,
+		Nonce:      hBlock.Nonce,
+		Difficulty: hBlock.Difficulty,
+	}
+	return nil
+}
+
+// HeaderHash returns the hash of the block header. It is the block hash of every block but the genesis block,
+// whose hash is given by config.
+func (b *Block) HeaderHash() string {
+	return hashBlock(b.Timestamp, *b.LastHash, b.MerkleRoot, b.Nonce, b.Difficulty)
+}
+
+// hashBlock returns the hash of the block header, data is committed to by merkleRoot
+func hashBlock(timestamp int64, lastHash string, merkleRoot string, nonce uint32, difficulty uint32) string {
+	return hashing.BlockHash(hashing.Block{
+		Timestamp:  timestamp,
+		LastHash:   lastHash,
+		MerkleRoot: merkleRoot,
+		Nonce:      nonce,
+		Difficulty: difficulty,
+	})
+}
+
+func merkleRoot(data []Transaction) string {
+	return hashing.MerkleRoot(toHashingTxs(data))
+}
+
+func toHashingTxs(data []Transaction) []hashing.Tx {
+	var hTxs []hashing.Tx
+	for _, transaction := range data {
+		hTxs = append(hTxs, hashing.Tx{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: hashing.TxInput{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: toHashingTxInputs(transaction.ExtraInputs),
+		})
+	}
+	return hTxs
+}
+
+// toConsensusHeaders returns the headers retargeting looks at of consecutive blocks starting at given height
+func toConsensusHeaders(blocks []Block, height uint32) []consensus.Header {
+	headers := make([]consensus.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = consensus.Header{Height: height + uint32(i), Timestamp: block.Timestamp, Difficulty: block.Difficulty}
+	}
+	return headers
+}
+
+func fromHashingTxInputs(inputs []hashing.TxInput) []Input {
+	var result []Input
+	for _, input := range inputs {
+		result = append(result, Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toHashingTxInputs(inputs []Input) []hashing.TxInput {
+	var result []hashing.TxInput
+	for _, input := range inputs {
+		result = append(result, hashing.TxInput{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
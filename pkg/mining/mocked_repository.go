@@ -1,6 +1,7 @@
 package mining
 
 import (
+	"github.com/knd/kndchain/pkg/calculating"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -20,3 +21,12 @@ func (m *MockedRepository) ReplaceChain(newChain *Blockchain) error {
 	args := m.Called(newChain)
 	return args.Error(0)
 }
+
+// GetAccountsAt returns the account states as of the block with given hash
+func (m *MockedRepository) GetAccountsAt(hash string) func(address string) calculating.Account {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(func(address string) calculating.Account)
+}
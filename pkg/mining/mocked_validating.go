@@ -11,7 +11,19 @@ type MockedValidating struct {
 }
 
 // IsValidChain returns true if list of blocks compose valid blockchain
-func (m *MockedValidating) IsValidChain(bc *validating.Blockchain) bool {
+func (m *MockedValidating) IsValidChain(bc *validating.Blockchain) (bool, error) {
+	args := m.Called(bc)
+	return args.Bool(0), args.Error(1)
+}
+
+// IsValidExtension returns true if new blocks of ext compose valid chain on top of its parents
+func (m *MockedValidating) IsValidExtension(ext *validating.Extension) (bool, error) {
+	args := m.Called(ext)
+	return args.Bool(0), args.Error(1)
+}
+
+// IsHeavierChain returns true if blockchain has more cumulative work than the local chain
+func (m *MockedValidating) IsHeavierChain(bc *validating.Blockchain) bool {
 	args := m.Called(bc)
 	return args.Bool(0)
 }
@@ -21,3 +33,9 @@ func (m *MockedValidating) ContainsValidTransactions(bc *validating.Blockchain)
 	args := m.Called(bc)
 	return args.Bool(0), args.Error(1)
 }
+
+// ContainsValidExtensionTransactions returns true if new blocks of ext contain valid transactions
+func (m *MockedValidating) ContainsValidExtensionTransactions(ext *validating.Extension) (bool, error) {
+	args := m.Called(ext)
+	return args.Bool(0), args.Error(1)
+}
@@ -0,0 +1,51 @@
+package mining
+
+import "sync"
+
+// maxOrphans limits the number of blocks parked while waiting for their parent
+const maxOrphans = 512
+
+// orphanPool parks blocks received before their parent, they are validated like any received block once the parent is accepted
+type orphanPool struct {
+	blocks map[string][]Block
+	count  int
+	mutex  *sync.Mutex
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks: make(map[string][]Block),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// add parks a block until its parent is accepted
+func (p *orphanPool) add(block Block) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.count >= maxOrphans || block.Hash == nil || block.LastHash == nil {
+		return
+	}
+
+	for _, orphan := range p.blocks[*block.LastHash] {
+		if *orphan.Hash == *block.Hash {
+			return
+		}
+	}
+
+	p.blocks[*block.LastHash] = append(p.blocks[*block.LastHash], block)
+	p.count++
+}
+
+// take removes and returns parked blocks whose parent has given hash
+func (p *orphanPool) take(parentHash string) []Block {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	orphans := p.blocks[parentHash]
+	delete(p.blocks, parentHash)
+	p.count -= len(orphans)
+
+	return orphans
+}
@@ -0,0 +1,38 @@
+package mining
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanPool(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("parks orphans until parent is taken", func(t *testing.T) {
+		pool := newOrphanPool()
+		lastHash, hash := "c1", "c2"
+		orphan := Block{LastHash: &lastHash, Hash: &hash}
+
+		// perform test
+		pool.add(orphan)
+		pool.add(orphan)
+
+		// test verification
+		assert.Empty(pool.take("a2"))
+		assert.Equal([]Block{orphan}, pool.take("c1"))
+		assert.Empty(pool.take("c1"))
+	})
+
+	t.Run("drops orphans beyond limit", func(t *testing.T) {
+		pool := newOrphanPool()
+		lastHash := "c1"
+		for i := 0; i <= maxOrphans; i++ {
+			hash := string(rune(i))
+			pool.add(Block{LastHash: &lastHash, Hash: &hash})
+		}
+
+		// perform test & verification
+		assert.Len(pool.take("c1"), maxOrphans)
+	})
+}
@@ -1,19 +1,25 @@
 package mining
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"log"
-	"strconv"
-	"strings"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
 	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/validating"
 )
 
+// hashBatch is the number of nonces a mining worker tries between checks for cancellation
+const hashBatch = 1 << 12
+
 // ErrMissingLastBlock is used when new block is not provided last block hash
 var ErrMissingLastBlock = errors.New("Missing last block")
 
@@ -23,13 +29,24 @@ var ErrInvalidChain = errors.New("Invalid chain is given to replace original cha
 // ErrInvalidTransactions is used when trying to replace chain with invalid transactions
 var ErrInvalidTransactions = errors.New("Invalid transactions")
 
-// ErrShorterChain is used when trying to replace a shorter chain
-var ErrShorterChain = errors.New("Current chain is the longest, Incoming chain is no longer, No replacement")
+// ErrInsufficientChainWork is used when trying to replace with a chain that has no more cumulative work
+var ErrInsufficientChainWork = errors.New("Current chain has the most work, Incoming chain has no more work, No replacement")
+
+// ErrOrphanBlock is used when the parent of a block is not known yet
+var ErrOrphanBlock = errors.New("Parent block is unknown, Block is parked as orphan")
+
+// ErrKnownBlock is used when a received block is already in the block tree
+var ErrKnownBlock = errors.New("Block is already known")
 
 // Service provides block creating operations
 type Service interface {
 	MineNewBlock(lastBlock *Block, data []Transaction) (*Block, error)
+	MineBlock(ctx context.Context, lastBlock *Block, data []Transaction) (*Block, error)
+	HashRate() float64
+	BlockTemplate(lastBlock *Block, data []Transaction, timestamp int64) (*Block, error)
 	AddBlock(minedBlock *Block) error
+	AcceptBlock(receivedBlock *Block) error
+	AcceptBlocks(receivedBlocks []Block) error
 	ReplaceChain(newChain *Blockchain) error
 }
 
@@ -38,73 +55,264 @@ type Repository interface {
 	// AddBlock adds a minedBlock into blockchain
 	AddBlock(minedBlock *Block) error
 	ReplaceChain(newChain *Blockchain) error
+	// GetAccountsAt returns the account states as of the block with given hash, nil if the block is unknown
+	GetAccountsAt(hash string) func(address string) calculating.Account
 }
 
 type service struct {
 	blockchain Repository
 	listing    listing.Service
 	validating validating.Service
-	MineRate   int64
+	params     consensus.Params
+	workers    int
+	orphans    *orphanPool
+
+	mu       sync.Mutex
+	hashRate float64
 }
 
-// NewService creates a creating service with necessary dependencies
-func NewService(r Repository, l listing.Service, v validating.Service, mineRate int64) Service {
-	return &service{r, l, v, mineRate}
+// NewService creates a creating service with necessary dependencies, blocks are mined by the given number of worker goroutines
+func NewService(r Repository, l listing.Service, v validating.Service, params consensus.Params, workers int) Service {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &service{
+		blockchain: r,
+		listing:    l,
+		validating: v,
+		params:     params,
+		workers:    workers,
+		orphans:    newOrphanPool(),
+	}
 }
 
 // CreateGenesisBlock returns the genesis block created from config
 func CreateGenesisBlock(genesisLastHash string, genesisHash string, genesisDifficulty uint32, genesisNonce uint32) (*Block, error) {
 	data := []Transaction{}
 
-	return yieldBlock(time.Now().UnixNano(), &genesisLastHash, &genesisHash, data, genesisNonce, genesisDifficulty), nil
+	return yieldBlock(time.Now().UnixNano(), &genesisLastHash, merkleRoot(data), &genesisHash, data, genesisNonce, genesisDifficulty), nil
 }
 
-func adjustBlockDifficulty(lastBlock Block, blockTimestamp int64, mineRate int64) uint32 {
-	if (blockTimestamp - lastBlock.Timestamp) < (time.Duration(mineRate) * time.Millisecond).Nanoseconds() {
-		return lastBlock.Difficulty + 1
-	} else if (blockTimestamp - lastBlock.Timestamp) > (time.Duration(mineRate) * time.Millisecond).Nanoseconds() {
-		if lastBlock.Difficulty <= 1 {
-			return 1
-		}
-		return lastBlock.Difficulty - 1
+// MineNewBlock returns a new block
+func (s *service) MineNewBlock(lastBlock *Block, data []Transaction) (*Block, error) {
+	return s.MineBlock(context.Background(), lastBlock, data)
+}
+
+// MineBlock returns a new block on lastBlock, workers try every workers-th nonce each and roll the timestamp when they run out of nonces.
+// It stops with ctx.Err() when ctx is done before a block is found, e.g. because a new tip arrived.
+func (s *service) MineBlock(ctx context.Context, lastBlock *Block, data []Transaction) (*Block, error) {
+	// validations
+	if lastBlock == nil {
+		return nil, ErrMissingLastBlock
+	}
+
+	retargeter, err := s.params.Retargeter()
+	if err != nil {
+		return nil, err
+	}
+	parents := s.parentHeaders(lastBlock, retargeter.Window())
+	if parents == nil {
+		return nil, ErrMissingLastBlock
+	}
+
+	root := merkleRoot(data)
+	workCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// buffered so a worker never blocks on finding a block after another one did
+	found := make(chan *Block, s.workers)
+	var hashes uint64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func(first uint32) {
+			defer wg.Done()
+			header := hashing.NewHeaderTemplate(hashing.Block{LastHash: *lastBlock.Hash, MerkleRoot: root})
+			step := uint32(s.workers)
+			nonce := first
+			var timestamp int64
+			for {
+				select {
+				case <-workCtx.Done():
+					return
+				default:
+				}
+
+				// the timestamp, and so the difficulty, is only refreshed once per batch of nonces
+				// or when the worker runs out of nonces, so no header is ever hashed twice
+				timestamp = nextTimestamp(timestamp)
+				difficulty := retargeter.NextDifficulty(parents, timestamp)
+				header.SetTimestamp(timestamp)
+				header.SetDifficulty(difficulty)
+				tried := 0
+				for rolled := false; tried < hashBatch && !rolled; tried++ {
+					header.SetNonce(nonce)
+					hash := header.Hash()
+					if uint32(hashing.LeadingZeroBits(hash[:])) >= difficulty {
+						atomic.AddUint64(&hashes, uint64(tried+1))
+						hexHash := hex.EncodeToString(hash[:])
+						found <- yieldBlock(timestamp, lastBlock.Hash, root, &hexHash, data, nonce, difficulty)
+						return
+					}
+					nonce, rolled = nextNonce(nonce, first, step)
+				}
+				atomic.AddUint64(&hashes, uint64(tried))
+			}
+		}(uint32(w + 1))
+	}
+
+	var block *Block
+	select {
+	case block = <-found:
+	case <-workCtx.Done():
 	}
+	stop()
+	wg.Wait()
+	s.setHashRate(atomic.LoadUint64(&hashes), time.Since(start))
 
-	return lastBlock.Difficulty
+	if block == nil {
+		// a block found just as ctx is done is still good
+		select {
+		case block = <-found:
+		default:
+			return nil, ctx.Err()
+		}
+	}
+	return block, nil
 }
 
-// MineNewBlock returns a new block
-func (s *service) MineNewBlock(lastBlock *Block, data []Transaction) (*Block, error) {
-	// validations
+// BlockTemplate returns the unmined block on lastBlock with given timestamp, for an external worker to find its nonce and hash
+func (s *service) BlockTemplate(lastBlock *Block, data []Transaction, timestamp int64) (*Block, error) {
 	if lastBlock == nil {
 		return nil, ErrMissingLastBlock
 	}
 
-	difficulty := lastBlock.Difficulty
-	var nonce uint32
-	var timestamp int64
-	var hash string
+	retargeter, err := s.params.Retargeter()
+	if err != nil {
+		return nil, err
+	}
+	parents := s.parentHeaders(lastBlock, retargeter.Window())
+	if parents == nil {
+		return nil, ErrMissingLastBlock
+	}
+
+	return yieldBlock(timestamp, lastBlock.Hash, merkleRoot(data), nil, data, 0, retargeter.NextDifficulty(parents, timestamp)), nil
+}
+
+// nextNonce returns the nonce a worker starting at first and stepping by step tries after nonce.
+// When the worker's share of the nonce space is exhausted it starts over from first and rolled is true, the header then needs a new timestamp.
+// Stopping short of wrapping around keeps the nonces of workers apart.
+func nextNonce(nonce uint32, first uint32, step uint32) (next uint32, rolled bool) {
+	if nonce > math.MaxUint32-step {
+		return first, true
+	}
+	return nonce + step, false
+}
+
+// nextTimestamp returns the current time, or last plus a nanosecond if the clock has not moved past last
+func nextTimestamp(last int64) int64 {
+	if now := time.Now().UnixNano(); now > last {
+		return now
+	}
+	return last + 1
+}
+
+// HashRate returns the hashes per second tried by the last call to MineBlock
+func (s *service) HashRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hashRate
+}
+
+func (s *service) setHashRate(hashes uint64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashRate = float64(hashes) / elapsed.Seconds()
+}
+
+// parentHeaders returns up to n headers of the chain ending at lastBlock, oldest first, nil if lastBlock is not in the block tree
+func (s *service) parentHeaders(lastBlock *Block, n int) []consensus.Header {
+	parents, height, ok := s.parentsOf(*lastBlock.Hash, n)
+	if !ok {
+		return nil
+	}
+	return toConsensusHeaders(parents, height+1-uint32(len(parents)))
+}
+
+// parentsOf returns up to n blocks of the chain ending at the block with given hash, oldest first, and the height of that block.
+// Side branch blocks are walked back by hash down to the main chain, the rest is read as a main chain range.
+func (s *service) parentsOf(hash string, n int) ([]Block, uint32, bool) {
+	// side holds the newest side branch blocks, newest first, sideLen counts all of them
+	var side []Block
+	sideLen := 0
 	for {
-		nonce++
-		timestamp = time.Now().UnixNano()
-		difficulty = adjustBlockDifficulty(*lastBlock, timestamp, s.MineRate)
-		hash = hashing.SHA256Hash(timestamp, *lastBlock.Hash, data, nonce, difficulty)
-		if hexStringToBinary(hash)[:difficulty] == strings.Repeat("0", int(difficulty)) {
-			break
+		if forkHeight, ok := s.listing.GetMainChainHeight(hash); ok {
+			var blocks []Block
+			if need := n - len(side); need > 0 {
+				var start uint32
+				if forkHeight+1 > uint32(need) {
+					start = forkHeight + 1 - uint32(need)
+				}
+				for _, lBlock := range s.listing.GetBlockRange(start, forkHeight+1-start) {
+					blocks = append(blocks, fromListingBlock(lBlock))
+				}
+			}
+			for i := len(side) - 1; i >= 0; i-- {
+				blocks = append(blocks, side[i])
+			}
+			return blocks, forkHeight + uint32(sideLen), true
 		}
-	}
 
-	return yieldBlock(timestamp, lastBlock.Hash, &hash, data, nonce, difficulty), nil
+		lBlock := s.listing.GetBlockByHash(hash)
+		if lBlock == nil {
+			return nil, 0, false
+		}
+		if len(side) < n {
+			side = append(side, fromListingBlock(*lBlock))
+		}
+		sideLen++
+		hash = *lBlock.LastHash
+	}
 }
 
-// HexStringToBinary converts the hex string to binary string representation
-func hexStringToBinary(s string) string {
-	res := ""
-	b, _ := hex.DecodeString(s)
-	for _, c := range b {
-		binary, _ := strconv.Atoi(fmt.Sprintf("%.b", c))
-		res = fmt.Sprintf("%s%s", res, fmt.Sprintf("%08d", binary))
+// extensionOf returns blocks on top of the block with given hash with the parent blocks and account states
+// validating them looks at, ErrOrphanBlock if the block is unknown
+func (s *service) extensionOf(lastHash string, blocks []Block) (*validating.Extension, error) {
+	retargeter, err := s.params.Retargeter()
+	if err != nil {
+		return nil, err
 	}
-	return res
+
+	// parents cover the spans median time past, retargeting and coinbase maturity look back at
+	n := s.params.MedianTimeSpan
+	if retargeter.Window() > n {
+		n = retargeter.Window()
+	}
+	if s.params.CoinbaseMaturity > n {
+		n = s.params.CoinbaseMaturity
+	}
+
+	parents, height, ok := s.parentsOf(lastHash, n)
+	if !ok {
+		return nil, ErrOrphanBlock
+	}
+	accountOf := s.blockchain.GetAccountsAt(lastHash)
+	if accountOf == nil {
+		return nil, ErrOrphanBlock
+	}
+
+	return &validating.Extension{
+		Parents:   toValidatingChain(&Blockchain{Chain: parents}).Chain,
+		Height:    height + 1,
+		Blocks:    toValidatingChain(&Blockchain{Chain: blocks}).Chain,
+		AccountOf: accountOf,
+	}, nil
 }
 
 // AddBlock adds a minedBlock into blockchain
@@ -115,10 +323,11 @@ func (s *service) AddBlock(minedBlock *Block) error {
 	return s.blockchain.AddBlock(minedBlock)
 }
 
-func yieldBlock(timestamp int64, lastHash *string, hash *string, data []Transaction, nonce uint32, difficulty uint32) *Block {
+func yieldBlock(timestamp int64, lastHash *string, merkleRoot string, hash *string, data []Transaction, nonce uint32, difficulty uint32) *Block {
 	return &Block{
 		Timestamp:  timestamp,
 		LastHash:   lastHash,
+		MerkleRoot: merkleRoot,
 		Hash:       hash,
 		Data:       data,
 		Nonce:      nonce,
@@ -132,17 +341,134 @@ func (s *service) ReplaceChain(newChain *Blockchain) error {
 		log.Printf("New chain is nil")
 		return ErrInvalidChain
 	}
-	if uint32(len(newChain.Chain)) <= s.listing.GetBlockCount() {
-		return ErrShorterChain
-	}
 	vChain := toValidatingChain(newChain)
-	if !s.validating.IsValidChain(vChain) {
-		return ErrInvalidChain
+	if !s.validating.IsHeavierChain(vChain) {
+		return ErrInsufficientChainWork
+	}
+	if valid, err := s.validating.IsValidChain(vChain); !valid || err != nil {
+		log.Printf("MiningService#ReplaceChain: Invalid chain %v", err)
+		return validationError(err, ErrInvalidChain)
 	}
 	if valid, err := s.validating.ContainsValidTransactions(vChain); !valid || err != nil {
 		log.Printf("MiningService#ReplaceChain: Failed to replace chain %v", err)
-		return ErrInvalidTransactions
+		return validationError(err, ErrInvalidTransactions)
 	}
 
 	return s.blockchain.ReplaceChain(newChain)
 }
+
+// AcceptBlock validates a block received from a peer against its parent chain and adds it to the block tree
+func (s *service) AcceptBlock(receivedBlock *Block) error {
+	if receivedBlock == nil || receivedBlock.Hash == nil || receivedBlock.LastHash == nil {
+		return ErrInvalidChain
+	}
+	if s.listing.GetBlockByHash(*receivedBlock.Hash) != nil {
+		return ErrKnownBlock
+	}
+
+	ext, err := s.extensionOf(*receivedBlock.LastHash, []Block{*receivedBlock})
+	if err == ErrOrphanBlock {
+		s.orphans.add(*receivedBlock)
+		log.Printf("Parked orphan block. BlockHash=%s, LastHash=%s", *receivedBlock.Hash, *receivedBlock.LastHash)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if valid, err := s.validating.IsValidExtension(ext); !valid || err != nil {
+		log.Printf("MiningService#AcceptBlock: Invalid block %v", err)
+		return validationError(err, ErrInvalidChain)
+	}
+	if valid, err := s.validating.ContainsValidExtensionTransactions(ext); !valid || err != nil {
+		log.Printf("MiningService#AcceptBlock: Failed to accept block %v", err)
+		return validationError(err, ErrInvalidTransactions)
+	}
+
+	if err := s.blockchain.AddBlock(receivedBlock); err != nil {
+		return err
+	}
+	s.acceptOrphans(*receivedBlock.Hash)
+	return nil
+}
+
+// acceptOrphans validates and adds the parked blocks waiting for the block with given hash
+func (s *service) acceptOrphans(hash string) {
+	for _, orphan := range s.orphans.take(hash) {
+		if err := s.AcceptBlock(&orphan); err != nil && err != ErrKnownBlock {
+			log.Printf("MiningService#acceptOrphans: Failed to accept orphan block=%s, %v", *orphan.Hash, err)
+		}
+	}
+}
+
+// AcceptBlocks validates a range of consecutive blocks received from a peer in one pass and adds them to the block tree.
+// Leading blocks that are already known are skipped.
+func (s *service) AcceptBlocks(receivedBlocks []Block) error {
+	// blocks come from peers, so hashes are checked to be there before any is looked up
+	for i := range receivedBlocks {
+		if receivedBlocks[i].Hash == nil || receivedBlocks[i].LastHash == nil {
+			return ErrInvalidChain
+		}
+		if i > 0 && *receivedBlocks[i].LastHash != *receivedBlocks[i-1].Hash {
+			return ErrInvalidChain
+		}
+	}
+
+	for len(receivedBlocks) > 0 && s.listing.GetBlockByHash(*receivedBlocks[0].Hash) != nil {
+		receivedBlocks = receivedBlocks[1:]
+	}
+	if len(receivedBlocks) == 0 {
+		return nil
+	}
+
+	// a node without blocks has no parent to extend, it takes blocks from genesis the way it takes a replaced chain
+	if s.listing.GetBlockCount() == 0 {
+		if err := s.ReplaceChain(&Blockchain{Chain: receivedBlocks}); err != nil {
+			return err
+		}
+		for _, block := range receivedBlocks {
+			s.acceptOrphans(*block.Hash)
+		}
+		return nil
+	}
+
+	ext, err := s.extensionOf(*receivedBlocks[0].LastHash, receivedBlocks)
+	if err == ErrOrphanBlock {
+		for _, block := range receivedBlocks {
+			s.orphans.add(block)
+		}
+		log.Printf("Parked %d orphan blocks. LastHash=%s", len(receivedBlocks), *receivedBlocks[0].LastHash)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if valid, err := s.validating.IsValidExtension(ext); !valid || err != nil {
+		log.Printf("MiningService#AcceptBlocks: Invalid blocks %v", err)
+		return validationError(err, ErrInvalidChain)
+	}
+	if valid, err := s.validating.ContainsValidExtensionTransactions(ext); !valid || err != nil {
+		log.Printf("MiningService#AcceptBlocks: Failed to accept blocks %v", err)
+		return validationError(err, ErrInvalidTransactions)
+	}
+
+	for i := range receivedBlocks {
+		if err := s.blockchain.AddBlock(&receivedBlocks[i]); err != nil {
+			return err
+		}
+	}
+	for _, block := range receivedBlocks {
+		s.acceptOrphans(*block.Hash)
+	}
+
+	return nil
+}
+
+// validationError returns err explaining why validating rejected blocks, or fallback when it gave no reason
+func validationError(err error, fallback error) error {
+	if err != nil {
+		return err
+	}
+	return fallback
+}
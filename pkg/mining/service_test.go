@@ -1,10 +1,16 @@
 package mining
 
 import (
+	"context"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
 	"github.com/knd/kndchain/pkg/hashing"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/validating"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -25,65 +31,49 @@ func TestCreateGenesisBlock(t *testing.T) {
 	})
 }
 
-func TestAdjustBlockDifficulty(t *testing.T) {
+func TestNextNonce(t *testing.T) {
 	assert := assert.New(t)
-	lastHash, hash := "0x123", "0x456"
-	lastBlock := &Block{
-		Timestamp:  time.Now().UnixNano(),
-		LastHash:   &lastHash,
-		Hash:       &hash,
-		Data:       []Transaction{Transaction{ID: "txA"}},
-		Nonce:      1,
-		Difficulty: 2,
-	}
-
-	t.Run("raises block difficulty if mining rate is faster than MINE_RATE milliseconds", func(t *testing.T) {
-		blockTimestamp := (*lastBlock).Timestamp + (time.Millisecond * 999).Nanoseconds()
 
+	t.Run("steps to the next nonce of the worker", func(t *testing.T) {
 		// perform test
-		difficulty := adjustBlockDifficulty(*lastBlock, blockTimestamp, 600000)
+		nonce, rolled := nextNonce(5, 2, 3)
 
 		// test verification
-		assert.Equal(uint32(3), difficulty)
+		assert.Equal(uint32(8), nonce)
+		assert.False(rolled)
 	})
 
-	t.Run("lowers block difficulty if mining rate is slower than threshold MINE_RATE milliseconds", func(t *testing.T) {
-		blockTimestamp := (*lastBlock).Timestamp + (time.Millisecond * 700000).Nanoseconds()
-
+	t.Run("starts over instead of wrapping around when nonces are exhausted", func(t *testing.T) {
 		// perform test
-		difficulty := adjustBlockDifficulty(*lastBlock, blockTimestamp, 600000)
+		nonce, rolled := nextNonce(math.MaxUint32-1, 2, 3)
 
-		// test verficiation
-		assert.Equal(uint32(1), difficulty)
+		// test verification
+		assert.Equal(uint32(2), nonce)
+		assert.True(rolled)
 	})
+}
 
-	t.Run("lowers block difficulty if mining rate is equal to threshold MINE_RATE milliseconds", func(t *testing.T) {
-		blockTimestamp := (*lastBlock).Timestamp + (time.Millisecond * 600000).Nanoseconds()
+func TestNextTimestamp(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("returns the current time", func(t *testing.T) {
+		before := time.Now().UnixNano()
 
 		// perform test
-		difficulty := adjustBlockDifficulty(*lastBlock, blockTimestamp, 600000)
+		timestamp := nextTimestamp(0)
 
-		// test verficiation
-		assert.Equal(uint32(2), difficulty)
+		// test verification
+		assert.True(timestamp >= before)
 	})
 
-	t.Run("has minimum difficulty of 1 no matter what", func(t *testing.T) {
-		lastBlock.Difficulty = 0
-		blockTimestamp := (*lastBlock).Timestamp + (time.Millisecond * 1001).Nanoseconds()
+	t.Run("moves past last timestamp when clock has not", func(t *testing.T) {
+		last := time.Now().Add(time.Hour).UnixNano()
 
-		// perform test
-		difficulty := adjustBlockDifficulty(*lastBlock, blockTimestamp, 600000)
-
-		// test verficiation
-		assert.Equal(uint32(1), difficulty)
+		// perform test & verification
+		assert.Equal(last+1, nextTimestamp(last))
 	})
 }
 
-func TestHexStringToBinary(t *testing.T) {
-	// https://www.binaryhexconverter.com/hex-to-binary-converter
-	assert.Equal(t, "0000000100100011010001011000100100010000101010111100110111101111", hexStringToBinary("0123458910abcdef"))
-}
-
 func TestService(t *testing.T) {
 	assert := assert.New(t)
 	var miningService Service
@@ -96,7 +86,7 @@ func TestService(t *testing.T) {
 		mockedListing = new(MockedListing)
 		mockedValidating = new(MockedValidating)
 		mockedValidating.On("ContainsValidTransactions", mock.Anything).Return(true, nil)
-		miningService = NewService(mockedRepository, mockedListing, mockedValidating, 600000)
+		miningService = NewService(mockedRepository, mockedListing, mockedValidating, consensus.DefaultParams(), 2)
 	}
 
 	t.Run("mines new block", func(t *testing.T) {
@@ -114,6 +104,8 @@ func TestService(t *testing.T) {
 			Nonce:      nonce,
 			Difficulty: difficulty,
 		}
+		mockedListing.On("GetMainChainHeight", hash).Return(uint32(0), true)
+		mockedListing.On("GetBlockRange", uint32(0), uint32(1)).Return([]listing.Block{listing.Block{Timestamp: lastBlock.Timestamp, Hash: &hash, Difficulty: difficulty}})
 		data := []Transaction{Transaction{ID: "tx2"}}
 
 		// perform test
@@ -123,8 +115,10 @@ func TestService(t *testing.T) {
 		assert.Nil(err)
 		assert.NotEmpty(newBlock.Timestamp)
 		assert.Equal("0x456", *newBlock.LastHash)
-		assert.Equal("00", hexStringToBinary(*newBlock.Hash)[:newBlock.Difficulty])
-		assert.Equal(hashing.SHA256Hash(data, newBlock.Timestamp, *lastBlock.Hash, newBlock.Nonce, newBlock.Difficulty), *newBlock.Hash)
+		assert.Equal(difficulty, newBlock.Difficulty)
+		assert.True(validating.HasProofOfWork(*newBlock.Hash, newBlock.Difficulty))
+		assert.Equal(merkleRoot(data), newBlock.MerkleRoot)
+		assert.Equal(hashBlock(newBlock.Timestamp, *lastBlock.Hash, newBlock.MerkleRoot, newBlock.Nonce, newBlock.Difficulty), *newBlock.Hash)
 		assert.Equal(data, newBlock.Data)
 	})
 
@@ -148,6 +142,48 @@ func TestService(t *testing.T) {
 		mockedRepository.AssertExpectations(t)
 	})
 
+	t.Run("creates block template for external workers", func(t *testing.T) {
+		beforeEach()
+		mockedListing.On("GetBlockCount").Return(1)
+		hash := "0x456"
+		lastBlock := Block{Timestamp: time.Now().UnixNano(), Hash: &hash, Difficulty: 7}
+		mockedListing.On("GetMainChainHeight", hash).Return(uint32(0), true)
+		mockedListing.On("GetBlockRange", uint32(0), uint32(1)).Return([]listing.Block{listing.Block{Timestamp: lastBlock.Timestamp, Hash: &hash, Difficulty: 7}})
+		data := []Transaction{Transaction{ID: "tx2"}}
+		timestamp := lastBlock.Timestamp + 1
+
+		// perform test
+		template, err := miningService.BlockTemplate(&lastBlock, data, timestamp)
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal(timestamp, template.Timestamp)
+		assert.Equal("0x456", *template.LastHash)
+		assert.Equal(merkleRoot(data), template.MerkleRoot)
+		assert.Equal(uint32(7), template.Difficulty)
+		assert.Nil(template.Hash)
+		assert.Equal(data, template.Data)
+	})
+
+	t.Run("stops mining when context is done", func(t *testing.T) {
+		beforeEach()
+		mockedListing.On("GetBlockCount").Return(1)
+		hash := "0x456"
+		lastBlock := Block{Timestamp: time.Now().UnixNano(), Hash: &hash, Difficulty: 255}
+		mockedListing.On("GetMainChainHeight", hash).Return(uint32(0), true)
+		mockedListing.On("GetBlockRange", uint32(0), uint32(1)).Return([]listing.Block{listing.Block{Timestamp: lastBlock.Timestamp, Hash: &hash, Difficulty: 255}})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// perform test
+		newBlock, err := miningService.MineBlock(ctx, &lastBlock, []Transaction{})
+
+		// test verification
+		assert.Nil(newBlock)
+		assert.Equal(context.DeadlineExceeded, err)
+		assert.True(miningService.HashRate() > 0)
+	})
+
 	t.Run("replaces with nil chain", func(t *testing.T) {
 		beforeEach()
 
@@ -159,9 +195,9 @@ func TestService(t *testing.T) {
 		mockedRepository.AssertNotCalled(t, "ReplaceChain")
 	})
 
-	t.Run("replaces with shorter chain", func(t *testing.T) {
+	t.Run("replaces with chain of less work", func(t *testing.T) {
 		beforeEach()
-		mockedListing.On("GetBlockCount").Return(5)
+		mockedValidating.On("IsHeavierChain", mock.Anything).Return(false)
 
 		genesisLastHash := "0x123"
 		genesisHash := "0x456"
@@ -198,14 +234,14 @@ func TestService(t *testing.T) {
 		err := miningService.ReplaceChain(blockchain)
 
 		// test verification
-		assert.Equal(err, ErrShorterChain)
+		assert.Equal(err, ErrInsufficientChainWork)
 		mockedRepository.AssertNotCalled(t, "ReplaceChain")
 	})
 
-	t.Run("replaces with longer valid chain", func(t *testing.T) {
+	t.Run("replaces with heavier valid chain", func(t *testing.T) {
 		beforeEach()
-		mockedListing.On("GetBlockCount").Return(2)
-		mockedValidating.On("IsValidChain", mock.Anything).Return(true)
+		mockedValidating.On("IsHeavierChain", mock.Anything).Return(true)
+		mockedValidating.On("IsValidChain", mock.Anything).Return(true, nil)
 
 		genesisLastHash := "0x123"
 		genesisHash := "0x456"
@@ -247,10 +283,11 @@ func TestService(t *testing.T) {
 		mockedRepository.AssertCalled(t, "ReplaceChain", blockchain)
 	})
 
-	t.Run("replaces with longer invalid chain", func(t *testing.T) {
+	t.Run("replaces with heavier invalid chain", func(t *testing.T) {
 		beforeEach()
-		mockedListing.On("GetBlockCount").Return(2)
-		mockedValidating.On("IsValidChain", mock.Anything).Return(false)
+		mockedValidating.On("IsHeavierChain", mock.Anything).Return(true)
+		rejection := &validating.ValidationError{Index: 2, Reason: validating.ReasonInvalidHash}
+		mockedValidating.On("IsValidChain", mock.Anything).Return(false, rejection)
 
 		genesisLastHash := "0x123"
 		genesisHash := "0x456"
@@ -288,7 +325,282 @@ func TestService(t *testing.T) {
 		err := miningService.ReplaceChain(blockchain)
 
 		// test verification
-		assert.Equal(err, ErrInvalidChain)
+		assert.Equal(rejection, err)
 		mockedRepository.AssertNotCalled(t, "ReplaceChain")
 	})
 }
+
+func TestService_AcceptBlock(t *testing.T) {
+	assert := assert.New(t)
+	var miningService Service
+	var mockedRepository *MockedRepository
+	var mockedListing *MockedListing
+	var mockedValidating *MockedValidating
+
+	genesisHash := "0x000"
+	tipHash := "0x123"
+	tipBlock := listing.Block{Timestamp: 2, LastHash: &genesisHash, Hash: &tipHash, Difficulty: 1}
+	genesisBlock := listing.Block{Timestamp: 1, LastHash: &genesisHash, Hash: &genesisHash, Difficulty: 1}
+
+	beforeEach := func() {
+		mockedRepository = new(MockedRepository)
+		mockedListing = new(MockedListing)
+		mockedValidating = new(MockedValidating)
+		mockedListing.On("GetBlockCount").Return(2)
+		mockedListing.On("GetLastBlock").Return(tipBlock)
+		mockedListing.On("GetMainChainHeight", genesisHash).Return(uint32(0), true)
+		mockedListing.On("GetMainChainHeight", tipHash).Return(uint32(1), true)
+		mockedListing.On("GetMainChainHeight", mock.Anything).Return(uint32(0), false)
+		mockedListing.On("GetBlockRange", uint32(0), uint32(1)).Return([]listing.Block{genesisBlock})
+		mockedListing.On("GetBlockRange", uint32(0), uint32(2)).Return([]listing.Block{genesisBlock, tipBlock})
+		mockedListing.On("GetBlockByHash", genesisHash).Return(&genesisBlock)
+		mockedListing.On("GetBlockByHash", tipHash).Return(&tipBlock)
+		mockedRepository.On("GetAccountsAt", mock.Anything).Return(func(address string) calculating.Account { return calculating.Account{} })
+		mockedValidating.On("ContainsValidExtensionTransactions", mock.Anything).Return(true, nil)
+		miningService = NewService(mockedRepository, mockedListing, mockedValidating, consensus.DefaultParams(), 2)
+	}
+
+	createBlock := func(lastHash string, hash string) *Block {
+		return &Block{Timestamp: 3, LastHash: &lastHash, Hash: &hash, Data: []Transaction{Transaction{ID: "txA"}}, Difficulty: 1}
+	}
+
+	t.Run("appends valid block extending the tip", func(t *testing.T) {
+		beforeEach()
+		receivedBlock := createBlock(tipHash, "0x456")
+		mockedListing.On("GetBlockByHash", "0x456").Return(nil)
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(true, nil)
+		mockedRepository.On("AddBlock", receivedBlock).Return(nil)
+
+		// perform test
+		err := miningService.AcceptBlock(receivedBlock)
+
+		// test verification
+		assert.Nil(err)
+		mockedRepository.AssertCalled(t, "AddBlock", receivedBlock)
+		ext := mockedValidating.Calls[0].Arguments.Get(0).(*validating.Extension)
+		assert.Equal(uint32(2), ext.Height)
+		assert.Len(ext.Parents, 2)
+		assert.Len(ext.Blocks, 1)
+		mockedRepository.AssertCalled(t, "GetAccountsAt", tipHash)
+		mockedListing.AssertNotCalled(t, "GetBlockchain")
+	})
+
+	t.Run("validates block extending a side branch against its own parent chain", func(t *testing.T) {
+		beforeEach()
+		receivedBlock := createBlock(genesisHash, "0x789")
+		mockedListing.On("GetBlockByHash", "0x789").Return(nil)
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(true, nil)
+		mockedRepository.On("AddBlock", receivedBlock).Return(nil)
+
+		// perform test
+		err := miningService.AcceptBlock(receivedBlock)
+
+		// test verification
+		assert.Nil(err)
+		ext := mockedValidating.Calls[0].Arguments.Get(0).(*validating.Extension)
+		assert.Equal(uint32(1), ext.Height)
+		assert.Len(ext.Parents, 1)
+	})
+
+	t.Run("walks back side branch blocks down to the main chain for parents", func(t *testing.T) {
+		beforeEach()
+		sideHash := "0xside"
+		sideBlock := listing.Block{Timestamp: 2, LastHash: &genesisHash, Hash: &sideHash, Difficulty: 1}
+		mockedListing.On("GetBlockByHash", sideHash).Return(&sideBlock)
+		receivedBlock := createBlock(sideHash, "0x789")
+		mockedListing.On("GetBlockByHash", "0x789").Return(nil)
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(true, nil)
+		mockedRepository.On("AddBlock", receivedBlock).Return(nil)
+
+		// perform test
+		err := miningService.AcceptBlock(receivedBlock)
+
+		// test verification
+		assert.Nil(err)
+		ext := mockedValidating.Calls[0].Arguments.Get(0).(*validating.Extension)
+		assert.Equal(uint32(2), ext.Height)
+		assert.Equal([]string{genesisHash, sideHash}, []string{*ext.Parents[0].Hash, *ext.Parents[1].Hash})
+		mockedRepository.AssertCalled(t, "GetAccountsAt", sideHash)
+	})
+
+	t.Run("rejects invalid block", func(t *testing.T) {
+		beforeEach()
+		receivedBlock := createBlock(tipHash, "0x456")
+		mockedListing.On("GetBlockByHash", "0x456").Return(nil)
+		rejection := &validating.ValidationError{Index: 2, BlockHash: "0x456", Reason: validating.ReasonInvalidHash}
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(false, rejection)
+
+		// perform test
+		err := miningService.AcceptBlock(receivedBlock)
+
+		// test verification
+		assert.Equal(rejection, err)
+		mockedRepository.AssertNotCalled(t, "AddBlock", receivedBlock)
+	})
+
+	t.Run("reports orphan block when parent is unknown", func(t *testing.T) {
+		beforeEach()
+		receivedBlock := createBlock("0xabc", "0x456")
+		mockedListing.On("GetBlockByHash", "0x456").Return(nil)
+		mockedListing.On("GetBlockByHash", "0xabc").Return(nil)
+
+		// perform test
+		err := miningService.AcceptBlock(receivedBlock)
+
+		// test verification
+		assert.Equal(ErrOrphanBlock, err)
+		mockedRepository.AssertNotCalled(t, "AddBlock", receivedBlock)
+	})
+
+	t.Run("validates parked orphan once its parent is accepted", func(t *testing.T) {
+		beforeEach()
+		parent := createBlock(tipHash, "0x456")
+		orphan := createBlock("0x456", "0x789")
+		orphan.Timestamp = 4
+		parentBlock := listing.Block{Timestamp: 3, LastHash: &tipHash, Hash: parent.Hash, Difficulty: 1}
+		// parent is unknown until it is accepted
+		mockedListing.On("GetBlockByHash", "0x456").Return(nil).Twice()
+		mockedListing.On("GetBlockByHash", "0x456").Return(&parentBlock)
+		mockedListing.On("GetBlockByHash", "0x789").Return(nil)
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(true, nil)
+		mockedRepository.On("AddBlock", mock.Anything).Return(nil)
+
+		// perform test
+		orphanErr := miningService.AcceptBlock(orphan)
+		err := miningService.AcceptBlock(parent)
+
+		// test verification
+		assert.Equal(ErrOrphanBlock, orphanErr)
+		assert.Nil(err)
+		mockedValidating.AssertNumberOfCalls(t, "IsValidExtension", 2)
+		mockedRepository.AssertCalled(t, "AddBlock", parent)
+		mockedRepository.AssertCalled(t, "AddBlock", orphan)
+		ext := mockedValidating.Calls[len(mockedValidating.Calls)-1].Arguments.Get(0).(*validating.Extension)
+		assert.Equal(uint32(3), ext.Height)
+	})
+
+	t.Run("ignores known block", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		err := miningService.AcceptBlock(createBlock(genesisHash, tipHash))
+
+		// test verification
+		assert.Equal(ErrKnownBlock, err)
+	})
+}
+
+func TestService_AcceptBlocks(t *testing.T) {
+	assert := assert.New(t)
+	var miningService Service
+	var mockedRepository *MockedRepository
+	var mockedListing *MockedListing
+	var mockedValidating *MockedValidating
+
+	genesisHash := "0x000"
+	tipHash := "0x123"
+	tipBlock := listing.Block{Timestamp: 2, LastHash: &genesisHash, Hash: &tipHash, Difficulty: 1}
+	genesisBlock := listing.Block{Timestamp: 1, LastHash: &genesisHash, Hash: &genesisHash, Difficulty: 1}
+
+	beforeEach := func() {
+		mockedRepository = new(MockedRepository)
+		mockedListing = new(MockedListing)
+		mockedValidating = new(MockedValidating)
+		mockedListing.On("GetBlockCount").Return(2)
+		mockedListing.On("GetLastBlock").Return(tipBlock)
+		mockedListing.On("GetMainChainHeight", genesisHash).Return(uint32(0), true)
+		mockedListing.On("GetMainChainHeight", tipHash).Return(uint32(1), true)
+		mockedListing.On("GetMainChainHeight", mock.Anything).Return(uint32(0), false)
+		mockedListing.On("GetBlockRange", uint32(0), uint32(1)).Return([]listing.Block{genesisBlock})
+		mockedListing.On("GetBlockRange", uint32(0), uint32(2)).Return([]listing.Block{genesisBlock, tipBlock})
+		mockedListing.On("GetBlockByHash", genesisHash).Return(&genesisBlock)
+		mockedListing.On("GetBlockByHash", tipHash).Return(&tipBlock)
+		mockedRepository.On("GetAccountsAt", mock.Anything).Return(func(address string) calculating.Account { return calculating.Account{} })
+		mockedListing.On("GetBlockByHash", mock.Anything).Return(nil)
+		mockedValidating.On("ContainsValidExtensionTransactions", mock.Anything).Return(true, nil)
+		miningService = NewService(mockedRepository, mockedListing, mockedValidating, consensus.DefaultParams(), 2)
+	}
+
+	createBlock := func(timestamp int64, lastHash string, hash string) Block {
+		return Block{Timestamp: timestamp, LastHash: &lastHash, Hash: &hash, Difficulty: 1}
+	}
+
+	t.Run("validates range once and adds unknown blocks", func(t *testing.T) {
+		beforeEach()
+		blocks := []Block{createBlock(2, genesisHash, tipHash), createBlock(3, tipHash, "0x456"), createBlock(4, "0x456", "0x789")}
+		mockedValidating.On("IsValidExtension", mock.Anything).Return(true, nil)
+		mockedRepository.On("AddBlock", mock.Anything).Return(nil)
+
+		// perform test
+		err := miningService.AcceptBlocks(blocks)
+
+		// test verification
+		assert.Nil(err)
+		mockedValidating.AssertNumberOfCalls(t, "IsValidExtension", 1)
+		ext := mockedValidating.Calls[0].Arguments.Get(0).(*validating.Extension)
+		assert.Equal(uint32(2), ext.Height)
+		assert.Len(ext.Parents, 2)
+		assert.Len(ext.Blocks, 2)
+		mockedRepository.AssertNumberOfCalls(t, "AddBlock", 2)
+		mockedRepository.AssertCalled(t, "AddBlock", &blocks[1])
+		mockedRepository.AssertCalled(t, "AddBlock", &blocks[2])
+	})
+
+	t.Run("rejects range with broken linkage", func(t *testing.T) {
+		beforeEach()
+		blocks := []Block{createBlock(3, tipHash, "0x456"), createBlock(4, "0xabc", "0x789")}
+
+		// perform test
+		err := miningService.AcceptBlocks(blocks)
+
+		// test verification
+		assert.Equal(ErrInvalidChain, err)
+		mockedRepository.AssertNotCalled(t, "AddBlock", mock.Anything)
+	})
+
+	t.Run("rejects range with block missing its hash", func(t *testing.T) {
+		beforeEach()
+		blocks := []Block{Block{}, createBlock(3, tipHash, "0x456")}
+
+		// perform test
+		err := miningService.AcceptBlocks(blocks)
+
+		// test verification
+		assert.Equal(ErrInvalidChain, err)
+		mockedListing.AssertNotCalled(t, "GetBlockByHash", mock.Anything)
+		mockedRepository.AssertNotCalled(t, "AddBlock", mock.Anything)
+	})
+
+	t.Run("reports orphan range when parent is unknown", func(t *testing.T) {
+		beforeEach()
+		blocks := []Block{createBlock(3, "0xabc", "0x456")}
+
+		// perform test
+		err := miningService.AcceptBlocks(blocks)
+
+		// test verification
+		assert.Equal(ErrOrphanBlock, err)
+	})
+
+	t.Run("takes range from genesis as a replaced chain when chain is empty", func(t *testing.T) {
+		mockedRepository = new(MockedRepository)
+		mockedListing = new(MockedListing)
+		mockedValidating = new(MockedValidating)
+		mockedListing.On("GetBlockCount").Return(0)
+		mockedListing.On("GetBlockByHash", mock.Anything).Return(nil)
+		mockedValidating.On("IsHeavierChain", mock.Anything).Return(true)
+		mockedValidating.On("IsValidChain", mock.Anything).Return(true, nil)
+		mockedValidating.On("ContainsValidTransactions", mock.Anything).Return(true, nil)
+		mockedRepository.On("ReplaceChain", mock.Anything).Return(nil)
+		miningService = NewService(mockedRepository, mockedListing, mockedValidating, consensus.DefaultParams(), 2)
+		blocks := []Block{createBlock(1, genesisHash, genesisHash), createBlock(2, genesisHash, tipHash)}
+
+		// perform test
+		err := miningService.AcceptBlocks(blocks)
+
+		// test verification
+		assert.Nil(err)
+		mockedRepository.AssertCalled(t, "ReplaceChain", &Blockchain{Chain: blocks})
+		mockedValidating.AssertNotCalled(t, "IsValidExtension", mock.Anything)
+	})
+}
@@ -1,6 +1,7 @@
 package mining
 
 import (
+	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/validating"
 )
 
@@ -9,14 +10,16 @@ type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
 // Transaction in data
 type Transaction struct {
-	ID     string            `json:"id"`
-	Input  Input             `json:"input"`
-	Output map[string]uint64 `json:"output"`
+	ID          string            `json:"id"`
+	Input       Input             `json:"input"`
+	ExtraInputs []Input           `json:"extraInputs,omitempty"`
+	Output      map[string]uint64 `json:"output"`
 }
 
 func toValidatingTransactions(data []Transaction) []validating.Transaction {
@@ -29,8 +32,10 @@ func toValidatingTransactions(data []Transaction) []validating.Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toValidatingInputs(transaction.ExtraInputs),
 		})
 	}
 	return vTxs
@@ -42,6 +47,7 @@ func toValidatingChain(newChain *Blockchain) *validating.Blockchain {
 		vBlock := &validating.Block{
 			Timestamp:  block.Timestamp,
 			LastHash:   block.LastHash,
+			MerkleRoot: block.MerkleRoot,
 			Hash:       block.Hash,
 			Data:       toValidatingTransactions(block.Data),
 			Nonce:      block.Nonce,
@@ -51,3 +57,58 @@ func toValidatingChain(newChain *Blockchain) *validating.Blockchain {
 	}
 	return vBlockchain
 }
+
+func fromListingBlock(lBlock listing.Block) Block {
+	var txs []Transaction
+	for _, transaction := range lBlock.Data {
+		txs = append(txs, Transaction{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: Input{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: fromListingInputs(transaction.ExtraInputs),
+		})
+	}
+	return Block{
+		Timestamp:  lBlock.Timestamp,
+		LastHash:   lBlock.LastHash,
+		MerkleRoot: lBlock.MerkleRoot,
+		Hash:       lBlock.Hash,
+		Data:       txs,
+		Nonce:      lBlock.Nonce,
+		Difficulty: lBlock.Difficulty,
+	}
+}
+
+func toValidatingInputs(inputs []Input) []validating.Input {
+	var result []validating.Input
+	for _, input := range inputs {
+		result = append(result, validating.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func fromListingInputs(inputs []listing.Input) []Input {
+	var result []Input
+	for _, input := range inputs {
+		result = append(result, Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
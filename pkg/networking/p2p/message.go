@@ -0,0 +1,129 @@
+package p2p
+
+import (
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/networking/pubsub"
+	"github.com/knd/kndchain/pkg/wallet"
+)
+
+// protocolVersion is bumped whenever the wire format changes incompatibly
+const protocolVersion uint32 = 2
+
+// maxBlockBytesPerMessage leaves room under maxMessageSize for the base64 encoding of blocks
+const maxBlockBytesPerMessage = maxMessageSize / 2
+
+// Types of envelopes sent over peer connections
+const (
+	typeVersion = "version"
+	typeVerack  = "verack"
+	typeGetAddr = "getaddr"
+	typeAddr    = "addr"
+	typePing    = "ping"
+	typePong    = "pong"
+	typeBlock   = "block"
+	typeTx      = "tx"
+)
+
+// envelope is a single JSON message on a peer connection
+type envelope struct {
+	Type        string        `json:"type"`
+	Version     *version      `json:"version,omitempty"`
+	Addrs       []string      `json:"addrs,omitempty"`
+	Nonce       uint64        `json:"nonce,omitempty"`
+	Message     *blockMessage `json:"message,omitempty"`
+	Transaction []byte        `json:"tx,omitempty"`
+}
+
+// blockMessage is a pubsub.Message with blocks in canonical binary encoding.
+// Block hashes are not sent, they are computed from the decoded blocks. The genesis block is the exception,
+// its hash is given by config, so it is sent in GenesisHash when genesis is the first of the blocks.
+type blockMessage struct {
+	Kind        string   `json:"kind"`
+	Sender      string   `json:"sender"`
+	Blocks      [][]byte `json:"blocks,omitempty"`
+	GenesisHash string   `json:"genesisHash,omitempty"`
+	Locator     []string `json:"locator,omitempty"`
+	HashStop    string   `json:"hashStop,omitempty"`
+}
+
+func blockEnvelope(msg *pubsub.Message) *envelope {
+	bm := &blockMessage{
+		Kind:     msg.Kind,
+		Sender:   msg.Sender,
+		Locator:  msg.Locator,
+		HashStop: msg.HashStop,
+	}
+
+	var blocks []mining.Block
+	size := 0
+	switch {
+	case msg.Blockchain != nil:
+		blocks = msg.Blockchain.Chain
+	case msg.Block != nil:
+		blocks = []mining.Block{*msg.Block}
+	default:
+		blocks = msg.Blocks
+	}
+	if len(blocks) > 0 && *blocks[0].Hash != blocks[0].HeaderHash() {
+		bm.GenesisHash = *blocks[0].Hash
+	}
+	for i := range blocks {
+		b, _ := blocks[i].MarshalBinary()
+		// cut replies of ancestors short of maxMessageSize, the requester asks again for the rest
+		if size += len(b); msg.Kind == pubsub.KindBlocks && i > 0 && size > maxBlockBytesPerMessage {
+			break
+		}
+		bm.Blocks = append(bm.Blocks, b)
+	}
+
+	return &envelope{Type: typeBlock, Message: bm}
+}
+
+// toMessage decodes the blocks of bm into the pubsub.Message field that matches its kind
+func (bm *blockMessage) toMessage() (*pubsub.Message, error) {
+	msg := &pubsub.Message{
+		Kind:     bm.Kind,
+		Sender:   bm.Sender,
+		Locator:  bm.Locator,
+		HashStop: bm.HashStop,
+	}
+
+	var blocks []mining.Block
+	for _, b := range bm.Blocks {
+		var block mining.Block
+		if err := block.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	if len(bm.GenesisHash) != 0 && len(blocks) > 0 {
+		genesisHash := bm.GenesisHash
+		blocks[0].Hash = &genesisHash
+	}
+
+	switch bm.Kind {
+	case pubsub.KindBlockchain:
+		msg.Blockchain = &mining.Blockchain{Chain: blocks}
+	case pubsub.KindNewBlock:
+		if len(blocks) != 1 {
+			return nil, errMalformedMessage
+		}
+		msg.Block = &blocks[0]
+	default:
+		msg.Blocks = blocks
+	}
+	return msg, nil
+}
+
+func txEnvelope(tx *wallet.Tx) *envelope {
+	b, _ := tx.MarshalBinary()
+	return &envelope{Type: typeTx, Transaction: b}
+}
+
+// version is exchanged by both sides when a connection opens
+type version struct {
+	Protocol   uint32 `json:"protocol"`
+	NodeID     string `json:"nodeId"`
+	ListenAddr string `json:"listenAddr"`
+	BestHeight uint32 `json:"bestHeight"`
+}
@@ -0,0 +1,156 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxMessageSize limits how many bytes a peer may send for a single envelope
+const maxMessageSize = 32 << 20
+
+var errMessageTooLarge = errors.New("message too large")
+
+// peer is a TCP connection to another node
+type peer struct {
+	conn    net.Conn
+	inbound bool
+	encoder *json.Encoder
+	decoder *json.Decoder
+	reader  *messageReader
+	// writeMutex serializes envelopes written to conn
+	writeMutex *sync.Mutex
+	// mutex guards the fields below, they are read by other goroutines than the one handling the peer
+	mutex *sync.Mutex
+	// addr is the address the peer accepts connections on, known after its version message
+	addr           string
+	nodeID         string
+	versionRcvd    bool
+	verackRcvd     bool
+	lastPingNonce  uint64
+	lastPingSentAt time.Time
+}
+
+func newPeer(conn net.Conn, inbound bool) *peer {
+	reader := &messageReader{r: conn}
+	return &peer{
+		conn:       conn,
+		inbound:    inbound,
+		addr:       conn.RemoteAddr().String(),
+		encoder:    json.NewEncoder(conn),
+		decoder:    json.NewDecoder(reader),
+		reader:     reader,
+		writeMutex: &sync.Mutex{},
+		mutex:      &sync.Mutex{},
+	}
+}
+
+func (p *peer) address() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.addr
+}
+
+func (p *peer) node() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.nodeID
+}
+
+// setVersion records the version message of the peer, addr is left unchanged when empty
+func (p *peer) setVersion(nodeID string, addr string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.nodeID = nodeID
+	p.versionRcvd = true
+	if addr != "" {
+		p.addr = addr
+	}
+}
+
+func (p *peer) hasVersion() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.versionRcvd
+}
+
+func (p *peer) setVerack() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.verackRcvd = true
+}
+
+// handshaked returns true once both version and verack were received
+func (p *peer) handshaked() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.versionRcvd && p.verackRcvd
+}
+
+// ping records a new ping nonce and returns it
+func (p *peer) ping() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.lastPingNonce = rand.Uint64()
+	p.lastPingSentAt = time.Now()
+	return p.lastPingNonce
+}
+
+// pong returns the time since the ping with nonce was sent, false if nonce isn't the last ping
+func (p *peer) pong(nonce uint64) (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if nonce != p.lastPingNonce {
+		return 0, false
+	}
+	return time.Since(p.lastPingSentAt), true
+}
+
+func (p *peer) send(e *envelope) error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return p.encoder.Encode(e)
+}
+
+// receive reads the next envelope, failing if the peer stays silent for timeout or sends more than maxMessageSize
+func (p *peer) receive(e *envelope, timeout time.Duration) error {
+	p.conn.SetReadDeadline(time.Now().Add(timeout))
+	p.reader.remaining = maxMessageSize
+	return p.decoder.Decode(e)
+}
+
+func (p *peer) close() error {
+	return p.conn.Close()
+}
+
+// messageReader fails reads once remaining bytes are used up, it is reset before each message
+type messageReader struct {
+	r         io.Reader
+	remaining int
+}
+
+func (m *messageReader) Read(b []byte) (int, error) {
+	if m.remaining <= 0 {
+		return 0, errMessageTooLarge
+	}
+	if len(b) > m.remaining {
+		b = b[:m.remaining]
+	}
+	n, err := m.r.Read(b)
+	m.remaining -= n
+	return n, err
+}
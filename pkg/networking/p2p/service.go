@@ -0,0 +1,571 @@
+package p2p
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/networking/pubsub"
+	"github.com/knd/kndchain/pkg/wallet"
+)
+
+const (
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+	pingInterval = 30 * time.Second
+	// peerTimeout disconnects peers that stay silent, they are pinged well before it expires
+	peerTimeout = 90 * time.Second
+
+	maxPeers        = 16
+	maxAddrsPerSend = 100
+	// maxKnownAddrs bounds the address book, addresses that fail to dial leave room for new ones
+	maxKnownAddrs = 1000
+	// maxDialsPerRound bounds how many known addresses are dialed at once
+	maxDialsPerRound = 8
+	maxSeen          = 10000
+)
+
+// ErrNotConnected is used when peers are subscribed before listening for connections
+var ErrNotConnected = errors.New("Node is not listening for peer connections")
+
+var errMalformedMessage = errors.New("malformed message")
+
+type service struct {
+	l          listing.Service
+	h          *pubsub.Handler
+	NodeID     string
+	ListenAddr string
+	Seeds      []string
+	listener   net.Listener
+	peers      map[*peer]bool
+	knownAddrs map[string]bool
+	seen       map[string]bool
+	mutex      *sync.Mutex
+	// handleMutex processes peer messages one at a time like a single subscription would
+	handleMutex *sync.Mutex
+	quit        chan struct{}
+	quitOnce    *sync.Once
+	peerTimeout time.Duration
+}
+
+// NewService creates a peer-to-peer networking service over direct TCP connections
+func NewService(l listing.Service, m mining.Service, p wallet.TransactionPool, listenAddr string, seeds []string) pubsub.Service {
+	return &service{
+		l:           l,
+		h:           pubsub.NewHandler(l, m, p),
+		NodeID:      uuid.New().String(),
+		ListenAddr:  listenAddr,
+		Seeds:       seeds,
+		peers:       make(map[*peer]bool),
+		knownAddrs:  make(map[string]bool),
+		seen:        make(map[string]bool),
+		mutex:       &sync.Mutex{},
+		handleMutex: &sync.Mutex{},
+		quit:        make(chan struct{}),
+		quitOnce:    &sync.Once{},
+		peerTimeout: peerTimeout,
+	}
+}
+
+// Connect starts listening for peer connections
+func (s *service) Connect() error {
+	listener, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		log.Printf("P2PService#Connect: Failed to listen on %s, %v", s.ListenAddr, err)
+		return err
+	}
+	s.listener = listener
+	log.Printf("Listening for peers on %s", listener.Addr())
+
+	return nil
+}
+
+// Disconnect stops listening and closes all peer connections
+func (s *service) Disconnect() error {
+	s.quitOnce.Do(func() { close(s.quit) })
+
+	s.mutex.Lock()
+	for p := range s.peers {
+		p.close()
+	}
+	s.mutex.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// SubscribePeers accepts incoming peers, dials the seed nodes and keeps connections alive
+func (s *service) SubscribePeers() error {
+	if s.listener == nil {
+		return ErrNotConnected
+	}
+
+	go s.acceptPeers()
+	for _, seed := range s.Seeds {
+		s.addKnownAddr(seed)
+		go s.dial(seed)
+	}
+	go s.keepAlive()
+
+	return nil
+}
+
+// BroadcastBlockchain broadcasts latest blockchain to peers
+func (s *service) BroadcastBlockchain(bc *listing.Blockchain) error {
+	mbc := &mining.Blockchain{}
+	for _, lBlock := range bc.Chain {
+		mbc.Chain = append(mbc.Chain, toMiningBlock(lBlock))
+	}
+
+	s.broadcast(blockEnvelope(&pubsub.Message{Kind: pubsub.KindBlockchain, Sender: s.NodeID, Blockchain: mbc}), nil)
+	return nil
+}
+
+// BroadcastBlock broadcasts a newly mined block to peers
+func (s *service) BroadcastBlock(b *mining.Block) error {
+	s.markSeen(*b.Hash)
+	s.broadcast(blockEnvelope(&pubsub.Message{Kind: pubsub.KindNewBlock, Sender: s.NodeID, Block: b}), nil)
+	return nil
+}
+
+// BroadcastTransaction broadcasts latest transaction to peers
+func (s *service) BroadcastTransaction(tx wallet.Transaction) error {
+	s.markSeen(tx.GetID())
+	s.broadcast(txEnvelope(toTx(tx)), nil)
+	return nil
+}
+
+// broadcast sends envelope to every handshaked peer except the one it came from
+func (s *service) broadcast(e *envelope, from *peer) {
+	for _, p := range s.activePeers() {
+		if p == from {
+			continue
+		}
+		if err := p.send(e); err != nil {
+			log.Printf("P2PService#broadcast: Failed to send %s to peer=%s, %v", e.Type, p.address(), err)
+		}
+	}
+}
+
+func (s *service) activePeers() []*peer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var peers []*peer
+	for p := range s.peers {
+		if p.handshaked() {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+func (s *service) acceptPeers() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			log.Printf("P2PService#acceptPeers: Failed to accept connection, %v", err)
+			continue
+		}
+
+		if s.peerCount() >= maxPeers {
+			conn.Close()
+			continue
+		}
+		go s.handlePeer(newPeer(conn, true))
+	}
+}
+
+func (s *service) dial(addr string) {
+	if s.isConnectedTo(addr) || s.peerCount() >= maxPeers {
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		log.Printf("P2PService#dial: Failed to connect to peer=%s, %v", addr, err)
+		s.removeKnownAddr(addr)
+		return
+	}
+
+	p := newPeer(conn, false)
+	p.addr = addr
+	s.handlePeer(p)
+}
+
+// handlePeer performs the version handshake and reads messages until the connection closes
+func (s *service) handlePeer(p *peer) {
+	s.mutex.Lock()
+	s.peers[p] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.peers, p)
+		s.mutex.Unlock()
+		p.close()
+		log.Printf("Disconnected from peer=%s", p.address())
+	}()
+
+	if err := p.send(&envelope{Type: typeVersion, Version: s.version()}); err != nil {
+		return
+	}
+
+	for {
+		var e envelope
+		if err := p.receive(&e, s.peerTimeout); err != nil {
+			if err == errMessageTooLarge {
+				log.Printf("P2PService#handlePeer: Dropping peer=%s, %v", p.address(), err)
+			}
+			return
+		}
+		if err := s.handleEnvelope(p, &e); err != nil {
+			log.Printf("P2PService#handlePeer: Dropping peer=%s, %v", p.address(), err)
+			return
+		}
+	}
+}
+
+func (s *service) version() *version {
+	return &version{
+		Protocol:   protocolVersion,
+		NodeID:     s.NodeID,
+		ListenAddr: s.ListenAddr,
+		BestHeight: s.l.GetBlockCount(),
+	}
+}
+
+func (s *service) handleEnvelope(p *peer, e *envelope) error {
+	switch e.Type {
+	case typeVersion:
+		return s.handleVersion(p, e.Version)
+
+	case typeVerack:
+		if !p.hasVersion() {
+			return errors.New("verack before version")
+		}
+		p.setVerack()
+		log.Printf("Connected to peer=%s, inbound=%t", p.address(), p.inbound)
+		return p.send(&envelope{Type: typeGetAddr})
+	}
+
+	if !p.handshaked() {
+		return errors.New("message before handshake")
+	}
+
+	switch e.Type {
+	case typeGetAddr:
+		return p.send(&envelope{Type: typeAddr, Addrs: s.addrsFor(p)})
+
+	case typeAddr:
+		if len(e.Addrs) > maxAddrsPerSend {
+			return errors.New("too many addresses")
+		}
+		var added []string
+		for _, addr := range e.Addrs {
+			if s.addKnownAddr(addr) {
+				added = append(added, addr)
+			}
+		}
+		if s.peerCount() < maxPeers/2 {
+			for _, addr := range sample(added, maxDialsPerRound) {
+				go s.dial(addr)
+			}
+		}
+
+	case typePing:
+		return p.send(&envelope{Type: typePong, Nonce: e.Nonce})
+
+	case typePong:
+		if latency, ok := p.pong(e.Nonce); ok {
+			log.Printf("Peer=%s latency %v", p.address(), latency)
+		}
+
+	case typeBlock:
+		if e.Message == nil {
+			return errMalformedMessage
+		}
+		msg, err := e.Message.toMessage()
+		if err != nil {
+			return err
+		}
+		s.handleBlockMessage(p, msg)
+
+	case typeTx:
+		var tx wallet.Tx
+		if err := tx.UnmarshalBinary(e.Transaction); err != nil {
+			return err
+		}
+		if s.markSeen(tx.ID) {
+			s.handleMutex.Lock()
+			s.h.HandleTransaction(&tx)
+			s.handleMutex.Unlock()
+			s.broadcast(e, p)
+		}
+	}
+
+	return nil
+}
+
+func (s *service) handleVersion(p *peer, v *version) error {
+	if v == nil || p.hasVersion() {
+		return errors.New("unexpected version message")
+	}
+	if v.Protocol != protocolVersion {
+		return errors.New("incompatible protocol version")
+	}
+	if v.NodeID == s.NodeID {
+		return errors.New("connected to self")
+	}
+	if s.hasNode(v.NodeID) {
+		return errors.New("already connected to node")
+	}
+
+	var addr string
+	if p.inbound {
+		addr = advertisedAddr(p.conn.RemoteAddr(), v.ListenAddr)
+	}
+	p.setVersion(v.NodeID, addr)
+	s.addKnownAddr(p.address())
+
+	return p.send(&envelope{Type: typeVerack})
+}
+
+func (s *service) handleBlockMessage(p *peer, msg *pubsub.Message) {
+	s.handleMutex.Lock()
+	reply := s.h.HandleMessage(msg)
+	s.handleMutex.Unlock()
+
+	if reply != nil {
+		reply.Sender = s.NodeID
+		if err := p.send(blockEnvelope(reply)); err != nil {
+			log.Printf("P2PService#handleBlockMessage: Failed to reply to peer=%s, %v", p.address(), err)
+		}
+	}
+
+	// relay new blocks that made it into the block tree
+	if msg.Kind == pubsub.KindNewBlock && msg.Block != nil && s.l.GetBlockByHash(*msg.Block.Hash) != nil && s.markSeen(*msg.Block.Hash) {
+		s.broadcast(blockEnvelope(&pubsub.Message{Kind: pubsub.KindNewBlock, Sender: s.NodeID, Block: msg.Block}), p)
+	}
+}
+
+// keepAlive pings peers and dials known addresses when short of peers
+func (s *service) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			for _, p := range s.activePeers() {
+				if err := p.send(&envelope{Type: typePing, Nonce: p.ping()}); err != nil {
+					p.close()
+				}
+			}
+
+			if s.peerCount() < maxPeers/2 {
+				for _, addr := range sample(s.unconnectedAddrs(), maxDialsPerRound) {
+					go s.dial(addr)
+				}
+			}
+		}
+	}
+}
+
+func (s *service) peerCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.peers)
+}
+
+func (s *service) isConnectedTo(addr string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for p := range s.peers {
+		if p.address() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *service) hasNode(nodeID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for p := range s.peers {
+		if p.node() == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// addKnownAddr records a peer address, returns true if it wasn't known before
+func (s *service) addKnownAddr(addr string) bool {
+	if addr == "" || addr == s.ListenAddr {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.knownAddrs[addr] || len(s.knownAddrs) >= maxKnownAddrs {
+		return false
+	}
+	s.knownAddrs[addr] = true
+	return true
+}
+
+// removeKnownAddr forgets a peer address, seeds are kept to find the network again
+func (s *service) removeKnownAddr(addr string) {
+	for _, seed := range s.Seeds {
+		if addr == seed {
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.knownAddrs, addr)
+}
+
+func (s *service) knownAddrList() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var addrs []string
+	for addr := range s.knownAddrs {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// unconnectedAddrs returns the known addresses no peer is connected from
+func (s *service) unconnectedAddrs() []string {
+	var addrs []string
+	for _, addr := range s.knownAddrList() {
+		if !s.isConnectedTo(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// sample returns up to n addresses picked at random from addrs
+func sample(addrs []string, n int) []string {
+	var picked []string
+	for _, i := range rand.Perm(len(addrs)) {
+		if len(picked) >= n {
+			break
+		}
+		picked = append(picked, addrs[i])
+	}
+	return picked
+}
+
+func (s *service) addrsFor(requester *peer) []string {
+	var addrs []string
+	for _, addr := range s.knownAddrList() {
+		if addr != requester.address() && len(addrs) < maxAddrsPerSend {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// markSeen records a block hash or transaction ID, returns true if it wasn't seen before
+func (s *service) markSeen(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.seen[id] {
+		return false
+	}
+	if len(s.seen) >= maxSeen {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[id] = true
+	return true
+}
+
+// advertisedAddr combines the remote host of a connection with the port the peer listens on
+func advertisedAddr(remote net.Addr, listenAddr string) string {
+	host, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return remote.String()
+	}
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return remote.String()
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func toTx(tx wallet.Transaction) *wallet.Tx {
+	return &wallet.Tx{
+		ID:          tx.GetID(),
+		Input:       tx.GetInput(),
+		ExtraInputs: tx.GetExtraInputs(),
+		Output:      tx.GetOutput(),
+	}
+}
+
+func toMiningBlock(lBlock listing.Block) mining.Block {
+	var txs []mining.Transaction
+	for _, transaction := range lBlock.Data {
+		txs = append(txs, mining.Transaction{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: mining.Input{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: toMiningInputs(transaction.ExtraInputs),
+		})
+	}
+	return mining.Block{
+		Timestamp:  lBlock.Timestamp,
+		LastHash:   lBlock.LastHash,
+		MerkleRoot: lBlock.MerkleRoot,
+		Hash:       lBlock.Hash,
+		Data:       txs,
+		Nonce:      lBlock.Nonce,
+		Difficulty: lBlock.Difficulty,
+	}
+}
+
+func toMiningInputs(inputs []listing.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
@@ -0,0 +1,327 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/storage/memory"
+	"github.com/knd/kndchain/pkg/validating"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_HandlePeer(t *testing.T) {
+	assert := assert.New(t)
+	var mockedListing *MockedListing
+	var s *service
+	var remote net.Conn
+	var encoder *json.Encoder
+	var decoder *json.Decoder
+	var done chan struct{}
+	remoteVersion := &version{Protocol: protocolVersion, NodeID: "remote-node", ListenAddr: "127.0.0.1:4000"}
+
+	// receive reads the next envelope the service sends to the remote side
+	receive := func() *envelope {
+		var e envelope
+		remote.SetReadDeadline(time.Now().Add(time.Second))
+		if err := decoder.Decode(&e); err != nil {
+			return nil
+		}
+		return &e
+	}
+
+	send := func(e *envelope) error {
+		remote.SetWriteDeadline(time.Now().Add(time.Second))
+		return encoder.Encode(e)
+	}
+
+	// handshake exchanges version and verack messages with the service
+	handshake := func() {
+		assert.Equal(typeVersion, receive().Type)
+		assert.NoError(send(&envelope{Type: typeVersion, Version: remoteVersion}))
+		assert.Equal(typeVerack, receive().Type)
+		assert.NoError(send(&envelope{Type: typeVerack}))
+		assert.Equal(typeGetAddr, receive().Type)
+	}
+
+	beforeEach := func() {
+		mockedListing = new(MockedListing)
+		mockedListing.On("GetBlockCount").Return(1)
+		s = NewService(mockedListing, nil, nil, "127.0.0.1:3000", nil).(*service)
+
+		var local net.Conn
+		local, remote = net.Pipe()
+		encoder = json.NewEncoder(remote)
+		decoder = json.NewDecoder(remote)
+		handled := make(chan struct{})
+		done = handled
+		go func() {
+			s.handlePeer(newPeer(local, true))
+			close(handled)
+		}()
+	}
+
+	// waitDisconnected returns true if the service drops the peer within a few seconds
+	waitDisconnected := func() bool {
+		select {
+		case <-done:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+
+	t.Run("completes handshake and activates peer", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+
+		// perform test
+		handshake()
+
+		// test verification
+		peers := s.activePeers()
+		assert.Len(peers, 1)
+		assert.Equal("remote-node", peers[0].node())
+		assert.True(s.hasNode("remote-node"))
+	})
+
+	t.Run("answers ping with pong of same nonce", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		handshake()
+
+		// perform test
+		assert.NoError(send(&envelope{Type: typePing, Nonce: 42}))
+
+		// test verification
+		assert.Equal(&envelope{Type: typePong, Nonce: 42}, receive())
+	})
+
+	t.Run("drops peer sending a second version message", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		handshake()
+
+		// perform test
+		assert.NoError(send(&envelope{Type: typeVersion, Version: remoteVersion}))
+
+		// test verification
+		assert.True(waitDisconnected())
+		assert.Nil(receive())
+		assert.Equal(0, s.peerCount())
+	})
+
+	t.Run("drops peer sending messages before handshake", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		assert.Equal(typeVersion, receive().Type)
+
+		// perform test
+		assert.NoError(send(&envelope{Type: typePing, Nonce: 42}))
+
+		// test verification
+		assert.True(waitDisconnected())
+		assert.Equal(0, s.peerCount())
+	})
+
+	t.Run("drops peer that stays silent past timeout", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		s.peerTimeout = 50 * time.Millisecond
+		handshake()
+
+		// perform test
+		disconnected := waitDisconnected()
+
+		// test verification
+		assert.True(disconnected)
+		assert.Equal(0, s.peerCount())
+	})
+
+	t.Run("drops peer sending more addresses than are ever sent", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		handshake()
+		var addrs []string
+		for i := 0; i <= maxAddrsPerSend; i++ {
+			addrs = append(addrs, fmt.Sprintf("10.0.0.1:%d", 1000+i))
+		}
+
+		// perform test
+		assert.NoError(send(&envelope{Type: typeAddr, Addrs: addrs}))
+
+		// test verification
+		assert.True(waitDisconnected())
+		assert.NotContains(s.knownAddrList(), addrs[0])
+	})
+
+	t.Run("drops peer sending message larger than limit", func(t *testing.T) {
+		beforeEach()
+		defer remote.Close()
+		assert.Equal(typeVersion, receive().Type)
+
+		// perform test
+		go func() {
+			remote.Write([]byte(`{"type":"`))
+			chunk := make([]byte, 1<<20)
+			for i := range chunk {
+				chunk[i] = 'a'
+			}
+			for i := 0; i <= maxMessageSize/len(chunk); i++ {
+				if _, err := remote.Write(chunk); err != nil {
+					return
+				}
+			}
+		}()
+
+		// test verification
+		assert.True(waitDisconnected())
+		assert.Equal(0, s.peerCount())
+	})
+}
+
+func TestService_KnownAddrs(t *testing.T) {
+	assert := assert.New(t)
+	seed := "127.0.0.1:1"
+	var s *service
+
+	// closedAddr returns a local address nothing listens on
+	closedAddr := func() string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		addr := listener.Addr().String()
+		listener.Close()
+		return addr
+	}
+
+	beforeEach := func() {
+		mockedListing := new(MockedListing)
+		mockedListing.On("GetBlockCount").Return(1)
+		s = NewService(mockedListing, nil, nil, "127.0.0.1:3000", []string{seed}).(*service)
+	}
+
+	t.Run("keeps address book within limit", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		for i := 0; i < maxKnownAddrs+10; i++ {
+			s.addKnownAddr(fmt.Sprintf("10.0.%d.%d:4000", i/256, i%256))
+		}
+
+		// test verification
+		assert.Len(s.knownAddrList(), maxKnownAddrs)
+	})
+
+	t.Run("forgets address that fails to dial but keeps seeds", func(t *testing.T) {
+		beforeEach()
+		addr := closedAddr()
+		s.addKnownAddr(seed)
+		s.addKnownAddr(addr)
+
+		// perform test
+		s.dial(addr)
+		s.dial(seed)
+
+		// test verification
+		assert.Equal([]string{seed}, s.knownAddrList())
+	})
+
+	t.Run("samples a bounded number of addresses", func(t *testing.T) {
+		addrs := make([]string, 50)
+		for i := range addrs {
+			addrs[i] = fmt.Sprintf("10.0.0.%d:4000", i)
+		}
+
+		// perform test
+		picked := sample(addrs, maxDialsPerRound)
+
+		// test verification
+		assert.Len(picked, maxDialsPerRound)
+		assert.Subset(addrs, picked)
+		assert.Len(sample(addrs[:3], maxDialsPerRound), 3)
+	})
+}
+
+func TestService_Disconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("can be called more than once", func(t *testing.T) {
+		s := NewService(new(MockedListing), nil, nil, "127.0.0.1:3000", nil)
+
+		// perform test
+		first := s.Disconnect()
+		second := s.Disconnect()
+
+		// test verification
+		assert.NoError(first)
+		assert.NoError(second)
+	})
+}
+
+func TestService_Sync(t *testing.T) {
+	assert := assert.New(t)
+	params := consensus.DefaultParams()
+
+	type node struct {
+		l listing.Service
+		m mining.Service
+		s *service
+	}
+
+	// newNode returns a node listening on a free port with an empty chain in memory
+	newNode := func(seeds []string) *node {
+		repo := memory.NewRepository()
+		l := listing.NewService(repo)
+		c := calculating.NewService(0, repo, "MINER_REWARD", params.CoinbaseMaturity)
+		v := validating.NewService(l, c, "MINER_REWARD", 10, params)
+		m := mining.NewService(repo, l, v, params, 1)
+		s := NewService(l, m, wallet.NewTransactionPool(l), "127.0.0.1:0", seeds).(*service)
+		assert.NoError(s.Connect())
+		return &node{l, m, s}
+	}
+
+	// waitFor returns true if condition holds within a few seconds
+	waitFor := func(condition func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("syncs node starting from an empty chain from genesis with hash given by config", func(t *testing.T) {
+		synced := newNode(nil)
+		defer synced.s.Disconnect()
+		genesis, _ := mining.CreateGenesisBlock("0x000", "0x000", 1, 0)
+		assert.NoError(synced.m.AddBlock(genesis))
+		var tip *mining.Block
+		for i := 0; i < 3; i++ {
+			lastBlock := toMiningBlock(synced.l.GetLastBlock())
+			block, err := synced.m.MineNewBlock(&lastBlock, []mining.Transaction{})
+			assert.NoError(err)
+			assert.NoError(synced.m.AddBlock(block))
+			tip = block
+		}
+		assert.NoError(synced.s.SubscribePeers())
+		fresh := newNode([]string{synced.s.listener.Addr().String()})
+		defer fresh.s.Disconnect()
+		assert.NoError(fresh.s.SubscribePeers())
+		assert.True(waitFor(func() bool { return len(synced.s.activePeers()) == 1 }))
+
+		// perform test
+		assert.NoError(synced.s.BroadcastBlock(tip))
+
+		// test verification
+		assert.True(waitFor(func() bool { return fresh.l.GetBlockCount() == 4 }))
+		assert.Equal(*tip.Hash, *fresh.l.GetLastBlock().Hash)
+		assert.Equal("0x000", *fresh.l.GetBlockRange(0, 1)[0].Hash)
+	})
+}
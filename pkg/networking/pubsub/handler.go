@@ -0,0 +1,162 @@
+package pubsub
+
+import (
+	"log"
+
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/wallet"
+)
+
+// maxBlocksPerMessage limits how many ancestors are sent in reply to a single request
+const maxBlocksPerMessage = 500
+
+// Handler processes messages received from peers independently of the transport carrying them
+type Handler struct {
+	l listing.Service
+	m mining.Service
+	p wallet.TransactionPool
+}
+
+// NewHandler creates a message handler with necessary dependencies
+func NewHandler(l listing.Service, m mining.Service, p wallet.TransactionPool) *Handler {
+	return &Handler{l, m, p}
+}
+
+// HandleTransaction adds a transaction received from a peer to the transaction pool
+func (h *Handler) HandleTransaction(tx wallet.Transaction) {
+	h.p.Add(tx)
+	log.Printf("Transaction received. ID=%s", tx.GetID())
+}
+
+// HandleMessage processes a block message from a peer and returns the reply to send back to it, if any
+func (h *Handler) HandleMessage(msg *Message) *Message {
+	switch msg.Kind {
+	case KindBlockchain:
+		// Replace incoming blockchain if valid chain with most work
+		if msg.Blockchain == nil {
+			return nil
+		}
+		if err := h.m.ReplaceChain(msg.Blockchain); err != nil {
+			log.Printf("PubSubHandler#HandleMessage: Failed to replace blockchain from peer=%s, %v", msg.Sender, err)
+			return nil
+		}
+		h.clearBlockTransactions()
+		log.Printf("Replaced with heavier chain. New len: %d", h.l.GetBlockCount())
+
+	case KindNewBlock:
+		if msg.Block == nil {
+			return nil
+		}
+		err := h.m.AcceptBlock(msg.Block)
+		if err == mining.ErrOrphanBlock {
+			// Only ask the sender for ancestors when the parent is unknown
+			log.Printf("Received orphan block=%s, requesting ancestors from peer=%s", *msg.Block.Hash, msg.Sender)
+			return &Message{Kind: KindGetBlocks, Locator: h.l.GetLocator(), HashStop: *msg.Block.Hash}
+		}
+		if err != nil {
+			if err != mining.ErrKnownBlock {
+				log.Printf("PubSubHandler#HandleMessage: Failed to accept block from peer=%s, %v", msg.Sender, err)
+			}
+			return nil
+		}
+		h.clearBlockTransactions()
+		log.Printf("Accepted new block=%s. Chain len: %d", *msg.Block.Hash, h.l.GetBlockCount())
+
+	case KindGetBlocks:
+		blocks := h.blocksAfterLocator(msg.Locator, msg.HashStop)
+		if len(blocks) == 0 {
+			return nil
+		}
+		return &Message{Kind: KindBlocks, Blocks: blocks, HashStop: msg.HashStop}
+
+	case KindBlocks:
+		if len(msg.Blocks) == 0 {
+			return nil
+		}
+		if err := h.m.AcceptBlocks(msg.Blocks); err != nil {
+			log.Printf("PubSubHandler#HandleMessage: Failed to accept ancestor blocks from peer=%s, %v", msg.Sender, err)
+			return nil
+		}
+		h.clearBlockTransactions()
+		log.Printf("Accepted %d ancestor blocks. Chain len: %d", len(msg.Blocks), h.l.GetBlockCount())
+
+		// the reply was cut short of the block requested, ask for the rest from the new tip
+		last := msg.Blocks[len(msg.Blocks)-1]
+		if len(msg.HashStop) != 0 && *last.Hash != msg.HashStop {
+			return &Message{Kind: KindGetBlocks, Locator: h.l.GetLocator(), HashStop: msg.HashStop}
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) clearBlockTransactions() {
+	if err := h.p.ClearBlockTransactions(); err != nil {
+		log.Printf("PubSubHandler#clearBlockTransactions: Failed to clear block transactions in transaction pool, %v", err)
+	}
+}
+
+// blocksAfterLocator returns the blocks leading to hashStop that come after the latest locator hash known here
+func (h *Handler) blocksAfterLocator(locator []string, hashStop string) []mining.Block {
+	known := make(map[string]bool)
+	for _, hash := range locator {
+		known[hash] = true
+	}
+
+	var blocks []mining.Block
+	for lBlock := h.l.GetBlockByHash(hashStop); lBlock != nil && !known[*lBlock.Hash]; lBlock = h.l.GetBlockByHash(*lBlock.LastHash) {
+		blocks = append(blocks, toMiningBlock(*lBlock))
+		if *lBlock.LastHash == *lBlock.Hash {
+			break
+		}
+	}
+
+	// send the oldest blocks first, the requester asks again for the rest
+	var result []mining.Block
+	for i := len(blocks) - 1; i >= 0 && len(result) < maxBlocksPerMessage; i-- {
+		result = append(result, blocks[i])
+	}
+	return result
+}
+
+func toMiningBlock(lBlock listing.Block) mining.Block {
+	var txs []mining.Transaction
+	for _, transaction := range lBlock.Data {
+		txs = append(txs, mining.Transaction{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: mining.Input{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: toMiningInputs(transaction.ExtraInputs),
+		})
+	}
+	return mining.Block{
+		Timestamp:  lBlock.Timestamp,
+		LastHash:   lBlock.LastHash,
+		MerkleRoot: lBlock.MerkleRoot,
+		Hash:       lBlock.Hash,
+		Data:       txs,
+		Nonce:      lBlock.Nonce,
+		Difficulty: lBlock.Difficulty,
+	}
+}
+
+func toMiningInputs(inputs []listing.Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
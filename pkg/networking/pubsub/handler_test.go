@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/wallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandler_HandleMessage(t *testing.T) {
+	assert := assert.New(t)
+	var mockedListing *MockedListing
+	var mockedMining *MockedMining
+	var handler *Handler
+	genesisHash, hash1, hash2 := "0x000", "0x001", "0x002"
+	genesis := listing.Block{Hash: &genesisHash, LastHash: &genesisHash}
+	block1 := listing.Block{Hash: &hash1, LastHash: &genesisHash}
+	block2 := listing.Block{Hash: &hash2, LastHash: &hash1}
+
+	beforeEach := func() {
+		mockedListing = new(MockedListing)
+		mockedListing.On("GetBlockByHash", genesisHash).Return(&genesis)
+		mockedListing.On("GetBlockByHash", hash1).Return(&block1)
+		mockedListing.On("GetBlockByHash", hash2).Return(&block2)
+		mockedListing.On("GetBlockchain").Return(&listing.Blockchain{})
+		mockedListing.On("GetBlockCount").Return(2)
+		mockedListing.On("GetLocator").Return([]string{hash1, genesisHash})
+		mockedMining = new(MockedMining)
+		mockedMining.On("AcceptBlocks", mock.Anything).Return(nil)
+		handler = NewHandler(mockedListing, mockedMining, wallet.NewTransactionPool(mockedListing))
+	}
+
+	t.Run("replies to getBlocks with blocks after locator up to hash stop", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		reply := handler.HandleMessage(&Message{Kind: KindGetBlocks, Locator: []string{genesisHash}, HashStop: hash2})
+
+		// test verification
+		assert.Equal(&Message{Kind: KindBlocks, Blocks: []mining.Block{toMiningBlock(block1), toMiningBlock(block2)}, HashStop: hash2}, reply)
+	})
+
+	t.Run("asks for the rest from new tip when blocks stop short of hash stop", func(t *testing.T) {
+		beforeEach()
+		blocks := []mining.Block{toMiningBlock(block1)}
+
+		// perform test
+		reply := handler.HandleMessage(&Message{Kind: KindBlocks, Blocks: blocks, HashStop: hash2})
+
+		// test verification
+		mockedMining.AssertCalled(t, "AcceptBlocks", blocks)
+		assert.Equal(&Message{Kind: KindGetBlocks, Locator: []string{hash1, genesisHash}, HashStop: hash2}, reply)
+	})
+
+	t.Run("does not ask again once blocks reach hash stop", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		reply := handler.HandleMessage(&Message{Kind: KindBlocks, Blocks: []mining.Block{toMiningBlock(block1), toMiningBlock(block2)}, HashStop: hash2})
+
+		// test verification
+		assert.Nil(reply)
+	})
+
+	t.Run("does not ask again when blocks are rejected", func(t *testing.T) {
+		beforeEach()
+		mockedMining = new(MockedMining)
+		mockedMining.On("AcceptBlocks", mock.Anything).Return(mining.ErrOrphanBlock)
+		handler = NewHandler(mockedListing, mockedMining, wallet.NewTransactionPool(mockedListing))
+
+		// perform test
+		reply := handler.HandleMessage(&Message{Kind: KindBlocks, Blocks: []mining.Block{toMiningBlock(block1)}, HashStop: hash2})
+
+		// test verification
+		assert.Nil(reply)
+	})
+}
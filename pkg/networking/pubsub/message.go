@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"github.com/knd/kndchain/pkg/mining"
+)
+
+// Kinds of messages exchanged on the block channel
+const (
+	// KindBlockchain carries a full blockchain
+	KindBlockchain = "blockchain"
+
+	// KindNewBlock carries a single newly mined block
+	KindNewBlock = "newBlock"
+
+	// KindGetBlocks requests the ancestors of a block the sender doesn't know
+	KindGetBlocks = "getBlocks"
+
+	// KindBlocks answers KindGetBlocks with the missing blocks in chain order
+	KindBlocks = "blocks"
+)
+
+// Message is the envelope of block messages sent between peers
+type Message struct {
+	Kind       string             `json:"kind"`
+	Sender     string             `json:"sender"`
+	Receiver   string             `json:"receiver,omitempty"`
+	Blockchain *mining.Blockchain `json:"blockchain,omitempty"`
+	Block      *mining.Block      `json:"block,omitempty"`
+	Blocks     []mining.Block     `json:"blocks,omitempty"`
+	// Locator lists hashes of the requester's main chain, dense near the tip and sparse towards genesis
+	Locator  []string `json:"locator,omitempty"`
+	HashStop string   `json:"hashStop,omitempty"`
+}
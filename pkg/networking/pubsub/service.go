@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
 	"github.com/knd/kndchain/pkg/wallet"
@@ -16,14 +17,15 @@ type Service interface {
 	Disconnect() error
 	SubscribePeers() error
 	BroadcastBlockchain(bc *listing.Blockchain) error
+	BroadcastBlock(b *mining.Block) error
 	BroadcastTransaction(tx wallet.Transaction) error
 }
 
 type service struct {
 	l                   listing.Service
-	m                   mining.Service
-	p                   wallet.TransactionPool
+	h                   *Handler
 	psc                 *redis.PubSubConn
+	NodeID              string
 	ChannelPubSub       string
 	ChannelTransactions string
 	URLPubSub           string
@@ -33,8 +35,8 @@ type service struct {
 func NewService(l listing.Service, m mining.Service, p wallet.TransactionPool, channelPubSub string, channelTransactions string, urlPubSub string) Service {
 	return &service{
 		l:                   l,
-		m:                   m,
-		p:                   p,
+		h:                   NewHandler(l, m, p),
+		NodeID:              uuid.New().String(),
 		ChannelPubSub:       channelPubSub,
 		ChannelTransactions: channelTransactions,
 		URLPubSub:           urlPubSub,
@@ -61,22 +63,17 @@ func (s *service) Disconnect() error {
 
 // BroadcastBlockchain broadcasts latest blockchain to peers
 func (s *service) BroadcastBlockchain(bc *listing.Blockchain) error {
-	b, err := json.Marshal(*bc)
-	if err != nil {
-		log.Printf("PubSubService#BroadcastBlockchain: Failed to json marshal blockchain, %v", err)
-		return err
+	mbc := &mining.Blockchain{}
+	for _, lBlock := range bc.Chain {
+		mbc.Chain = append(mbc.Chain, toMiningBlock(lBlock))
 	}
 
-	conn, err := redis.DialURL(s.URLPubSub)
-	defer conn.Close()
-	if err != nil {
-		log.Printf("PubSubService#BroadcastBlockchain: Failed to dial tcp connection, %v", err)
-		return err
-	}
-
-	_, err = conn.Do("PUBLISH", s.ChannelPubSub, string(b[:]))
+	return s.publishMessage(&Message{Kind: KindBlockchain, Blockchain: mbc})
+}
 
-	return err
+// BroadcastBlock broadcasts a newly mined block to peers
+func (s *service) BroadcastBlock(b *mining.Block) error {
+	return s.publishMessage(&Message{Kind: KindNewBlock, Block: b})
 }
 
 // BroadcastTransaction broadcasts latest transaction to peers
@@ -86,19 +83,34 @@ func (s *service) BroadcastTransaction(tx wallet.Transaction) error {
 		log.Fatal(err)
 	}
 
+	return s.publish(s.ChannelTransactions, b)
+}
+
+func (s *service) publishMessage(msg *Message) error {
+	msg.Sender = s.NodeID
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("PubSubService#publishMessage: Failed to json marshal message kind=%s, %v", msg.Kind, err)
+		return err
+	}
+
+	return s.publish(s.ChannelPubSub, b)
+}
+
+func (s *service) publish(channel string, b []byte) error {
 	conn, err := redis.DialURL(s.URLPubSub)
-	defer conn.Close()
 	if err != nil {
-		log.Printf("PubSubService#BroadcastTransaction: Failed to dial tcp connection, %v", err)
+		log.Printf("PubSubService#publish: Failed to dial tcp connection, %v", err)
 		return err
 	}
+	defer conn.Close()
 
-	_, err = conn.Do("PUBLISH", s.ChannelTransactions, string(b[:]))
+	_, err = conn.Do("PUBLISH", channel, string(b[:]))
 
 	return err
 }
 
-// SubscribePeers listens to peers for incoming blockchain and transactions
+// SubscribePeers listens to peers for incoming blocks and transactions
 func (s *service) SubscribePeers() error {
 	err := s.psc.Subscribe(s.ChannelPubSub)
 	if err != nil {
@@ -117,29 +129,22 @@ func (s *service) SubscribePeers() error {
 			switch v := s.psc.Receive().(type) {
 			case redis.Message:
 				if v.Channel == s.ChannelPubSub {
-					// Received incoming blockchain
-					// Replace incoming blockchain if valid longest chain
-					var bc mining.Blockchain
-					var err error
-					err = json.Unmarshal(v.Data, &bc)
+					var msg Message
+					err := json.Unmarshal(v.Data, &msg)
 					if err != nil {
-						log.Printf("PubSubService#SubscribePeers: Coudn't unmarshall incoming blockchain, %v", err)
+						log.Printf("PubSubService#SubscribePeers: Coudn't unmarshall incoming message, %v", err)
 						continue
 					}
-
-					err = s.m.ReplaceChain(&bc)
-					if err != nil {
-						log.Printf("PubSubService#SubscribePeers: Failed to replace blockchain, %v", err)
+					if msg.Sender == s.NodeID || (msg.Receiver != "" && msg.Receiver != s.NodeID) {
 						continue
 					}
 
-					err = s.p.ClearBlockTransactions()
-					if err != nil {
-						log.Printf("PubSubService#SubscribePeers: Failed to clear block transactions in transaction pool, %v", err)
-						continue
+					if reply := s.h.HandleMessage(&msg); reply != nil {
+						reply.Receiver = msg.Sender
+						if err := s.publishMessage(reply); err != nil {
+							log.Printf("PubSubService#SubscribePeers: Failed to reply with message kind=%s, %v", reply.Kind, err)
+						}
 					}
-
-					log.Printf("Replaced with longer chain. New len: %d", s.l.GetBlockCount())
 				} else if v.Channel == s.ChannelTransactions {
 					// Received incoming transaction
 					// add transaction to pool
@@ -150,8 +155,7 @@ func (s *service) SubscribePeers() error {
 						log.Printf("PubSubService#SubscribePeers: Couldn't unmarshall incoming transaction, %v", err)
 						continue
 					}
-					s.p.Add(&tx)
-					log.Printf("Transaction received. ID=%s", tx.GetID())
+					s.h.HandleTransaction(&tx)
 				}
 
 			case redis.Subscription:
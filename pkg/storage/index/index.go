@@ -0,0 +1,176 @@
+package index
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/validating"
+)
+
+// ErrKnownBlock is used when block is already in the index
+var ErrKnownBlock = errors.New("Block is already in the index")
+
+// Node is a block entry in the block index
+type Node struct {
+	Hash   string
+	Parent *Node
+	Height uint32
+	// Work is the cumulative work from genesis up to and including this block
+	Work *big.Int
+}
+
+// Reorg describes how the main chain moves from the old tip to the new tip
+type Reorg struct {
+	// Disconnect lists main chain blocks to remove, from the old tip down to the fork point
+	Disconnect []*Node
+	// Connect lists blocks to add, from the fork point up to the new tip
+	Connect []*Node
+}
+
+// BlockIndex keeps every known block keyed by hash and tracks the tip with most work
+type BlockIndex struct {
+	nodes map[string]*Node
+	tip   *Node
+	main  []*Node // main chain blocks by height
+	mutex *sync.RWMutex
+}
+
+// New creates an empty block index
+func New() *BlockIndex {
+	return &BlockIndex{
+		nodes: make(map[string]*Node),
+		mutex: &sync.RWMutex{},
+	}
+}
+
+// Tip returns the last block of the main chain, nil if index is empty
+func (idx *BlockIndex) Tip() *Node {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return idx.tip
+}
+
+// Get returns the indexed block with given hash, nil if not known
+func (idx *BlockIndex) Get(hash string) *Node {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return idx.nodes[hash]
+}
+
+// MainChain returns up to limit main chain blocks starting at height start, in chain order
+func (idx *BlockIndex) MainChain(start uint32, limit uint32) []*Node {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if idx.tip == nil || limit == 0 || start > idx.tip.Height {
+		return nil
+	}
+
+	end := start + limit - 1
+	if end > idx.tip.Height || end < start {
+		end = idx.tip.Height
+	}
+
+	nodes := make([]*Node, end-start+1)
+	copy(nodes, idx.main[start:end+1])
+	return nodes
+}
+
+// MainChainHeight returns the height of block with given hash when it is on the main chain
+func (idx *BlockIndex) MainChainHeight(hash string) (uint32, bool) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	node, ok := idx.nodes[hash]
+	if !ok || node.Height >= uint32(len(idx.main)) || idx.main[node.Height] != node {
+		return 0, false
+	}
+	return node.Height, true
+}
+
+// Add indexes a block under its parent.
+// The first block added to an empty index is the genesis block.
+// A non-nil Reorg is returned when the block becomes the new tip.
+// mining.ErrOrphanBlock is returned when the parent is not indexed yet.
+func (idx *BlockIndex) Add(hash string, lastHash string, difficulty uint32) (*Reorg, error) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if _, ok := idx.nodes[hash]; ok {
+		return nil, ErrKnownBlock
+	}
+
+	if idx.tip == nil {
+		node := &Node{Hash: hash, Work: validating.BlockWork(difficulty)}
+		idx.nodes[hash] = node
+		idx.tip = node
+		idx.main = []*Node{node}
+		return &Reorg{Connect: []*Node{node}}, nil
+	}
+
+	parent, ok := idx.nodes[lastHash]
+	if !ok {
+		return nil, mining.ErrOrphanBlock
+	}
+
+	node := &Node{
+		Hash:   hash,
+		Parent: parent,
+		Height: parent.Height + 1,
+		Work:   new(big.Int).Add(parent.Work, validating.BlockWork(difficulty)),
+	}
+	idx.nodes[hash] = node
+
+	if validating.CompareWork(node.Work, node.Hash, idx.tip.Work, idx.tip.Hash) <= 0 {
+		// block extends a side branch
+		return nil, nil
+	}
+
+	reorg := findReorg(idx.tip, node)
+	idx.tip = node
+	idx.main = append(idx.main[:reorg.Connect[0].Height], reorg.Connect...)
+
+	return reorg, nil
+}
+
+// ReorgTo returns how the main chain would move from the tip to the block with given hash, nil if the block is unknown
+func (idx *BlockIndex) ReorgTo(hash string) *Reorg {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	node, ok := idx.nodes[hash]
+	if !ok {
+		return nil
+	}
+	return findReorg(idx.tip, node)
+}
+
+func findReorg(oldTip *Node, newTip *Node) *Reorg {
+	reorg := &Reorg{}
+	var connect []*Node
+
+	a, b := oldTip, newTip
+	for a.Height > b.Height {
+		reorg.Disconnect = append(reorg.Disconnect, a)
+		a = a.Parent
+	}
+	for b.Height > a.Height {
+		connect = append(connect, b)
+		b = b.Parent
+	}
+	for a != b {
+		reorg.Disconnect = append(reorg.Disconnect, a)
+		connect = append(connect, b)
+		a, b = a.Parent, b.Parent
+	}
+
+	for i := len(connect) - 1; i >= 0; i-- {
+		reorg.Connect = append(reorg.Connect, connect[i])
+	}
+
+	return reorg
+}
@@ -0,0 +1,125 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockIndex(t *testing.T) {
+	assert := assert.New(t)
+	var blockIndex *BlockIndex
+
+	beforeEach := func() {
+		blockIndex = New()
+		blockIndex.Add("genesis", "genesis", 1)
+		blockIndex.Add("a1", "genesis", 1)
+		blockIndex.Add("a2", "a1", 1)
+	}
+
+	t.Run("indexes first block as genesis", func(t *testing.T) {
+		beforeEach()
+
+		// perform test & verification
+		assert.Nil(blockIndex.Get("genesis").Parent)
+		assert.Equal(uint32(2), blockIndex.Get("a2").Height)
+		assert.Equal("a2", blockIndex.Tip().Hash)
+	})
+
+	t.Run("rejects known block", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		_, err := blockIndex.Add("a1", "genesis", 1)
+
+		// test verification
+		assert.Equal(ErrKnownBlock, err)
+	})
+
+	t.Run("keeps side branch with less work", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		reorg, err := blockIndex.Add("b1", "genesis", 1)
+
+		// test verification
+		assert.Nil(err)
+		assert.Nil(reorg)
+		assert.NotNil(blockIndex.Get("b1"))
+		assert.Equal("a2", blockIndex.Tip().Hash)
+	})
+
+	t.Run("reorganizes when side branch overtakes main chain", func(t *testing.T) {
+		beforeEach()
+		blockIndex.Add("b1", "genesis", 1)
+
+		// perform test
+		reorg, err := blockIndex.Add("b2", "b1", 3)
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal("b2", blockIndex.Tip().Hash)
+		assert.Equal([]*Node{blockIndex.Get("a2"), blockIndex.Get("a1")}, reorg.Disconnect)
+		assert.Equal([]*Node{blockIndex.Get("b1"), blockIndex.Get("b2")}, reorg.Connect)
+	})
+
+	t.Run("returns orphan error when parent is unknown", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		_, err := blockIndex.Add("c2", "c1", 1)
+
+		// test verification
+		assert.Equal(mining.ErrOrphanBlock, err)
+		assert.Nil(blockIndex.Get("c2"))
+	})
+
+	t.Run("lists main chain range from given height", func(t *testing.T) {
+		beforeEach()
+		blockIndex.Add("b1", "genesis", 1)
+
+		// perform test
+		nodes := blockIndex.MainChain(1, 5)
+
+		// test verification
+		assert.Len(nodes, 2)
+		assert.Equal("a1", nodes[0].Hash)
+		assert.Equal("a2", nodes[1].Hash)
+		assert.Nil(blockIndex.MainChain(3, 5))
+		assert.Len(blockIndex.MainChain(0, 1), 1)
+	})
+
+	t.Run("tells heights of main chain blocks only", func(t *testing.T) {
+		beforeEach()
+		blockIndex.Add("b1", "genesis", 1)
+		blockIndex.Add("b2", "b1", 3)
+
+		// perform test
+		height, onMain := blockIndex.MainChainHeight("b2")
+		_, oldOnMain := blockIndex.MainChainHeight("a1")
+		_, unknownOnMain := blockIndex.MainChainHeight("c1")
+
+		// test verification
+		assert.True(onMain)
+		assert.Equal(uint32(2), height)
+		assert.False(oldOnMain)
+		assert.False(unknownOnMain)
+		assert.Equal([]*Node{blockIndex.Get("genesis"), blockIndex.Get("b1"), blockIndex.Get("b2")}, blockIndex.MainChain(0, 5))
+	})
+
+	t.Run("finds path from tip to side branch block", func(t *testing.T) {
+		beforeEach()
+		blockIndex.Add("b1", "genesis", 1)
+
+		// perform test
+		reorg := blockIndex.ReorgTo("b1")
+
+		// test verification
+		assert.Equal([]*Node{blockIndex.Get("a2"), blockIndex.Get("a1")}, reorg.Disconnect)
+		assert.Equal([]*Node{blockIndex.Get("b1")}, reorg.Connect)
+		assert.Empty(blockIndex.ReorgTo("a2").Connect)
+		assert.Nil(blockIndex.ReorgTo("c1"))
+		assert.Equal("a2", blockIndex.Tip().Hash)
+	})
+}
@@ -0,0 +1,217 @@
+package leveldb
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/storage/index"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrPersistAccounts indicates when there is error persisting account states
+var ErrPersistAccounts = errors.New("Failed to persist account states")
+
+const (
+	accountKeyPrefix = "account/"
+	undoKeyPrefix    = "undo/"
+	// accountTipKey holds the hash of the main chain tip the account states are at
+	accountTipKey = "tip"
+)
+
+// GetAccount returns the account of address as of the main chain tip, nil if address has no transactions yet
+func (db *LevelDB) GetAccount(address string) *calculating.Account {
+	accountBytes, err := db.accountDB.Get([]byte(accountKeyPrefix+address), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	var account calculating.Account
+	if err := json.Unmarshal(accountBytes, &account); err != nil {
+		panic(err)
+	}
+	return &account
+}
+
+// GetAccountsAt returns the account states as of the block with given hash, nil if the block is unknown.
+// States of a block off the tip are the tip states with the undo records of disconnected blocks and the blocks
+// of its branch applied on top, so only the blocks since the fork point are looked at.
+func (db *LevelDB) GetAccountsAt(hash string) func(address string) calculating.Account {
+	reorg := db.index.ReorgTo(hash)
+	if reorg == nil {
+		return nil
+	}
+
+	// overlay holds the states that differ from the tip, nil when the account does not exist at the block
+	overlay := make(map[string]*calculating.Account)
+	for _, node := range reorg.Disconnect {
+		undo, err := db.getUndo(node.Hash)
+		if err != nil {
+			return nil
+		}
+		for address, prev := range undo {
+			overlay[address] = prev
+		}
+	}
+	accountOf := func(address string) calculating.Account {
+		account, ok := overlay[address]
+		if !ok {
+			account = db.GetAccount(address)
+		}
+		if account == nil {
+			return calculating.Account{}
+		}
+		return *account
+	}
+	for _, node := range reorg.Connect {
+		rBlock := db.getRepoBlock(node.Hash)
+		if rBlock == nil {
+			return nil
+		}
+		for address, account := range calculating.ApplyBlock(toCalculatingBlock(*rBlock), accountOf) {
+			updated := account
+			overlay[address] = &updated
+		}
+	}
+
+	return accountOf
+}
+
+// getUndo returns the account states the main chain block with given hash replaced
+func (db *LevelDB) getUndo(hash string) (map[string]*calculating.Account, error) {
+	undoBytes, err := db.accountDB.Get([]byte(undoKeyPrefix+hash), nil)
+	if err != nil {
+		return nil, ErrPersistAccounts
+	}
+	var undo map[string]*calculating.Account
+	if err := json.Unmarshal(undoBytes, &undo); err != nil {
+		return nil, ErrPersistAccounts
+	}
+	return undo, nil
+}
+
+// applyAccounts moves account states along the reorg, disconnected blocks are undone before connected blocks are applied
+func (db *LevelDB) applyAccounts(reorg *index.Reorg, tipHash string) error {
+	batch := new(leveldb.Batch)
+	// pending holds states changed in this batch, nil when the account is removed
+	pending := make(map[string]*calculating.Account)
+	accountOf := func(address string) *calculating.Account {
+		if account, ok := pending[address]; ok {
+			return account
+		}
+		return db.GetAccount(address)
+	}
+	setAccount := func(address string, account *calculating.Account) {
+		pending[address] = account
+		if account == nil {
+			batch.Delete([]byte(accountKeyPrefix + address))
+			return
+		}
+		accountBytes, _ := json.Marshal(account)
+		batch.Put([]byte(accountKeyPrefix+address), accountBytes)
+	}
+
+	for _, node := range reorg.Disconnect {
+		undo, err := db.getUndo(node.Hash)
+		if err != nil {
+			return err
+		}
+		for address, prev := range undo {
+			setAccount(address, prev)
+		}
+		batch.Delete([]byte(undoKeyPrefix + node.Hash))
+	}
+
+	for _, node := range reorg.Connect {
+		rBlock := db.getRepoBlock(node.Hash)
+		if rBlock == nil {
+			return ErrPersistAccounts
+		}
+
+		undo := make(map[string]*calculating.Account)
+		accounts := calculating.ApplyBlock(toCalculatingBlock(*rBlock), func(address string) calculating.Account {
+			if account := accountOf(address); account != nil {
+				return *account
+			}
+			return calculating.Account{}
+		})
+		for address, account := range accounts {
+			undo[address] = accountOf(address)
+			updated := account
+			setAccount(address, &updated)
+		}
+
+		undoBytes, _ := json.Marshal(undo)
+		batch.Put([]byte(undoKeyPrefix+node.Hash), undoBytes)
+	}
+
+	batch.Put([]byte(accountTipKey), []byte(tipHash))
+	if err := db.accountDB.Write(batch, nil); err != nil {
+		return ErrPersistAccounts
+	}
+	return nil
+}
+
+// loadAccounts rebuilds account states from the main chain when they are not at the indexed tip,
+// e.g. after an interrupted write or on a data dir created before account states were kept
+func (db *LevelDB) loadAccounts() error {
+	tip := db.index.Tip()
+	if tip == nil {
+		return nil
+	}
+
+	tipHash, err := db.accountDB.Get([]byte(accountTipKey), nil)
+	if err == nil && string(tipHash) == tip.Hash {
+		return nil
+	}
+
+	if err := deleteDB(db.accountDB); err != nil {
+		return err
+	}
+	return db.applyAccounts(&index.Reorg{Connect: db.index.MainChain(0, tip.Height+1)}, tip.Hash)
+}
+
+func toCalculatingBlock(b Block) calculating.Block {
+	var transactions []calculating.Transaction
+	for _, tx := range b.Data {
+		transactions = append(transactions, calculating.Transaction{
+			ID:     tx.ID,
+			Output: tx.Output,
+			Input: calculating.Input{
+				Timestamp: tx.Input.Timestamp,
+				Amount:    tx.Input.Amount,
+				Address:   tx.Input.Address,
+				Nonce:     tx.Input.Nonce,
+				Signature: tx.Input.Signature,
+			},
+			ExtraInputs: toCalculatingInputs(tx.ExtraInputs),
+		})
+	}
+
+	return calculating.Block{
+		Timestamp:  b.Timestamp,
+		LastHash:   &b.LastHash,
+		MerkleRoot: b.MerkleRoot,
+		Hash:       &b.Hash,
+		Nonce:      b.Nonce,
+		Difficulty: b.Difficulty,
+		Data:       transactions,
+	}
+}
+
+func toCalculatingInputs(inputs []Input) []calculating.Input {
+	var result []calculating.Input
+	for _, input := range inputs {
+		result = append(result, calculating.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
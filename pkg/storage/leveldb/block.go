@@ -5,20 +5,23 @@ type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
 // Transaction in data
 type Transaction struct {
-	ID     string            `json:"id"`
-	Input  Input             `json:"input"`
-	Output map[string]uint64 `json:"output"`
+	ID          string            `json:"id"`
+	Input       Input             `json:"input"`
+	ExtraInputs []Input           `json:"extraInputs,omitempty"`
+	Output      map[string]uint64 `json:"output"`
 }
 
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   string        `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       string        `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
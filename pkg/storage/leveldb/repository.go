@@ -1,16 +1,20 @@
 package leveldb
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 	"path"
+	"sort"
 	"sync"
 
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/storage/index"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -19,11 +23,12 @@ type LevelDB struct {
 	PathToTransactionData string
 	PathToBlockData       string
 	PathToChainData       string
+	PathToAccountData     string
 	transactionDB         *leveldb.DB
 	blockDB               *leveldb.DB
 	chainDB               *leveldb.DB
-	currentBlockHash      string
-	blockCount            uint32
+	accountDB             *leveldb.DB
+	index                 *index.BlockIndex
 	mutex                 *sync.Mutex
 }
 
@@ -33,6 +38,7 @@ func NewRepository(pathToDataDir string) *LevelDB {
 		PathToTransactionData: path.Join(pathToDataDir, "transactionDatadir"),
 		PathToBlockData:       path.Join(pathToDataDir, "blockDatadir"),
 		PathToChainData:       path.Join(pathToDataDir, "chainDatadir"),
+		PathToAccountData:     path.Join(pathToDataDir, "accountDatadir"),
 		mutex:                 &sync.Mutex{},
 	}
 
@@ -57,6 +63,13 @@ func NewRepository(pathToDataDir string) *LevelDB {
 		}
 	}
 
+	if dirExisted, _ := exists(r.PathToAccountData); !dirExisted {
+		if err := os.Mkdir(r.PathToAccountData, os.ModePerm); err != nil {
+			log.Println(err)
+			log.Fatalf("Failed to create dir=%s", r.PathToAccountData)
+		}
+	}
+
 	transactionDB, err := leveldb.OpenFile(r.PathToTransactionData, nil)
 	if err != nil {
 		log.Fatalf("Failed to open leveldb#openfile dir=%s, %v", r.PathToTransactionData, err)
@@ -75,9 +88,114 @@ func NewRepository(pathToDataDir string) *LevelDB {
 	}
 	r.chainDB = chainDB
 
+	accountDB, err := leveldb.OpenFile(r.PathToAccountData, nil)
+	if err != nil {
+		log.Fatalf("Failed to open leveldb#openfile dir=%s, %v", r.PathToAccountData, err)
+	}
+	r.accountDB = accountDB
+
+	r.index = index.New()
+	if err := r.loadIndex(); err != nil {
+		log.Fatalf("Failed to load block index, %v", err)
+	}
+	if err := r.loadAccounts(); err != nil {
+		log.Fatalf("Failed to load account states, %v", err)
+	}
+
 	return r
 }
 
+// loadIndex rebuilds the block index from persisted blocks, main chain first then side branches
+func (db *LevelDB) loadIndex() error {
+	blocks := make(map[string]Block)
+	iter := db.blockDB.NewIterator(nil, nil)
+	for iter.Next() {
+		var rBlock Block
+		if err := json.Unmarshal(iter.Value(), &rBlock); err != nil {
+			iter.Release()
+			return err
+		}
+		blocks[rBlock.Hash] = rBlock
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	legacy := false
+	iter = db.chainDB.NewIterator(nil, nil)
+	for iter.Next() {
+		if len(iter.Key()) != chainKeyLen {
+			legacy = true
+			break
+		}
+		rBlock, ok := blocks[string(iter.Value())]
+		if !ok {
+			iter.Release()
+			return fmt.Errorf("main chain block=%s is missing in block db", string(iter.Value()))
+		}
+		if _, err := db.index.Add(rBlock.Hash, rBlock.LastHash, rBlock.Difficulty); err != nil {
+			iter.Release()
+			return err
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	// chain db keyed by block timestamps is rebuilt from the block tree
+	if legacy {
+		log.Println("LevelDB#loadIndex: Chain db is keyed by timestamps, Rebuilding it by heights")
+		db.index = index.New()
+		deleteDB(db.chainDB)
+	}
+
+	var sideBlocks []Block
+	for hash, rBlock := range blocks {
+		if db.index.Get(hash) == nil {
+			sideBlocks = append(sideBlocks, rBlock)
+		}
+	}
+	// genesis goes first when there is no main chain to add side blocks to
+	isGenesis := func(rBlock Block) bool {
+		_, ok := blocks[rBlock.LastHash]
+		return !ok || rBlock.LastHash == rBlock.Hash
+	}
+	sort.Slice(sideBlocks, func(i, j int) bool {
+		if isGenesis(sideBlocks[i]) != isGenesis(sideBlocks[j]) {
+			return isGenesis(sideBlocks[i])
+		}
+		return sideBlocks[i].Timestamp < sideBlocks[j].Timestamp
+	})
+	// a block may be earlier than its parent, so side blocks whose parent is not indexed yet wait for the next pass
+	for len(sideBlocks) > 0 {
+		var pending []Block
+		for _, rBlock := range sideBlocks {
+			reorg, err := db.index.Add(rBlock.Hash, rBlock.LastHash, rBlock.Difficulty)
+			if err == mining.ErrOrphanBlock {
+				pending = append(pending, rBlock)
+				continue
+			}
+			if err != nil && err != index.ErrKnownBlock {
+				return err
+			}
+			// a crash after a block is persisted and before the main chain moves to it leaves chain db behind
+			if reorg != nil {
+				if err := db.writeMainChain(reorg); err != nil {
+					return err
+				}
+			}
+		}
+		if len(pending) == len(sideBlocks) {
+			log.Printf("LevelDB#loadIndex: %d side blocks have no indexed ancestor, Skipping them", len(pending))
+			break
+		}
+		sideBlocks = pending
+	}
+
+	return nil
+}
+
 // ErrAddNilBlock is used when no mined block is given to add
 var ErrAddNilBlock = errors.New("Mined block is not given to add")
 
@@ -90,15 +208,29 @@ var ErrPersistBlock = errors.New("Failed to persist block")
 // ErrPersistBlockchain indicates where there is error persisting blockchain
 var ErrPersistBlockchain = errors.New("Failed to persist blockchain")
 
-// AddBlock adds mined block into blockchain
+// AddBlock adds mined block into block tree, the main chain follows the tip with most work
 func (db *LevelDB) AddBlock(minedBlock *mining.Block) error {
 	if minedBlock == nil {
 		return ErrAddNilBlock
 	}
 
-	rBlock := toRepoBlock(minedBlock)
-
 	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.addBlock(*minedBlock)
+}
+
+func (db *LevelDB) addBlock(minedBlock mining.Block) error {
+	rBlock := toRepoBlock(&minedBlock)
+
+	reorg, err := db.index.Add(rBlock.Hash, rBlock.LastHash, rBlock.Difficulty)
+	if err == index.ErrKnownBlock {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
 	// add to transaction db
 	for _, tx := range rBlock.Data {
 		txBytes, err := json.Marshal(tx)
@@ -106,7 +238,7 @@ func (db *LevelDB) AddBlock(minedBlock *mining.Block) error {
 			panic(err)
 		}
 		if err := db.transactionDB.Put(
-			[]byte(fmt.Sprintf("%v", tx.Input.Timestamp)),
+			[]byte(tx.ID),
 			txBytes,
 			nil); err != nil {
 			return ErrPersistTransaction
@@ -114,6 +246,24 @@ func (db *LevelDB) AddBlock(minedBlock *mining.Block) error {
 	}
 
 	// add to block db
+	if err := db.putBlock(rBlock); err != nil {
+		return err
+	}
+
+	// move main chain in chain db
+	if reorg != nil {
+		if err := db.applyReorg(reorg); err != nil {
+			return err
+		}
+		log.Printf("Added block. Timestamp: %d, BlockHash=%s, Count=%d", rBlock.Timestamp, rBlock.Hash, db.index.Tip().Height+1)
+	} else {
+		log.Printf("Added side branch block. Timestamp: %d, BlockHash=%s", rBlock.Timestamp, rBlock.Hash)
+	}
+
+	return nil
+}
+
+func (db *LevelDB) putBlock(rBlock *Block) error {
 	blockBytes, err := json.Marshal(rBlock)
 	if err != nil {
 		panic(err)
@@ -124,21 +274,49 @@ func (db *LevelDB) AddBlock(minedBlock *mining.Block) error {
 		nil); err != nil {
 		return ErrPersistBlock
 	}
+	return nil
+}
 
-	// add to chain db
-	if err := db.chainDB.Put(
-		[]byte(fmt.Sprintf("%v", rBlock.Timestamp)),
-		[]byte(rBlock.Hash),
-		nil); err != nil {
-		return ErrPersistBlockchain
+// applyReorg moves the main chain along reorg in chain db, then the account states. The two DBs can't share a batch,
+// so account db records the tip its states are at and loadAccounts brings them up to the main chain on open
+// if a crash comes between the two writes.
+func (db *LevelDB) applyReorg(reorg *index.Reorg) error {
+	if len(reorg.Disconnect) > 0 {
+		log.Printf("Reorganizing chain. Disconnecting %d blocks, Connecting %d blocks", len(reorg.Disconnect), len(reorg.Connect))
+	}
+
+	if err := db.writeMainChain(reorg); err != nil {
+		return err
 	}
+	return db.applyAccounts(reorg, reorg.Connect[len(reorg.Connect)-1].Hash)
+}
+
+// chainKeyLen is the length of chain db keys, the big-endian heights of main chain blocks
+const chainKeyLen = 4
 
-	db.currentBlockHash = rBlock.Hash
-	db.blockCount++
-	db.mutex.Unlock()
+func chainKey(height uint32) []byte {
+	key := make([]byte, chainKeyLen)
+	binary.BigEndian.PutUint32(key, height)
+	return key
+}
 
-	log.Printf("Added block. Timestamp: %d, BlockHash=%s, Count=%d", rBlock.Timestamp, db.currentBlockHash, db.blockCount)
+// writeMainChain moves the main chain along reorg in chain db. Blocks are keyed by height,
+// so the chain db iterates in chain order whatever the block timestamps are.
+func (db *LevelDB) writeMainChain(reorg *index.Reorg) error {
+	batch := new(leveldb.Batch)
+	for _, node := range reorg.Disconnect {
+		batch.Delete(chainKey(node.Height))
+	}
+	for _, node := range reorg.Connect {
+		if db.getRepoBlock(node.Hash) == nil {
+			return ErrPersistBlockchain
+		}
+		batch.Put(chainKey(node.Height), []byte(node.Hash))
+	}
 
+	if err := db.chainDB.Write(batch, nil); err != nil {
+		return ErrPersistBlockchain
+	}
 	return nil
 }
 
@@ -152,13 +330,16 @@ func toRepoBlock(miningBlock *mining.Block) *Block {
 				Timestamp: miningBlockTransaction.Input.Timestamp,
 				Amount:    miningBlockTransaction.Input.Amount,
 				Address:   miningBlockTransaction.Input.Address,
+				Nonce:     miningBlockTransaction.Input.Nonce,
 				Signature: miningBlockTransaction.Input.Signature,
 			},
+			ExtraInputs: toRepoInputs(miningBlockTransaction.ExtraInputs),
 		})
 	}
 	return &Block{
 		Timestamp:  miningBlock.Timestamp,
 		LastHash:   *miningBlock.LastHash,
+		MerkleRoot: miningBlock.MerkleRoot,
 		Hash:       *miningBlock.Hash,
 		Nonce:      miningBlock.Nonce,
 		Difficulty: miningBlock.Difficulty,
@@ -166,62 +347,105 @@ func toRepoBlock(miningBlock *mining.Block) *Block {
 	}
 }
 
-// GetBlockCount returns the latest block count in blockchain
-func (db *LevelDB) GetBlockCount() uint32 {
-	if db.blockCount != 0 {
-		return db.blockCount
+func toMiningBlock(b Block) mining.Block {
+	var transactions []mining.Transaction
+	for _, tx := range b.Data {
+		transactions = append(transactions, mining.Transaction{
+			ID:     tx.ID,
+			Output: tx.Output,
+			Input: mining.Input{
+				Timestamp: tx.Input.Timestamp,
+				Amount:    tx.Input.Amount,
+				Address:   tx.Input.Address,
+				Nonce:     tx.Input.Nonce,
+				Signature: tx.Input.Signature,
+			},
+			ExtraInputs: toMiningInputs(tx.ExtraInputs),
+		})
 	}
 
-	var count uint32
-	iter := db.chainDB.NewIterator(nil, nil)
-	for iter.Next() {
-		count++
+	return mining.Block{
+		Timestamp:  b.Timestamp,
+		LastHash:   &b.LastHash,
+		MerkleRoot: b.MerkleRoot,
+		Hash:       &b.Hash,
+		Nonce:      b.Nonce,
+		Difficulty: b.Difficulty,
+		Data:       transactions,
 	}
-	iter.Release()
-	err := iter.Error()
-	if err != nil {
-		panic(err)
+}
+
+// GetBlockCount returns the latest block count in blockchain
+func (db *LevelDB) GetBlockCount() uint32 {
+	tip := db.index.Tip()
+	if tip == nil {
+		return 0
 	}
-	return count
+	return tip.Height + 1
 }
 
 // GetLastBlock returns the last block in blockchain
 func (db *LevelDB) GetLastBlock() listing.Block {
-	if db.currentBlockHash != "" {
-		db.mutex.Lock()
-		lBlock := db.GetBlockByHash(db.currentBlockHash)
-		if lBlock == nil {
-			panic("No last block found by currentBlockHash")
-		}
-		db.mutex.Unlock()
-		return *lBlock
+	tip := db.index.Tip()
+	if tip == nil {
+		panic("Blockchain is empty")
 	}
 
-	db.mutex.Lock()
-	iter := db.chainDB.NewIterator(nil, nil)
-	var currentBlockHash string
-	var lastBlockHashBytes []byte
-	for iter.Next() {
-		lastBlockHashBytes = iter.Value()
-		currentBlockHash = string(lastBlockHashBytes[:])
-	}
-	iter.Release()
-	err := iter.Error()
-	if err != nil {
-		panic(err)
-	}
-	db.currentBlockHash = currentBlockHash
-	lBlock := db.GetBlockByHash(db.currentBlockHash)
+	lBlock := db.GetBlockByHash(tip.Hash)
 	if lBlock == nil {
-		panic(err)
+		panic("No last block found by tip hash")
 	}
-	db.mutex.Lock()
-
 	return *lBlock
 }
 
 // GetBlockByHash returns block with given block hash
 func (db *LevelDB) GetBlockByHash(hash string) *listing.Block {
+	rBlock := db.getRepoBlock(hash)
+	if rBlock == nil {
+		return nil
+	}
+
+	lBlock := toListingBlock(*rBlock)
+	return &lBlock
+}
+
+// GetBlockRange returns up to limit main chain blocks starting at height start
+func (db *LevelDB) GetBlockRange(start uint32, limit uint32) []listing.Block {
+	var res []listing.Block
+	for _, node := range db.index.MainChain(start, limit) {
+		rBlock := db.getRepoBlock(node.Hash)
+		if rBlock == nil {
+			panic("No block found by indexed hash")
+		}
+		res = append(res, toListingBlock(*rBlock))
+	}
+	return res
+}
+
+// GetChainWorkAt returns the cumulative work of the chain ending at block with given hash, nil if not found
+func (db *LevelDB) GetChainWorkAt(hash string) *big.Int {
+	node := db.index.Get(hash)
+	if node == nil {
+		return nil
+	}
+	return new(big.Int).Set(node.Work)
+}
+
+// GetMainChainHeight returns the height of block with given hash, false if it is not on the main chain
+func (db *LevelDB) GetMainChainHeight(hash string) (uint32, bool) {
+	return db.index.MainChainHeight(hash)
+}
+
+// GetChainWork returns the cumulative work of the main chain up to its tip
+func (db *LevelDB) GetChainWork() *big.Int {
+	tip := db.index.Tip()
+	if tip == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(tip.Work)
+}
+
+func (db *LevelDB) getRepoBlock(hash string) *Block {
 	var rBlock Block
 	blockBytes, err := db.blockDB.Get(
 		[]byte(hash),
@@ -238,8 +462,7 @@ func (db *LevelDB) GetBlockByHash(hash string) *listing.Block {
 		panic(err)
 	}
 
-	lBlock := toListingBlock(rBlock)
-	return &lBlock
+	return &rBlock
 }
 
 func toListingBlock(b Block) listing.Block {
@@ -252,14 +475,17 @@ func toListingBlock(b Block) listing.Block {
 				Timestamp: tx.Input.Timestamp,
 				Amount:    tx.Input.Amount,
 				Address:   tx.Input.Address,
+				Nonce:     tx.Input.Nonce,
 				Signature: tx.Input.Signature,
 			},
+			ExtraInputs: toListingInputs(tx.ExtraInputs),
 		})
 	}
 
 	return listing.Block{
 		Timestamp:  b.Timestamp,
 		LastHash:   &b.LastHash,
+		MerkleRoot: b.MerkleRoot,
 		Hash:       &b.Hash,
 		Nonce:      b.Nonce,
 		Difficulty: b.Difficulty,
@@ -296,37 +522,46 @@ func (db *LevelDB) GetBlockchain() *listing.Blockchain {
 	return lBlockchain
 }
 
-// ReplaceChain replace the current blockchain with the newchain
+// ReplaceChain adds the blocks of newChain into block tree, which reorganizes to newChain if it has more work
 func (db *LevelDB) ReplaceChain(newChain *mining.Blockchain) error {
+	if newChain == nil || len(newChain.Chain) < 1 {
+		return ErrPersistBlockchain
+	}
+
 	db.mutex.Lock()
-	err := db.DeleteAllData()
-	if err != nil {
-		return err
+	defer db.mutex.Unlock()
+
+	// the network genesis block replaces the local one of same hash
+	genesisBlock := newChain.Chain[0]
+	if node := db.index.Get(*genesisBlock.Hash); node != nil && node.Parent == nil {
+		if err := db.replaceGenesisBlock(toRepoBlock(&genesisBlock)); err != nil {
+			return err
+		}
 	}
 
-	var lastMinedBlock mining.Block
 	for _, minedBlock := range newChain.Chain {
-		lastMinedBlock = minedBlock
-		err = db.AddBlock(&minedBlock)
-		if err != nil {
-			panic(err)
+		if err := db.addBlock(minedBlock); err != nil {
+			return err
 		}
 	}
 
-	db.currentBlockHash = *lastMinedBlock.Hash
-	db.blockCount = uint32(len(newChain.Chain))
-	db.mutex.Unlock()
-
 	return nil
 }
 
+func (db *LevelDB) replaceGenesisBlock(rBlock *Block) error {
+	if db.getRepoBlock(rBlock.Hash) == nil {
+		return ErrPersistBlock
+	}
+	return db.putBlock(rBlock)
+}
+
 // DeleteAllData delete everything
 func (db *LevelDB) DeleteAllData() error {
 	deleteDB(db.transactionDB)
 	deleteDB(db.blockDB)
 	deleteDB(db.chainDB)
-	db.currentBlockHash = ""
-	db.blockCount = 0
+	deleteDB(db.accountDB)
+	db.index = index.New()
 	log.Printf("Blockcount after delete=%d", db.GetBlockCount())
 	return nil
 }
@@ -335,7 +570,8 @@ func deleteDB(db *leveldb.DB) error {
 	var txToDelete [][]byte
 	iter := db.NewIterator(nil, nil)
 	for iter.Next() {
-		txToDelete = append(txToDelete, iter.Key())
+		// the iterator reuses the buffer of its key
+		txToDelete = append(txToDelete, append([]byte{}, iter.Key()...))
 	}
 	iter.Release()
 	err := iter.Error()
@@ -361,7 +597,11 @@ func (db *LevelDB) Close() error {
 	if err != nil {
 		return err
 	}
-	return db.chainDB.Close()
+	err = db.chainDB.Close()
+	if err != nil {
+		return err
+	}
+	return db.accountDB.Close()
 }
 
 func exists(path string) (bool, error) {
@@ -374,3 +614,45 @@ func exists(path string) (bool, error) {
 	}
 	return true, err
 }
+
+func toRepoInputs(inputs []mining.Input) []Input {
+	var result []Input
+	for _, input := range inputs {
+		result = append(result, Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toMiningInputs(inputs []Input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toListingInputs(inputs []Input) []listing.Input {
+	var result []listing.Input
+	for _, input := range inputs {
+		result = append(result, listing.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package leveldb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelDB_Reopen(t *testing.T) {
+	assert := assert.New(t)
+	var dir string
+	var db *LevelDB
+
+	// newBlock returns a block after lastHash whose reward transaction pays amount to receiver
+	newBlock := func(lastHash string, hash string, timestamp int64, receiver string, amount uint64) mining.Block {
+		return mining.Block{
+			Timestamp:  timestamp,
+			LastHash:   &lastHash,
+			Hash:       &hash,
+			Difficulty: 4,
+			Data: []mining.Transaction{{
+				ID:     fmt.Sprintf("reward-%s", hash),
+				Input:  mining.Input{Timestamp: timestamp, Address: "MINER_REWARD"},
+				Output: map[string]uint64{receiver: amount},
+			}},
+		}
+	}
+	genesis := newBlock("0x000", "0x000", 1000, "genesis", 0)
+	block1 := newBlock("0x000", "0x001", 1001, "alice", 10)
+	block2 := newBlock("0x001", "0x002", 1002, "alice", 10)
+	side1 := newBlock("0x000", "0x101", 1001, "bob", 10)
+	side2 := newBlock("0x101", "0x102", 1002, "bob", 10)
+
+	beforeEach := func() {
+		var err error
+		dir, err = ioutil.TempDir("", "kndchainData")
+		assert.NoError(err)
+		db = NewRepository(dir)
+		assert.NoError(db.AddBlock(&genesis))
+		assert.NoError(db.AddBlock(&block1))
+	}
+
+	reopen := func() {
+		assert.NoError(db.Close())
+		db = NewRepository(dir)
+	}
+
+	afterEach := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+
+	t.Run("rebuilds account states left behind the main chain by an interrupted write", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		// account db still at genesis, as if the crash came after chain db moved on
+		assert.NoError(db.accountDB.Put([]byte(accountTipKey), []byte(*genesis.Hash), nil))
+		assert.NoError(db.accountDB.Delete([]byte(accountKeyPrefix+"alice"), nil))
+
+		// perform test
+		reopen()
+
+		// test verification
+		assert.Equal(uint64(10), db.GetAccount("alice").Balance)
+		tipHash, _ := db.accountDB.Get([]byte(accountTipKey), nil)
+		assert.Equal(*block1.Hash, string(tipHash))
+	})
+
+	t.Run("moves main chain to a persisted block it was not moved to before a crash", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		// block db has the block, chain db and account db do not
+		assert.NoError(db.putBlock(toRepoBlock(&block2)))
+
+		// perform test
+		reopen()
+
+		// test verification
+		assert.Equal(uint32(3), db.GetBlockCount())
+		assert.Equal(*block2.Hash, *db.GetLastBlock().Hash)
+		chain := db.GetBlockchain().Chain
+		assert.Len(chain, 3)
+		assert.Equal(*block2.Hash, *chain[2].Hash)
+		assert.Equal(uint64(20), db.GetAccount("alice").Balance)
+	})
+
+	t.Run("reorganizes to side branch with more work and keeps balances after reopen", func(t *testing.T) {
+		beforeEach()
+		assert.NoError(db.AddBlock(&side1))
+		assert.Equal(*block1.Hash, *db.GetLastBlock().Hash)
+		assert.Equal(uint64(10), db.GetAccount("alice").Balance)
+		assert.Nil(db.GetAccount("bob"))
+
+		// perform test
+		assert.NoError(db.AddBlock(&side2))
+		reopen()
+
+		// test verification
+		assert.Equal(uint32(3), db.GetBlockCount())
+		chain := db.GetBlockchain().Chain
+		assert.Len(chain, 3)
+		assert.Equal(*side1.Hash, *chain[1].Hash)
+		assert.Equal(*side2.Hash, *chain[2].Hash)
+		assert.Nil(db.GetAccount("alice"))
+		assert.Equal(uint64(20), db.GetAccount("bob").Balance)
+		assert.Equal(uint64(10), db.GetAccountsAt(*block1.Hash)("alice").Balance)
+		assert.Equal(uint64(0), db.GetAccountsAt(*block1.Hash)("bob").Balance)
+	})
+
+	t.Run("keeps main chain order of blocks earlier than or as early as their parent after reopen", func(t *testing.T) {
+		beforeEach()
+		earlier := newBlock("0x001", "0x002", 1000, "alice", 10)
+		sameTime := newBlock("0x002", "0x003", 1000, "alice", 10)
+
+		// perform test
+		assert.NoError(db.AddBlock(&earlier))
+		assert.NoError(db.AddBlock(&sameTime))
+		reopen()
+
+		// test verification
+		chain := db.GetBlockchain().Chain
+		assert.Len(chain, 4)
+		for i, hash := range []string{*genesis.Hash, *block1.Hash, *earlier.Hash, *sameTime.Hash} {
+			assert.Equal(hash, *chain[i].Hash)
+		}
+		assert.Equal(*sameTime.Hash, *db.GetLastBlock().Hash)
+		assert.Equal(uint64(30), db.GetAccount("alice").Balance)
+	})
+
+	t.Run("rebuilds chain db keyed by block timestamps", func(t *testing.T) {
+		beforeEach()
+		assert.NoError(db.AddBlock(&block2))
+		deleteDB(db.chainDB)
+		for _, block := range []mining.Block{genesis, block1, block2} {
+			assert.NoError(db.chainDB.Put([]byte(fmt.Sprintf("%v", block.Timestamp)), []byte(*block.Hash), nil))
+		}
+
+		// perform test
+		reopen()
+
+		// test verification
+		chain := db.GetBlockchain().Chain
+		assert.Len(chain, 3)
+		for i, hash := range []string{*genesis.Hash, *block1.Hash, *block2.Hash} {
+			assert.Equal(hash, *chain[i].Hash)
+		}
+		assert.Equal(uint64(20), db.GetAccount("alice").Balance)
+	})
+}
@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"github.com/knd/kndchain/pkg/calculating"
+)
+
+// GetAccount returns the account of address as of the main chain tip, nil if address has no transactions yet
+func (m *MemStorage) GetAccount(address string) *calculating.Account {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	account, ok := m.accounts[address]
+	if !ok {
+		return nil
+	}
+	return &account
+}
+
+// GetAccountsAt returns the account states as of the block with given hash, nil if the block is unknown.
+// States of a block off the tip are the tip states with the undo records of disconnected blocks and the blocks
+// of its branch applied on top, so only the blocks since the fork point are looked at.
+func (m *MemStorage) GetAccountsAt(hash string) func(address string) calculating.Account {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reorg := m.index.ReorgTo(hash)
+	if reorg == nil {
+		return nil
+	}
+
+	// overlay holds the states that differ from the tip, nil when the account does not exist at the block
+	overlay := make(map[string]*calculating.Account)
+	for _, node := range reorg.Disconnect {
+		for address, prev := range m.undo[node.Hash] {
+			overlay[address] = prev
+		}
+	}
+	accountOf := func(address string) calculating.Account {
+		if account, ok := overlay[address]; ok {
+			if account == nil {
+				return calculating.Account{}
+			}
+			return *account
+		}
+		return m.accounts[address]
+	}
+	for _, node := range reorg.Connect {
+		for address, account := range calculating.ApplyBlock(toCalculatingBlock(m.blocks[node.Hash]), accountOf) {
+			updated := account
+			overlay[address] = &updated
+		}
+	}
+
+	return func(address string) calculating.Account {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		return accountOf(address)
+	}
+}
+
+// connectAccounts applies block to account states and keeps the replaced states to undo it
+func (m *MemStorage) connectAccounts(block Block) {
+	undo := make(map[string]*calculating.Account)
+	accountOf := func(address string) calculating.Account {
+		return m.accounts[address]
+	}
+
+	for address, account := range calculating.ApplyBlock(toCalculatingBlock(block), accountOf) {
+		undo[address] = nil
+		if prev, ok := m.accounts[address]; ok {
+			undo[address] = &prev
+		}
+		m.accounts[address] = account
+	}
+	m.undo[*block.Hash] = undo
+}
+
+// disconnectAccounts restores the account states replaced by the block with given hash
+func (m *MemStorage) disconnectAccounts(hash string) {
+	for address, prev := range m.undo[hash] {
+		if prev == nil {
+			delete(m.accounts, address)
+		} else {
+			m.accounts[address] = *prev
+		}
+	}
+	delete(m.undo, hash)
+}
+
+func toCalculatingBlock(block Block) calculating.Block {
+	var cTxs []calculating.Transaction
+	for _, transaction := range block.Data {
+		cTxs = append(cTxs, calculating.Transaction{
+			ID:     transaction.ID,
+			Output: transaction.Output,
+			Input: calculating.Input{
+				Timestamp: transaction.Input.Timestamp,
+				Amount:    transaction.Input.Amount,
+				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
+				Signature: transaction.Input.Signature,
+			},
+			ExtraInputs: toCalculatingInputs(transaction.ExtraInputs),
+		})
+	}
+	return calculating.Block{
+		Timestamp:  block.Timestamp,
+		LastHash:   block.LastHash,
+		MerkleRoot: block.MerkleRoot,
+		Hash:       block.Hash,
+		Data:       cTxs,
+		Nonce:      block.Nonce,
+		Difficulty: block.Difficulty,
+	}
+}
+
+func toCalculatingInputs(inputs []Input) []calculating.Input {
+	var result []calculating.Input
+	for _, input := range inputs {
+		result = append(result, calculating.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
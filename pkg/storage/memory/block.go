@@ -5,20 +5,23 @@ type Input struct {
 	Timestamp int64
 	Amount    uint64
 	Address   string
+	Nonce     uint64
 	Signature string
 }
 
 // Transaction in data
 type Transaction struct {
-	ID     string
-	Input  Input
-	Output map[string]uint64
+	ID          string
+	Input       Input
+	ExtraInputs []Input
+	Output      map[string]uint64
 }
 
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64
 	LastHash   *string
+	MerkleRoot string
 	Hash       *string
 	Data       []Transaction
 	Nonce      uint32
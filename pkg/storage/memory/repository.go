@@ -3,9 +3,13 @@ package memory
 import (
 	"errors"
 	"log"
+	"math/big"
+	"sync"
 
+	"github.com/knd/kndchain/pkg/calculating"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/storage/index"
 )
 
 // ErrAddNilBlock is used when no mined block is given to add
@@ -14,93 +18,196 @@ var ErrAddNilBlock = errors.New("Mined block is not given to add")
 // MemStorage keeps blockchain in memory
 type MemStorage struct {
 	blockchain *Blockchain
+	blocks     map[string]Block
+	index      *index.BlockIndex
+	accounts   map[string]calculating.Account
+	// undo keeps the account states each main chain block replaced, to roll back on reorg
+	undo  map[string]map[string]*calculating.Account
+	mutex *sync.Mutex
 }
 
 // NewRepository creates a blockchain repository
 func NewRepository() *MemStorage {
 	return &MemStorage{
 		blockchain: &Blockchain{},
+		blocks:     make(map[string]Block),
+		index:      index.New(),
+		accounts:   make(map[string]calculating.Account),
+		undo:       make(map[string]map[string]*calculating.Account),
+		mutex:      &sync.Mutex{},
 	}
 }
 
-// AddBlock adds mined block into blockchain
+// AddBlock adds mined block into block tree, the main chain follows the tip with most work
 func (m *MemStorage) AddBlock(minedBlock *mining.Block) error {
 	if minedBlock == nil {
 		return ErrAddNilBlock
 	}
 
-	newB := Block{
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.addBlock(*minedBlock)
+}
+
+func (m *MemStorage) addBlock(minedBlock mining.Block) error {
+	reorg, err := m.index.Add(*minedBlock.Hash, *minedBlock.LastHash, minedBlock.Difficulty)
+	if err == index.ErrKnownBlock {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.blocks[*minedBlock.Hash] = toStorageBlock(minedBlock)
+	if reorg != nil {
+		m.applyReorg(reorg)
+	}
+
+	return nil
+}
+
+func (m *MemStorage) applyReorg(reorg *index.Reorg) {
+	if len(reorg.Disconnect) > 0 {
+		log.Printf("Reorganizing chain. Disconnecting %d blocks, Connecting %d blocks", len(reorg.Disconnect), len(reorg.Connect))
+	}
+
+	for _, node := range reorg.Disconnect {
+		m.disconnectAccounts(node.Hash)
+	}
+	m.blockchain.chain = m.blockchain.chain[:len(m.blockchain.chain)-len(reorg.Disconnect)]
+	for _, node := range reorg.Connect {
+		m.blockchain.chain = append(m.blockchain.chain, m.blocks[node.Hash])
+		m.connectAccounts(m.blocks[node.Hash])
+	}
+}
+
+func toStorageBlock(minedBlock mining.Block) Block {
+	return Block{
 		Timestamp:  minedBlock.Timestamp,
 		LastHash:   minedBlock.LastHash,
+		MerkleRoot: minedBlock.MerkleRoot,
 		Hash:       minedBlock.Hash,
 		Data:       toStorageTransactions(minedBlock.Data),
 		Nonce:      minedBlock.Nonce,
 		Difficulty: minedBlock.Difficulty,
 	}
-
-	m.blockchain.chain = append(m.blockchain.chain, newB)
-
-	return nil
 }
 
 // GetBlockCount returns the latest block count in blockchain
 func (m *MemStorage) GetBlockCount() uint32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	return uint32(len(m.blockchain.chain))
 }
 
 // GetLastBlock returns the last block in blockchain
 func (m *MemStorage) GetLastBlock() listing.Block {
-	if m.GetBlockCount() == 0 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.blockchain.chain) == 0 {
 		log.Fatal("Blockchain is empty")
 	}
 
-	lastBlock := m.blockchain.chain[m.GetBlockCount()-1]
-
-	return listing.Block{
-		Timestamp:  lastBlock.Timestamp,
-		LastHash:   lastBlock.LastHash,
-		Hash:       lastBlock.Hash,
-		Data:       toListingTransactions(lastBlock.Data),
-		Nonce:      lastBlock.Nonce,
-		Difficulty: lastBlock.Difficulty,
-	}
+	return toListingBlock(m.blockchain.chain[len(m.blockchain.chain)-1])
 }
 
 // GetBlockchain returns a list of blocks from genesis block
 func (m *MemStorage) GetBlockchain() *listing.Blockchain {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	var res []listing.Block
 	for _, block := range m.blockchain.chain {
-		res = append(res, listing.Block{
-			Timestamp:  block.Timestamp,
-			LastHash:   block.LastHash,
-			Hash:       block.Hash,
-			Data:       toListingTransactions(block.Data),
-			Nonce:      block.Nonce,
-			Difficulty: block.Difficulty,
-		})
+		res = append(res, toListingBlock(block))
 	}
 	return &listing.Blockchain{Chain: res}
 }
 
-// ReplaceChain replace the current blockchain with the newchain
+// GetBlockByHash returns block with given block hash
+func (m *MemStorage) GetBlockByHash(hash string) *listing.Block {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	block, ok := m.blocks[hash]
+	if !ok {
+		return nil
+	}
+
+	lBlock := toListingBlock(block)
+	return &lBlock
+}
+
+// GetBlockRange returns up to limit main chain blocks starting at height start
+func (m *MemStorage) GetBlockRange(start uint32, limit uint32) []listing.Block {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var res []listing.Block
+	for _, node := range m.index.MainChain(start, limit) {
+		res = append(res, toListingBlock(m.blocks[node.Hash]))
+	}
+	return res
+}
+
+// GetChainWorkAt returns the cumulative work of the chain ending at block with given hash, nil if not found
+func (m *MemStorage) GetChainWorkAt(hash string) *big.Int {
+	node := m.index.Get(hash)
+	if node == nil {
+		return nil
+	}
+	return new(big.Int).Set(node.Work)
+}
+
+// GetMainChainHeight returns the height of block with given hash, false if it is not on the main chain
+func (m *MemStorage) GetMainChainHeight(hash string) (uint32, bool) {
+	return m.index.MainChainHeight(hash)
+}
+
+// GetChainWork returns the cumulative work of the main chain up to its tip
+func (m *MemStorage) GetChainWork() *big.Int {
+	tip := m.index.Tip()
+	if tip == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(tip.Work)
+}
+
+func toListingBlock(block Block) listing.Block {
+	return listing.Block{
+		Timestamp:  block.Timestamp,
+		LastHash:   block.LastHash,
+		MerkleRoot: block.MerkleRoot,
+		Hash:       block.Hash,
+		Data:       toListingTransactions(block.Data),
+		Nonce:      block.Nonce,
+		Difficulty: block.Difficulty,
+	}
+}
+
+// ReplaceChain adds the blocks of newChain into block tree, which reorganizes to newChain if it has more work
 func (m *MemStorage) ReplaceChain(newChain *mining.Blockchain) error {
 	if newChain == nil || len(newChain.Chain) < 1 {
 		log.Fatal("Blockchain is nil/ zero block")
 	}
 
-	newBc := []Block{}
-	for _, newBlock := range newChain.Chain {
-		newBc = append(newBc, Block{
-			Timestamp:  newBlock.Timestamp,
-			LastHash:   newBlock.LastHash,
-			Hash:       newBlock.Hash,
-			Data:       toStorageTransactions(newBlock.Data),
-			Nonce:      newBlock.Nonce,
-			Difficulty: newBlock.Difficulty,
-		})
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// the network genesis block replaces the local one of same hash
+	genesisBlock := newChain.Chain[0]
+	if m.index.Get(*genesisBlock.Hash) != nil && m.index.Get(*genesisBlock.Hash).Parent == nil {
+		m.blocks[*genesisBlock.Hash] = toStorageBlock(genesisBlock)
+		m.blockchain.chain[0] = m.blocks[*genesisBlock.Hash]
 	}
 
-	m.blockchain.chain = newBc
+	for _, newBlock := range newChain.Chain {
+		if err := m.addBlock(newBlock); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -115,8 +222,10 @@ func toStorageTransactions(data []mining.Transaction) []Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toStorageInputs(transaction.ExtraInputs),
 		})
 	}
 	return sTxs
@@ -132,9 +241,39 @@ func toListingTransactions(data []Transaction) []listing.Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toListingInputs(transaction.ExtraInputs),
 		})
 	}
 	return sTxs
 }
+
+func toStorageInputs(inputs []mining.Input) []Input {
+	var result []Input
+	for _, input := range inputs {
+		result = append(result, Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toListingInputs(inputs []Input) []listing.Input {
+	var result []listing.Input
+	for _, input := range inputs {
+		result = append(result, listing.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
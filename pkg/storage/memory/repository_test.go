@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemStorage_Reorg(t *testing.T) {
+	assert := assert.New(t)
+	var m *MemStorage
+
+	// newBlock returns a block after lastHash whose reward transaction pays amount to receiver
+	newBlock := func(lastHash string, hash string, timestamp int64, receiver string, amount uint64) mining.Block {
+		return mining.Block{
+			Timestamp:  timestamp,
+			LastHash:   &lastHash,
+			Hash:       &hash,
+			Difficulty: 4,
+			Data: []mining.Transaction{{
+				ID:     fmt.Sprintf("reward-%s", hash),
+				Input:  mining.Input{Timestamp: timestamp, Address: "MINER_REWARD"},
+				Output: map[string]uint64{receiver: amount},
+			}},
+		}
+	}
+	genesis := newBlock("0x000", "0x000", 1000, "genesis", 0)
+	block1 := newBlock("0x000", "0x001", 1001, "alice", 10)
+	side1 := newBlock("0x000", "0x101", 1001, "bob", 10)
+	side2 := newBlock("0x101", "0x102", 1002, "bob", 10)
+
+	beforeEach := func() {
+		m = NewRepository()
+		assert.NoError(m.AddBlock(&genesis))
+		assert.NoError(m.AddBlock(&block1))
+	}
+
+	t.Run("keeps main chain and balances when side branch has less work", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		assert.NoError(m.AddBlock(&side1))
+
+		// test verification
+		assert.Equal(uint32(2), m.GetBlockCount())
+		assert.Equal(*block1.Hash, *m.GetLastBlock().Hash)
+		assert.Equal(uint64(10), m.GetAccount("alice").Balance)
+		assert.Nil(m.GetAccount("bob"))
+		assert.Equal(uint64(10), m.GetAccountsAt(*side1.Hash)("bob").Balance)
+		assert.Equal(uint64(0), m.GetAccountsAt(*side1.Hash)("alice").Balance)
+	})
+
+	t.Run("reorganizes to side branch with more work and undoes balances of disconnected blocks", func(t *testing.T) {
+		beforeEach()
+		assert.NoError(m.AddBlock(&side1))
+
+		// perform test
+		assert.NoError(m.AddBlock(&side2))
+
+		// test verification
+		assert.Equal(uint32(3), m.GetBlockCount())
+		chain := m.GetBlockchain().Chain
+		assert.Equal(*side1.Hash, *chain[1].Hash)
+		assert.Equal(*side2.Hash, *chain[2].Hash)
+		assert.Nil(m.GetAccount("alice"))
+		assert.Equal(uint64(20), m.GetAccount("bob").Balance)
+		assert.Equal(uint64(10), m.GetAccountsAt(*block1.Hash)("alice").Balance)
+		assert.Equal(uint64(0), m.GetAccountsAt(*block1.Hash)("bob").Balance)
+	})
+
+	t.Run("reads chain while blocks are added", func(t *testing.T) {
+		beforeEach()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			lastHash := *block1.Hash
+			for i := 0; i < 100; i++ {
+				block := newBlock(lastHash, fmt.Sprintf("0x2%02d", i), int64(1002+i), "alice", 10)
+				m.AddBlock(&block)
+				lastHash = *block.Hash
+			}
+		}()
+
+		// perform test
+		for i := 0; i < 100; i++ {
+			m.GetBlockCount()
+			m.GetLastBlock()
+			m.GetBlockchain()
+		}
+		<-done
+
+		// test verification
+		assert.Equal(uint32(102), m.GetBlockCount())
+		assert.Len(m.GetBlockchain().Chain, 102)
+	})
+}
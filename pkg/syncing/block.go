@@ -4,8 +4,20 @@ package syncing
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   *string       `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       *string       `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
 	Difficulty uint32        `json:"difficulty"`
 }
+
+// Header is a block without its transaction data
+type Header struct {
+	Height     uint32  `json:"height"`
+	Timestamp  int64   `json:"timestamp"`
+	LastHash   *string `json:"lastHash"`
+	MerkleRoot string  `json:"merkleRoot"`
+	Hash       *string `json:"hash"`
+	Nonce      uint32  `json:"nonce"`
+	Difficulty uint32  `json:"difficulty"`
+}
@@ -0,0 +1,61 @@
+package syncing
+
+import (
+	"context"
+
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockedMining is a mocked object that implements mining.Service
+type MockedMining struct {
+	mock.Mock
+}
+
+// MineNewBlock mines a new block on top of lastBlock
+func (m *MockedMining) MineNewBlock(lastBlock *mining.Block, data []mining.Transaction) (*mining.Block, error) {
+	args := m.Called(lastBlock, data)
+	return args.Get(0).(*mining.Block), args.Error(1)
+}
+
+// MineBlock mines a new block on top of lastBlock until ctx is done
+func (m *MockedMining) MineBlock(ctx context.Context, lastBlock *mining.Block, data []mining.Transaction) (*mining.Block, error) {
+	args := m.Called(ctx, lastBlock, data)
+	return args.Get(0).(*mining.Block), args.Error(1)
+}
+
+// HashRate returns the hash rate of the last mined block
+func (m *MockedMining) HashRate() float64 {
+	args := m.Called()
+	return args.Get(0).(float64)
+}
+
+// BlockTemplate returns an unmined block on top of lastBlock
+func (m *MockedMining) BlockTemplate(lastBlock *mining.Block, data []mining.Transaction, timestamp int64) (*mining.Block, error) {
+	args := m.Called(lastBlock, data, timestamp)
+	return args.Get(0).(*mining.Block), args.Error(1)
+}
+
+// AddBlock adds mined block to blockchain
+func (m *MockedMining) AddBlock(minedBlock *mining.Block) error {
+	args := m.Called(minedBlock)
+	return args.Error(0)
+}
+
+// AcceptBlock validates and adds a block received from a peer
+func (m *MockedMining) AcceptBlock(receivedBlock *mining.Block) error {
+	args := m.Called(receivedBlock)
+	return args.Error(0)
+}
+
+// AcceptBlocks validates and adds a range of blocks received from a peer
+func (m *MockedMining) AcceptBlocks(receivedBlocks []mining.Block) error {
+	args := m.Called(receivedBlocks)
+	return args.Error(0)
+}
+
+// ReplaceChain replaces blockchain with a heavier valid chain
+func (m *MockedMining) ReplaceChain(newChain *mining.Blockchain) error {
+	args := m.Called(newChain)
+	return args.Error(0)
+}
@@ -2,13 +2,40 @@ package syncing
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/big"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/knd/kndchain/pkg/listing"
 	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/validating"
 	"github.com/knd/kndchain/pkg/wallet"
 )
 
+const (
+	headersPerRequest uint32 = 2000
+	blocksPerRequest  uint32 = 100
+	maxRetries               = 3
+	retryDelay               = 2 * time.Second
+	requestTimeout           = 30 * time.Second
+)
+
+// ErrInvalidHeaders is used when headers from node don't form a linked chain
+var ErrInvalidHeaders = errors.New("Headers are not a linked chain")
+
+// ErrInvalidProofOfWork is used when a header hash from node is not the hash of its fields or does not meet its difficulty
+var ErrInvalidProofOfWork = errors.New("Header does not have valid proof of work")
+
+// ErrGenesisMismatch is used when node follows a chain with a different genesis block
+var ErrGenesisMismatch = errors.New("Node has a different genesis block")
+
+// ErrUnexpectedBlocks is used when downloaded blocks don't match the synced headers
+var ErrUnexpectedBlocks = errors.New("Downloaded blocks don't match headers")
+
 // Service provides access to blockchain/transactions syncing operations
 type Service interface {
 	SyncBlockchain(nodeURL string) error
@@ -17,45 +44,221 @@ type Service interface {
 
 type service struct {
 	m mining.Service
+	l listing.Service
 	p wallet.TransactionPool
 }
 
 // NewService creates a syncing service with necessary dependencies
-func NewService(m mining.Service, p wallet.TransactionPool) Service {
-	return &service{m, p}
+func NewService(m mining.Service, l listing.Service, p wallet.TransactionPool) Service {
+	return &service{m, l, p}
 }
 
-// SyncBlockchain obtains the full blockchain from nodeEndpoint url
+// SyncBlockchain syncs blockchain headers-first from node at nodeURL.
+// A block locator of the local main chain lets node send only the headers after the fork point, each header is
+// checked for proof of work and linkage as it arrives. Then only the missing blocks are downloaded in ranges and
+// validated as they arrive. Blocks kept from an interrupted sync are not downloaded again.
 func (s *service) SyncBlockchain(nodeURL string) error {
-	req, _ := http.NewRequest("GET", nodeURL, nil)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := http.Client{}
-
-	resp, err := client.Do(req)
+	headers, err := s.fetchHeaders(nodeURL)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	defer resp.Body.Close()
+	if len(headers) == 0 {
+		log.Printf("Blockchain already synced, node has no headers after local chain")
+		return nil
+	}
+
+	forkWork := big.NewInt(0)
+	if headers[0].Height > 0 {
+		if forkWork = s.l.GetChainWorkAt(*headers[0].LastHash); forkWork == nil {
+			return ErrInvalidHeaders
+		}
+	} else if s.l.GetBlockCount() > 0 {
+		// node shares none of the local main chain, not even its genesis block
+		return ErrGenesisMismatch
+	}
+	remoteWork := new(big.Int).Add(forkWork, headersWork(headers))
+	localTipHash := ""
+	if s.l.GetBlockCount() > 0 {
+		localTipHash = *s.l.GetLastBlock().Hash
+	}
+	if validating.CompareWork(remoteWork, *headers[len(headers)-1].Hash, s.l.GetChainWork(), localTipHash) <= 0 {
+		log.Printf("Node chain has no more work than local chain, Skipping sync")
+		return nil
+	}
+
+	// headers up to the first unknown block are already in local block tree
+	for len(headers) > 0 && s.l.GetBlockByHash(*headers[0].Hash) != nil {
+		headers = headers[1:]
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+
+	first, last := headers[0].Height, headers[len(headers)-1].Height
+	log.Printf("Syncing %d blocks from height %d", len(headers), first)
+	for offset := uint32(0); offset < uint32(len(headers)); offset += blocksPerRequest {
+		blocks, err := s.fetchBlocks(nodeURL, headers[offset:])
+		if err != nil {
+			return err
+		}
+
+		start := first + offset
+		if start == 0 {
+			if err := s.m.ReplaceChain(&mining.Blockchain{Chain: blocks[:1]}); err != nil {
+				log.Printf("SyncingService#SyncBlockchain: Failed to replace chain with genesis block of %s, %v", nodeURL, err)
+				return err
+			}
+			blocks = blocks[1:]
+		}
+		if err := s.m.AcceptBlocks(blocks); err != nil {
+			log.Printf("SyncingService#SyncBlockchain: Failed to accept blocks of %s from height %d, %v", nodeURL, start, err)
+			return err
+		}
+		log.Printf("Synced blocks up to height %d of %d", start+uint32(len(blocks))-1, last)
+	}
+
+	return nil
+}
+
+// fetchHeaders pages through node headers after the fork point with local main chain, each page continues
+// from the last header received
+func (s *service) fetchHeaders(nodeURL string) ([]Header, error) {
+	var headers []Header
+	locator := s.l.GetLocator()
+	for {
+		var page []Header
+		url := fmt.Sprintf("%s/api/headers?limit=%d", nodeURL, headersPerRequest)
+		if len(locator) > 0 {
+			url += "&locator=" + strings.Join(locator, ",")
+		}
+		if err := getJSON(url, &page); err != nil {
+			return nil, err
+		}
+
+		for _, header := range page {
+			if err := s.checkHeader(header, headers); err != nil {
+				log.Printf("SyncingService#fetchHeaders: Invalid header at height %d from %s, %v", header.Height, nodeURL, err)
+				return nil, err
+			}
+			headers = append(headers, header)
+		}
+
+		if uint32(len(page)) < headersPerRequest {
+			return headers, nil
+		}
+		locator = []string{*headers[len(headers)-1].Hash}
+	}
+}
+
+// checkHeader checks header links up to the previous header, or to the local main chain when it is the first one,
+// and that its hash meets its difficulty
+func (s *service) checkHeader(header Header, prev []Header) error {
+	if header.Hash == nil || header.LastHash == nil {
+		return ErrInvalidHeaders
+	}
 
-	var bc Blockchain
-	json.NewDecoder(resp.Body).Decode(&bc)
+	switch {
+	case len(prev) > 0:
+		if *header.LastHash != *prev[len(prev)-1].Hash || header.Height != prev[len(prev)-1].Height+1 {
+			return ErrInvalidHeaders
+		}
+	case header.Height > 0:
+		forkHeight, ok := s.l.GetMainChainHeight(*header.LastHash)
+		if !ok || header.Height != forkHeight+1 {
+			return ErrInvalidHeaders
+		}
+	default:
+		// genesis block is given by config, it is not mined
+		return nil
+	}
+
+	hash := validating.BlockHash(validating.Block{
+		Timestamp:  header.Timestamp,
+		LastHash:   header.LastHash,
+		MerkleRoot: header.MerkleRoot,
+		Nonce:      header.Nonce,
+		Difficulty: header.Difficulty,
+	})
+	if hash != *header.Hash || !validating.HasProofOfWork(hash, header.Difficulty) {
+		return ErrInvalidProofOfWork
+	}
+	return nil
+}
+
+// fetchBlocks downloads the range of blocks of the first headers and checks them against those headers
+func (s *service) fetchBlocks(nodeURL string, headers []Header) ([]mining.Block, error) {
+	limit := blocksPerRequest
+	if uint32(len(headers)) < limit {
+		limit = uint32(len(headers))
+	}
+
+	var bBlocks []Block
+	url := fmt.Sprintf("%s/api/blocks/range?start=%d&limit=%d", nodeURL, headers[0].Height, limit)
+	if err := getJSON(url, &bBlocks); err != nil {
+		return nil, err
+	}
+	if uint32(len(bBlocks)) != limit {
+		return nil, ErrUnexpectedBlocks
+	}
 
 	var blocks []mining.Block
-	for _, b := range bc.Chain {
+	for i, b := range bBlocks {
+		if b.Hash == nil || *b.Hash != *headers[i].Hash {
+			return nil, ErrUnexpectedBlocks
+		}
 		blocks = append(blocks, mining.Block{
 			Timestamp:  b.Timestamp,
 			LastHash:   b.LastHash,
+			MerkleRoot: b.MerkleRoot,
 			Hash:       b.Hash,
 			Data:       toMiningTransactions(b.Data),
 			Nonce:      b.Nonce,
 			Difficulty: b.Difficulty,
 		})
 	}
-	mbc := &mining.Blockchain{Chain: blocks}
+	return blocks, nil
+}
 
-	return s.m.ReplaceChain(mbc)
+func headersWork(headers []Header) *big.Int {
+	work := big.NewInt(0)
+	for _, header := range headers {
+		work.Add(work, validating.BlockWork(header.Difficulty))
+	}
+	return work
+}
+
+// getJSON decodes response of GET request to url into v, retrying on failure
+func getJSON(url string, v interface{}) error {
+	client := http.Client{Timeout: requestTimeout}
+
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		err = func() error {
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("Unexpected status code %d", resp.StatusCode)
+			}
+			return json.NewDecoder(resp.Body).Decode(v)
+		}()
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("SyncingService#getJSON: Failed to get %s, attempt %d/%d, %v", url, attempt, maxRetries, err)
+		if attempt < maxRetries {
+			time.Sleep(retryDelay)
+		}
+	}
+
+	return err
 }
 
 func toMiningTransactions(data []Transaction) []mining.Transaction {
@@ -68,8 +271,10 @@ func toMiningTransactions(data []Transaction) []mining.Transaction {
 				Timestamp: transaction.Input.Timestamp,
 				Amount:    transaction.Input.Amount,
 				Address:   transaction.Input.Address,
+				Nonce:     transaction.Input.Nonce,
 				Signature: transaction.Input.Signature,
 			},
+			ExtraInputs: toMiningInputs(transaction.ExtraInputs),
 		})
 	}
 	return mTxs
@@ -100,12 +305,42 @@ func (s *service) SyncTransactionPool(nodeURL string) error {
 				Timestamp: t.Input.Timestamp,
 				Amount:    t.Input.Amount,
 				Address:   t.Input.Address,
+				Nonce:     t.Input.Nonce,
 				Signature: t.Input.Signature,
 			},
-			Output: map[string]uint64(t.Output),
+			ExtraInputs: toWalletInputs(t.ExtraInputs),
+			Output:      map[string]uint64(t.Output),
 		}
 		pool[tx.ID] = tx
 	}
 
 	return s.p.SetPool(pool)
 }
+
+func toMiningInputs(inputs []input) []mining.Input {
+	var result []mining.Input
+	for _, input := range inputs {
+		result = append(result, mining.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
+
+func toWalletInputs(inputs []input) []wallet.Input {
+	var result []wallet.Input
+	for _, input := range inputs {
+		result = append(result, wallet.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package syncing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/mining"
+	"github.com/knd/kndchain/pkg/validating"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_SyncBlockchain(t *testing.T) {
+	assert := assert.New(t)
+	var mockedListing *MockedListing
+	var mockedMining *MockedMining
+	var syncer Service
+	var headerQueries []string
+	genesisHash := "0x000"
+
+	// mineHeader finds the nonce that gives header a hash meeting its difficulty
+	mineHeader := func(height uint32, lastHash string, difficulty uint32) Header {
+		for nonce := uint32(0); ; nonce++ {
+			block := validating.Block{Timestamp: int64(height), LastHash: &lastHash, Nonce: nonce, Difficulty: difficulty}
+			if hash := validating.BlockHash(block); validating.HasProofOfWork(hash, difficulty) {
+				return Header{Height: height, Timestamp: block.Timestamp, LastHash: &lastHash, Hash: &hash, Nonce: nonce, Difficulty: difficulty}
+			}
+		}
+	}
+
+	toBlocks := func(headers []Header) []Block {
+		var blocks []Block
+		for _, header := range headers {
+			blocks = append(blocks, Block{Timestamp: header.Timestamp, LastHash: header.LastHash, Hash: header.Hash, Nonce: header.Nonce, Difficulty: header.Difficulty})
+		}
+		return blocks
+	}
+
+	toMiningBlocks := func(headers []Header) []mining.Block {
+		var blocks []mining.Block
+		for _, header := range headers {
+			blocks = append(blocks, mining.Block{Timestamp: header.Timestamp, LastHash: header.LastHash, Hash: header.Hash, Nonce: header.Nonce, Difficulty: header.Difficulty})
+		}
+		return blocks
+	}
+
+	// serve answers header and block requests of the syncer with the given headers after genesis
+	serve := func(headers []Header) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/headers":
+				headerQueries = append(headerQueries, r.URL.RawQuery)
+				json.NewEncoder(w).Encode(headers)
+			case "/api/blocks/range":
+				json.NewEncoder(w).Encode(toBlocks(headers))
+			}
+		}))
+	}
+
+	beforeEach := func() {
+		headerQueries = nil
+		mockedListing = new(MockedListing)
+		mockedListing.On("GetLocator").Return([]string{genesisHash})
+		mockedListing.On("GetBlockCount").Return(1)
+		mockedListing.On("GetLastBlock").Return(listing.Block{Hash: &genesisHash})
+		mockedListing.On("GetMainChainHeight", genesisHash).Return(uint32(0), true)
+		mockedListing.On("GetChainWorkAt", genesisHash).Return(validating.BlockWork(1))
+		mockedListing.On("GetChainWork").Return(validating.BlockWork(1))
+		mockedListing.On("GetBlockByHash", mock.Anything).Return(nil)
+		mockedMining = new(MockedMining)
+		syncer = NewService(mockedMining, mockedListing, nil)
+	}
+
+	t.Run("requests headers after local locator and accepts the missing blocks", func(t *testing.T) {
+		beforeEach()
+		h1 := mineHeader(1, genesisHash, 4)
+		h2 := mineHeader(2, *h1.Hash, 4)
+		node := serve([]Header{h1, h2})
+		defer node.Close()
+		mockedMining.On("AcceptBlocks", mock.Anything).Return(nil)
+
+		// perform test
+		err := syncer.SyncBlockchain(node.URL)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal([]string{fmt.Sprintf("limit=%d&locator=%s", headersPerRequest, genesisHash)}, headerQueries)
+		mockedMining.AssertCalled(t, "AcceptBlocks", toMiningBlocks([]Header{h1, h2}))
+	})
+
+	t.Run("rejects header without proof of work", func(t *testing.T) {
+		beforeEach()
+		h1 := mineHeader(1, genesisHash, 4)
+		h1.Nonce++
+		node := serve([]Header{h1})
+		defer node.Close()
+
+		// perform test
+		err := syncer.SyncBlockchain(node.URL)
+
+		// test verification
+		assert.Equal(ErrInvalidProofOfWork, err)
+		mockedMining.AssertNotCalled(t, "AcceptBlocks", mock.Anything)
+	})
+
+	t.Run("rejects headers not linked to local main chain or each other", func(t *testing.T) {
+		beforeEach()
+		unknownHash := "0x999"
+		mockedListing.On("GetMainChainHeight", unknownHash).Return(uint32(0), false)
+		h1 := mineHeader(1, genesisHash, 4)
+		unlinked := serve([]Header{mineHeader(1, unknownHash, 4)})
+		defer unlinked.Close()
+		gapped := serve([]Header{h1, mineHeader(3, *h1.Hash, 4)})
+		defer gapped.Close()
+
+		// perform test
+		unlinkedErr := syncer.SyncBlockchain(unlinked.URL)
+		gappedErr := syncer.SyncBlockchain(gapped.URL)
+
+		// test verification
+		assert.Equal(ErrInvalidHeaders, unlinkedErr)
+		assert.Equal(ErrInvalidHeaders, gappedErr)
+		mockedMining.AssertNotCalled(t, "AcceptBlocks", mock.Anything)
+	})
+
+	t.Run("skips sync when node chain has no more work", func(t *testing.T) {
+		beforeEach()
+		mockedListing = new(MockedListing)
+		h1 := mineHeader(1, genesisHash, 4)
+		localTipHash := "0x001"
+		mockedListing.On("GetLocator").Return([]string{localTipHash, genesisHash})
+		mockedListing.On("GetBlockCount").Return(3)
+		mockedListing.On("GetLastBlock").Return(listing.Block{Hash: &localTipHash})
+		mockedListing.On("GetMainChainHeight", genesisHash).Return(uint32(0), true)
+		mockedListing.On("GetChainWorkAt", genesisHash).Return(validating.BlockWork(1))
+		mockedListing.On("GetChainWork").Return(validating.BlockWork(8))
+		syncer = NewService(mockedMining, mockedListing, nil)
+		node := serve([]Header{h1})
+		defer node.Close()
+
+		// perform test
+		err := syncer.SyncBlockchain(node.URL)
+
+		// test verification
+		assert.NoError(err)
+		mockedMining.AssertNotCalled(t, "AcceptBlocks", mock.Anything)
+	})
+}
@@ -4,6 +4,7 @@ type input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
@@ -11,9 +12,10 @@ type output map[string]uint64
 
 // Transaction to marshall in syncing service
 type Transaction struct {
-	ID     string `json:"id"`
-	Input  input  `json:"input"`
-	Output output `json:"output"`
+	ID          string  `json:"id"`
+	Input       input   `json:"input"`
+	ExtraInputs []input `json:"extraInputs,omitempty"`
+	Output      output  `json:"output"`
 }
 
 type TransactionPool map[string]Transaction
@@ -1,11 +1,82 @@
 package validating
 
+import (
+	"sort"
+
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
 // Block represents a block in blockchain
 type Block struct {
 	Timestamp  int64         `json:"timestamp"`
 	LastHash   *string       `json:"lastHash"`
+	MerkleRoot string        `json:"merkleRoot"`
 	Hash       *string       `json:"hash"`
 	Data       []Transaction `json:"data"`
 	Nonce      uint32        `json:"nonce"`
 	Difficulty uint32        `json:"difficulty"`
 }
+
+// BlockHash returns the hash of the canonical encoding of block header
+func BlockHash(b Block) string {
+	return hashing.BlockHash(hashing.Block{
+		Timestamp:  b.Timestamp,
+		LastHash:   *b.LastHash,
+		MerkleRoot: b.MerkleRoot,
+		Nonce:      b.Nonce,
+		Difficulty: b.Difficulty,
+	})
+}
+
+// BlockSize returns the length of the canonical encoding of block
+func BlockSize(b Block) int {
+	var hTxs []hashing.Tx
+	for _, tx := range b.Data {
+		hTxs = append(hTxs, toHashingTx(tx))
+	}
+
+	return len(hashing.EncodeBlock(hashing.Block{
+		Timestamp:  b.Timestamp,
+		LastHash:   *b.LastHash,
+		MerkleRoot: b.MerkleRoot,
+		Data:       hTxs,
+		Nonce:      b.Nonce,
+		Difficulty: b.Difficulty,
+	}))
+}
+
+// MerkleRoot returns the merkle root of block transactions
+func MerkleRoot(data []Transaction) string {
+	var hTxs []hashing.Tx
+	for _, tx := range data {
+		hTxs = append(hTxs, toHashingTx(tx))
+	}
+	return hashing.MerkleRoot(hTxs)
+}
+
+// MedianTimePast returns the median timestamp of the last span blocks, or of all blocks when there are fewer
+func MedianTimePast(blocks []Block, span int) int64 {
+	if len(blocks) > span {
+		blocks = blocks[len(blocks)-span:]
+	}
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	timestamps := make([]int64, len(blocks))
+	for i, block := range blocks {
+		timestamps[i] = block.Timestamp
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// toConsensusHeaders returns the headers retargeting looks at of consecutive blocks starting at given height
+func toConsensusHeaders(blocks []Block, height uint32) []consensus.Header {
+	headers := make([]consensus.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = consensus.Header{Height: height + uint32(i), Timestamp: block.Timestamp, Difficulty: block.Difficulty}
+	}
+	return headers
+}
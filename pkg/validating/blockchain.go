@@ -1,6 +1,21 @@
 package validating
 
+import "github.com/knd/kndchain/pkg/calculating"
+
 // Blockchain represents a chain of mined blocks
 type Blockchain struct {
 	Chain []Block
 }
+
+// Extension is a range of consecutive new blocks together with what validating them looks at,
+// so they are validated without the chain they extend from genesis
+type Extension struct {
+	// Parents are the last blocks of the chain up to the parent of the first new block, oldest first.
+	// They cover the spans of median time past, retargeting and coinbase maturity or reach back to genesis.
+	Parents []Block
+	// Height is the height of the first new block
+	Height uint32
+	Blocks []Block
+	// AccountOf returns the account state of address as of the parent of the first new block
+	AccountOf func(address string) calculating.Account
+}
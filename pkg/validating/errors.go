@@ -0,0 +1,101 @@
+package validating
+
+import "fmt"
+
+// Reason tells which consensus rule a chain breaks
+type Reason string
+
+const (
+	// ReasonEmptyChain is used when there are no blocks to validate
+	ReasonEmptyChain Reason = "empty-chain"
+	// ReasonInvalidGenesis is used when the genesis block has data
+	ReasonInvalidGenesis Reason = "invalid-genesis"
+	// ReasonTooManyTransactions is used when a block has more transactions than params allow
+	ReasonTooManyTransactions Reason = "too-many-transactions"
+	// ReasonBlockTooLarge is used when a block encodes to more bytes than params allow
+	ReasonBlockTooLarge Reason = "block-too-large"
+	// ReasonTimestampTooNew is used when a block timestamp is beyond the future drift
+	ReasonTimestampTooNew Reason = "timestamp-too-new"
+	// ReasonTimestampTooOld is used when a block timestamp is not later than median time past
+	ReasonTimestampTooOld Reason = "timestamp-too-old"
+	// ReasonInvalidLastHash is used when a block does not link to the block before it
+	ReasonInvalidLastHash Reason = "invalid-last-hash"
+	// ReasonInvalidDifficulty is used when a block difficulty is not the retargeted one
+	ReasonInvalidDifficulty Reason = "invalid-difficulty"
+	// ReasonInvalidMerkleRoot is used when a block merkle root does not match its transactions
+	ReasonInvalidMerkleRoot Reason = "invalid-merkle-root"
+	// ReasonInvalidHash is used when a block hash is not the hash of its header
+	ReasonInvalidHash Reason = "invalid-hash"
+	// ReasonInsufficientWork is used when a block hash does not meet its difficulty
+	ReasonInsufficientWork Reason = "insufficient-work"
+	// ReasonTooManyRewards is used when a block has more than one reward transaction
+	ReasonTooManyRewards Reason = "too-many-rewards"
+	// ReasonInvalidReward is used when a reward transaction does not claim the reward plus block fees
+	ReasonInvalidReward Reason = "invalid-reward"
+	// ReasonInvalidOutput is used when transaction outputs total more than its inputs
+	ReasonInvalidOutput Reason = "invalid-output"
+	// ReasonInvalidPubKey is used when a transaction address is not a public key
+	ReasonInvalidPubKey Reason = "invalid-pubkey"
+	// ReasonInvalidAddress is used when a transaction address is neither a public key in hex nor a checksummed address
+	ReasonInvalidAddress Reason = "invalid-address"
+	// ReasonInvalidSignature is used when a transaction is not signed by its address
+	ReasonInvalidSignature Reason = "invalid-signature"
+	// ReasonInvalidNonce is used when a transaction does not carry the next nonce of its sender
+	ReasonInvalidNonce Reason = "invalid-nonce"
+	// ReasonInvalidInputBalance is used when a transaction input is not the balance of its sender
+	ReasonInvalidInputBalance Reason = "invalid-input-balance"
+	// ReasonImmatureReward is used when a transaction spends a mining reward before it matures
+	ReasonImmatureReward Reason = "immature-reward"
+	// ReasonDuplicateInput is used when a transaction spends from the same address more than once
+	ReasonDuplicateInput Reason = "duplicate-input"
+)
+
+// ValidationError tells where and why a chain is invalid, TransactionID is empty when the block itself is invalid
+type ValidationError struct {
+	Index         int    `json:"index"`
+	BlockHash     string `json:"blockHash"`
+	TransactionID string `json:"transactionId,omitempty"`
+	Reason        Reason `json:"reason"`
+	// Err holds the underlying error if any, e.g. ErrInvalidSignature or a ProofOfWorkError
+	Err error `json:"-"`
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("Invalid block %d %s, %s", e.Index, e.BlockHash, e.Reason)
+	if e.TransactionID != "" {
+		msg = fmt.Sprintf("%s in transaction %s", msg, e.TransactionID)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s, %v", msg, e.Err)
+	}
+	return msg
+}
+
+func blockError(index int, b Block, reason Reason, err error) *ValidationError {
+	var hash string
+	if b.Hash != nil {
+		hash = *b.Hash
+	}
+	return &ValidationError{Index: index, BlockHash: hash, Reason: reason, Err: err}
+}
+
+func transactionError(index int, b Block, tx Transaction, reason Reason, err error) *ValidationError {
+	e := blockError(index, b, reason, err)
+	e.TransactionID = tx.ID
+	return e
+}
+
+// transactionReason returns the reason of an error returned by IsValidTransaction
+func transactionReason(err error) Reason {
+	switch err {
+	case ErrInvalidOutputTotalBalance:
+		return ReasonInvalidOutput
+	case ErrInvalidPubKey:
+		return ReasonInvalidPubKey
+	case ErrInvalidAddress:
+		return ReasonInvalidAddress
+	case ErrDuplicateInput:
+		return ReasonDuplicateInput
+	}
+	return ReasonInvalidSignature
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/hex"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
 	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/knd/kndchain/pkg/listing"
@@ -13,8 +15,11 @@ import (
 
 // Service provides blockchain validating operations
 type Service interface {
-	IsValidChain(bc *Blockchain) bool
+	IsValidChain(bc *Blockchain) (bool, error)
+	IsValidExtension(ext *Extension) (bool, error)
+	IsHeavierChain(bc *Blockchain) bool
 	ContainsValidTransactions(bc *Blockchain) (bool, error)
+	ContainsValidExtensionTransactions(ext *Extension) (bool, error)
 }
 
 type service struct {
@@ -22,61 +27,135 @@ type service struct {
 	calculator           calculating.Service
 	RewardTxInputAddress string
 	MiningReward         uint64
+	params               consensus.Params
 }
 
 // NewService creates a validating service with necessary dependencies
-func NewService(l listing.Service, c calculating.Service, rewardInputAddress string, reward uint64) Service {
-	return &service{l, c, rewardInputAddress, reward}
+func NewService(l listing.Service, c calculating.Service, rewardInputAddress string, reward uint64, params consensus.Params) Service {
+	return &service{l, c, rewardInputAddress, reward, params}
 }
 
-// IsValidChain returns true if list of blocks compose valid blockchain
-func (s *service) IsValidChain(bc *Blockchain) bool {
+// IsValidChain returns true if list of blocks compose valid blockchain,
+// otherwise a ValidationError tells which block breaks which rule
+func (s *service) IsValidChain(bc *Blockchain) (bool, error) {
 	if bc == nil || len(bc.Chain) == 0 {
 		log.Println("Not a valid chain. Chain length is nil or zero length")
-		return false
+		return false, &ValidationError{Reason: ReasonEmptyChain}
 	}
 	if len(bc.Chain) == 1 {
 		// the only constrant for valid genesis block is that data is empty
-		log.Println("Not a valid chain. Genesis block should have zero data")
-		return len(bc.Chain[0].Data) == 0
+		if len(bc.Chain[0].Data) != 0 {
+			log.Println("Not a valid chain. Genesis block should have zero data")
+			return false, blockError(0, bc.Chain[0], ReasonInvalidGenesis, nil)
+		}
+		return true, nil
+	}
+
+	return s.isValidBlocks(bc.Chain[:1], 1, bc.Chain[1:])
+}
+
+// IsValidExtension returns true if the new blocks of ext compose a valid chain on top of its parents,
+// otherwise a ValidationError tells which block breaks which rule, its Index being the block height
+func (s *service) IsValidExtension(ext *Extension) (bool, error) {
+	if ext == nil || len(ext.Parents) == 0 || len(ext.Blocks) == 0 || uint32(len(ext.Parents)) > ext.Height {
+		log.Println("Not a valid chain extension. Parents or blocks are missing")
+		return false, &ValidationError{Reason: ReasonEmptyChain}
+	}
+
+	return s.isValidBlocks(ext.Parents, ext.Height, ext.Blocks)
+}
+
+// isValidBlocks validates blocks starting at given height on top of parents, the blocks right before them
+func (s *service) isValidBlocks(parents []Block, height uint32, blocks []Block) (bool, error) {
+	retargeter, err := s.params.Retargeter()
+	if err != nil {
+		log.Printf("Not a valid chain. %v", err)
+		return false, err
 	}
 
-	genesisBlock := bc.Chain[0]
-	prevTimestamp := genesisBlock.Timestamp
-	prevHash := genesisBlock.Hash
-	prevBlockDifficulty := genesisBlock.Difficulty
+	// chain holds parents and blocks, offset is the height of its first block
+	chain := append(append([]Block{}, parents...), blocks...)
+	offset := int(height) - len(parents)
+	headers := toConsensusHeaders(chain, uint32(offset))
+	prevHash := parents[len(parents)-1].Hash
 
-	for i := 1; i < len(bc.Chain); i++ {
-		currBlock := bc.Chain[i]
+	for p := len(parents); p < len(chain); p++ {
+		i := offset + p
+		currBlock := chain[p]
 		log.Printf("PrevBlockHash=%s, CurrBlockHash=%s", *prevHash, *currBlock.Hash)
 
-		if prevTimestamp >= currBlock.Timestamp {
-			log.Println("Not a valid chain. Block timestamp is not chronological")
-			return false
+		// limits are checked first so an oversized block is rejected before it is hashed
+		if len(currBlock.Data) > s.params.MaxBlockTransactions {
+			log.Printf("Not a valid chain. Block has %d transactions, more than %d", len(currBlock.Data), s.params.MaxBlockTransactions)
+			return false, blockError(i, currBlock, ReasonTooManyTransactions, nil)
+		}
+
+		if size := BlockSize(currBlock); size > s.params.MaxBlockSize {
+			log.Printf("Not a valid chain. Block size %d is more than %d", size, s.params.MaxBlockSize)
+			return false, blockError(i, currBlock, ReasonBlockTooLarge, nil)
+		}
+
+		if maxTimestamp := time.Now().Add(s.params.MaxFutureDrift).UnixNano(); currBlock.Timestamp > maxTimestamp {
+			log.Printf("Not a valid chain. Block timestamp %d is more than %v ahead of local time", currBlock.Timestamp, s.params.MaxFutureDrift)
+			return false, blockError(i, currBlock, ReasonTimestampTooNew, nil)
+		}
+
+		// a block only has to be later than the median of its predecessors so one skewed timestamp cannot stall the chain
+		if mtp := MedianTimePast(chain[:p], s.params.MedianTimeSpan); currBlock.Timestamp <= mtp {
+			log.Printf("Not a valid chain. Block timestamp %d is not later than median time past %d", currBlock.Timestamp, mtp)
+			return false, blockError(i, currBlock, ReasonTimestampTooOld, nil)
 		}
 
 		if *prevHash != *currBlock.LastHash {
 			log.Printf("Not a valid chain. Last block hash is not inside current block's last hash. *prevHash=%s, *currBlock.LastHash=%s", *prevHash, *currBlock.LastHash)
-			return false
+			return false, blockError(i, currBlock, ReasonInvalidLastHash, nil)
 		}
 
-		// Prevent difficulty jump
-		if (prevBlockDifficulty > currBlock.Difficulty && prevBlockDifficulty-currBlock.Difficulty > 1) || (currBlock.Difficulty > prevBlockDifficulty && currBlock.Difficulty-prevBlockDifficulty > 1) {
-			log.Printf("Not a valid chain. Difficulty jump in blocks. prevBlockDifficulty=%d, currBlock.Difficulty=%d", prevBlockDifficulty, currBlock.Difficulty)
-			return false
+		window := headers[:p]
+		if len(window) > retargeter.Window() {
+			window = window[len(window)-retargeter.Window():]
+		}
+		if difficulty := retargeter.NextDifficulty(window, currBlock.Timestamp); currBlock.Difficulty != difficulty {
+			log.Printf("Not a valid chain. Block difficulty is not retargeted. difficulty=%d, currBlock.Difficulty=%d", difficulty, currBlock.Difficulty)
+			return false, blockError(i, currBlock, ReasonInvalidDifficulty, &ProofOfWorkError{Index: i, Hash: *currBlock.Hash, Difficulty: currBlock.Difficulty, ExpectedDifficulty: difficulty})
 		}
 
-		if hashing.SHA256Hash(currBlock.Timestamp, *currBlock.LastHash, currBlock.Data, currBlock.Nonce, currBlock.Difficulty) != *currBlock.Hash {
+		if MerkleRoot(currBlock.Data) != currBlock.MerkleRoot {
+			log.Println("Not a valid chain. Block merkle root does not match its transactions")
+			return false, blockError(i, currBlock, ReasonInvalidMerkleRoot, nil)
+		}
+
+		if BlockHash(currBlock) != *currBlock.Hash {
 			log.Println("Not a valid chain. Current block hash is not correct SHA256")
-			return false
+			return false, blockError(i, currBlock, ReasonInvalidHash, nil)
+		}
+
+		if !HasProofOfWork(*currBlock.Hash, currBlock.Difficulty) {
+			log.Printf("Not a valid chain. Block hash does not meet its difficulty. hash=%s, currBlock.Difficulty=%d", *currBlock.Hash, currBlock.Difficulty)
+			return false, blockError(i, currBlock, ReasonInsufficientWork, &ProofOfWorkError{Index: i, Hash: *currBlock.Hash, Difficulty: currBlock.Difficulty, ExpectedDifficulty: currBlock.Difficulty})
 		}
 
-		prevTimestamp = currBlock.Timestamp
 		prevHash = currBlock.Hash
-		prevBlockDifficulty = currBlock.Difficulty
 	}
 
-	return true
+	return true, nil
+}
+
+// IsHeavierChain returns true if blockchain has more cumulative work than the local chain
+func (s *service) IsHeavierChain(bc *Blockchain) bool {
+	if bc == nil || len(bc.Chain) == 0 {
+		return false
+	}
+
+	// local work comes from the block index tip, the local chain is not reloaded
+	var localTipHash string
+	if s.lister.GetBlockCount() > 0 {
+		if lastBlock := s.lister.GetLastBlock(); lastBlock.Hash != nil {
+			localTipHash = *lastBlock.Hash
+		}
+	}
+
+	return CompareWork(ChainWork(bc), tipHash(bc), s.lister.GetChainWork(), localTipHash) > 0
 }
 
 // ErrInvalidOutputTotalBalance invalid output total balance compared with input amount
@@ -88,91 +167,205 @@ var ErrInvalidSignature = errors.New("Signature is invalid")
 // ErrInvalidPubKey invalid public key
 var ErrInvalidPubKey = errors.New("Invalid public key")
 
-// ErrCannotGetOutputBytes indicates error obtaining output bytes
-var ErrCannotGetOutputBytes = errors.New("Cannot obtain output bytes")
+// ErrInvalidAddress invalid address, neither a public key in hex nor a checksummed address
+var ErrInvalidAddress = errors.New("Invalid address")
 
-// IsValidTransaction returns true if transaction itself contains
-// valid input and output information
+// ErrDuplicateInput indicates when a transaction spends from the same address more than once
+var ErrDuplicateInput = errors.New("Duplicate input address in transaction")
+
+// IsValidTransaction returns true if transaction itself contains valid input and output information,
+// every input is signed by its address and outputs may total less than the inputs to leave a fee
 func IsValidTransaction(tx Transaction) (bool, error) {
-	i := tx.Input
-	o := tx.Output
+	iBalance, ok := inputTotal(tx)
+	if !ok {
+		return false, ErrInvalidOutputTotalBalance
+	}
+	oBalance, ok := outputTotal(tx)
+	if !ok || oBalance > iBalance {
+		return false, ErrInvalidOutputTotalBalance
+	}
 
-	var oBalance uint64
-	for _, oAmount := range o {
-		oBalance += oAmount
+	// every input signs the transaction without any signature, so inputs may sign in any order
+	msg := hashing.TransactionSigningBytes(toHashingTx(tx))
+	addresses := make(map[string]bool)
+	for _, input := range tx.Inputs() {
+		if addresses[input.Address] {
+			return false, ErrDuplicateInput
+		}
+		addresses[input.Address] = true
+
+		if err := verifyInput(input, msg); err != nil {
+			return false, err
+		}
 	}
 
-	if i.Amount != oBalance {
-		return false, ErrInvalidOutputTotalBalance
+	return true, nil
+}
+
+// verifyInput returns nil if input is signed by its address
+func verifyInput(input Input, msg []byte) error {
+	sigBytes, _ := hex.DecodeString(input.Signature)
+
+	// addresses were public keys in hex before checksummed addresses, inputs of such addresses stay valid
+	if pubKeyInByte, err := hex.DecodeString(input.Address); err == nil {
+		if !crypto.NewSecp256k1Generator().Verify(pubKeyInByte, msg, sigBytes) {
+			return ErrInvalidSignature
+		}
+		return nil
 	}
 
-	pubKeyInByte, err := hex.DecodeString(i.Address)
-	if err != nil {
-		return false, ErrInvalidPubKey
+	if err := crypto.ValidateAddress(input.Address); err != nil {
+		return ErrInvalidAddress
 	}
 
-	outputBytes, err := hex.DecodeString(hashing.SHA256Hash(tx.Output))
-	if err != nil {
-		return false, ErrCannotGetOutputBytes
+	// a multisig input carries the script of its address followed by the signatures of at least m of its keys
+	if crypto.IsMultisigAddress(input.Address) {
+		if !crypto.NewSecp256k1Generator().VerifyMultisig(input.Address, msg, sigBytes) {
+			return ErrInvalidSignature
+		}
+		return nil
 	}
 
-	sigBytes, _ := hex.DecodeString(i.Signature)
-	if !crypto.NewSecp256k1Generator().Verify(pubKeyInByte, outputBytes, sigBytes) {
-		return false, ErrInvalidSignature
+	if !crypto.NewSecp256k1Generator().VerifyAddress(input.Address, msg, sigBytes) {
+		return ErrInvalidSignature
 	}
 
-	return true, nil
+	return nil
 }
 
 // ErrMinerRewardExceedsLimit indicates when miner reward is more than 1
 var ErrMinerRewardExceedsLimit = errors.New("Miner reward exceeds limit")
 
-// ErrInvalidMinerRewardAmount indicates when miner reward tx amount is not same as config
+// ErrInvalidMinerRewardAmount indicates when miner reward tx amount is not same as config plus the block fees
 var ErrInvalidMinerRewardAmount = errors.New("Miner reward amount is invalid")
 
-// ErrInvalidInputBalance indicates when the sender has invalid input balance
+// ErrInvalidInputBalance indicates when an input amount is not the balance of its address
 var ErrInvalidInputBalance = errors.New("Invalid input balance")
 
-// ErrDuplicateTransaction indicates when the sender has duplicate transactions in same block
-var ErrDuplicateTransaction = errors.New("Duplicate transaction in same block")
+// ErrInvalidTransactionNonce indicates when an input does not carry the next nonce of its address,
+// as when a transaction is replayed or comes before an earlier transaction of the same address in its block
+var ErrInvalidTransactionNonce = errors.New("Invalid transaction nonce")
+
+// ErrImmatureRewardSpent indicates when the sender spends a mining reward before it is CoinbaseMaturity blocks deep
+var ErrImmatureRewardSpent = errors.New("Immature mining reward is spent")
 
-// ContainsValidTransactions returns true if all chain transactions are valid
+// ContainsValidTransactions returns true if all chain transactions are valid,
+// otherwise a ValidationError tells which transaction breaks which rule
 func (s *service) ContainsValidTransactions(bc *Blockchain) (bool, error) {
 	if bc == nil {
-		return false, errors.New("Empty blockchain")
+		return false, &ValidationError{Reason: ReasonEmptyChain}
+	}
+
+	// balances are taken from the given chain itself, which may fork from the local chain
+	noAccounts := func(address string) calculating.Account {
+		return calculating.Account{}
+	}
+	return s.containsValidTransactions(nil, 0, bc.Chain, noAccounts)
+}
+
+// ContainsValidExtensionTransactions returns true if all transactions of the new blocks of ext are valid
+// against the account states of its parent, otherwise a ValidationError tells which transaction breaks which rule,
+// its Index being the block height
+func (s *service) ContainsValidExtensionTransactions(ext *Extension) (bool, error) {
+	if ext == nil || ext.AccountOf == nil || uint32(len(ext.Parents)) > ext.Height {
+		return false, &ValidationError{Reason: ReasonEmptyChain}
+	}
+
+	return s.containsValidTransactions(ext.Parents, ext.Height, ext.Blocks, ext.AccountOf)
+}
+
+// containsValidTransactions validates transactions of blocks starting at given height on top of parents,
+// accountOf gives the account states as of the last parent
+func (s *service) containsValidTransactions(parents []Block, height uint32, blocks []Block, accountOf func(address string) calculating.Account) (bool, error) {
+	// account states are kept running from the parent so each block is applied once
+	accounts := make(map[string]calculating.Account)
+	runningAccountOf := func(address string) calculating.Account {
+		if account, ok := accounts[address]; ok {
+			return account
+		}
+		return accountOf(address)
 	}
 
-	cBlockchain := toCalculatingBlockchain(s.lister.GetBlockchain())
-	for i := 0; i < len(bc.Chain); i++ {
-		block := bc.Chain[i]
+	maturity := s.params.CoinbaseMaturity
+	if maturity < 1 {
+		maturity = 1
+	}
+
+	// chain holds parents and blocks, offset is the height of its first block
+	cBlockchain := toCalculatingBlockchain(&Blockchain{Chain: append(append([]Block{}, parents...), blocks...)})
+	offset := int(height) - len(parents)
+
+	// immature holds the rewards of the last blocks that the next block may not spend yet,
+	// those of parents are within the last maturity-1 of them
+	immature := make(map[string]uint64)
+	for p := len(parents) - maturity + 1; p < len(parents); p++ {
+		if p >= 0 {
+			for address, amount := range calculating.BlockRewards(cBlockchain.Chain[p], s.RewardTxInputAddress) {
+				immature[address] += amount
+			}
+		}
+	}
+
+	for p := len(parents); p < len(cBlockchain.Chain); p++ {
+		i := offset + p
+		block := blocks[p-len(parents)]
 		rewardTransactionCount := 0
-		senderTransactions := map[string]bool{}
 
+		var fees uint64
 		for _, transaction := range block.Data {
+			if transaction.Input.Address != s.RewardTxInputAddress {
+				fees += TransactionFee(transaction)
+			}
+		}
+
+		// transactions are applied in block order, so an address may send several transactions in a block
+		// as long as each carries its next nonce and spends the balance left by the ones before it
+		for j, transaction := range block.Data {
 			if transaction.Input.Address == s.RewardTxInputAddress {
 				rewardTransactionCount++
 
 				if rewardTransactionCount > 1 {
-					return false, ErrMinerRewardExceedsLimit
+					return false, transactionError(i, block, transaction, ReasonTooManyRewards, ErrMinerRewardExceedsLimit)
+				}
+
+				if len(transaction.Output) > 1 || getFirstValueOfMap(transaction.Output) != s.MiningReward+fees {
+					return false, transactionError(i, block, transaction, ReasonInvalidReward, ErrInvalidMinerRewardAmount)
 				}
 
-				if len(transaction.Output) > 1 || getFirstValueOfMap(transaction.Output) != s.MiningReward {
-					return false, ErrInvalidMinerRewardAmount
+				// a reward is immature from its own block on, even for transactions after it in the block
+				for address, amount := range transaction.Output {
+					immature[address] += amount
 				}
 			} else {
 				if valid, err := IsValidTransaction(transaction); !valid && err != nil {
-					return valid, ErrInvalidMinerRewardAmount
+					return false, transactionError(i, block, transaction, transactionReason(err), err)
 				}
 
-				senderBalance := s.calculator.BalanceByBlockIndex(transaction.Input.Address, cBlockchain, i-1)
-				if transaction.Input.Amount != senderBalance {
-					return false, ErrInvalidInputBalance
-				}
+				for _, input := range transaction.Inputs() {
+					if input.Nonce != runningAccountOf(input.Address).Nonce {
+						return false, transactionError(i, block, transaction, ReasonInvalidNonce, ErrInvalidTransactionNonce)
+					}
+
+					if input.Amount != s.calculator.AccountBalance(runningAccountOf(input.Address)) {
+						return false, transactionError(i, block, transaction, ReasonInvalidInputBalance, ErrInvalidInputBalance)
+					}
 
-				if _, present := senderTransactions[transaction.Input.Address]; present {
-					return false, ErrDuplicateTransaction
+					// the change output keeps immature rewards, only the rest may be sent or paid as fee
+					if transaction.Output[input.Address] < immature[input.Address] {
+						return false, transactionError(i, block, transaction, ReasonImmatureReward, ErrImmatureRewardSpent)
+					}
 				}
-				senderTransactions[transaction.Input.Address] = true
+			}
+
+			for address, account := range calculating.ApplyTransaction(cBlockchain.Chain[p].Data[j], runningAccountOf) {
+				accounts[address] = account
+			}
+		}
+
+		// rewards of block i-maturity+1 may be spent from block i+1 on
+		if matured := p + 1 - maturity; matured >= 0 {
+			for address, amount := range calculating.BlockRewards(cBlockchain.Chain[matured], s.RewardTxInputAddress) {
+				immature[address] -= amount
 			}
 		}
 	}
@@ -187,7 +380,7 @@ func getFirstValueOfMap(m map[string]uint64) uint64 {
 	return 0
 }
 
-func toCalculatingBlockchain(bc *listing.Blockchain) *calculating.Blockchain {
+func toCalculatingBlockchain(bc *Blockchain) *calculating.Blockchain {
 	if bc == nil {
 		return nil
 	}
@@ -203,14 +396,17 @@ func toCalculatingBlockchain(bc *listing.Blockchain) *calculating.Blockchain {
 					Timestamp: transaction.Input.Timestamp,
 					Amount:    transaction.Input.Amount,
 					Address:   transaction.Input.Address,
+					Nonce:     transaction.Input.Nonce,
 					Signature: transaction.Input.Signature,
 				},
+				ExtraInputs: toCalculatingInputs(transaction.ExtraInputs),
 			}
 			cTransactions = append(cTransactions, cTx)
 		}
 		cBlock := calculating.Block{
 			Timestamp:  block.Timestamp,
 			LastHash:   block.LastHash,
+			MerkleRoot: block.MerkleRoot,
 			Hash:       block.Hash,
 			Data:       cTransactions,
 			Nonce:      block.Nonce,
@@ -221,3 +417,17 @@ func toCalculatingBlockchain(bc *listing.Blockchain) *calculating.Blockchain {
 
 	return result
 }
+
+func toCalculatingInputs(inputs []Input) []calculating.Input {
+	var cInputs []calculating.Input
+	for _, input := range inputs {
+		cInputs = append(cInputs, calculating.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return cInputs
+}
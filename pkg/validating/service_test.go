@@ -1,17 +1,21 @@
 package validating
 
 import (
+	"encoding/hex"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/consensus"
+	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/knd/kndchain/pkg/listing"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestService_IsInvalidChainWhenGenesisBlockIsInvalid(t *testing.T) {
-	validatingService := NewService(new(MockedListing), calculating.NewService(1000), "MINER_REWARD", 5)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 	lastHash := "0x123"
 	hash := "0x456"
 	blockchain := &Blockchain{
@@ -28,11 +32,13 @@ func TestService_IsInvalidChainWhenGenesisBlockIsInvalid(t *testing.T) {
 	}
 
 	// perform test & verification
-	assert.False(t, validatingService.IsValidChain(blockchain))
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonInvalidGenesis, reasonOf(err))
 }
 
 func TestService_IsInvalidChainWhenLastHashIsTampered(t *testing.T) {
-	validatingService := NewService(new(MockedListing), calculating.NewService(1000), "MINER_REWARD", 5)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 	genesisTimestamp := time.Now().UnixNano()
 	lastHash := "0x123"
 	hash := "0x456"
@@ -59,11 +65,13 @@ func TestService_IsInvalidChainWhenLastHashIsTampered(t *testing.T) {
 	}
 
 	// perform test & verification
-	assert.False(t, validatingService.IsValidChain(blockchain))
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonInvalidLastHash, reasonOf(err))
 }
 
 func TestService_IsInvalidChainWhenTimestampIsNotInOrder(t *testing.T) {
-	validatingService := NewService(new(MockedListing), calculating.NewService(1000), "MINER_REWARD", 5)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 
 	genesisLastHash := "0x123"
 	genesisHash := "0x456"
@@ -84,32 +92,34 @@ func TestService_IsInvalidChainWhenTimestampIsNotInOrder(t *testing.T) {
 	blockA := Block{
 		Timestamp:  timestamp2,
 		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot([]Transaction{txA}),
 		Data:       []Transaction{txA},
 		Nonce:      1,
 		Difficulty: 1,
 	}
-	blockAHash := hashing.SHA256Hash(timestamp2, genesisHash, []Transaction{txA}, blockA.Nonce, blockA.Difficulty)
-	blockA.Hash = &blockAHash
+	blockAHash := mineBlock(&blockA)
 
 	txB := Transaction{ID: "txB"}
 	blockB := Block{
 		Timestamp:  timestamp1,
 		LastHash:   &blockAHash,
+		MerkleRoot: MerkleRoot([]Transaction{txB}),
 		Data:       []Transaction{txB},
 		Nonce:      2,
 		Difficulty: 1,
 	}
-	blockBHash := hashing.SHA256Hash(timestamp1, blockAHash, []Transaction{txB}, blockB.Nonce, blockB.Difficulty)
-	blockB.Hash = &blockBHash
+	mineBlock(&blockB)
 
 	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA, blockB}}
 
 	// perform test & verification
-	assert.False(t, validatingService.IsValidChain(blockchain))
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonTimestampTooOld, reasonOf(err))
 }
 
 func TestService_IsValidChainWhenChainContainsOnlyValidBlocks(t *testing.T) {
-	validatingService := NewService(new(MockedListing), calculating.NewService(1000), "MINER_REWARD", 5)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 
 	genesisLastHash := "0x123"
 	genesisHash := "0x456"
@@ -130,32 +140,205 @@ func TestService_IsValidChainWhenChainContainsOnlyValidBlocks(t *testing.T) {
 	blockA := Block{
 		Timestamp:  timestamp1,
 		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot([]Transaction{txA}),
 		Data:       []Transaction{txA},
 		Nonce:      1,
 		Difficulty: 1,
 	}
-	blockAHash := hashing.SHA256Hash(timestamp1, genesisHash, blockA.Data, blockA.Nonce, blockA.Difficulty)
-	blockA.Hash = &blockAHash
+	blockAHash := mineBlock(&blockA)
 
 	txB := Transaction{ID: "txB"}
 	blockB := Block{
 		Timestamp:  timestamp2,
 		LastHash:   &blockAHash,
+		MerkleRoot: MerkleRoot([]Transaction{txB}),
 		Data:       []Transaction{txB},
 		Nonce:      2,
 		Difficulty: 1,
 	}
-	blockBHash := hashing.SHA256Hash(timestamp2, blockAHash, blockB.Data, blockB.Nonce, blockB.Difficulty)
-	blockB.Hash = &blockBHash
+	mineBlock(&blockB)
 
 	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA, blockB}}
 
 	// perform test & verification
-	assert.True(t, validatingService.IsValidChain(blockchain))
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.True(t, valid)
+	assert.Nil(t, err)
+}
+
+func TestService_IsValidExtension(t *testing.T) {
+	assert := assert.New(t)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+	genesisLastHash := "0x123"
+	genesisHash := "0x456"
+	timestamp := time.Now().UnixNano()
+	genesisBlock := Block{Timestamp: timestamp, LastHash: &genesisLastHash, Hash: &genesisHash, Data: []Transaction{}, Difficulty: 1}
+
+	createBlocks := func() (Block, Block) {
+		txA := Transaction{ID: "txA"}
+		blockA := Block{Timestamp: timestamp + 100, LastHash: &genesisHash, MerkleRoot: MerkleRoot([]Transaction{txA}), Data: []Transaction{txA}, Difficulty: 1}
+		blockAHash := mineBlock(&blockA)
+		txB := Transaction{ID: "txB"}
+		blockB := Block{Timestamp: timestamp + 200, LastHash: &blockAHash, MerkleRoot: MerkleRoot([]Transaction{txB}), Data: []Transaction{txB}, Difficulty: 1}
+		mineBlock(&blockB)
+		return blockA, blockB
+	}
+
+	t.Run("validates new blocks on top of parents only", func(t *testing.T) {
+		blockA, blockB := createBlocks()
+
+		// perform test
+		valid, err := validatingService.IsValidExtension(&Extension{Parents: []Block{genesisBlock, blockA}, Height: 2, Blocks: []Block{blockB}})
+
+		// test verification
+		assert.True(valid)
+		assert.Nil(err)
+	})
+
+	t.Run("reports block height of the invalid block", func(t *testing.T) {
+		blockA, blockB := createBlocks()
+		tamperedLastHash := "tampered"
+		blockB.LastHash = &tamperedLastHash
+
+		// perform test
+		valid, err := validatingService.IsValidExtension(&Extension{Parents: []Block{genesisBlock}, Height: 1, Blocks: []Block{blockA, blockB}})
+
+		// test verification
+		assert.False(valid)
+		assert.Equal(ReasonInvalidLastHash, reasonOf(err))
+		assert.Equal(2, err.(*ValidationError).Index)
+	})
+
+	t.Run("rejects extension without parents or with more parents than its height", func(t *testing.T) {
+		blockA, _ := createBlocks()
+
+		// perform test
+		noParentsValid, noParentsErr := validatingService.IsValidExtension(&Extension{Height: 1, Blocks: []Block{blockA}})
+		tooManyValid, tooManyErr := validatingService.IsValidExtension(&Extension{Parents: []Block{genesisBlock, genesisBlock}, Height: 1, Blocks: []Block{blockA}})
+
+		// test verification
+		assert.False(noParentsValid)
+		assert.Equal(ReasonEmptyChain, reasonOf(noParentsErr))
+		assert.False(tooManyValid)
+		assert.Equal(ReasonEmptyChain, reasonOf(tooManyErr))
+	})
+}
+
+func TestService_IsInvalidChainWhenBlockHasTooManyTransactions(t *testing.T) {
+	params := consensus.DefaultParams()
+	params.MaxBlockTransactions = 1
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, params)
+
+	genesisLastHash := "0x123"
+	genesisHash := "0x456"
+	genesisTimestamp := time.Now().UnixNano()
+	timestamp1 := time.Now().Add(time.Duration(100)).UnixNano()
+
+	genesisBlock := Block{
+		Timestamp:  genesisTimestamp,
+		LastHash:   &genesisLastHash,
+		Hash:       &genesisHash,
+		Data:       []Transaction{},
+		Nonce:      0,
+		Difficulty: 1,
+	}
+
+	data := []Transaction{{ID: "txA"}, {ID: "txB"}}
+	blockA := Block{
+		Timestamp:  timestamp1,
+		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot(data),
+		Data:       data,
+		Nonce:      1,
+		Difficulty: 1,
+	}
+	mineBlock(&blockA)
+
+	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA}}
+
+	// perform test & verification
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonTooManyTransactions, reasonOf(err))
+}
+
+func TestService_IsInvalidChainWhenBlockIsTooLarge(t *testing.T) {
+	params := consensus.DefaultParams()
+	params.MaxBlockSize = 200
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, params)
+
+	genesisLastHash := "0x123"
+	genesisHash := "0x456"
+	genesisTimestamp := time.Now().UnixNano()
+	timestamp1 := time.Now().Add(time.Duration(100)).UnixNano()
+
+	genesisBlock := Block{
+		Timestamp:  genesisTimestamp,
+		LastHash:   &genesisLastHash,
+		Hash:       &genesisHash,
+		Data:       []Transaction{},
+		Nonce:      0,
+		Difficulty: 1,
+	}
+
+	data := []Transaction{{ID: "txA", Output: map[string]uint64{strings.Repeat("a", 200): 1}}}
+	blockA := Block{
+		Timestamp:  timestamp1,
+		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot(data),
+		Data:       data,
+		Nonce:      1,
+		Difficulty: 1,
+	}
+	mineBlock(&blockA)
+
+	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA}}
+
+	// perform test & verification
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonBlockTooLarge, reasonOf(err))
+}
+
+func TestService_IsInvalidChainWhenMerkleRootDoesNotMatchData(t *testing.T) {
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+	genesisLastHash := "0x123"
+	genesisHash := "0x456"
+	genesisTimestamp := time.Now().UnixNano()
+	timestamp1 := time.Now().Add(time.Duration(100)).UnixNano()
+
+	genesisBlock := Block{
+		Timestamp:  genesisTimestamp,
+		LastHash:   &genesisLastHash,
+		Hash:       &genesisHash,
+		Data:       []Transaction{},
+		Nonce:      0,
+		Difficulty: 1,
+	}
+
+	txA := Transaction{ID: "txA"}
+	blockA := Block{
+		Timestamp:  timestamp1,
+		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot([]Transaction{txA}),
+		Data:       []Transaction{{ID: "txEvil"}},
+		Nonce:      1,
+		Difficulty: 1,
+	}
+	mineBlock(&blockA)
+
+	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA}}
+
+	// perform test & verification
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, ReasonInvalidMerkleRoot, reasonOf(err))
 }
 
 func TestService_IsInvalidChainWhenLastBlockJumpsDifficulty(t *testing.T) {
-	validatingService := NewService(new(MockedListing), calculating.NewService(1000), "MINER_REWARD", 5)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 
 	genesisLastHash := "0x123"
 	genesisHash := "0x456"
@@ -176,28 +359,221 @@ func TestService_IsInvalidChainWhenLastBlockJumpsDifficulty(t *testing.T) {
 	blockA := Block{
 		Timestamp:  timestamp1,
 		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot([]Transaction{txA}),
 		Data:       []Transaction{txA},
 		Nonce:      1,
 		Difficulty: 4,
 	}
-	blockAHash := hashing.SHA256Hash(timestamp1, genesisHash, blockA.Data, blockA.Nonce, blockA.Difficulty)
-	blockA.Hash = &blockAHash
+	blockAHash := mineBlock(&blockA)
 
 	txB := Transaction{ID: "txB"}
 	blockB := Block{
 		Timestamp:  timestamp2,
 		LastHash:   &blockAHash,
+		MerkleRoot: MerkleRoot([]Transaction{txB}),
 		Data:       []Transaction{txB},
 		Nonce:      2,
 		Difficulty: 2,
 	}
-	blockBHash := hashing.SHA256Hash(timestamp2, blockAHash, blockB.Data, blockB.Nonce, blockB.Difficulty)
-	blockB.Hash = &blockBHash
+	mineBlock(&blockB)
 
 	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA, blockB}}
 
 	// perform test & verification
-	assert.False(t, validatingService.IsValidChain(blockchain))
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, &ValidationError{
+		Index:     1,
+		BlockHash: blockAHash,
+		Reason:    ReasonInvalidDifficulty,
+		Err:       &ProofOfWorkError{Index: 1, Hash: blockAHash, Difficulty: 4, ExpectedDifficulty: 5},
+	}, err)
+}
+
+func TestService_IsInvalidChainWhenHashDoesNotMeetDifficulty(t *testing.T) {
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+	genesisLastHash := "0x123"
+	genesisHash := "0x456"
+	genesisTimestamp := time.Now().UnixNano()
+	timestamp1 := time.Now().Add(time.Duration(100)).UnixNano()
+
+	genesisBlock := Block{
+		Timestamp:  genesisTimestamp,
+		LastHash:   &genesisLastHash,
+		Hash:       &genesisHash,
+		Data:       []Transaction{},
+		Nonce:      0,
+		Difficulty: 8,
+	}
+
+	txA := Transaction{ID: "txA"}
+	blockA := Block{
+		Timestamp:  timestamp1,
+		LastHash:   &genesisHash,
+		MerkleRoot: MerkleRoot([]Transaction{txA}),
+		Data:       []Transaction{txA},
+		Difficulty: 8,
+	}
+	// any nonce whose hash misses the target
+	for HasProofOfWork(BlockHash(blockA), blockA.Difficulty) {
+		blockA.Nonce++
+	}
+	blockAHash := BlockHash(blockA)
+	blockA.Hash = &blockAHash
+
+	blockchain := &Blockchain{Chain: []Block{genesisBlock, blockA}}
+
+	// perform test & verification
+	valid, err := validatingService.IsValidChain(blockchain)
+	assert.False(t, valid)
+	assert.Equal(t, &ValidationError{
+		Index:     1,
+		BlockHash: blockAHash,
+		Reason:    ReasonInsufficientWork,
+		Err:       &ProofOfWorkError{Index: 1, Hash: blockAHash, Difficulty: 8, ExpectedDifficulty: 8},
+	}, err)
+}
+
+func TestHasProofOfWork(t *testing.T) {
+	assert := assert.New(t)
+
+	// perform test & verification
+	assert.True(HasProofOfWork("0fff", 4))
+	assert.False(HasProofOfWork("0fff", 5))
+	assert.True(HasProofOfWork("0000", 16))
+	assert.False(HasProofOfWork("0000", 17))
+	assert.False(HasProofOfWork("not hex", 0))
+}
+
+func TestService_IsValidChainTimestamps(t *testing.T) {
+	assert := assert.New(t)
+	validatingService := NewService(new(MockedListing), calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+	now := time.Now()
+
+	createChain := func(timestamps ...time.Time) *Blockchain {
+		genesisLastHash := "0x123"
+		genesisHash := "0x456"
+		bc := &Blockchain{Chain: []Block{
+			Block{Timestamp: now.Add(-time.Hour).UnixNano(), LastHash: &genesisLastHash, Hash: &genesisHash, Data: []Transaction{}, Difficulty: 1},
+		}}
+		for i, timestamp := range timestamps {
+			lastHash := *bc.Chain[len(bc.Chain)-1].Hash
+			block := Block{
+				Timestamp:  timestamp.UnixNano(),
+				LastHash:   &lastHash,
+				MerkleRoot: MerkleRoot([]Transaction{}),
+				Data:       []Transaction{},
+				Nonce:      uint32(i),
+				Difficulty: 1,
+			}
+			mineBlock(&block)
+			bc.Chain = append(bc.Chain, block)
+		}
+		return bc
+	}
+
+	t.Run("accepts block within future drift", func(t *testing.T) {
+		// perform test & verification
+		valid, _ := validatingService.IsValidChain(createChain(now.Add(time.Minute)))
+		assert.True(valid)
+	})
+
+	t.Run("rejects block beyond future drift", func(t *testing.T) {
+		// perform test & verification
+		valid, _ := validatingService.IsValidChain(createChain(now.Add(3 * time.Minute)))
+		assert.False(valid)
+	})
+
+	t.Run("accepts block earlier than parent but later than median time past", func(t *testing.T) {
+		// perform test & verification
+		valid, _ := validatingService.IsValidChain(createChain(now.Add(-30*time.Minute), now.Add(-10*time.Minute), now.Add(-20*time.Minute)))
+		assert.True(valid)
+	})
+
+	t.Run("rejects block not later than median time past", func(t *testing.T) {
+		// perform test & verification
+		valid, _ := validatingService.IsValidChain(createChain(now.Add(-30*time.Minute), now.Add(-10*time.Minute), now.Add(-30*time.Minute)))
+		assert.False(valid)
+	})
+}
+
+func TestMedianTimePast(t *testing.T) {
+	assert := assert.New(t)
+	blocks := []Block{Block{Timestamp: 5}, Block{Timestamp: 1}, Block{Timestamp: 4}, Block{Timestamp: 2}}
+
+	// perform test & verification
+	assert.Equal(int64(0), MedianTimePast(nil, 11))
+	assert.Equal(int64(4), MedianTimePast(blocks, 11))
+	assert.Equal(int64(2), MedianTimePast(blocks, 3))
+	assert.Equal(int64(2), MedianTimePast(blocks, 1))
+}
+
+func TestService_IsHeavierChain(t *testing.T) {
+	assert := assert.New(t)
+
+	createChain := func(difficulties ...uint32) *Blockchain {
+		bc := &Blockchain{}
+		for i, difficulty := range difficulties {
+			hash := hashing.SHA256Hash(i, difficulty)
+			bc.Chain = append(bc.Chain, Block{Hash: &hash, Difficulty: difficulty})
+		}
+		return bc
+	}
+
+	mockLocalTip := func(lister *MockedListing, bc *Blockchain) {
+		lastBlock := bc.Chain[len(bc.Chain)-1]
+		lister.On("GetBlockCount").Return(len(bc.Chain))
+		lister.On("GetLastBlock").Return(listing.Block{Hash: lastBlock.Hash, Difficulty: lastBlock.Difficulty})
+		lister.On("GetChainWork").Return(ChainWork(bc))
+	}
+
+	t.Run("prefers shorter chain with more cumulative work", func(t *testing.T) {
+		lister := new(MockedListing)
+		mockLocalTip(lister, createChain(1, 1, 1, 1, 1))
+		validator := NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+		// perform test & verification
+		assert.True(validator.IsHeavierChain(createChain(1, 6)))
+	})
+
+	t.Run("rejects longer chain with less cumulative work", func(t *testing.T) {
+		lister := new(MockedListing)
+		mockLocalTip(lister, createChain(1, 6))
+		validator := NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+		// perform test & verification
+		assert.False(validator.IsHeavierChain(createChain(1, 1, 1, 1, 1)))
+	})
+
+	t.Run("rejects identical chain", func(t *testing.T) {
+		lister := new(MockedListing)
+		mockLocalTip(lister, createChain(1, 2, 3))
+		validator := NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+		// perform test & verification
+		assert.False(validator.IsHeavierChain(createChain(1, 2, 3)))
+		lister.AssertNotCalled(t, "GetBlockchain")
+	})
+
+	t.Run("caps work of difficulty no hash can meet", func(t *testing.T) {
+		lister := new(MockedListing)
+		mockLocalTip(lister, createChain(1, 256, 1))
+		validator := NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
+
+		// perform test & verification
+		assert.Equal(BlockWork(256), BlockWork(1<<31))
+		assert.False(validator.IsHeavierChain(createChain(1, 1<<31)))
+	})
+
+	t.Run("breaks ties of equal work by lower tip hash", func(t *testing.T) {
+		lowHash, highHash := "0x001", "0x002"
+
+		// perform test & verification
+		assert.Equal(1, CompareWork(BlockWork(3), lowHash, BlockWork(3), highHash))
+		assert.Equal(-1, CompareWork(BlockWork(3), highHash, BlockWork(3), lowHash))
+		assert.Equal(0, CompareWork(BlockWork(3), lowHash, BlockWork(3), lowHash))
+	})
 }
 
 func TestService_ContainsValidTransactions(t *testing.T) {
@@ -267,7 +643,7 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 
 	beforeEach := func() {
 		lister = new(MockedListing)
-		validator = NewService(lister, calculating.NewService(1000), "MINER_REWARD", 5)
+		validator = NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, consensus.DefaultParams())
 		bc = &Blockchain{}
 	}
 
@@ -291,9 +667,9 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 999, "0x1233": 1}, 1567756188, 1000, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600"),
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 999, "0x1233": 1}, 1567756188, 1000, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -306,6 +682,103 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		assert.True(valid)
 	})
 
+	t.Run("returns false if transaction is replayed in later block", func(t *testing.T) {
+		beforeEach()
+
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		data := []Transaction{}
+		nonce := uint32(0)
+		difficulty := uint32(3)
+
+		block := createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
+		bc.Chain = append(bc.Chain, block)
+		lister.On("GetBlockchain").Return(toListingBlockchain(bc))
+
+		data = []Transaction{
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+		}
+		for i := 1; i <= 2; i++ {
+			blockTs = blockTs.Add(time.Minute)
+			block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, uint32(i), difficulty)
+			bc.Chain = append(bc.Chain, block)
+		}
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(bc)
+
+		// test verification
+		assert.False(valid)
+		assert.Equal(ErrInvalidTransactionNonce, causeOf(err))
+		assert.Equal(ReasonInvalidNonce, reasonOf(err))
+	})
+
+	t.Run("returns true if reward transaction claims reward plus fees", func(t *testing.T) {
+		beforeEach()
+
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		data := []Transaction{}
+		nonce := uint32(0)
+		difficulty := uint32(3)
+
+		block := createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
+		bc.Chain = append(bc.Chain, block)
+		lister.On("GetBlockchain").Return(toListingBlockchain(bc))
+
+		blockTs, _ = time.Parse(time.RFC3339, "2019-09-06T14:50:04.265389+07:00")
+		nonce = uint32(7)
+		difficulty = uint32(2)
+		data = []Transaction{
+			createTransaction("1c9f0b4e-6a53-4c2b-9d0f-2f8f3b1f5a10", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 800, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "b4cbeab881f3f2da0f3ccadfbed10803430e0642b9086e1f4d905f2d7d69955c404e171bb63dc7efe4a27c846706171c1799e17a28bea53bc070bd82e1b232c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 15}, 0, 0, "MINER_REWARD", ""),
+		}
+		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
+		bc.Chain = append(bc.Chain, block)
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(bc)
+
+		// test verification
+		assert.Nil(err)
+		assert.True(valid)
+	})
+
+	t.Run("returns false if reward transaction does not claim fees exactly", func(t *testing.T) {
+		beforeEach()
+
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		data := []Transaction{}
+		nonce := uint32(0)
+		difficulty := uint32(3)
+
+		block := createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
+		bc.Chain = append(bc.Chain, block)
+		lister.On("GetBlockchain").Return(toListingBlockchain(bc))
+
+		blockTs, _ = time.Parse(time.RFC3339, "2019-09-06T14:50:04.265389+07:00")
+		nonce = uint32(7)
+		difficulty = uint32(2)
+		data = []Transaction{
+			createTransaction("1c9f0b4e-6a53-4c2b-9d0f-2f8f3b1f5a10", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 800, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "b4cbeab881f3f2da0f3ccadfbed10803430e0642b9086e1f4d905f2d7d69955c404e171bb63dc7efe4a27c846706171c1799e17a28bea53bc070bd82e1b232c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
+		}
+		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
+		bc.Chain = append(bc.Chain, block)
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(bc)
+
+		// test verification
+		assert.False(valid)
+		assert.Equal(ErrInvalidMinerRewardAmount, causeOf(err))
+		assert.Equal(ReasonInvalidReward, reasonOf(err))
+	})
+
 	t.Run("returns false if block has more than 1 reward transaction", func(t *testing.T) {
 		beforeEach()
 
@@ -326,10 +799,10 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 999, "0x1233": 1}, 1567756188, 1000, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600"),
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
-			createTransaction("43b0982e", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""), // 2nd reward transaction
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 999, "0x1233": 1}, 1567756188, 1000, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("43b0982e", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""), // 2nd reward transaction
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -338,7 +811,8 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		valid, err := validator.ContainsValidTransactions(bc)
 
 		// test verification
-		assert.Equal(ErrMinerRewardExceedsLimit, err)
+		assert.Equal(ErrMinerRewardExceedsLimit, causeOf(err))
+		assert.Equal(ReasonTooManyRewards, reasonOf(err))
 		assert.False(valid)
 	})
 
@@ -362,9 +836,9 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 99999, "0x1233": 1}, 1567756188, 1000, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600"), // transaction with malformed output
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 99999, "0x1233": 1}, 1567756188, 1000, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600"), // transaction with malformed output
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -373,7 +847,13 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		valid, err := validator.ContainsValidTransactions(bc)
 
 		// test verification
-		assert.Equal(ErrInvalidMinerRewardAmount, err)
+		assert.Equal(&ValidationError{
+			Index:         1,
+			BlockHash:     "153bdcdd6dcb3d7c4746f91489305275efe324128d235b6d315b6d4118691184",
+			TransactionID: "6ff6a803-6500-44f7-89f7-dbcf53b7b701",
+			Reason:        ReasonInvalidOutput,
+			Err:           ErrInvalidOutputTotalBalance,
+		}, err)
 		assert.False(valid)
 	})
 
@@ -397,9 +877,9 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 999, "0x1233": 1}, 1567756188, 1000, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600"),
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0x123": 5, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 10}, 0, 0, "MINER_REWARD", ""), // malformed reward transaction output
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 999, "0x1233": 1}, 1567756188, 1000, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0x123": 5, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 10}, 0, 0, "MINER_REWARD", ""), // malformed reward transaction output
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -408,7 +888,8 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		valid, err := validator.ContainsValidTransactions(bc)
 
 		// test verification
-		assert.Equal(ErrInvalidMinerRewardAmount, err)
+		assert.Equal(ErrInvalidMinerRewardAmount, causeOf(err))
+		assert.Equal(ReasonInvalidReward, reasonOf(err))
 		assert.False(valid)
 	})
 
@@ -431,9 +912,9 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 999, "0x1233": 1}, 1567756188, 1000, "0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600"),
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("6ff6a803-6500-44f7-89f7-dbcf53b7b701", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 999, "0x1233": 1}, 1567756188, 1000, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600"),
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -446,8 +927,8 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(1)
 		difficulty = uint32(1)
 		data = []Transaction{
-			createTransaction("42be10af-e50d-4f2e-a8dd-6b245738f695", map[string]uint64{"0439c221797ebc2acee2ab71194a125b35c9de7b5880e0fed65e0d9602cfc3206de51048f17c2b39d65bd677a8d0300b72260bfb361bfd109ad9d4d3f24c9e2b6c": 901, "0x893999": 100}, 1568004167, 1001, "0439c221797ebc2acee2ab71194a125b35c9de7b5880e0fed65e0d9602cfc3206de51048f17c2b39d65bd677a8d0300b72260bfb361bfd109ad9d4d3f24c9e2b6c", "aedb4dd132cb57aac82fa18725953d785556ef5505952fcbab25ad0e1fd414890d98ebdc7349668e3058372ea60ddb3dd6229a9fb73ab5fc6b17899553b864db01"),
-			createTransaction("838842c2-c34f-4947-9991-3af6491577d9", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("42be10af-e50d-4f2e-a8dd-6b245738f695", map[string]uint64{"04b37ba1e38ce4432ae5efe866484cc9db6e874d5226d67c1ea8ef8688d4f9908f3e9076447f3fda429328371f196f439fea0edf1af58eed672bd96d08a796f3be": 901, "0x893999": 100}, 1568004167, 1001, "04b37ba1e38ce4432ae5efe866484cc9db6e874d5226d67c1ea8ef8688d4f9908f3e9076447f3fda429328371f196f439fea0edf1af58eed672bd96d08a796f3be", "71400fdf35fad8d861423c46b94d200a77cf3ef2f47c03850daa4240406430a511db6be1b0112f97fd0adb54e587a2210deb777ef34e833eed830b27c964576f00"),
+			createTransaction("838842c2-c34f-4947-9991-3af6491577d9", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -456,7 +937,8 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		valid, err := validator.ContainsValidTransactions(bc)
 
 		// test verification
-		assert.Equal(ErrInvalidInputBalance, err)
+		assert.Equal(ErrInvalidInputBalance, causeOf(err))
+		assert.Equal(ReasonInvalidInputBalance, reasonOf(err))
 		assert.False(valid)
 	})
 
@@ -480,9 +962,9 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		nonce = uint32(7)
 		difficulty = uint32(2)
 		data = []Transaction{
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"),
-			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01"), // duplicated transaction
-			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"0444e8eb4de7752fbcbdc28082b63f36b0d372e06952bd6382e3ef3232946e9f44cd641076458acaa2549725b7e41d4f204ef15f3071d1bc2e3b298d00b5a532d1": 5}, 0, 0, "MINER_REWARD", ""),
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"), // duplicated transaction
+			createTransaction("43b0982e-bda0-4726-a686-78b6628b2b19", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
 		}
 		block = createBlock(blockTs.UnixNano(), &lastHash, &hash, data, nonce, difficulty)
 		bc.Chain = append(bc.Chain, block)
@@ -491,7 +973,226 @@ func TestService_ContainsValidTransactions(t *testing.T) {
 		valid, err := validator.ContainsValidTransactions(bc)
 
 		// test verification
-		assert.Equal(ErrDuplicateTransaction, err)
+		assert.Equal(ErrInvalidTransactionNonce, causeOf(err))
+		assert.Equal(ReasonInvalidNonce, reasonOf(err))
 		assert.False(valid)
 	})
+
+	// createSendingChain returns a chain whose block 1 holds data with every input signed by its address
+	createSendingChain := func(data ...Transaction) *Blockchain {
+		privKeys := map[string]string{
+			"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": "f8bec1ca9768c3c1aad2f03ed45152530649c007012bbb002c9ca126b170952b",
+			"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": "ebea872f04edd8c74131f01a9112829362cefae46cb23e679fc0e41587303ad5",
+		}
+		sign := func(input Input, msg []byte) string {
+			privKey, _ := hex.DecodeString(privKeys[input.Address])
+			sig, _ := crypto.NewSecp256k1Generator().Sign(msg, privKey)
+			return hex.EncodeToString(sig)
+		}
+		for i, tx := range data {
+			if tx.Input.Address == "MINER_REWARD" {
+				continue
+			}
+			msg := hashing.TransactionSigningBytes(toHashingTx(tx))
+			data[i].Input.Signature = sign(tx.Input, msg)
+			for j, input := range tx.ExtraInputs {
+				data[i].ExtraInputs[j].Signature = sign(input, msg)
+			}
+		}
+
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		chain := &Blockchain{}
+		chain.Chain = append(chain.Chain, createBlock(blockTs.UnixNano(), &lastHash, &hash, []Transaction{}, 0, 3))
+		chain.Chain = append(chain.Chain, createBlock(blockTs.Add(time.Minute).UnixNano(), &lastHash, &hash, data, 1, 3))
+		return chain
+	}
+	alice := "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5"
+	bob := "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0"
+	createSends := func() []Transaction {
+		first := createTransaction("d1a6c3f0-0f3e-4b7e-9a51-6c1f2e3d4b01", map[string]uint64{alice: 900, "0x893": 100}, 1567756159, 1000, alice, "")
+		second := createTransaction("d1a6c3f0-0f3e-4b7e-9a51-6c1f2e3d4b02", map[string]uint64{alice: 850, bob: 49}, 1567756160, 900, alice, "")
+		second.Input.Nonce = 1
+		// bob and alice both spend their whole balance to 0x1233
+		multiInput := createTransaction("d1a6c3f0-0f3e-4b7e-9a51-6c1f2e3d4b03", map[string]uint64{"0x1233": 1899}, 1567756161, 1049, bob, "")
+		multiInput.ExtraInputs = []Input{{Timestamp: 1567756161, Amount: 850, Address: alice, Nonce: 2}}
+		reward := createTransaction("d1a6c3f0-0f3e-4b7e-9a51-6c1f2e3d4b04", map[string]uint64{"0x1234": 6}, 0, 0, "MINER_REWARD", "")
+		return []Transaction{first, second, multiInput, reward}
+	}
+
+	t.Run("returns true if a sender has several transactions in a block in nonce order", func(t *testing.T) {
+		beforeEach()
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(createSendingChain(createSends()...))
+
+		// test verification
+		assert.Nil(err)
+		assert.True(valid)
+	})
+
+	t.Run("returns false if transactions of a sender are not in nonce order", func(t *testing.T) {
+		beforeEach()
+		sends := createSends()
+		sends[0], sends[1] = sends[1], sends[0]
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(createSendingChain(sends...))
+
+		// test verification
+		assert.Equal(ErrInvalidTransactionNonce, causeOf(err))
+		assert.Equal(ReasonInvalidNonce, reasonOf(err))
+		assert.Equal("d1a6c3f0-0f3e-4b7e-9a51-6c1f2e3d4b02", err.(*ValidationError).TransactionID)
+		assert.False(valid)
+	})
+
+	t.Run("returns false if an extra input is not the balance left by earlier transactions", func(t *testing.T) {
+		beforeEach()
+		sends := createSends()
+		sends[2].ExtraInputs[0].Amount = 900
+		sends[2].Output["0x1233"] = 1949
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(createSendingChain(sends...))
+
+		// test verification
+		assert.Equal(ErrInvalidInputBalance, causeOf(err))
+		assert.Equal(ReasonInvalidInputBalance, reasonOf(err))
+		assert.False(valid)
+	})
+
+	// createRewardSpendingChain returns a chain where the miner of block 1 sends all but 4 of its balance in block 2
+	createRewardSpendingChain := func() *Blockchain {
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		chain := &Blockchain{}
+		chain.Chain = append(chain.Chain, createBlock(blockTs.UnixNano(), &lastHash, &hash, []Transaction{}, 0, 3))
+
+		blockTs = blockTs.Add(time.Minute)
+		data := []Transaction{
+			createTransaction("5d0e7c52-6a1f-4f5e-9b8e-0c3e2f6d7a11", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 5}, 0, 0, "MINER_REWARD", ""),
+		}
+		chain.Chain = append(chain.Chain, createBlock(blockTs.UnixNano(), &lastHash, &hash, data, 1, 3))
+
+		blockTs = blockTs.Add(time.Minute)
+		data = []Transaction{
+			createTransaction("9a4f3c1e-2b7d-4e8a-a6f5-3d2c1b0e9f82", map[string]uint64{"04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0": 4, "0x1233": 1001}, 1567756200, 1005, "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0", "b893a0ee60457160198ea557a81ab0369a07301f0c6b7e7b4e4506d51e2628b504213382353c37abee703b715b3b60c5954f35528469418df372181fe9bd447701"),
+			createTransaction("b7e2d9a0-4c3f-4a1b-8e6d-5f9c0a1b2c33", map[string]uint64{"0x1234": 5}, 0, 0, "MINER_REWARD", ""),
+		}
+		chain.Chain = append(chain.Chain, createBlock(blockTs.UnixNano(), &lastHash, &hash, data, 2, 3))
+		return chain
+	}
+
+	t.Run("returns false if a transaction spends an immature reward", func(t *testing.T) {
+		beforeEach()
+		params := consensus.DefaultParams()
+		params.CoinbaseMaturity = 2
+		validator = NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 2), "MINER_REWARD", 5, params)
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(createRewardSpendingChain())
+
+		// test verification
+		assert.Equal(ErrImmatureRewardSpent, causeOf(err))
+		assert.Equal(ReasonImmatureReward, reasonOf(err))
+		assert.Equal(2, err.(*ValidationError).Index)
+		assert.False(valid)
+	})
+
+	t.Run("returns true if a transaction spends a mature reward", func(t *testing.T) {
+		beforeEach()
+		params := consensus.DefaultParams()
+		params.CoinbaseMaturity = 1
+		validator = NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 1), "MINER_REWARD", 5, params)
+
+		// perform test
+		valid, err := validator.ContainsValidTransactions(createRewardSpendingChain())
+
+		// test verification
+		assert.Nil(err)
+		assert.True(valid)
+	})
+	t.Run("returns false if an extension transaction spends a reward immature since a parent", func(t *testing.T) {
+		beforeEach()
+		params := consensus.DefaultParams()
+		params.CoinbaseMaturity = 2
+		validator = NewService(lister, calculating.NewService(1000, nil, "MINER_REWARD", 2), "MINER_REWARD", 5, params)
+		chain := createRewardSpendingChain()
+		// the miner of block 1 has its reward on top of the initial balance
+		minerRewarded := func(address string) calculating.Account {
+			if address == "04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0" {
+				return calculating.Account{Balance: 5}
+			}
+			return calculating.Account{}
+		}
+
+		// perform test
+		valid, err := validator.ContainsValidExtensionTransactions(&Extension{Parents: chain.Chain[:2], Height: 2, Blocks: chain.Chain[2:], AccountOf: minerRewarded})
+
+		// test verification
+		assert.Equal(ErrImmatureRewardSpent, causeOf(err))
+		assert.Equal(2, err.(*ValidationError).Index)
+		assert.False(valid)
+	})
+
+	t.Run("checks extension transactions against account states of the parent", func(t *testing.T) {
+		beforeEach()
+		blockTs, _ := time.Parse(time.RFC3339, "2019-09-06T14:18:44.226857+07:00")
+		lastHash := "0x000"
+		hash := "0x000"
+		alice := "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5"
+		data := []Transaction{
+			createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{alice: 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, alice, "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800"),
+		}
+		parents := []Block{createBlock(blockTs.UnixNano(), &lastHash, &hash, []Transaction{}, 0, 3)}
+		blocks := []Block{createBlock(blockTs.Add(time.Minute).UnixNano(), &lastHash, &hash, data, 1, 3)}
+		noAccounts := func(address string) calculating.Account { return calculating.Account{} }
+		aliceHasSent := func(address string) calculating.Account {
+			if address == alice {
+				return calculating.Account{Balance: 810, HasSent: true, Nonce: 1}
+			}
+			return calculating.Account{}
+		}
+
+		// perform test
+		valid, err := validator.ContainsValidExtensionTransactions(&Extension{Parents: parents, Height: 1, Blocks: blocks, AccountOf: noAccounts})
+		replayValid, replayErr := validator.ContainsValidExtensionTransactions(&Extension{Parents: parents, Height: 1, Blocks: blocks, AccountOf: aliceHasSent})
+
+		// test verification
+		assert.Nil(err)
+		assert.True(valid)
+		assert.Equal(ErrInvalidTransactionNonce, causeOf(replayErr))
+		assert.Equal(1, replayErr.(*ValidationError).Index)
+		assert.False(replayValid)
+	})
+}
+
+// mineBlock finds a nonce that meets block difficulty and sets block hash
+func mineBlock(b *Block) string {
+	for {
+		hash := BlockHash(*b)
+		if HasProofOfWork(hash, b.Difficulty) {
+			b.Hash = &hash
+			return hash
+		}
+		b.Nonce++
+	}
+}
+
+// reasonOf returns the reason of a validation error, empty if err is not one
+func reasonOf(err error) Reason {
+	if vErr, ok := err.(*ValidationError); ok {
+		return vErr.Reason
+	}
+	return ""
+}
+
+// causeOf returns the underlying error of a validation error, err itself if it is not one
+func causeOf(err error) error {
+	if vErr, ok := err.(*ValidationError); ok {
+		return vErr.Err
+	}
+	return err
 }
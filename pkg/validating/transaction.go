@@ -1,16 +1,83 @@
 package validating
 
+import (
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
 // Input of transaction
 type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
 // Transaction in data
 type Transaction struct {
-	ID     string            `json:"id"`
-	Input  Input             `json:"input"`
-	Output map[string]uint64 `json:"output"`
+	ID          string            `json:"id"`
+	Input       Input             `json:"input"`
+	ExtraInputs []Input           `json:"extraInputs,omitempty"`
+	Output      map[string]uint64 `json:"output"`
+}
+
+// Inputs returns Input followed by the extra inputs of a transaction spending from several addresses
+func (tx Transaction) Inputs() []Input {
+	return append([]Input{tx.Input}, tx.ExtraInputs...)
+}
+
+// TransactionFee returns what the senders leave to the miner, the input total minus the output total
+func TransactionFee(tx Transaction) uint64 {
+	iBalance, iOk := inputTotal(tx)
+	oBalance, oOk := outputTotal(tx)
+	if !iOk || !oOk || oBalance > iBalance {
+		return 0
+	}
+	return iBalance - oBalance
+}
+
+// inputTotal sums the input amounts of tx, ok is false when the sum overflows
+func inputTotal(tx Transaction) (total uint64, ok bool) {
+	for _, input := range tx.Inputs() {
+		if total+input.Amount < total {
+			return 0, false
+		}
+		total += input.Amount
+	}
+	return total, true
+}
+
+// outputTotal sums the outputs of tx, ok is false when the sum overflows
+func outputTotal(tx Transaction) (total uint64, ok bool) {
+	for _, amount := range tx.Output {
+		if total+amount < total {
+			return 0, false
+		}
+		total += amount
+	}
+	return total, true
+}
+
+func toHashingTx(tx Transaction) hashing.Tx {
+	var extraInputs []hashing.TxInput
+	for _, input := range tx.ExtraInputs {
+		extraInputs = append(extraInputs, toHashingTxInput(input))
+	}
+
+	return hashing.Tx{
+		ID:          tx.ID,
+		Output:      tx.Output,
+		Input:       toHashingTxInput(tx.Input),
+		ExtraInputs: extraInputs,
+	}
+}
+
+func toHashingTxInput(input Input) hashing.TxInput {
+	return hashing.TxInput{
+		Timestamp: input.Timestamp,
+		Amount:    input.Amount,
+		Address:   input.Address,
+		Nonce:     input.Nonce,
+		Signature: input.Signature,
+	}
 }
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/knd/kndchain/pkg/hashing"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,7 +27,7 @@ func TestIsValidTransaction(t *testing.T) {
 	}
 
 	t.Run("returns true if tx is valid", func(t *testing.T) {
-		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01")
+		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800")
 
 		// perform test
 		valid, _ := IsValidTransaction(tx)
@@ -34,6 +36,17 @@ func TestIsValidTransaction(t *testing.T) {
 		assert.True(valid)
 	})
 
+	t.Run("returns true if tx outputs leave a fee", func(t *testing.T) {
+		tx := createTransaction("1c9f0b4e-6a53-4c2b-9d0f-2f8f3b1f5a10", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 800, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "b4cbeab881f3f2da0f3ccadfbed10803430e0642b9086e1f4d905f2d7d69955c404e171bb63dc7efe4a27c846706171c1799e17a28bea53bc070bd82e1b232c600")
+
+		// perform test
+		valid, _ := IsValidTransaction(tx)
+
+		// test verification
+		assert.True(valid)
+		assert.Equal(uint64(10), TransactionFee(tx))
+	})
+
 	t.Run("returns false if tx ouptut is invalid", func(t *testing.T) {
 		iT := time.Now().UnixNano()
 		senderPubKeyHex := "0x123"
@@ -61,7 +74,7 @@ func TestIsValidTransaction(t *testing.T) {
 	})
 
 	t.Run("returns false if tx input signature invalid", func(t *testing.T) {
-		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "027b67184af6964e3b1605c29e854cce41e1c1dfbbbfb4c0a8b3a271f3f9723f5267e7e70695a0b6ff547883d44b4e992d5c46453f92ddc8b9028185bf002dec01")
+		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800")
 		tx.Input.Signature = "abc"
 
 		// perform test
@@ -72,8 +85,20 @@ func TestIsValidTransaction(t *testing.T) {
 		assert.Equal(ErrInvalidSignature, err)
 	})
 
+	t.Run("returns false if tx nonce is changed after signing", func(t *testing.T) {
+		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "75368bcd2d565f40847e39c302ef6f93af26d232b4f208a0380546f385c5f71615c149f1ca329579b3b577c783e5095c8053ea37e0a4008ce5216cc1d2087a9800")
+		tx.Input.Nonce = 1
+
+		// perform test
+		valid, err := IsValidTransaction(tx)
+
+		// test verification
+		assert.False(valid)
+		assert.Equal(ErrInvalidSignature, err)
+	})
+
 	t.Run("returns false if tx input signature is signed by different key", func(t *testing.T) {
-		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa", "fa2266c9c3f3c6c11f08715d2eb32faeae3e64545a1244a077001b0b4cabe3743b0ab01745f8cbe5b5561711724b323dba250b24a17e6a86dd18fd23346858a600")
+		tx := createTransaction("75b3d287-386d-4633-bea6-681b226dcbe5", map[string]uint64{"04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5": 810, "0x893": 100, "0x89333": 90}, 1567756159, 1000, "04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5", "201395d58ff5a784a7b1dfc08182c617d7bf3621534f202f9f3c6793716a0c69227f58d3309b531160e8528b5261c32be1774e257caa9fd3ede80042d9cb93c600")
 
 		// perform test
 		valid, err := IsValidTransaction(tx)
@@ -82,4 +107,100 @@ func TestIsValidTransaction(t *testing.T) {
 		assert.False(valid)
 		assert.Equal(ErrInvalidSignature, err)
 	})
+
+	t.Run("verifies tx of checksummed address with the recovered key", func(t *testing.T) {
+		secp256k1 := crypto.NewSecp256k1Generator()
+		pubKey, _ := hex.DecodeString("04b675cc100970f7a53a4eed33c48a8f1c23f7d4c97891f11271a735fc6aeb02efc45a5779c2ad35566d18e705c024a054afa7631e602cc54250097621422ba9f5")
+		privKey, _ := hex.DecodeString("f8bec1ca9768c3c1aad2f03ed45152530649c007012bbb002c9ca126b170952b")
+		address, _ := crypto.PubKeyToAddress(pubKey)
+		otherPubKey, _ := hex.DecodeString("04f6cae9a455c6b5d9e86cdfa26de736021a735fb638dfa4a1cfea5ed0b3f9f29e6f9e12eaba6aa5a211455141ea0a59352befc3cbd0381383021d1c2b8de34aa0")
+		otherAddress, _ := crypto.PubKeyToAddress(otherPubKey)
+		sign := func(tx Transaction) Transaction {
+			sig, _ := secp256k1.Sign(hashing.TransactionSigningBytes(toHashingTx(tx)), privKey)
+			tx.Input.Signature = hex.EncodeToString(sig)
+			return tx
+		}
+
+		// perform test
+		valid, err := IsValidTransaction(sign(createTransaction("0e1ae7c4-8b9a-4a59-a3f4-4b3e0f1b8d21", map[string]uint64{address: 900, otherAddress: 100}, 1567756159, 1000, address, "")))
+		otherValid, otherErr := IsValidTransaction(sign(createTransaction("0e1ae7c4-8b9a-4a59-a3f4-4b3e0f1b8d21", map[string]uint64{otherAddress: 1000}, 1567756159, 1000, otherAddress, "")))
+		typoValid, typoErr := IsValidTransaction(sign(createTransaction("0e1ae7c4-8b9a-4a59-a3f4-4b3e0f1b8d21", map[string]uint64{address: 1000}, 1567756159, 1000, address[:len(address)-1]+"1", "")))
+
+		// test verification
+		assert.True(valid)
+		assert.NoError(err)
+		assert.False(otherValid)
+		assert.Equal(ErrInvalidSignature, otherErr)
+		assert.False(typoValid)
+		assert.Equal(ErrInvalidAddress, typoErr)
+	})
+
+	t.Run("verifies every input of tx spending from several addresses", func(t *testing.T) {
+		secp256k1 := crypto.NewSecp256k1Generator()
+		alicePubKey, alicePrivKey := secp256k1.Generate()
+		bobPubKey, bobPrivKey := secp256k1.Generate()
+		alice, _ := crypto.PubKeyToAddress(alicePubKey)
+		bob, _ := crypto.PubKeyToAddress(bobPubKey)
+		createMultiInputTransaction := func(extraAddress string) Transaction {
+			tx := createTransaction("5b8e2f3a-7c1d-4e6f-9a0b-1c2d3e4f5a6b", map[string]uint64{"0x893": 1990}, 1567756159, 1000, alice, "")
+			tx.ExtraInputs = []Input{{Timestamp: 1567756159, Amount: 1000, Address: extraAddress}}
+			return tx
+		}
+		sign := func(tx Transaction, privKeys ...[]byte) Transaction {
+			msg := hashing.TransactionSigningBytes(toHashingTx(tx))
+			sig, _ := secp256k1.Sign(msg, privKeys[0])
+			tx.Input.Signature = hex.EncodeToString(sig)
+			sig, _ = secp256k1.Sign(msg, privKeys[1])
+			tx.ExtraInputs[0].Signature = hex.EncodeToString(sig)
+			return tx
+		}
+
+		// perform test
+		valid, err := IsValidTransaction(sign(createMultiInputTransaction(bob), alicePrivKey, bobPrivKey))
+		wrongKeyValid, wrongKeyErr := IsValidTransaction(sign(createMultiInputTransaction(bob), alicePrivKey, alicePrivKey))
+		duplicateValid, duplicateErr := IsValidTransaction(sign(createMultiInputTransaction(alice), alicePrivKey, alicePrivKey))
+
+		// test verification
+		assert.True(valid)
+		assert.NoError(err)
+		assert.Equal(uint64(10), TransactionFee(sign(createMultiInputTransaction(bob), alicePrivKey, bobPrivKey)))
+		assert.False(wrongKeyValid)
+		assert.Equal(ErrInvalidSignature, wrongKeyErr)
+		assert.False(duplicateValid)
+		assert.Equal(ErrDuplicateInput, duplicateErr)
+	})
+
+	t.Run("verifies m of n signatures of tx spending from multisig address", func(t *testing.T) {
+		secp256k1 := crypto.NewSecp256k1Generator()
+		alicePubKey, alicePrivKey := secp256k1.Generate()
+		bobPubKey, bobPrivKey := secp256k1.Generate()
+		carolPubKey, _ := secp256k1.Generate()
+		_, mallory := secp256k1.Generate()
+		script, _ := crypto.NewMultisigScript(2, [][]byte{alicePubKey, bobPubKey, carolPubKey})
+		createMultisigTransaction := func(privKeys ...[]byte) Transaction {
+			tx := createTransaction("8d1c4b7e-2f3a-4c5d-8e9f-0a1b2c3d4e5f", map[string]uint64{"0x893": 990}, 1567756159, 1000, script.Address(), "")
+			msg := hashing.TransactionSigningBytes(toHashingTx(tx))
+			var signatures [][]byte
+			for _, privKey := range privKeys {
+				sig, _ := secp256k1.Sign(msg, privKey)
+				signatures = append(signatures, sig)
+			}
+			tx.Input.Signature = hex.EncodeToString(crypto.EncodeMultisigSignature(script, signatures))
+			return tx
+		}
+
+		// perform test
+		valid, err := IsValidTransaction(createMultisigTransaction(bobPrivKey, alicePrivKey))
+		partialValid, partialErr := IsValidTransaction(createMultisigTransaction(alicePrivKey))
+		repeatedValid, _ := IsValidTransaction(createMultisigTransaction(alicePrivKey, alicePrivKey))
+		outsiderValid, _ := IsValidTransaction(createMultisigTransaction(alicePrivKey, mallory))
+
+		// test verification
+		assert.True(valid)
+		assert.NoError(err)
+		assert.False(partialValid)
+		assert.Equal(ErrInvalidSignature, partialErr)
+		assert.False(repeatedValid)
+		assert.False(outsiderValid)
+	})
 }
@@ -0,0 +1,79 @@
+package validating
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
+// ProofOfWorkError indicates when a block is not mined at the difficulty retargeting expects or its hash does not meet its difficulty
+type ProofOfWorkError struct {
+	Index              int
+	Hash               string
+	Difficulty         uint32
+	ExpectedDifficulty uint32
+}
+
+func (e *ProofOfWorkError) Error() string {
+	if e.Difficulty != e.ExpectedDifficulty {
+		return fmt.Sprintf("Block %d has difficulty %d, expected %d", e.Index, e.Difficulty, e.ExpectedDifficulty)
+	}
+	return fmt.Sprintf("Block %d hash %s does not have %d leading zero bits", e.Index, e.Hash, e.Difficulty)
+}
+
+// HasProofOfWork returns true if hash starts with at least difficulty zero bits
+func HasProofOfWork(hash string, difficulty uint32) bool {
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	return uint32(hashing.LeadingZeroBits(b)) >= difficulty
+}
+
+// maxDifficulty is the most leading zero bits a sha256 hash can have
+const maxDifficulty = 256
+
+// BlockWork returns the expected number of hashes needed to mine a block of given difficulty.
+// Difficulty comes from peers, so it is capped to what a hash can meet before shifting.
+func BlockWork(difficulty uint32) *big.Int {
+	if difficulty > maxDifficulty {
+		difficulty = maxDifficulty
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(difficulty))
+}
+
+// ChainWork returns the cumulative work of all blocks in blockchain
+func ChainWork(bc *Blockchain) *big.Int {
+	work := big.NewInt(0)
+	if bc == nil {
+		return work
+	}
+
+	for _, block := range bc.Chain {
+		work.Add(work, BlockWork(block.Difficulty))
+	}
+
+	return work
+}
+
+// CompareWork compares two chain tips by their cumulative work.
+// It returns 1 if chain a is preferred, -1 if chain b is preferred and 0 if both are the same tip.
+// When work is equal the tip with the lower hash wins, so every node settles on the same chain.
+func CompareWork(aWork *big.Int, aTipHash string, bWork *big.Int, bTipHash string) int {
+	if c := aWork.Cmp(bWork); c != 0 {
+		return c
+	}
+
+	return -strings.Compare(aTipHash, bTipHash)
+}
+
+func tipHash(bc *Blockchain) string {
+	if bc == nil || len(bc.Chain) == 0 || bc.Chain[len(bc.Chain)-1].Hash == nil {
+		return ""
+	}
+
+	return *bc.Chain[len(bc.Chain)-1].Hash
+}
@@ -0,0 +1,227 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/crypto"
+)
+
+// DefaultGapLimit is the number of unused addresses in a row after which discovery stops, as in BIP-44
+const DefaultGapLimit = 20
+
+// DerivationPath is the BIP-44 path whose children are the addresses of a HD wallet, with the coin type of test networks
+const DerivationPath = "m/44'/1'/0'/0"
+
+// ErrGapLimitReached is used when a HD wallet already has gap limit unused addresses, a new one would not be discovered on restore
+var ErrGapLimitReached = errors.New("Gap limit reached, Use an unused address first")
+
+// ErrUnknownAddress is used when an address is not derived by a HD wallet
+var ErrUnknownAddress = errors.New("Address not derived by this wallet")
+
+// HDWallet provides access to many addresses derived from one seed, backing up the seed backs up all of them
+type HDWallet interface {
+	// ID returns the pubkeyhex of the master key, the keystore keeps the seed under it
+	ID() string
+	// Addresses returns the derived addresses in derivation order
+	Addresses() []string
+	// NextAddress derives a new address to receive to
+	NextAddress() (string, error)
+	// Wallet returns the wallet of a derived address to send from
+	Wallet(address string) (Wallet, error)
+	// Discover derives addresses until gap limit of them in a row have no transactions as of the main chain tip
+	Discover()
+	// Balance returns the sum of the balances of all addresses as of the main chain tip
+	Balance() uint64
+	// CreateTransaction creates a transaction spending from as many addresses as amount and fee take, in derivation order
+	CreateTransaction(receiver string, amount uint64, fee uint64) (Transaction, error)
+}
+
+type hdWallet struct {
+	gen        KeyPairGenerator
+	calculator calculating.Service
+	master     *crypto.ExtendedKey
+	account    *crypto.ExtendedKey
+	keys       []*crypto.ExtendedKey
+	addresses  []string
+	nextIndex  uint32
+	gapLimit   int
+}
+
+// NewHDWallet creates a HD wallet of seed, e.g. from MnemonicToSeed, the seed is stored encrypted with passphrase unless ks is nil.
+// A gapLimit less than 1 means DefaultGapLimit.
+func NewHDWallet(kpg KeyPairGenerator, c calculating.Service, seed []byte, gapLimit int, ks Keystore, passphrase string) (HDWallet, error) {
+	if gapLimit < 1 {
+		gapLimit = DefaultGapLimit
+	}
+
+	master, err := crypto.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(DerivationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &hdWallet{
+		gen:        kpg,
+		calculator: c,
+		master:     master,
+		account:    account,
+		gapLimit:   gapLimit,
+	}
+
+	if ks != nil {
+		if err := ks.Store(w.ID(), seed, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// LoadHDWallet unlocks the seed of HD wallet id from keystore with passphrase and discovers its addresses
+func LoadHDWallet(kpg KeyPairGenerator, c calculating.Service, ks Keystore, id string, passphrase string, gapLimit int) (HDWallet, error) {
+	seed, err := ks.Unlock(id, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewHDWallet(kpg, c, seed, gapLimit, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	w.Discover()
+	return w, nil
+}
+
+// ID returns the pubkeyhex of the master key
+func (w *hdWallet) ID() string {
+	return hex.EncodeToString(w.master.PubKey())
+}
+
+// Addresses returns the derived addresses in derivation order
+func (w *hdWallet) Addresses() []string {
+	return w.addresses
+}
+
+// NextAddress derives a new address unless the last gap limit addresses are unused
+func (w *hdWallet) NextAddress() (string, error) {
+	if w.unusedTail() >= w.gapLimit {
+		return "", ErrGapLimitReached
+	}
+
+	key := w.derive()
+	w.keys = append(w.keys, key)
+	w.addresses = append(w.addresses, toAddress(key))
+	return w.addresses[len(w.addresses)-1], nil
+}
+
+// Wallet returns the wallet of a derived address with its balance and nonce as of the main chain tip
+func (w *hdWallet) Wallet(address string) (Wallet, error) {
+	for i, a := range w.addresses {
+		if a != address {
+			continue
+		}
+
+		addressWallet := &wallet{
+			gen:        w.gen,
+			publicKey:  w.keys[i].PubKey(),
+			privateKey: w.keys[i].PrivKey(),
+			calculator: w.calculator,
+		}
+		addressWallet.refresh()
+		return addressWallet, nil
+	}
+	return nil, ErrUnknownAddress
+}
+
+// Discover derives addresses until gap limit of them in a row have no transactions,
+// it keeps the addresses up to the last used one besides those derived already
+func (w *hdWallet) Discover() {
+	var keys []*crypto.ExtendedKey
+	var addresses []string
+	for gap := 0; gap < w.gapLimit; {
+		var key *crypto.ExtendedKey
+		if len(w.keys) > len(keys) {
+			key = w.keys[len(keys)]
+		} else {
+			key = w.derive()
+		}
+		address := toAddress(key)
+		keys = append(keys, key)
+		addresses = append(addresses, address)
+
+		if w.calculator.CurrentHasTransactions(address) {
+			gap = 0
+			continue
+		}
+		gap++
+	}
+
+	keep := len(keys) - w.gapLimit
+	if keep < len(w.keys) {
+		keep = len(w.keys)
+	}
+	w.keys = keys[:keep]
+	w.addresses = addresses[:keep]
+	if keep > 0 {
+		w.nextIndex = w.keys[keep-1].Index() + 1
+	} else {
+		w.nextIndex = 0
+	}
+}
+
+// Balance returns the sum of the balances of all addresses as of the main chain tip
+func (w *hdWallet) Balance() uint64 {
+	return w.calculator.CurrentTotalBalance(w.addresses)
+}
+
+// CreateTransaction creates a transaction spending from addresses in derivation order with their balances as of the main chain tip,
+// it has a single input if the first address with a spendable balance covers amount and fee
+func (w *hdWallet) CreateTransaction(receiver string, amount uint64, fee uint64) (Transaction, error) {
+	var senders []Wallet
+	for i := range w.addresses {
+		sender := &wallet{
+			gen:        w.gen,
+			publicKey:  w.keys[i].PubKey(),
+			privateKey: w.keys[i].PrivKey(),
+			calculator: w.calculator,
+		}
+		sender.refresh()
+		senders = append(senders, sender)
+	}
+
+	return NewMultiInputTransaction(senders, receiver, amount, fee)
+}
+
+// derive returns the key at the next child index, skipping the rare indexes BIP-32 has no valid key for
+func (w *hdWallet) derive() *crypto.ExtendedKey {
+	for {
+		key, err := w.account.Child(w.nextIndex)
+		w.nextIndex++
+		if err == nil {
+			return key
+		}
+	}
+}
+
+// toAddress returns the address of a derived key, which is valid since BIP-32 only derives keys on the curve
+func toAddress(key *crypto.ExtendedKey) string {
+	address, _ := crypto.PubKeyToAddress(key.PubKey())
+	return address
+}
+
+// unusedTail returns the number of addresses in a row without transactions at the end of the derived ones
+func (w *hdWallet) unusedTail() int {
+	unused := 0
+	for i := len(w.addresses) - 1; i >= 0 && unused < w.gapLimit; i-- {
+		if w.calculator.CurrentHasTransactions(w.addresses[i]) {
+			break
+		}
+		unused++
+	}
+	return unused
+}
@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHDWallet(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	seed, _ := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	master, _ := crypto.NewMasterKey(seed)
+	addressAt := func(index int) string {
+		key, _ := master.Derive(DerivationPath + "/" + strconv.Itoa(index))
+		address, _ := crypto.PubKeyToAddress(key.PubKey())
+		return address
+	}
+	var mockedCalculating *MockedCalculating
+
+	beforeEach := func(used ...int) {
+		mockedCalculating = new(MockedCalculating)
+		for _, index := range used {
+			mockedCalculating.On("CurrentHasTransactions", addressAt(index)).Return(true)
+		}
+		mockedCalculating.On("CurrentHasTransactions", mock.Anything).Return(false)
+	}
+
+	t.Run("derives addresses in order up to gap limit", func(t *testing.T) {
+		beforeEach()
+		w, err := NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		assert.NoError(err)
+
+		// perform test
+		first, err := w.NextAddress()
+		assert.NoError(err)
+		second, err := w.NextAddress()
+		assert.NoError(err)
+		_, err = w.NextAddress()
+
+		// test verification
+		assert.Equal(addressAt(0), first)
+		assert.Equal(addressAt(1), second)
+		assert.Equal(ErrGapLimitReached, err)
+		assert.Equal([]string{first, second}, w.Addresses())
+	})
+
+	t.Run("derives past gap limit once an address is used", func(t *testing.T) {
+		beforeEach(1)
+		w, _ := NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		w.NextAddress()
+		w.NextAddress()
+
+		// perform test
+		third, err := w.NextAddress()
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(addressAt(2), third)
+	})
+
+	t.Run("discovers addresses up to the last used one", func(t *testing.T) {
+		beforeEach(0, 3, 5, 9)
+		w, _ := NewHDWallet(secp256k1, mockedCalculating, seed, 3, nil, "")
+
+		// perform test
+		w.Discover()
+
+		// test verification
+		assert.Len(w.Addresses(), 6)
+		assert.Equal(addressAt(5), w.Addresses()[5])
+		next, _ := w.NextAddress()
+		assert.Equal(addressAt(6), next)
+	})
+
+	t.Run("sums balances of addresses", func(t *testing.T) {
+		beforeEach(0, 1)
+		w, _ := NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		w.Discover()
+		mockedCalculating.On("CurrentTotalBalance", []string{addressAt(0), addressAt(1)}).Return(uint64(1500))
+
+		// perform test & verification
+		assert.Equal(uint64(1500), w.Balance())
+	})
+
+	t.Run("returns wallet that signs for address", func(t *testing.T) {
+		beforeEach()
+		w, _ := NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		address, _ := w.NextAddress()
+		mockedCalculating.On("CurrentBalance", address).Return(uint64(1000))
+		mockedCalculating.On("CurrentImmatureBalance", address).Return(uint64(0))
+		mockedCalculating.On("CurrentNonce", address).Return(uint64(4))
+		data := []byte("foo")
+
+		// perform test
+		addressWallet, err := w.Wallet(address)
+		_, unknownErr := w.Wallet("0x123")
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(address, addressWallet.Address())
+		assert.Equal(uint64(1000), addressWallet.Balance())
+		assert.Equal(uint64(4), addressWallet.Nonce())
+		assert.Equal(uint64(4), NewTransaction(addressWallet, "receiver", 10, 1).GetInput().Nonce)
+		assert.True(secp256k1.Verify(addressWallet.PubKey(), data, addressWallet.Sign(data)))
+		assert.Equal(ErrUnknownAddress, unknownErr)
+	})
+
+	t.Run("creates transaction spending from several addresses", func(t *testing.T) {
+		beforeEach(0, 1)
+		w, _ := NewHDWallet(secp256k1, mockedCalculating, seed, 2, nil, "")
+		w.Discover()
+		mockedCalculating.On("CurrentBalance", addressAt(0)).Return(uint64(300))
+		mockedCalculating.On("CurrentBalance", addressAt(1)).Return(uint64(800))
+		mockedCalculating.On("CurrentImmatureBalance", mock.Anything).Return(uint64(0))
+		mockedCalculating.On("CurrentNonce", addressAt(0)).Return(uint64(2))
+		mockedCalculating.On("CurrentNonce", addressAt(1)).Return(uint64(0))
+
+		// perform test
+		tx, err := w.CreateTransaction("receiver", 500, 10)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(Input{Timestamp: tx.GetInput().Timestamp, Amount: 300, Address: addressAt(0), Nonce: 2, Signature: tx.GetInput().Signature}, tx.GetInput())
+		assert.Len(tx.GetExtraInputs(), 1)
+		assert.Equal(uint64(0), tx.GetExtraInputs()[0].Nonce)
+		assert.Equal(Output{"receiver": 500, addressAt(0): 0, addressAt(1): 590}, tx.GetOutput())
+		_, err = w.CreateTransaction("receiver", 1100, 1)
+		assert.Equal(ErrTxAmountExceedsBalance, err)
+	})
+
+	t.Run("restores from keystore", func(t *testing.T) {
+		beforeEach(0, 1)
+		dir, err := ioutil.TempDir("", "kndchainKeys")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+		keystore := NewKeystore(dir, LightScryptN)
+		w, err := NewHDWallet(secp256k1, mockedCalculating, seed, 2, keystore, "secret")
+		assert.NoError(err)
+
+		// perform test
+		restored, err := LoadHDWallet(secp256k1, mockedCalculating, keystore, w.ID(), "secret", 2)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(w.ID(), restored.ID())
+		assert.Equal([]string{addressAt(0), addressAt(1)}, restored.Addresses())
+		_, err = LoadHDWallet(secp256k1, mockedCalculating, keystore, w.ID(), "guess", 2)
+		assert.Equal(ErrInvalidPassphrase, err)
+	})
+}
@@ -0,0 +1,273 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeystoreVersion is the version of the key file format, it changes whenever the format changes
+const KeystoreVersion = 1
+
+const (
+	// StandardScryptN is the scrypt cost parameter for keys of a node, deriving a key takes about a second
+	StandardScryptN = 1 << 18
+	// LightScryptN is the scrypt cost parameter for throwaway keys, e.g. in tests
+	LightScryptN = 1 << 12
+
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+
+	kdfScrypt       = "scrypt"
+	cipherAES256GCM = "aes-256-gcm"
+)
+
+// ErrInvalidPassphrase is used when a key file can not be decrypted with the given passphrase
+var ErrInvalidPassphrase = errors.New("Invalid passphrase, Key can not be decrypted")
+
+// ErrKeyNotFound is used when there is no key file for the given public key
+var ErrKeyNotFound = errors.New("Key not found in keystore")
+
+// ErrUnencryptedKey is used when a key file holds a raw private key, it needs to be imported with a passphrase first
+var ErrUnencryptedKey = errors.New("Key file is not encrypted, Key needs to be imported")
+
+// ErrKeyAlreadyEncrypted is used when importing a key file that is encrypted already
+var ErrKeyAlreadyEncrypted = errors.New("Key file is encrypted already")
+
+// ErrUnsupportedKeyFile is used when a key file has an unknown version, KDF or cipher
+var ErrUnsupportedKeyFile = errors.New("Unsupported key file")
+
+// Keystore keeps private keys encrypted with a passphrase, one file named by the public key hex per key
+type Keystore interface {
+	// Store encrypts privKey with passphrase into the key file of pubKeyHex
+	Store(pubKeyHex string, privKey []byte, passphrase string) error
+	// Unlock returns the private key of pubKeyHex decrypted with passphrase
+	Unlock(pubKeyHex string, passphrase string) ([]byte, error)
+	// ChangePassphrase encrypts the key of pubKeyHex again with newPassphrase
+	ChangePassphrase(pubKeyHex string, oldPassphrase string, newPassphrase string) error
+	// Export returns the private key of pubKeyHex in hex, e.g. to back it up
+	Export(pubKeyHex string, passphrase string) (string, error)
+	// Import encrypts the unencrypted key file of pubKeyHex with passphrase
+	Import(pubKeyHex string, passphrase string) error
+}
+
+// KeyFile is the JSON format of an encrypted key on disk
+type KeyFile struct {
+	Version int        `json:"version"`
+	Address string     `json:"address"`
+	Crypto  CryptoJSON `json:"crypto"`
+}
+
+// CryptoJSON holds how a key is encrypted, byte fields are hex
+type CryptoJSON struct {
+	Cipher     string           `json:"cipher"`
+	CipherText string           `json:"ciphertext"`
+	Nonce      string           `json:"nonce"`
+	KDF        string           `json:"kdf"`
+	KDFParams  ScryptParamsJSON `json:"kdfparams"`
+}
+
+// ScryptParamsJSON holds the parameters the encryption key is derived from the passphrase with
+type ScryptParamsJSON struct {
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	KeyLen int    `json:"dklen"`
+	Salt   string `json:"salt"`
+}
+
+type keystore struct {
+	dir     string
+	scryptN int
+}
+
+// NewKeystore creates a keystore in dir, new keys are encrypted with scrypt cost scryptN
+func NewKeystore(dir string, scryptN int) Keystore {
+	return &keystore{dir, scryptN}
+}
+
+func (ks *keystore) Store(pubKeyHex string, privKey []byte, passphrase string) error {
+	keyFile, err := ks.encrypt(pubKeyHex, privKey, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ks.write(pubKeyHex, keyFile)
+}
+
+func (ks *keystore) Unlock(pubKeyHex string, passphrase string) ([]byte, error) {
+	keyFile, err := ks.read(pubKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(keyFile, passphrase)
+}
+
+func (ks *keystore) ChangePassphrase(pubKeyHex string, oldPassphrase string, newPassphrase string) error {
+	privKey, err := ks.Unlock(pubKeyHex, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return ks.Store(pubKeyHex, privKey, newPassphrase)
+}
+
+func (ks *keystore) Export(pubKeyHex string, passphrase string) (string, error) {
+	privKey, err := ks.Unlock(pubKeyHex, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(privKey), nil
+}
+
+func (ks *keystore) Import(pubKeyHex string, passphrase string) error {
+	if _, err := ks.read(pubKeyHex); err != ErrUnencryptedKey {
+		if err == nil {
+			return ErrKeyAlreadyEncrypted
+		}
+		return err
+	}
+
+	privKey, err := ioutil.ReadFile(ks.path(pubKeyHex))
+	if err != nil {
+		return err
+	}
+
+	return ks.Store(pubKeyHex, privKey, passphrase)
+}
+
+func (ks *keystore) path(pubKeyHex string) string {
+	return path.Join(ks.dir, pubKeyHex)
+}
+
+func (ks *keystore) read(pubKeyHex string) (*KeyFile, error) {
+	b, err := ioutil.ReadFile(ks.path(pubKeyHex))
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keyFile KeyFile
+	if err := json.Unmarshal(b, &keyFile); err != nil {
+		// key files written before the keystore hold the raw private key
+		return nil, ErrUnencryptedKey
+	}
+	if keyFile.Version != KeystoreVersion || keyFile.Crypto.KDF != kdfScrypt || keyFile.Crypto.Cipher != cipherAES256GCM {
+		return nil, ErrUnsupportedKeyFile
+	}
+	return &keyFile, nil
+}
+
+// write replaces the key file of pubKeyHex through a temporary file, so a failed write never loses the old key
+func (ks *keystore) write(pubKeyHex string, keyFile *KeyFile) error {
+	b, err := json.MarshalIndent(keyFile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(ks.dir, "."+pubKeyHex)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// TempFile creates the file readable by its owner only
+	return os.Rename(tmp.Name(), ks.path(pubKeyHex))
+}
+
+func (ks *keystore) encrypt(pubKeyHex string, privKey []byte, passphrase string) (*KeyFile, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params := ScryptParamsJSON{N: ks.scryptN, R: scryptR, P: scryptP, KeyLen: scryptKeyLen, Salt: hex.EncodeToString(salt)}
+
+	aead, err := newAEAD(params, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &KeyFile{
+		Version: KeystoreVersion,
+		Address: pubKeyHex,
+		Crypto: CryptoJSON{
+			Cipher: cipherAES256GCM,
+			// the address is authenticated too, so a key file can not be passed off as another one
+			CipherText: hex.EncodeToString(aead.Seal(nil, nonce, privKey, []byte(pubKeyHex))),
+			Nonce:      hex.EncodeToString(nonce),
+			KDF:        kdfScrypt,
+			KDFParams:  params,
+		},
+	}, nil
+}
+
+func decrypt(keyFile *KeyFile, passphrase string) ([]byte, error) {
+	cipherText, err := hex.DecodeString(keyFile.Crypto.CipherText)
+	if err != nil {
+		return nil, ErrUnsupportedKeyFile
+	}
+	nonce, err := hex.DecodeString(keyFile.Crypto.Nonce)
+	if err != nil {
+		return nil, ErrUnsupportedKeyFile
+	}
+
+	aead, err := newAEAD(keyFile.Crypto.KDFParams, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrUnsupportedKeyFile
+	}
+
+	privKey, err := aead.Open(nil, nonce, cipherText, []byte(keyFile.Address))
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	return privKey, nil
+}
+
+// newAEAD returns AES-256-GCM keyed by passphrase stretched with scrypt
+func newAEAD(params ScryptParamsJSON, passphrase string) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil || params.KeyLen != scryptKeyLen {
+		return nil, ErrUnsupportedKeyFile
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return nil, ErrUnsupportedKeyFile
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystore(t *testing.T) {
+	assert := assert.New(t)
+	pubKey := "04c1bc492c403e1484c81316c7ac789353beb57e620a4c15536fcc668830b79dbcdca2a6cf4e01a2be88f9e617016d06c89f8a45a9e1550b29f6d182b9308113fa"
+	privKey := []byte("0123456789abcdef0123456789abcdef")
+	var dir string
+	var ks Keystore
+
+	beforeEach := func() {
+		var err error
+		dir, err = ioutil.TempDir("", "kndchainKeys")
+		assert.NoError(err)
+		ks = NewKeystore(dir, LightScryptN)
+	}
+
+	afterEach := func() {
+		os.RemoveAll(dir)
+	}
+
+	t.Run("unlocks stored key with passphrase", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+
+		// perform test
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+		unlocked, err := ks.Unlock(pubKey, "secret")
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(privKey, unlocked)
+	})
+
+	t.Run("writes versioned key file readable by owner only", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+
+		// perform test
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+
+		// test verification
+		info, err := os.Stat(path.Join(dir, pubKey))
+		assert.NoError(err)
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+		b, _ := ioutil.ReadFile(path.Join(dir, pubKey))
+		var keyFile KeyFile
+		assert.NoError(json.Unmarshal(b, &keyFile))
+		assert.Equal(KeystoreVersion, keyFile.Version)
+		assert.Equal(pubKey, keyFile.Address)
+		assert.Equal("scrypt", keyFile.Crypto.KDF)
+		assert.Equal("aes-256-gcm", keyFile.Crypto.Cipher)
+		assert.NotContains(string(b), "0123456789abcdef")
+	})
+
+	t.Run("rejects wrong passphrase", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+
+		// perform test
+		_, err := ks.Unlock(pubKey, "guess")
+
+		// test verification
+		assert.Equal(ErrInvalidPassphrase, err)
+	})
+
+	t.Run("rejects key file renamed to another address", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+		assert.NoError(os.Rename(path.Join(dir, pubKey), path.Join(dir, "04ab")))
+		b, _ := ioutil.ReadFile(path.Join(dir, "04ab"))
+		var keyFile KeyFile
+		json.Unmarshal(b, &keyFile)
+		keyFile.Address = "04ab"
+		b, _ = json.Marshal(keyFile)
+		ioutil.WriteFile(path.Join(dir, "04ab"), b, 0600)
+
+		// perform test
+		_, err := ks.Unlock("04ab", "secret")
+
+		// test verification
+		assert.Equal(ErrInvalidPassphrase, err)
+	})
+
+	t.Run("returns not found for unknown key", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+
+		// perform test
+		_, err := ks.Unlock(pubKey, "secret")
+
+		// test verification
+		assert.Equal(ErrKeyNotFound, err)
+	})
+
+	t.Run("changes passphrase", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+
+		// perform test
+		assert.Equal(ErrInvalidPassphrase, ks.ChangePassphrase(pubKey, "guess", "new secret"))
+		assert.NoError(ks.ChangePassphrase(pubKey, "secret", "new secret"))
+
+		// test verification
+		_, err := ks.Unlock(pubKey, "secret")
+		assert.Equal(ErrInvalidPassphrase, err)
+		unlocked, err := ks.Unlock(pubKey, "new secret")
+		assert.NoError(err)
+		assert.Equal(privKey, unlocked)
+	})
+
+	t.Run("exports key in hex", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		assert.NoError(ks.Store(pubKey, privKey, "secret"))
+
+		// perform test
+		privKeyHex, err := ks.Export(pubKey, "secret")
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal("3031323334353637383961626364656630313233343536373839616263646566", privKeyHex)
+	})
+
+	t.Run("imports unencrypted key file", func(t *testing.T) {
+		beforeEach()
+		defer afterEach()
+		assert.NoError(ioutil.WriteFile(path.Join(dir, pubKey), privKey, os.ModePerm))
+		_, err := ks.Unlock(pubKey, "secret")
+		assert.Equal(ErrUnencryptedKey, err)
+
+		// perform test
+		assert.NoError(ks.Import(pubKey, "secret"))
+
+		// test verification
+		unlocked, err := ks.Unlock(pubKey, "secret")
+		assert.NoError(err)
+		assert.Equal(privKey, unlocked)
+		assert.Equal(ErrKeyAlreadyEncrypted, ks.Import(pubKey, "secret"))
+	})
+}
@@ -0,0 +1,33 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// MnemonicEntropyBits is the entropy of new mnemonics, 256 bits make 24 words
+const MnemonicEntropyBits = 256
+
+// ErrInvalidMnemonic is used when a mnemonic has a word not in the BIP-39 English word list or a wrong checksum
+var ErrInvalidMnemonic = errors.New("Invalid mnemonic")
+
+// NewMnemonic returns a random BIP-39 mnemonic, writing it down is all it takes to back up a HD wallet
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(MnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicToSeed returns the BIP-39 seed of mnemonic, passphrase is the optional BIP-39 passphrase and not the keystore one
+func MnemonicToSeed(mnemonic string, passphrase string) ([]byte, error) {
+	// the seed hashes the words as typed, so whitespace is normalized first
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if _, err := bip39.MnemonicToByteArray(mnemonic); err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+	return bip39.NewSeed(mnemonic, passphrase), nil
+}
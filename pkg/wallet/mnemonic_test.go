@@ -0,0 +1,45 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMnemonic(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("creates mnemonic of 24 words", func(t *testing.T) {
+		// perform test
+		mnemonic, err := NewMnemonic()
+
+		// test verification
+		assert.NoError(err)
+		assert.Len(strings.Fields(mnemonic), 24)
+		_, err = MnemonicToSeed(mnemonic, "")
+		assert.NoError(err)
+	})
+
+	t.Run("derives seed of BIP-39 test vector", func(t *testing.T) {
+		// perform test
+		seed, err := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon  about\n", "TREZOR")
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal("c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04", hex.EncodeToString(seed))
+	})
+
+	t.Run("rejects unknown word and wrong checksum", func(t *testing.T) {
+		// perform test & verification
+		_, err := MnemonicToSeed(strings.Repeat("abandon ", 11)+"abut", "")
+		assert.Equal(ErrInvalidMnemonic, err)
+		_, err = MnemonicToSeed(strings.Repeat("abandon ", 12), "")
+		assert.Equal(ErrInvalidMnemonic, err)
+		_, err = MnemonicToSeed(strings.Repeat("abandon ", 23)+"art", "")
+		assert.NoError(err)
+		_, err = MnemonicToSeed(strings.Repeat("abandon ", 24), "")
+		assert.Equal(ErrInvalidMnemonic, err)
+	})
+}
@@ -21,3 +21,69 @@ func (m *MockedCalculating) BalanceByBlockIndex(address string, bc *calculating.
 	args := m.Called(address, bc, index)
 	return args.Get(0).(uint64)
 }
+
+// CurrentBalance returns balance of address as of the main chain tip
+func (m *MockedCalculating) CurrentBalance(address string) uint64 {
+	args := m.Called(address)
+	return args.Get(0).(uint64)
+}
+
+// AccountBalance returns balance of given account state
+func (m *MockedCalculating) AccountBalance(account calculating.Account) uint64 {
+	args := m.Called(account)
+	return args.Get(0).(uint64)
+}
+
+// Nonce returns nonce of next transaction of address based on given blockchain history
+func (m *MockedCalculating) Nonce(address string, bc *calculating.Blockchain) uint64 {
+	args := m.Called(address, bc)
+	return args.Get(0).(uint64)
+}
+
+// CurrentNonce returns nonce of next transaction of address as of the main chain tip
+func (m *MockedCalculating) CurrentNonce(address string) uint64 {
+	args := m.Called(address)
+	return args.Get(0).(uint64)
+}
+
+// ImmatureBalance returns rewards of address that may not be spent yet based on given blockchain history
+func (m *MockedCalculating) ImmatureBalance(address string, bc *calculating.Blockchain) uint64 {
+	args := m.Called(address, bc)
+	return args.Get(0).(uint64)
+}
+
+// ImmatureBalanceByBlockIndex returns rewards of address that may not be spent yet based on given blockchain history at block index
+func (m *MockedCalculating) ImmatureBalanceByBlockIndex(address string, bc *calculating.Blockchain, index int) uint64 {
+	args := m.Called(address, bc, index)
+	return args.Get(0).(uint64)
+}
+
+// CurrentImmatureBalance returns rewards of address that may not be spent yet as of the main chain tip
+func (m *MockedCalculating) CurrentImmatureBalance(address string) uint64 {
+	args := m.Called(address)
+	return args.Get(0).(uint64)
+}
+
+// TotalBalance returns the sum of the balances of addresses based on given blockchain history
+func (m *MockedCalculating) TotalBalance(addresses []string, bc *calculating.Blockchain) uint64 {
+	args := m.Called(addresses, bc)
+	return args.Get(0).(uint64)
+}
+
+// CurrentTotalBalance returns the sum of the balances of addresses as of the main chain tip
+func (m *MockedCalculating) CurrentTotalBalance(addresses []string) uint64 {
+	args := m.Called(addresses)
+	return args.Get(0).(uint64)
+}
+
+// HasTransactions returns true if address sent or received a transaction based on given blockchain history
+func (m *MockedCalculating) HasTransactions(address string, bc *calculating.Blockchain) bool {
+	args := m.Called(address, bc)
+	return args.Bool(0)
+}
+
+// CurrentHasTransactions returns true if address sent or received a transaction as of the main chain tip
+func (m *MockedCalculating) CurrentHasTransactions(address string) bool {
+	args := m.Called(address)
+	return args.Bool(0)
+}
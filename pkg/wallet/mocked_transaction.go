@@ -21,6 +21,15 @@ func (m *MockedTransaction) GetInput() Input {
 	return args.Get(0).(Input)
 }
 
+// GetExtraInputs returns tx extra inputs
+func (m *MockedTransaction) GetExtraInputs() []Input {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]Input)
+}
+
 // GetOutput returns tx output
 func (m *MockedTransaction) GetOutput() Output {
 	args := m.Called()
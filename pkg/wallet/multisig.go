@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knd/kndchain/pkg/calculating"
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/knd/kndchain/pkg/hashing"
+)
+
+// ErrNotMultisig indicates a transaction that does not spend from a multisig address
+var ErrNotMultisig = errors.New("Transaction does not spend from a multisig address")
+
+// ErrNotCosigner indicates a signature that is not by one of the keys of the multisig address
+var ErrNotCosigner = errors.New("Signer is not a key of the multisig address")
+
+// ErrAlreadySigned indicates a key that has already signed the multisig transaction
+var ErrAlreadySigned = errors.New("Key has already signed the transaction")
+
+// NewMultisigTransaction creates a transaction spending from the multisig address of script without any signature yet,
+// co-signers then sign it with Cosign or AddSignature until it has the signatures script requires
+func NewMultisigTransaction(script *crypto.MultisigScript, c calculating.Service, receiver string, amount uint64, fee uint64) (Transaction, error) {
+	address := script.Address()
+	balance := c.CurrentBalance(address)
+	immature := c.CurrentImmatureBalance(address)
+
+	// immature rewards stay in the change output
+	var spendable uint64
+	if balance > immature {
+		spendable = balance - immature
+	}
+	if amount > spendable || fee > spendable-amount {
+		return nil, ErrTxAmountExceedsBalance
+	}
+
+	tx := &Tx{ID: uuid.New().String(), Output: Output{receiver: amount}}
+	tx.Output[address] += balance - amount - fee
+	tx.Input = Input{
+		Timestamp: time.Now().UnixNano(),
+		Amount:    balance,
+		Address:   address,
+		Nonce:     c.CurrentNonce(address),
+		Signature: hex.EncodeToString(crypto.EncodeMultisigSignature(script, nil)),
+	}
+
+	return tx, nil
+}
+
+// SigningBytes returns the bytes every input of tx signs, they leave out all signatures
+// so co-signers may sign in any order
+func SigningBytes(tx Transaction) []byte {
+	return hashing.TransactionSigningBytes(toHashingTx(tx.GetID(), tx.GetInput(), tx.GetExtraInputs(), tx.GetOutput()))
+}
+
+// Cosign returns a copy of multisig tx with the signature of w added
+func Cosign(tx Transaction, w Wallet) (Transaction, error) {
+	return AddSignature(tx, w.Sign(SigningBytes(tx)))
+}
+
+// AddSignature returns a copy of multisig tx with signature added, signature has to be by a key
+// of the multisig address that has not signed yet
+func AddSignature(tx Transaction, signature []byte) (Transaction, error) {
+	script, signatures, err := multisigOf(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	gen := crypto.NewSecp256k1Generator()
+	msg := SigningBytes(tx)
+	signer, ok := gen.Signer(script, msg, signature)
+	if !ok {
+		return nil, ErrNotCosigner
+	}
+	for _, existing := range signatures {
+		if index, _ := gen.Signer(script, msg, existing); index == signer {
+			return nil, ErrAlreadySigned
+		}
+	}
+
+	input := tx.GetInput()
+	input.Signature = hex.EncodeToString(crypto.EncodeMultisigSignature(script, append(signatures, signature)))
+	return &Tx{
+		ID:          tx.GetID(),
+		Input:       input,
+		ExtraInputs: tx.GetExtraInputs(),
+		Output:      tx.GetOutput(),
+	}, nil
+}
+
+// Signatures returns the number of signatures multisig tx has collected and the number its address requires
+func Signatures(tx Transaction) (signed int, required int, err error) {
+	script, signatures, err := multisigOf(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(signatures), script.Required, nil
+}
+
+// multisigOf returns the script and signatures carried by the input of multisig tx
+func multisigOf(tx Transaction) (*crypto.MultisigScript, [][]byte, error) {
+	if !crypto.IsMultisigAddress(tx.GetInput().Address) {
+		return nil, nil, ErrNotMultisig
+	}
+
+	b, err := hex.DecodeString(tx.GetInput().Signature)
+	if err != nil {
+		return nil, nil, crypto.ErrInvalidMultisig
+	}
+	script, signatures, err := crypto.DecodeMultisigSignature(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if script.Address() != tx.GetInput().Address {
+		return nil, nil, crypto.ErrInvalidMultisig
+	}
+	return script, signatures, nil
+}
@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/knd/kndchain/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultisigTransaction(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	alice := NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	bob := NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	carol := NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	mallory := NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+	script, _ := crypto.NewMultisigScript(2, [][]byte{alice.PubKey(), bob.PubKey(), carol.PubKey()})
+	mockedCalculating := new(MockedCalculating)
+	mockedCalculating.On("CurrentBalance", script.Address()).Return(uint64(1000))
+	mockedCalculating.On("CurrentImmatureBalance", script.Address()).Return(uint64(0))
+	mockedCalculating.On("CurrentNonce", script.Address()).Return(uint64(3))
+
+	t.Run("creates transaction spending from multisig address without signatures", func(t *testing.T) {
+		// perform test
+		tx, err := NewMultisigTransaction(script, mockedCalculating, "receiver", 600, 10)
+		_, exceedsErr := NewMultisigTransaction(script, mockedCalculating, "receiver", 995, 10)
+
+		// test verification
+		assert.NoError(err)
+		assert.Equal(script.Address(), tx.GetInput().Address)
+		assert.Equal(uint64(1000), tx.GetInput().Amount)
+		assert.Equal(uint64(3), tx.GetInput().Nonce)
+		assert.Equal(Output{"receiver": 600, script.Address(): 390}, tx.GetOutput())
+		signed, required, _ := Signatures(tx)
+		assert.Equal(0, signed)
+		assert.Equal(2, required)
+		assert.Equal(ErrTxAmountExceedsBalance, exceedsErr)
+	})
+
+	t.Run("collects co-signatures until transaction is valid", func(t *testing.T) {
+		tx, _ := NewMultisigTransaction(script, mockedCalculating, "receiver", 600, 10)
+		pool := NewTransactionPool(nil)
+
+		// perform test
+		partial, err := Cosign(tx, carol)
+		pool.Add(partial)
+		partialValid := pool.ValidTransactions()
+		full, fullErr := AddSignature(partial, alice.Sign(SigningBytes(partial)))
+		pool.Add(full)
+
+		// test verification
+		assert.NoError(err)
+		assert.Empty(partialValid)
+		assert.NoError(fullErr)
+		signed, required, _ := Signatures(full)
+		assert.Equal(required, signed)
+		assert.Equal([]Transaction{full}, pool.ValidTransactions())
+		assert.Equal(uint64(10), Fee(full))
+	})
+
+	t.Run("rejects signatures of outsiders and keys that already signed", func(t *testing.T) {
+		tx, _ := NewMultisigTransaction(script, mockedCalculating, "receiver", 600, 10)
+		tx, _ = Cosign(tx, bob)
+
+		// perform test
+		_, outsiderErr := Cosign(tx, mallory)
+		_, repeatedErr := Cosign(tx, bob)
+		_, singleKeyErr := Cosign(NewTransaction(alice, "receiver", 0, 0), alice)
+
+		// test verification
+		assert.Equal(ErrNotCosigner, outsiderErr)
+		assert.Equal(ErrAlreadySigned, repeatedErr)
+		assert.Equal(ErrNotMultisig, singleKeyErr)
+		assert.Equal(ErrAppendMultiInput, tx.Append(bob, "receiver", 1))
+	})
+}
@@ -0,0 +1,50 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ErrPassphraseMismatch is used when a new passphrase and its confirmation differ
+var ErrPassphraseMismatch = errors.New("Passphrases do not match")
+
+// ReadPassphrase returns the first line of file, or prompts for the passphrase on the terminal without echo when file is empty
+func ReadPassphrase(file string, prompt string) (string, error) {
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(strings.SplitN(string(b), "\n", 2)[0], "\r"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadNewPassphrase is like ReadPassphrase but asks twice on the terminal, so a typo does not lock the key away
+func ReadNewPassphrase(file string, prompt string) (string, error) {
+	passphrase, err := ReadPassphrase(file, prompt)
+	if err != nil || file != "" {
+		return passphrase, err
+	}
+
+	confirmation, err := ReadPassphrase("", "Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirmation {
+		return "", ErrPassphraseMismatch
+	}
+	return passphrase, nil
+}
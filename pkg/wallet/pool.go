@@ -2,6 +2,8 @@ package wallet
 
 import (
 	"errors"
+	"math/bits"
+	"sort"
 
 	"github.com/knd/kndchain/pkg/validating"
 
@@ -13,10 +15,13 @@ type TransactionPool interface {
 	All() map[string]Transaction
 	Get(id string) Transaction
 	GetTransaction(inputAddress string) Transaction
+	LastTransaction(inputAddress string) Transaction
 	Add(tx Transaction) error
+	Remove(id string) error
 	Exists(inputAddress string) bool
 	SetPool(newPool map[string]Transaction) error
 	ValidTransactions() []Transaction
+	BlockTemplate(maxSize int, maxCount int) []Transaction
 	Clear() error
 	ClearBlockTransactions() error
 }
@@ -24,13 +29,16 @@ type TransactionPool interface {
 type transactionPool struct {
 	transactions map[string]Transaction
 	lister       listing.Service
+	// pruned are pools whose block transactions are cleared along with those of this pool
+	pruned []TransactionPool
 }
 
-// NewTransactionPool creates an new transaction pool
-func NewTransactionPool(l listing.Service) TransactionPool {
+// NewTransactionPool creates an new transaction pool, clearing its block transactions clears those of pruned as well
+func NewTransactionPool(l listing.Service, pruned ...TransactionPool) TransactionPool {
 	return &transactionPool{
 		transactions: make(map[string]Transaction),
 		lister:       l,
+		pruned:       pruned,
 	}
 }
 
@@ -56,6 +64,11 @@ func (p *transactionPool) Add(tx Transaction) error {
 	return nil
 }
 
+func (p *transactionPool) Remove(id string) error {
+	delete(p.transactions, id)
+	return nil
+}
+
 func (p *transactionPool) Exists(inputAddress string) bool {
 	for _, tx := range p.transactions {
 		if tx.GetInput().Address == inputAddress {
@@ -76,6 +89,22 @@ func (p *transactionPool) GetTransaction(inputAddress string) Transaction {
 	return nil
 }
 
+// LastTransaction returns the transaction with the highest nonce among those spending from inputAddress, nil if there is none
+func (p *transactionPool) LastTransaction(inputAddress string) Transaction {
+	var last Transaction
+	var lastNonce uint64
+	for _, tx := range p.transactions {
+		for _, input := range inputsOf(tx) {
+			if input.Address == inputAddress && (last == nil || input.Nonce > lastNonce) {
+				last = tx
+				lastNonce = input.Nonce
+			}
+		}
+	}
+
+	return last
+}
+
 func (p *transactionPool) SetPool(newPool map[string]Transaction) error {
 	p.transactions = newPool
 	return nil
@@ -91,8 +120,10 @@ func (p *transactionPool) ValidTransactions() []Transaction {
 				Timestamp: tx.GetInput().Timestamp,
 				Amount:    tx.GetInput().Amount,
 				Address:   tx.GetInput().Address,
+				Nonce:     tx.GetInput().Nonce,
 				Signature: tx.GetInput().Signature,
 			},
+			ExtraInputs: toValidatingInputs(tx.GetExtraInputs()),
 		}
 
 		valid, err := validating.IsValidTransaction(validatingTx)
@@ -103,6 +134,84 @@ func (p *transactionPool) ValidTransactions() []Transaction {
 	return validTxs
 }
 
+// BlockTemplate returns up to maxCount valid transactions by descending fee rate, the fee per encoded byte,
+// skipping those that would take the total encoded size over maxSize. Blocks apply transactions spending from
+// the same address one after another, so a transaction is only taken once the pool transactions with lower nonces
+// of its input addresses are, and it is left out with them when they are.
+func (p *transactionPool) BlockTemplate(maxSize int, maxCount int) []Transaction {
+	type candidate struct {
+		tx   Transaction
+		fee  uint64
+		size int
+	}
+
+	var candidates []candidate
+	for _, tx := range p.ValidTransactions() {
+		candidates = append(candidates, candidate{tx, Fee(tx), Size(tx)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		// compares fee_i/size_i with fee_j/size_j without dividing, the products take 128 bits
+		leftHi, leftLo := bits.Mul64(candidates[i].fee, uint64(candidates[j].size))
+		rightHi, rightLo := bits.Mul64(candidates[j].fee, uint64(candidates[i].size))
+		if leftHi != rightHi {
+			return leftHi > rightHi
+		}
+		if leftLo != rightLo {
+			return leftLo > rightLo
+		}
+		return candidates[i].tx.GetID() < candidates[j].tx.GetID()
+	})
+
+	// next holds the nonce each input address spends with next, starting from its lowest one in the pool
+	next := make(map[string]uint64)
+	for _, c := range candidates {
+		for _, input := range inputsOf(c.tx) {
+			if nonce, ok := next[input.Address]; !ok || input.Nonce < nonce {
+				next[input.Address] = input.Nonce
+			}
+		}
+	}
+	isNext := func(tx Transaction) bool {
+		for _, input := range inputsOf(tx) {
+			if input.Nonce != next[input.Address] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var template []Transaction
+	size := 0
+	for len(template) < maxCount {
+		// the best paying transaction that is next of all its input addresses and fits, taking it may make
+		// a better paying one next
+		picked := -1
+		for i, c := range candidates {
+			if isNext(c.tx) && size+c.size <= maxSize {
+				picked = i
+				break
+			}
+		}
+		if picked < 0 {
+			break
+		}
+
+		c := candidates[picked]
+		candidates = append(candidates[:picked], candidates[picked+1:]...)
+		template = append(template, c.tx)
+		size += c.size
+		for _, input := range inputsOf(c.tx) {
+			next[input.Address] = input.Nonce + 1
+		}
+	}
+	return template
+}
+
+// inputsOf returns all inputs of tx
+func inputsOf(tx Transaction) []Input {
+	return append([]Input{tx.GetInput()}, tx.GetExtraInputs()...)
+}
+
 func (p *transactionPool) Clear() error {
 	p.transactions = make(map[string]Transaction)
 	return nil
@@ -117,5 +226,25 @@ func (p *transactionPool) ClearBlockTransactions() error {
 		}
 	}
 
+	for _, pruned := range p.pruned {
+		if err := pruned.ClearBlockTransactions(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+func toValidatingInputs(inputs []Input) []validating.Input {
+	var result []validating.Input
+	for _, input := range inputs {
+		result = append(result, validating.Input{
+			Timestamp: input.Timestamp,
+			Amount:    input.Amount,
+			Address:   input.Address,
+			Nonce:     input.Nonce,
+			Signature: input.Signature,
+		})
+	}
+	return result
+}
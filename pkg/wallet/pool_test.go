@@ -2,6 +2,7 @@ package wallet
 
 import (
 	"encoding/hex"
+	"math"
 	"testing"
 
 	"github.com/knd/kndchain/pkg/listing"
@@ -17,17 +18,17 @@ func TestTransactionPool(t *testing.T) {
 	var transactionPool TransactionPool
 	var txA, txB, txC Transaction
 	secp256k1 := crypto.NewSecp256k1Generator()
-	walletA := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	walletB := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	walletC := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
+	walletA := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	walletB := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	walletC := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
 	var validTransactions []Transaction
 	mockedListing := new(MockedListing)
 
 	beforeEach := func() {
 		transactionPool = NewTransactionPool(mockedListing)
-		txA = NewTransaction(walletA, walletB.PubKeyHex(), 100)
-		txB = NewTransaction(walletB, walletC.PubKeyHex(), 1)
-		txC = NewTransaction(walletC, walletA.PubKeyHex(), 99)
+		txA = NewTransaction(walletA, walletB.Address(), 100, 0)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 0)
+		txC = NewTransaction(walletC, walletA.Address(), 99, 0)
 		validTransactions = []Transaction{}
 	}
 
@@ -41,6 +42,19 @@ func TestTransactionPool(t *testing.T) {
 		assert.Equal(txA, transactionPool.Get(txA.GetID()))
 	})
 
+	t.Run("removes transaction", func(t *testing.T) {
+		beforeEach()
+		transactionPool.Add(txA)
+		transactionPool.Add(txB)
+
+		// perform test
+		transactionPool.Remove(txA.GetID())
+
+		// test verification
+		assert.Nil(transactionPool.Get(txA.GetID()))
+		assert.Equal(txB, transactionPool.Get(txB.GetID()))
+	})
+
 	t.Run("exists transaction", func(t *testing.T) {
 		beforeEach()
 
@@ -48,17 +62,29 @@ func TestTransactionPool(t *testing.T) {
 		transactionPool.Add(txB)
 
 		// test verification
-		assert.True(transactionPool.Exists(walletB.PubKeyHex()))
+		assert.True(transactionPool.Exists(walletB.Address()))
 
-		receivedTx := transactionPool.GetTransaction(walletB.PubKeyHex())
+		receivedTx := transactionPool.GetTransaction(walletB.Address())
 		assert.Equal(txB, receivedTx)
 	})
 
+	t.Run("gets transaction with highest nonce of input address", func(t *testing.T) {
+		beforeEach()
+		nextTx, _ := NewNextTransaction(walletA, txA, walletC.Address(), 1, 0)
+		transactionPool.Add(txA)
+		transactionPool.Add(nextTx)
+		transactionPool.Add(txB)
+
+		// perform test & verification
+		assert.Equal(nextTx, transactionPool.LastTransaction(walletA.Address()))
+		assert.Equal(txB, transactionPool.LastTransaction(walletB.Address()))
+		assert.Nil(transactionPool.LastTransaction(walletC.Address()))
+	})
+
 	t.Run("get valid transactions", func(t *testing.T) {
 		beforeEach()
 
-		outputInBytes, _ := hex.DecodeString(hashing.SHA256Hash(txC.GetOutput()))
-		invalidSig := walletB.Sign(outputInBytes)
+		invalidSig := walletB.Sign(hashing.TransactionSigningBytes(toHashingTx(txC.GetID(), txC.GetInput(), nil, txC.GetOutput())))
 		invalidTx := &Tx{
 			ID:     txC.GetID(),
 			Output: txC.GetOutput(),
@@ -82,6 +108,129 @@ func TestTransactionPool(t *testing.T) {
 		assert.Contains(validTransactions, txB)
 	})
 
+	t.Run("orders block template by fee rate", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 100, 1)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 30)
+		txC = NewTransaction(walletC, walletA.Address(), 99, 0)
+		transactionPool.Add(txA)
+		transactionPool.Add(txB)
+		transactionPool.Add(txC)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 10)
+
+		// test verification
+		assert.Equal([]Transaction{txB, txA, txC}, template)
+	})
+
+	t.Run("orders block template by fee rate of fees whose products with sizes overflow", func(t *testing.T) {
+		beforeEach()
+		richA := NewWallet(secp256k1, new(MockedCalculating), math.MaxUint64, nil, "")
+		richB := NewWallet(secp256k1, new(MockedCalculating), math.MaxUint64, nil, "")
+		txA = NewTransaction(richA, walletC.Address(), 1, 1<<60)
+		txB = NewTransaction(richB, walletC.Address(), 1, 1<<61)
+		transactionPool.Add(txA)
+		transactionPool.Add(txB)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 10)
+
+		// test verification
+		assert.Equal([]Transaction{txB, txA}, template)
+	})
+
+	t.Run("orders block template transactions of same address by nonce", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 10, 1)
+		laterTx := NewTransaction(walletA, walletC.Address(), 10, 20).(*Tx)
+		laterTx.Input = laterTx.generateInput(walletA, laterTx.Output, 1)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 5)
+		transactionPool.Add(txA)
+		transactionPool.Add(laterTx)
+		transactionPool.Add(txB)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 10)
+
+		// test verification
+		assert.Equal([]Transaction{txB, txA, laterTx}, template)
+	})
+
+	t.Run("takes block template transactions of same address as a chain of nonces", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 10, 1)
+		secondTx, _ := NewNextTransaction(walletA, txA, walletC.Address(), 10, 10)
+		thirdTx, _ := NewNextTransaction(walletA, secondTx, walletC.Address(), 10, 20)
+		transactionPool.Add(txA)
+		transactionPool.Add(secondTx)
+		transactionPool.Add(thirdTx)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 2)
+
+		// test verification
+		assert.Equal([]Transaction{txA, secondTx}, template)
+	})
+
+	t.Run("keeps block template within max size", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 100, 1)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 30)
+		transactionPool.Add(txA)
+		transactionPool.Add(txB)
+
+		// perform test
+		template := transactionPool.BlockTemplate(Size(txB)+Size(txA)-1, 10)
+
+		// test verification
+		assert.Equal([]Transaction{txB}, template)
+	})
+
+	t.Run("keeps block template within max count", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 100, 1)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 30)
+		transactionPool.Add(txA)
+		transactionPool.Add(txB)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 1)
+
+		// test verification
+		assert.Equal([]Transaction{txB}, template)
+	})
+
+	t.Run("leaves out higher nonce transaction paying higher fee when the lower nonce one does not fit in max size", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 10, 1)
+		laterTx, _ := NewNextTransaction(walletA, txA, walletC.Address(), 10, 20)
+		txB = NewTransaction(walletB, walletC.Address(), 1, 5)
+		transactionPool.Add(txA)
+		transactionPool.Add(laterTx)
+		transactionPool.Add(txB)
+
+		// perform test
+		template := transactionPool.BlockTemplate(Size(txB)+Size(txA), 10)
+
+		// test verification
+		assert.Equal([]Transaction{txB, txA}, template)
+	})
+
+	t.Run("leaves out higher nonce transaction paying higher fee when the lower nonce one takes max count", func(t *testing.T) {
+		beforeEach()
+		txA = NewTransaction(walletA, walletB.Address(), 10, 1)
+		laterTx, _ := NewNextTransaction(walletA, txA, walletC.Address(), 10, 20)
+		transactionPool.Add(txA)
+		transactionPool.Add(laterTx)
+
+		// perform test
+		template := transactionPool.BlockTemplate(1<<20, 1)
+
+		// test verification
+		assert.Equal([]Transaction{txA}, template)
+	})
+
 	t.Run("clears transaction pool", func(t *testing.T) {
 		beforeEach()
 		transactionPool.Add(txA)
@@ -137,4 +286,23 @@ func TestTransactionPool(t *testing.T) {
 		// test verification
 		assert.Contains(transactionPool.All(), txB.GetID())
 	})
+
+	t.Run("clears blockchain transaction of pruned pools", func(t *testing.T) {
+		beforeEach()
+		lister := new(MockedListing)
+		lister.On("GetBlockchain").Return(&listing.Blockchain{Chain: []listing.Block{
+			listing.Block{Data: []listing.Transaction{listing.Transaction{ID: txA.GetID()}}},
+		}})
+		prunedPool := NewTransactionPool(lister)
+		prunedPool.Add(txA)
+		prunedPool.Add(txB)
+		transactionPool = NewTransactionPool(lister, prunedPool)
+
+		// perform test
+		transactionPool.ClearBlockTransactions()
+
+		// test verification
+		assert.Nil(prunedPool.Get(txA.GetID()))
+		assert.Equal(txB, prunedPool.Get(txB.GetID()))
+	})
 }
@@ -3,10 +3,10 @@ package wallet
 import (
 	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/knd/kndchain/pkg/crypto"
 	"github.com/knd/kndchain/pkg/hashing"
 )
 
@@ -15,6 +15,7 @@ type Input struct {
 	Timestamp int64  `json:"timestamp"`
 	Amount    uint64 `json:"amount"`
 	Address   string `json:"address"`
+	Nonce     uint64 `json:"nonce"`
 	Signature string `json:"sig"`
 }
 
@@ -25,32 +26,154 @@ type Output map[string]uint64
 type Transaction interface {
 	GetID() string
 	GetInput() Input
+	GetExtraInputs() []Input
 	GetOutput() Output
 	Append(w Wallet, r string, amount uint64) error
 }
 
 // Tx encapsulates necessary transaction info
 type Tx struct {
-	ID     string `json:"id"`
-	Input  Input  `json:"input"`
-	Output Output `json:"output"`
+	ID          string  `json:"id"`
+	Input       Input   `json:"input"`
+	ExtraInputs []Input `json:"extraInputs,omitempty"`
+	Output      Output  `json:"output"`
 }
 
 // ErrAmountExceedsBalance indicates amount to be sent exceeds the sender remaining balance
 var ErrAmountExceedsBalance = errors.New("Amount exceeds sender balance")
 
-// NewTransaction creates a transaction
-func NewTransaction(w Wallet, r string, amount uint64) Transaction {
+// ErrDuplicateSender indicates a sender given more than once to a transaction spending from several wallets
+var ErrDuplicateSender = errors.New("Duplicate sender")
+
+// ErrNoInputs indicates a transaction that would spend from none of its senders
+var ErrNoInputs = errors.New("Transaction has no inputs")
+
+// ErrNotPooledSender indicates a wallet that is not an input of the pooled transaction it should follow
+var ErrNotPooledSender = errors.New("Wallet is not an input of the pooled transaction")
+
+// ErrAppendMultiInput indicates appending to a transaction with several inputs or spending from a multisig address,
+// which the other senders or co-signers would have to sign again
+var ErrAppendMultiInput = errors.New("Can't append to a transaction with several inputs")
+
+// NewTransaction creates a transaction, fee is left out of the outputs for the miner to claim
+func NewTransaction(w Wallet, r string, amount uint64, fee uint64) Transaction {
 	tx := &Tx{ID: uuid.New().String()}
-	tx.Output = tx.generateOutput(w, r, amount)
-	tx.Input = tx.generateInput(w, tx.Output)
+	tx.Output = tx.generateOutput(w, r, amount, fee)
+	tx.Input = tx.generateInput(w, tx.Output, w.Nonce())
 
 	return tx
 }
 
+// NewMultiInputTransaction creates a transaction spending from senders in order until amount and fee are covered,
+// each sender spent from becomes an input signed by it and gets its change back
+func NewMultiInputTransaction(senders []Wallet, receiver string, amount uint64, fee uint64) (Transaction, error) {
+	if amount+fee < amount {
+		return nil, ErrTxAmountExceedsBalance
+	}
+
+	tx := &Tx{ID: uuid.New().String(), Output: Output{receiver: amount}}
+	var spenders []Wallet
+	var inputs []Input
+	remaining := amount + fee
+	timestamp := time.Now().UnixNano()
+	for _, w := range senders {
+		for _, input := range inputs {
+			if input.Address == w.Address() {
+				return nil, ErrDuplicateSender
+			}
+		}
+		if remaining == 0 {
+			break
+		}
+		if w.SpendableBalance() == 0 {
+			continue
+		}
+
+		spent := w.SpendableBalance()
+		if spent > remaining {
+			spent = remaining
+		}
+		remaining -= spent
+		// a sender may also be the receiver, so the change adds to its output
+		tx.Output[w.Address()] += w.Balance() - spent
+
+		spenders = append(spenders, w)
+		inputs = append(inputs, Input{
+			Timestamp: timestamp,
+			Amount:    w.Balance(),
+			Address:   w.Address(),
+			Nonce:     w.Nonce(),
+		})
+	}
+	if remaining > 0 {
+		return nil, ErrTxAmountExceedsBalance
+	}
+	if len(inputs) == 0 {
+		return nil, ErrNoInputs
+	}
+
+	tx.Input = inputs[0]
+	tx.ExtraInputs = inputs[1:]
+	if len(tx.ExtraInputs) == 0 {
+		tx.ExtraInputs = nil
+	}
+
+	// every sender signs the transaction without any signature
+	msg := hashing.TransactionSigningBytes(toHashingTx(tx.ID, tx.Input, tx.ExtraInputs, tx.Output))
+	tx.Input.Signature = hex.EncodeToString(spenders[0].Sign(msg))
+	for i := range tx.ExtraInputs {
+		tx.ExtraInputs[i].Signature = hex.EncodeToString(spenders[i+1].Sign(msg))
+	}
+
+	return tx, nil
+}
+
+// NewNextTransaction creates a transaction from w that blocks apply after pooled, a transaction of w not in a block yet.
+// It spends the change pooled leaves to w with the nonce after the one pooled spends with.
+func NewNextTransaction(w Wallet, pooled Transaction, receiver string, amount uint64, fee uint64) (Transaction, error) {
+	var pooledInput Input
+	found := false
+	for _, input := range inputsOf(pooled) {
+		if input.Address == w.Address() {
+			pooledInput, found = input, true
+		}
+	}
+	if !found {
+		return nil, ErrNotPooledSender
+	}
+
+	// immature rewards stay in the change output
+	balance := pooled.GetOutput()[w.Address()]
+	var spendable uint64
+	if balance > w.ImmatureBalance() {
+		spendable = balance - w.ImmatureBalance()
+	}
+	if amount > spendable || fee > spendable-amount {
+		return nil, ErrTxAmountExceedsBalance
+	}
+
+	tx := &Tx{ID: uuid.New().String(), Output: Output{receiver: amount}}
+	tx.Output[w.Address()] += balance - amount - fee
+	tx.Input = Input{
+		Timestamp: time.Now().UnixNano(),
+		Amount:    balance,
+		Address:   w.Address(),
+		Nonce:     pooledInput.Nonce + 1,
+	}
+	tx.Input.Signature = hex.EncodeToString(w.Sign(hashing.TransactionSigningBytes(toHashingTx(tx.ID, tx.Input, nil, tx.Output))))
+
+	return tx, nil
+}
+
 // Append adds more amount and receiver
 func (t *Tx) Append(w Wallet, receiver string, amount uint64) error {
-	if amount > t.Output[w.PubKeyHex()] {
+	if len(t.ExtraInputs) > 0 || crypto.IsMultisigAddress(t.Input.Address) {
+		return ErrAppendMultiInput
+	}
+
+	// immature rewards must stay in the change output
+	change := t.Output[w.Address()]
+	if change < w.ImmatureBalance() || amount > change-w.ImmatureBalance() {
 		return ErrAmountExceedsBalance
 	}
 
@@ -60,8 +183,9 @@ func (t *Tx) Append(w Wallet, receiver string, amount uint64) error {
 		t.Output[receiver] = amount
 	}
 
-	t.Output[w.PubKeyHex()] -= amount
-	t.Input = t.generateInput(w, t.Output)
+	t.Output[w.Address()] -= amount
+	// the appended transaction replaces the original one, so it keeps its nonce
+	t.Input = t.generateInput(w, t.Output, t.Input.Nonce)
 
 	return nil
 }
@@ -71,6 +195,11 @@ func (t *Tx) GetInput() Input {
 	return t.Input
 }
 
+// GetExtraInputs returns the inputs after the first one, nil unless tx spends from several addresses
+func (t *Tx) GetExtraInputs() []Input {
+	return t.ExtraInputs
+}
+
 // GetOutput returns output
 func (t *Tx) GetOutput() Output {
 	return t.Output
@@ -81,27 +210,106 @@ func (t *Tx) GetID() string {
 	return t.ID
 }
 
-func (t *Tx) generateOutput(w Wallet, receiver string, amount uint64) Output {
+func (t *Tx) generateOutput(w Wallet, receiver string, amount uint64, fee uint64) Output {
 	o := Output{}
 	o[receiver] = amount
-	o[w.PubKeyHex()] = w.Balance() - amount
+	o[w.Address()] = w.Balance() - amount - fee
 	return o
 }
 
-func (t *Tx) generateInput(w Wallet, op Output) Input {
-	ob, err := hex.DecodeString(hashing.SHA256Hash(op))
+func (t *Tx) generateInput(w Wallet, op Output, nonce uint64) Input {
+	input := Input{
+		Timestamp: time.Now().UnixNano(),
+		Amount:    w.Balance(),
+		Address:   w.Address(),
+		Nonce:     nonce,
+	}
+	input.Signature = hex.EncodeToString(w.Sign(hashing.TransactionSigningBytes(toHashingTx(t.ID, input, nil, op))))
+
+	return input
+}
+
+// MarshalBinary returns the canonical encoding of transaction
+func (t *Tx) MarshalBinary() ([]byte, error) {
+	return hashing.EncodeTransaction(toHashingTx(t.ID, t.Input, t.ExtraInputs, t.Output)), nil
+}
+
+// UnmarshalBinary parses the canonical encoding of a transaction
+func (t *Tx) UnmarshalBinary(data []byte) error {
+	hTx, err := hashing.DecodeTransaction(data)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	return Input{
-		Timestamp: time.Now().UnixNano(),
-		Amount:    w.Balance(),
-		Address:   w.PubKeyHex(),
-		Signature: hex.EncodeToString(w.Sign(ob)),
+	*t = Tx{
+		ID:     hTx.ID,
+		Output: Output(hTx.Output),
+		Input: Input{
+			Timestamp: hTx.Input.Timestamp,
+			Amount:    hTx.Input.Amount,
+			Address:   hTx.Input.Address,
+			Nonce:     hTx.Input.Nonce,
+			Signature: hTx.Input.Signature,
+		},
+	}
+	for _, hInput := range hTx.ExtraInputs {
+		t.ExtraInputs = append(t.ExtraInputs, Input{
+			Timestamp: hInput.Timestamp,
+			Amount:    hInput.Amount,
+			Address:   hInput.Address,
+			Nonce:     hInput.Nonce,
+			Signature: hInput.Signature,
+		})
+	}
+	return nil
+}
+
+func toHashingTx(id string, input Input, extraInputs []Input, output Output) hashing.Tx {
+	var hExtraInputs []hashing.TxInput
+	for _, extraInput := range extraInputs {
+		hExtraInputs = append(hExtraInputs, toHashingTxInput(extraInput))
+	}
+
+	return hashing.Tx{
+		ID:          id,
+		Output:      output,
+		Input:       toHashingTxInput(input),
+		ExtraInputs: hExtraInputs,
+	}
+}
+
+func toHashingTxInput(input Input) hashing.TxInput {
+	return hashing.TxInput{
+		Timestamp: input.Timestamp,
+		Amount:    input.Amount,
+		Address:   input.Address,
+		Nonce:     input.Nonce,
+		Signature: input.Signature,
 	}
 }
 
+// Fee returns the input total of tx minus its output total
+func Fee(tx Transaction) uint64 {
+	iBalance := tx.GetInput().Amount
+	for _, input := range tx.GetExtraInputs() {
+		iBalance += input.Amount
+	}
+
+	var oBalance uint64
+	for _, amount := range tx.GetOutput() {
+		oBalance += amount
+	}
+	if oBalance > iBalance {
+		return 0
+	}
+	return iBalance - oBalance
+}
+
+// Size returns the length of the canonical encoding of tx
+func Size(tx Transaction) int {
+	return len(hashing.EncodeTransaction(toHashingTx(tx.GetID(), tx.GetInput(), tx.GetExtraInputs(), tx.GetOutput())))
+}
+
 // GetRewardTransactionInput returns the special input in the reward tx to miner
 func GetRewardTransactionInput(rewardTxInputAddress string) Input {
 	return Input{
@@ -115,7 +323,7 @@ func CreateRewardTransaction(mw Wallet, rewardTxInputAddress string, miningRewar
 	tx.Input = GetRewardTransactionInput(rewardTxInputAddress)
 
 	o := Output{}
-	o[mw.PubKeyHex()] = miningReward
+	o[mw.Address()] = miningReward
 	tx.Output = o
 
 	return tx, nil
@@ -13,7 +13,7 @@ func TestTransaction_HasAutoGeneratedID(t *testing.T) {
 	m := crypto.NewSecp256k1Generator()
 
 	// perform test
-	tx := NewTransaction(NewWallet(m, new(MockedCalculating), 1000, nil), "receiver", 0)
+	tx := NewTransaction(NewWallet(m, new(MockedCalculating), 1000, nil, ""), "receiver", 0, 0)
 
 	// test verification
 	assert.NotEmpty(t, tx.GetID())
@@ -23,7 +23,7 @@ func TestTransaction_OutputHasAmountToReceiver(t *testing.T) {
 	m := crypto.NewSecp256k1Generator()
 
 	// perform test
-	tx := NewTransaction(NewWallet(m, new(MockedCalculating), 1000, nil), "receiver", 1)
+	tx := NewTransaction(NewWallet(m, new(MockedCalculating), 1000, nil, ""), "receiver", 1, 0)
 
 	// test verification
 	assert.Equal(t, uint64(1), tx.GetOutput()["receiver"])
@@ -31,23 +31,38 @@ func TestTransaction_OutputHasAmountToReceiver(t *testing.T) {
 
 func TestTransaction_OutputHasRemainingBalanceOfSenderWallet(t *testing.T) {
 	m := crypto.NewSecp256k1Generator()
-	w := NewWallet(m, new(MockedCalculating), 1000, nil)
+	w := NewWallet(m, new(MockedCalculating), 1000, nil, "")
 
 	// perform test
-	tx := NewTransaction(w, "receiver", 1)
+	tx := NewTransaction(w, "receiver", 1, 0)
 
 	// test verification
-	assert.Equal(t, uint64(999), tx.GetOutput()[w.PubKeyHex()])
+	assert.Equal(t, uint64(999), tx.GetOutput()[w.Address()])
+}
+
+func TestTransaction_OutputLeavesFee(t *testing.T) {
+	m := crypto.NewSecp256k1Generator()
+	w := NewWallet(m, new(MockedCalculating), 1000, nil, "")
+
+	// perform test
+	tx := NewTransaction(w, "receiver", 1, 10)
+
+	// test verification
+	assert.Equal(t, uint64(989), tx.GetOutput()[w.Address()])
+	assert.Equal(t, uint64(10), Fee(tx))
+
+	tx.Append(w, "receiverB", 5)
+	assert.Equal(t, uint64(10), Fee(tx))
 }
 
 func TestTransaction_Input(t *testing.T) {
 	assert := assert.New(t)
 	secp256k1 := crypto.NewSecp256k1Generator()
-	senderWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	receiverWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
+	senderWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	receiverWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
 
 	// perform test
-	tx := NewTransaction(senderWallet, receiverWallet.PubKeyHex(), 99)
+	tx := NewTransaction(senderWallet, receiverWallet.Address(), 99, 0)
 
 	t.Run("has timestamp", func(t *testing.T) {
 		assert.NotZero(tx.GetInput().Timestamp)
@@ -58,11 +73,11 @@ func TestTransaction_Input(t *testing.T) {
 	})
 
 	t.Run("sets `address` to the `senderWallet` pubKey", func(t *testing.T) {
-		assert.Equal(senderWallet.PubKeyHex(), tx.GetInput().Address)
+		assert.Equal(senderWallet.Address(), tx.GetInput().Address)
 	})
 
 	t.Run("signs the input with senderWallet privKey", func(t *testing.T) {
-		ob, _ := hex.DecodeString(hashing.SHA256Hash(tx.GetOutput()))
+		ob := hashing.TransactionSigningBytes(toHashingTx(tx.GetID(), tx.GetInput(), nil, tx.GetOutput()))
 
 		sigInBytes, _ := hex.DecodeString(tx.GetInput().Signature)
 		assert.True(secp256k1.Verify(senderWallet.PubKey(), ob, sigInBytes))
@@ -72,26 +87,26 @@ func TestTransaction_Input(t *testing.T) {
 func TestTransaction_Append(t *testing.T) {
 	assert := assert.New(t)
 	secp256k1 := crypto.NewSecp256k1Generator()
-	senderWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	receiverAWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	receiverBWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	tx := NewTransaction(senderWallet, receiverAWallet.PubKeyHex(), 10)
+	senderWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	receiverAWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	receiverBWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	tx := NewTransaction(senderWallet, receiverAWallet.Address(), 10, 0)
 
 	originalSignature := tx.GetInput().Signature
 
 	// perform test
-	tx.Append(senderWallet, receiverBWallet.PubKeyHex(), 20)
+	tx.Append(senderWallet, receiverBWallet.Address(), 20)
 
 	t.Run("returns error if append amount is greater than sender current output balance", func(t *testing.T) {
-		assert.Equal(ErrAmountExceedsBalance, tx.Append(senderWallet, receiverBWallet.PubKeyHex(), 971))
+		assert.Equal(ErrAmountExceedsBalance, tx.Append(senderWallet, receiverBWallet.Address(), 971))
 	})
 
 	t.Run("outputs the amount to receiver B", func(t *testing.T) {
-		assert.Equal(uint64(20), tx.GetOutput()[receiverBWallet.PubKeyHex()])
+		assert.Equal(uint64(20), tx.GetOutput()[receiverBWallet.Address()])
 	})
 
 	t.Run("outputs updated remaining amount of sender", func(t *testing.T) {
-		assert.Equal(uint64(970), tx.GetOutput()[senderWallet.PubKeyHex()])
+		assert.Equal(uint64(970), tx.GetOutput()[senderWallet.Address()])
 	})
 
 	t.Run("maintains total output balance that matches input amount", func(t *testing.T) {
@@ -108,12 +123,120 @@ func TestTransaction_Append(t *testing.T) {
 	})
 
 	t.Run("updates the receiverB output amount", func(t *testing.T) {
-		err := tx.Append(senderWallet, receiverBWallet.PubKeyHex(), 10)
+		err := tx.Append(senderWallet, receiverBWallet.Address(), 10)
 
 		assert.Nil(err)
-		assert.Equal(int(10), int(tx.GetOutput()[receiverAWallet.PubKeyHex()]))
-		assert.Equal(int(960), int(tx.GetOutput()[senderWallet.PubKeyHex()]))
-		assert.Equal(int(30), int(tx.GetOutput()[receiverBWallet.PubKeyHex()]))
+		assert.Equal(int(10), int(tx.GetOutput()[receiverAWallet.Address()]))
+		assert.Equal(int(960), int(tx.GetOutput()[senderWallet.Address()]))
+		assert.Equal(int(30), int(tx.GetOutput()[receiverBWallet.Address()]))
+	})
+}
+
+func TestNewMultiInputTransaction(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	senderA := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	senderB := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	senderC := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+
+	t.Run("spends from senders in order until amount and fee are covered", func(t *testing.T) {
+		// perform test
+		tx, err := NewMultiInputTransaction([]Wallet{senderA, senderB, senderC}, "receiver", 1500, 10)
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal(senderA.Address(), tx.GetInput().Address)
+		assert.Len(tx.GetExtraInputs(), 1)
+		assert.Equal(senderB.Address(), tx.GetExtraInputs()[0].Address)
+		assert.Equal(Output{"receiver": 1500, senderA.Address(): 0, senderB.Address(): 490}, tx.GetOutput())
+		assert.Equal(uint64(10), Fee(tx))
+	})
+
+	t.Run("signs every input", func(t *testing.T) {
+		tx, _ := NewMultiInputTransaction([]Wallet{senderA, senderB}, "receiver", 1500, 10)
+		pool := NewTransactionPool(nil)
+		pool.Add(tx)
+
+		// perform test & verification
+		assert.Equal([]Transaction{tx}, pool.ValidTransactions())
+	})
+
+	t.Run("creates single input transaction if first sender covers it", func(t *testing.T) {
+		// perform test
+		tx, err := NewMultiInputTransaction([]Wallet{senderA, senderB}, "receiver", 100, 0)
+
+		// test verification
+		assert.Nil(err)
+		assert.Nil(tx.GetExtraInputs())
+	})
+
+	t.Run("returns error on append", func(t *testing.T) {
+		tx, _ := NewMultiInputTransaction([]Wallet{senderA, senderB}, "receiver", 1500, 0)
+
+		// perform test & verification
+		assert.Equal(ErrAppendMultiInput, tx.Append(senderA, "receiver", 1))
+	})
+
+	t.Run("returns error if senders do not cover amount and fee", func(t *testing.T) {
+		// perform test
+		_, err := NewMultiInputTransaction([]Wallet{senderA, senderB}, "receiver", 2000, 1)
+		_, duplicateErr := NewMultiInputTransaction([]Wallet{senderA, senderA}, "receiver", 1500, 0)
+
+		// test verification
+		assert.Equal(ErrTxAmountExceedsBalance, err)
+		assert.Equal(ErrDuplicateSender, duplicateErr)
+	})
+
+	t.Run("returns error if no sender is spent from", func(t *testing.T) {
+		emptySender := NewWallet(secp256k1, new(MockedCalculating), 0, nil, "")
+
+		// perform test
+		_, nothingErr := NewMultiInputTransaction([]Wallet{senderA}, "receiver", 0, 0)
+		_, noSendersErr := NewMultiInputTransaction(nil, "receiver", 0, 0)
+		_, emptyErr := NewMultiInputTransaction([]Wallet{emptySender}, "receiver", 0, 0)
+
+		// test verification
+		assert.Equal(ErrNoInputs, nothingErr)
+		assert.Equal(ErrNoInputs, noSendersErr)
+		assert.Equal(ErrNoInputs, emptyErr)
+	})
+}
+
+func TestNewNextTransaction(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	sender := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	other := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	pooled := NewTransaction(sender, "receiverA", 100, 10)
+
+	t.Run("spends change of pooled transaction with next nonce", func(t *testing.T) {
+		// perform test
+		tx, err := NewNextTransaction(sender, pooled, "receiverB", 50, 5)
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal(uint64(890), tx.GetInput().Amount)
+		assert.Equal(pooled.GetInput().Nonce+1, tx.GetInput().Nonce)
+		assert.Equal(Output{"receiverB": 50, sender.Address(): 835}, tx.GetOutput())
+		pool := NewTransactionPool(nil)
+		pool.Add(tx)
+		assert.Equal([]Transaction{tx}, pool.ValidTransactions())
+	})
+
+	t.Run("returns error if amount and fee exceed change of pooled transaction", func(t *testing.T) {
+		// perform test
+		_, err := NewNextTransaction(sender, pooled, "receiverB", 890, 1)
+
+		// test verification
+		assert.Equal(ErrTxAmountExceedsBalance, err)
+	})
+
+	t.Run("returns error if wallet is not an input of pooled transaction", func(t *testing.T) {
+		// perform test
+		_, err := NewNextTransaction(other, pooled, "receiverB", 50, 5)
+
+		// test verification
+		assert.Equal(ErrNotPooledSender, err)
 	})
 }
 
@@ -124,7 +247,7 @@ func TestCreateRewardTransaction(t *testing.T) {
 	var rewardTransaction Transaction
 
 	beforeEach := func() {
-		minerWallet = NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
+		minerWallet = NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
 		rewardTransaction, _ = CreateRewardTransaction(minerWallet, "MINER_REWARD", 5)
 	}
 
@@ -139,6 +262,6 @@ func TestCreateRewardTransaction(t *testing.T) {
 		beforeEach()
 
 		// perform test & verification
-		assert.Equal(5, int(rewardTransaction.GetOutput()[minerWallet.PubKeyHex()]))
+		assert.Equal(5, int(rewardTransaction.GetOutput()[minerWallet.Address()]))
 	})
 }
@@ -3,13 +3,10 @@ package wallet
 import (
 	"encoding/hex"
 	"errors"
-	"io/ioutil"
 	"log"
-	"os"
-	"path"
 
 	"github.com/knd/kndchain/pkg/calculating"
-	"github.com/knd/kndchain/pkg/listing"
+	"github.com/knd/kndchain/pkg/crypto"
 )
 
 // ErrTxAmountExceedsBalance indicates tx amount exceeds current balance
@@ -26,69 +23,66 @@ type KeyPairGenerator interface {
 type Wallet interface {
 	PubKey() []byte
 	PubKeyHex() string
+	Address() string
 	Balance() uint64
+	ImmatureBalance() uint64
+	SpendableBalance() uint64
+	Nonce() uint64
 	Sign(data []byte) []byte
-	CreateTransaction(receiver string, amount uint64, lister listing.Service) (Transaction, error)
+	CreateTransaction(receiver string, amount uint64, fee uint64) (Transaction, error)
 }
 
 type wallet struct {
-	gen           KeyPairGenerator
-	balance       uint64
-	publicKey     []byte
-	privateKey    []byte
-	calculator    calculating.Service
-	pathToKeysdir *string
+	gen        KeyPairGenerator
+	balance    uint64
+	immature   uint64
+	nonce      uint64
+	publicKey  []byte
+	privateKey []byte
+	calculator calculating.Service
 }
 
-// NewWallet creates a wallet with necessary dependencies
-func NewWallet(kpg KeyPairGenerator, c calculating.Service, initialBalance uint64, pathToKeysdir *string) Wallet {
+// NewWallet creates a wallet with necessary dependencies, its key is stored encrypted with passphrase unless ks is nil
+func NewWallet(kpg KeyPairGenerator, c calculating.Service, initialBalance uint64, ks Keystore, passphrase string) Wallet {
 	pubKey, privKey := kpg.Generate()
 
 	w := &wallet{
-		gen:           kpg,
-		balance:       initialBalance,
-		publicKey:     pubKey,
-		privateKey:    privKey,
-		calculator:    c,
-		pathToKeysdir: pathToKeysdir,
+		gen:        kpg,
+		balance:    initialBalance,
+		publicKey:  pubKey,
+		privateKey: privKey,
+		calculator: c,
 	}
 
-	if pathToKeysdir != nil && *pathToKeysdir != "" {
-		pubKeyHex := hex.EncodeToString(pubKey)
-		err := ioutil.WriteFile(path.Join(*pathToKeysdir, pubKeyHex), privKey, os.ModePerm)
-		if err != nil {
-			log.Fatalf("Error to save keys into %s, %v", *pathToKeysdir, err)
+	if ks != nil {
+		if err := ks.Store(hex.EncodeToString(pubKey), privKey, passphrase); err != nil {
+			log.Fatalf("Error to save keys into keystore, %v", err)
 		}
 	}
 
 	return w
 }
 
-// LoadWallet loads privKey from local filesystem
-func LoadWallet(kpg KeyPairGenerator, c calculating.Service, l listing.Service, pathToKeysdir string, pubKeyHex string) Wallet {
-	file, err := os.Open(path.Join(pathToKeysdir, pubKeyHex))
+// LoadWallet unlocks privKey of pubKeyHex from keystore with passphrase
+func LoadWallet(kpg KeyPairGenerator, c calculating.Service, ks Keystore, pubKeyHex string, passphrase string) Wallet {
+	privKey, err := ks.Unlock(pubKeyHex, passphrase)
 	if err != nil {
-		log.Fatalf("Error opening key file %s, %v", path.Join(pathToKeysdir, pubKeyHex), err)
-	}
-	defer file.Close()
-
-	privKey, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Fatalf("Error reading key file %s, %v", path.Join(pathToKeysdir, pubKeyHex), err)
+		log.Fatalf("Error unlocking key of %s, %v", pubKeyHex, err)
 	}
 
 	pubKey, err := hex.DecodeString(pubKeyHex)
 	if err != nil {
-		log.Fatalf("Invalid public key hex=%s, %v", pubKey, err)
+		log.Fatalf("Invalid public key hex=%s, %v", pubKeyHex, err)
 	}
-	return &wallet{
-		gen:           kpg,
-		balance:       c.Balance(pubKeyHex, toCalculatingBlockchain(l.GetBlockchain())),
-		publicKey:     pubKey,
-		privateKey:    privKey,
-		calculator:    c,
-		pathToKeysdir: &pathToKeysdir,
+	w := &wallet{
+		gen:        kpg,
+		publicKey:  pubKey,
+		privateKey: privKey,
+		calculator: c,
 	}
+
+	w.refresh()
+	return w
 }
 
 // PubKey returns public key in bytes
@@ -101,11 +95,39 @@ func (w *wallet) PubKeyHex() string {
 	return hex.EncodeToString(w.publicKey)
 }
 
+// Address returns the checksummed address of the public key, which transactions of wallet are sent from
+func (w *wallet) Address() string {
+	address, err := crypto.PubKeyToAddress(w.publicKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return address
+}
+
 // Balance returns the current balance of wallet
 func (w *wallet) Balance() uint64 {
 	return w.balance
 }
 
+// ImmatureBalance returns the part of the balance made of mining rewards that may not be spent yet
+func (w *wallet) ImmatureBalance() uint64 {
+	return w.immature
+}
+
+// SpendableBalance returns the part of the balance that may be sent or paid as fee
+func (w *wallet) SpendableBalance() uint64 {
+	if w.immature > w.balance {
+		return 0
+	}
+	return w.balance - w.immature
+}
+
+// Nonce returns the nonce of the next transaction created by wallet
+func (w *wallet) Nonce() uint64 {
+	return w.nonce
+}
+
 // Sign returns a signed signature of input string
 func (w *wallet) Sign(data []byte) []byte {
 	b, err := w.gen.Sign(data, w.privateKey)
@@ -116,51 +138,21 @@ func (w *wallet) Sign(data []byte) []byte {
 	return b
 }
 
-// CreateTransaction creates a new transaction from this wallet
-func (w *wallet) CreateTransaction(receiver string, amount uint64, lister listing.Service) (Transaction, error) {
-	bc := toCalculatingBlockchain(lister.GetBlockchain())
-	if bc != nil {
-		w.balance = w.calculator.Balance(w.PubKeyHex(), bc)
-	}
+// CreateTransaction creates a new transaction from this wallet paying fee to the miner
+func (w *wallet) CreateTransaction(receiver string, amount uint64, fee uint64) (Transaction, error) {
+	w.refresh()
 
-	if amount > w.Balance() {
+	// immature rewards stay in the change output
+	if amount > w.SpendableBalance() || fee > w.SpendableBalance()-amount {
 		return nil, ErrTxAmountExceedsBalance
 	}
 
-	return NewTransaction(w, receiver, amount), nil
+	return NewTransaction(w, receiver, amount, fee), nil
 }
 
-func toCalculatingBlockchain(bc *listing.Blockchain) *calculating.Blockchain {
-	if bc == nil {
-		return nil
-	}
-
-	result := &calculating.Blockchain{}
-	for _, block := range bc.Chain {
-		cTransactions := []calculating.Transaction{}
-		for _, transaction := range block.Data {
-			cTx := calculating.Transaction{
-				ID:     transaction.ID,
-				Output: transaction.Output,
-				Input: calculating.Input{
-					Timestamp: transaction.Input.Timestamp,
-					Amount:    transaction.Input.Amount,
-					Address:   transaction.Input.Address,
-					Signature: transaction.Input.Signature,
-				},
-			}
-			cTransactions = append(cTransactions, cTx)
-		}
-		cBlock := calculating.Block{
-			Timestamp:  block.Timestamp,
-			LastHash:   block.LastHash,
-			Hash:       block.Hash,
-			Data:       cTransactions,
-			Nonce:      block.Nonce,
-			Difficulty: block.Difficulty,
-		}
-		result.Chain = append(result.Chain, cBlock)
-	}
-
-	return result
+// refresh sets balance, immature balance and nonce as of the main chain tip from the account index
+func (w *wallet) refresh() {
+	w.balance = w.calculator.CurrentBalance(w.Address())
+	w.immature = w.calculator.CurrentImmatureBalance(w.Address())
+	w.nonce = w.calculator.CurrentNonce(w.Address())
 }
@@ -1,6 +1,8 @@
 package wallet
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/knd/kndchain/pkg/crypto"
@@ -9,15 +11,25 @@ import (
 
 func TestWallet_PublicKeyIsGenerated(t *testing.T) {
 	// perform test
-	w := NewWallet(crypto.NewSecp256k1Generator(), new(MockedCalculating), 1000, nil)
+	w := NewWallet(crypto.NewSecp256k1Generator(), new(MockedCalculating), 1000, nil, "")
 
 	// test verification
 	assert.NotEmpty(t, w.PubKeyHex())
 }
 
+func TestWallet_AddressIsDerivedFromPublicKey(t *testing.T) {
+	// perform test
+	w := NewWallet(crypto.NewSecp256k1Generator(), new(MockedCalculating), 1000, nil, "")
+
+	// test verification
+	address, _ := crypto.PubKeyToAddress(w.PubKey())
+	assert.Equal(t, address, w.Address())
+	assert.NoError(t, crypto.ValidateAddress(w.Address()))
+}
+
 func TestWallet_InitialBalanceOf1000(t *testing.T) {
 	// perform test
-	w := NewWallet(crypto.NewSecp256k1Generator(), new(MockedCalculating), 1000, nil)
+	w := NewWallet(crypto.NewSecp256k1Generator(), new(MockedCalculating), 1000, nil, "")
 
 	// test verification
 	assert.Equal(t, 1000, int(w.Balance()))
@@ -28,7 +40,7 @@ func TestWallet_SigningData(t *testing.T) {
 
 	t.Run("verifies signing is done properly", func(t *testing.T) {
 		secp256k1 := crypto.NewSecp256k1Generator()
-		w := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
+		w := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
 		data := []byte("hello world")
 
 		// perform test
@@ -40,11 +52,11 @@ func TestWallet_SigningData(t *testing.T) {
 
 	t.Run("verifies signing is NOT done properly", func(t *testing.T) {
 		secp256k1 := crypto.NewSecp256k1Generator()
-		w := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
+		w := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
 		data := []byte("hello world")
 
 		// perform test
-		signature := NewWallet(secp256k1, new(MockedCalculating), 1000, nil).Sign(data)
+		signature := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "").Sign(data)
 
 		// test verification
 		assert.False(secp256k1.Verify(w.PubKey(), data, signature))
@@ -54,25 +66,114 @@ func TestWallet_SigningData(t *testing.T) {
 func TestWallet_CreateTransaction(t *testing.T) {
 	assert := assert.New(t)
 	secp256k1 := crypto.NewSecp256k1Generator()
-	senderWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	receiverWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil)
-	mockedLister := new(MockedListing)
-	mockedLister.On("GetBlockchain").Return(nil)
-	txA, errA := senderWallet.CreateTransaction(receiverWallet.PubKeyHex(), 99, mockedLister)
-	txB, errB := senderWallet.CreateTransaction(receiverWallet.PubKeyHex(), 1001, mockedLister)
+	mockedCalculating := new(MockedCalculating)
+	senderWallet := NewWallet(secp256k1, mockedCalculating, 1000, nil, "")
+	receiverWallet := NewWallet(secp256k1, new(MockedCalculating), 1000, nil, "")
+	mockedCalculating.On("CurrentBalance", senderWallet.Address()).Return(uint64(1000))
+	mockedCalculating.On("CurrentImmatureBalance", senderWallet.Address()).Return(uint64(0))
+	mockedCalculating.On("CurrentNonce", senderWallet.Address()).Return(uint64(0))
+	txA, errA := senderWallet.CreateTransaction(receiverWallet.Address(), 99, 0)
+	txB, errB := senderWallet.CreateTransaction(receiverWallet.Address(), 1001, 0)
+	txC, errC := senderWallet.CreateTransaction(receiverWallet.Address(), 990, 11)
 
 	t.Run("created transaction with input matched wallet", func(t *testing.T) {
 		assert.Nil(errA)
-		assert.Equal(senderWallet.PubKeyHex(), txA.GetInput().Address)
+		assert.Equal(senderWallet.Address(), txA.GetInput().Address)
 		assert.Equal(senderWallet.Balance(), txA.GetInput().Amount)
 	})
 
 	t.Run("created transaction with output containing receiver amount", func(t *testing.T) {
-		assert.Equal(uint64(99), txA.GetOutput()[receiverWallet.PubKeyHex()])
+		assert.Equal(uint64(99), txA.GetOutput()[receiverWallet.Address()])
 	})
 
 	t.Run("fails to create transaction with amount exceeding balance", func(t *testing.T) {
 		assert.Equal(errB, ErrTxAmountExceedsBalance)
 		assert.Nil(txB)
 	})
+
+	t.Run("fails to create transaction with amount and fee exceeding balance", func(t *testing.T) {
+		assert.Equal(errC, ErrTxAmountExceedsBalance)
+		assert.Nil(txC)
+	})
+}
+
+func TestWallet_CreateTransactionWithNonce(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	mockedCalculating := new(MockedCalculating)
+	senderWallet := NewWallet(secp256k1, mockedCalculating, 1000, nil, "")
+	mockedCalculating.On("CurrentBalance", senderWallet.Address()).Return(uint64(900))
+	mockedCalculating.On("CurrentNonce", senderWallet.Address()).Return(uint64(3))
+	mockedCalculating.On("CurrentImmatureBalance", senderWallet.Address()).Return(uint64(0))
+
+	// perform test
+	tx, err := senderWallet.CreateTransaction("receiver", 99, 0)
+
+	// test verification
+	assert.Nil(err)
+	assert.Equal(uint64(3), senderWallet.Nonce())
+	assert.Equal(uint64(3), tx.GetInput().Nonce)
+
+	t.Run("keeps nonce when transaction is appended", func(t *testing.T) {
+		err := tx.Append(senderWallet, "receiverB", 1)
+
+		assert.Nil(err)
+		assert.Equal(uint64(3), tx.GetInput().Nonce)
+	})
+}
+
+func TestWallet_CreateTransactionWithImmatureReward(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	mockedCalculating := new(MockedCalculating)
+	senderWallet := NewWallet(secp256k1, mockedCalculating, 1000, nil, "")
+	mockedCalculating.On("CurrentBalance", senderWallet.Address()).Return(uint64(1005))
+	mockedCalculating.On("CurrentImmatureBalance", senderWallet.Address()).Return(uint64(5))
+	mockedCalculating.On("CurrentNonce", senderWallet.Address()).Return(uint64(0))
+
+	t.Run("fails to spend immature reward", func(t *testing.T) {
+		// perform test
+		tx, err := senderWallet.CreateTransaction("receiver", 1000, 1)
+
+		// test verification
+		assert.Equal(ErrTxAmountExceedsBalance, err)
+		assert.Nil(tx)
+	})
+
+	t.Run("keeps immature reward in change output", func(t *testing.T) {
+		// perform test
+		tx, err := senderWallet.CreateTransaction("receiver", 999, 1)
+
+		// test verification
+		assert.Nil(err)
+		assert.Equal(uint64(1005), tx.GetInput().Amount)
+		assert.Equal(uint64(5), tx.GetOutput()[senderWallet.Address()])
+		assert.Equal(uint64(1000), senderWallet.SpendableBalance())
+		assert.Equal(ErrAmountExceedsBalance, tx.Append(senderWallet, "receiverB", 1))
+	})
+}
+
+func TestLoadWallet(t *testing.T) {
+	assert := assert.New(t)
+	secp256k1 := crypto.NewSecp256k1Generator()
+	dir, err := ioutil.TempDir("", "kndchainKeys")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	keystore := NewKeystore(dir, LightScryptN)
+	w := NewWallet(secp256k1, new(MockedCalculating), 1000, keystore, "secret")
+	mockedCalculating := new(MockedCalculating)
+	mockedCalculating.On("CurrentBalance", w.Address()).Return(uint64(900))
+	mockedCalculating.On("CurrentImmatureBalance", w.Address()).Return(uint64(0))
+	mockedCalculating.On("CurrentNonce", w.Address()).Return(uint64(3))
+
+	// perform test
+	loaded := LoadWallet(secp256k1, mockedCalculating, keystore, w.PubKeyHex(), "secret")
+
+	// test verification
+	assert.Equal(w.PubKeyHex(), loaded.PubKeyHex())
+	assert.Equal(w.Address(), loaded.Address())
+	assert.Equal(uint64(900), loaded.Balance())
+	assert.Equal(uint64(3), loaded.Nonce())
+	data := []byte("foo")
+	assert.True(secp256k1.Verify(w.PubKey(), data, loaded.Sign(data)))
 }